@@ -0,0 +1,236 @@
+// Package analyzer provides an analysis.Analyzer which reports fake usages
+// created by gouse and unused variables, with suggested fixes which remove and
+// create fake usages like gouse does.
+//
+// go vet only runs analyzers on packages without type errors, so under
+// ‘go vet -vettool’ it reports fake usages left in code. Run standalone, e.g.
+// as ‘gouse-analyzer -fix ./...’, it creates fake usages for unused variables
+// too.
+//
+// Drivers which embed analyzers, e.g. multicheckers, run Analyzer along with
+// others:
+//
+//	multichecker.Main(analyzer.Analyzer, nilness.Analyzer)
+package analyzer
+
+import (
+	"bytes"
+	"go/ast"
+	"go/token"
+	"os"
+	"regexp"
+	"strings"
+
+	"golang.org/x/tools/go/analysis"
+)
+
+const (
+	fakeUsageCommentPrefix = " /* TODO"
+	fakeUsageCommentTag    = ": gouse"
+	fakeUsageCommentSuffix = " */"
+	fakeUsageSuffix        = fakeUsageCommentPrefix + fakeUsageCommentTag +
+		fakeUsageCommentSuffix
+	fakeUsagePrefix = "; _ ="
+
+	notUsedErrorPrefix = "declared and not used: "
+
+	// categoryFakeUsage and categoryUnusedVariable are categories of
+	// diagnostics, named like rules of reports of gouse, e.g. in SARIF.
+	// Drivers like gopls tell the diagnostics apart by them and link them
+	// to Analyzer.URL#category.
+	categoryFakeUsage      = "fake-usage"
+	categoryUnusedVariable = "unused-variable"
+	// ignoreDirective on or above the line of a declaration makes gouse
+	// never create fake usages for variables declared there.
+	ignoreDirective = "//gouse:ignore"
+)
+
+var (
+	// fakeUsageComment catches comments of fake usages with an optional
+	// author, ID and date.
+	// The comment text has no leading space of fakeUsageCommentPrefix.
+	fakeUsageComment = regexp.MustCompile(
+		"^" + regexp.QuoteMeta(fakeUsageCommentPrefix[1:]) +
+			`(?:\([^()*\n]+\))?` +
+			regexp.QuoteMeta(fakeUsageCommentTag) +
+			`(?:#\d+)?` +
+			`(?: \d{4}-\d{2}-\d{2})?` +
+			regexp.QuoteMeta(fakeUsageCommentSuffix) + "$",
+	)
+	// fakeUsageStatement catches the statement of a fake usage before its
+	// comment and the name of the variable or, if fake usages are gathered
+	// into one statement, names of variables.
+	fakeUsageStatement = regexp.MustCompile(
+		`(;\s*)?_(?:\s*,\s*_)*\s*=\s*(\w+(?:\s*,\s*\w+)*)\s*$`,
+	)
+)
+
+// Analyzer reports fake usages created by gouse and unused variables.
+var Analyzer = New(true)
+
+// New returns an analysis.Analyzer which reports fake usages created by gouse
+// and, if reportUnused is true, unused variables. Drivers which report type
+// errors themselves, like golangci-lint, don’t need the latter.
+func New(reportUnused bool) *analysis.Analyzer {
+	doc := "report fake usages created by gouse"
+	if reportUnused {
+		doc += " and unused variables\n\n" +
+			"Suggested fixes remove fake usages and create them " +
+			"for unused variables."
+	} else {
+		doc += "\n\nSuggested fixes remove them."
+	}
+	return &analysis.Analyzer{
+		Name: "gouse",
+		Doc:  doc,
+		URL:  "https://github.com/looshch/gouse",
+		Run: func(pass *analysis.Pass) (any, error) {
+			return run(pass, reportUnused)
+		},
+		RunDespiteErrors: true,
+	}
+}
+
+func run(pass *analysis.Pass, reportUnused bool) (any, error) {
+	readFile := pass.ReadFile
+	if readFile == nil {
+		readFile = os.ReadFile
+	}
+	type source struct {
+		f    *ast.File
+		code []byte
+	}
+	sources := make(map[*token.File]source)
+	for _, f := range pass.Files {
+		tf := pass.Fset.File(f.FileStart)
+		code, err := readFile(tf.Name())
+		if err != nil {
+			return nil, err
+		}
+		sources[tf] = source{f, code}
+		reportFakeUsages(pass, f, tf, code)
+	}
+	if !reportUnused {
+		return nil, nil
+	}
+	for _, e := range pass.TypeErrors {
+		name, ok := strings.CutPrefix(e.Msg, notUsedErrorPrefix)
+		if !ok {
+			continue
+		}
+		tf := pass.Fset.File(e.Pos)
+		if s, ok := sources[tf]; ok {
+			reportUnusedVariable(pass, s.f, tf, s.code, e.Pos, name)
+		}
+	}
+	return nil, nil
+}
+
+// reportFakeUsages reports every fake usage in the file f with the token file
+// tf and the source code.
+func reportFakeUsages(
+	pass *analysis.Pass, f *ast.File, tf *token.File, code []byte,
+) {
+	for _, g := range f.Comments {
+		for _, c := range g.List {
+			if !fakeUsageComment.MatchString(c.Text) {
+				continue
+			}
+			end := tf.Offset(c.End())
+			commentStart := tf.Offset(c.Pos())
+			lineStart := tf.Offset(tf.LineStart(tf.Line(c.Pos())))
+			m := fakeUsageStatement.FindSubmatchIndex(
+				code[lineStart:commentStart],
+			)
+			if m == nil {
+				continue
+			}
+			start := lineStart + m[0]
+			// A fake usage on its own line, left by gofmt, is
+			// removed with the preceding line break.
+			if m[2] < 0 {
+				before := code[lineStart:start]
+				if len(bytes.TrimSpace(before)) > 0 {
+					continue
+				}
+				start = lineStart - 1
+			}
+			name := string(code[lineStart+m[4] : lineStart+m[5]])
+			pass.Report(analysis.Diagnostic{
+				Pos:      c.Pos(),
+				End:      c.End(),
+				Category: categoryFakeUsage,
+				Message:  "fake usage of " + name,
+				SuggestedFixes: []analysis.SuggestedFix{{
+					Message: "Remove fake usage of " + name,
+					TextEdits: []analysis.TextEdit{{
+						Pos: tf.Pos(start),
+						End: tf.Pos(end),
+					}},
+				}},
+			})
+		}
+	}
+}
+
+// reportUnusedVariable reports the unused variable name declared at pos in the
+// file f with the token file tf and the source code.
+func reportUnusedVariable(
+	pass *analysis.Pass,
+	f *ast.File,
+	tf *token.File,
+	code []byte,
+	pos token.Pos,
+	name string,
+) {
+	line := tf.Line(pos)
+	if ignored(code, tf, line) {
+		return
+	}
+	insert := len(code)
+	if line < tf.LineCount() {
+		// -1 is an adjustment for the line break.
+		insert = tf.Offset(tf.LineStart(line+1)) - 1
+	}
+	// The fake usage must be before a trailing comment.
+	for _, g := range f.Comments {
+		if g.Pos() > pos && tf.Line(g.Pos()) == line {
+			insert = tf.Offset(g.Pos())
+			break
+		}
+	}
+	insert = len(bytes.TrimRight(code[:insert], " \t\r"))
+	text := fakeUsagePrefix + " " + name + fakeUsageSuffix
+	pass.Report(analysis.Diagnostic{
+		Pos:      pos,
+		Category: categoryUnusedVariable,
+		Message:  notUsedErrorPrefix + name,
+		SuggestedFixes: []analysis.SuggestedFix{{
+			Message: "Create fake usage of " + name,
+			TextEdits: []analysis.TextEdit{{
+				Pos:     tf.Pos(insert),
+				End:     tf.Pos(insert),
+				NewText: []byte(text),
+			}},
+		}},
+	})
+}
+
+// ignored reports whether the line in code with the token file tf is marked
+// with ignoreDirective.
+func ignored(code []byte, tf *token.File, line int) bool {
+	lineText := func(line int) []byte {
+		start := tf.Offset(tf.LineStart(line))
+		end := len(code)
+		if line < tf.LineCount() {
+			end = tf.Offset(tf.LineStart(line + 1))
+		}
+		return code[start:end]
+	}
+	directive := []byte(ignoreDirective)
+	if bytes.Contains(lineText(line), directive) {
+		return true
+	}
+	return line > 1 &&
+		bytes.HasPrefix(bytes.TrimSpace(lineText(line-1)), directive)
+}
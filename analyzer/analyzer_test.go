@@ -0,0 +1,20 @@
+package analyzer_test
+
+import (
+	"testing"
+
+	"github.com/looshch/gouse/analyzer"
+	"golang.org/x/tools/go/analysis/analysistest"
+)
+
+func TestAnalyzer(t *testing.T) {
+	analysistest.RunWithSuggestedFixes(
+		t, analysistest.TestData(), analyzer.Analyzer, "a", "b",
+	)
+}
+
+func TestAnalyzerWithoutUnused(t *testing.T) {
+	analysistest.Run(
+		t, analysistest.TestData(), analyzer.New(false), "c",
+	)
+}
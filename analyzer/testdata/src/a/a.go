@@ -0,0 +1,10 @@
+package a
+
+func f() {
+	notUsed0 := 0 // want "declared and not used: notUsed0"
+	used := 1
+	_ = used
+	var notUsed1 int // want "declared and not used: notUsed1"
+	//gouse:ignore
+	notUsed2 := 2
+}
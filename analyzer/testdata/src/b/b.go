@@ -0,0 +1,11 @@
+package b
+
+func f() {
+	x := 0; _ = x /* TODO: gouse */ // want "fake usage of x"
+	y := 0
+	_ = y /* TODO(alice): gouse 2024-06-01 */ // want "fake usage of y"
+	z := 0
+	_ = z /* TODO: other */
+	v, w := 0, 0
+	_, _ = v, w /* TODO: gouse#2 */ // want "fake usage of v, w"
+}
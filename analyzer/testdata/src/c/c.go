@@ -0,0 +1,6 @@
+package c
+
+func f() {
+	notUsed := 0
+	x := 0; _ = x /* TODO: gouse */ // want "fake usage of x"
+}
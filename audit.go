@@ -0,0 +1,287 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/looshch/gouse/internal/core"
+)
+
+// recursivePatternSuffix denotes a pattern matching Go files in a directory
+// and all its subdirectories, like in ‘./...’.
+const recursivePatternSuffix = "..."
+
+// expandPatterns returns paths with every pattern ending with ‘...’ replaced
+// by paths of Go files in the directory before it and all its subdirectories
+// but skipped ones, see skippedDirs.
+func expandPatterns(
+	paths []string, skipped map[string]bool,
+) ([]string, error) {
+	var expanded []string
+	for _, p := range paths {
+		dir, ok := strings.CutSuffix(p, recursivePatternSuffix)
+		if !ok {
+			expanded = append(expanded, p)
+			continue
+		}
+		if dir == "" {
+			dir = "."
+		}
+		files, err := goFilesIn(dir, true, skipped)
+		if err != nil {
+			return nil, fmt.Errorf("expandPatterns: %v", err)
+		}
+		expanded = append(expanded, files...)
+	}
+	return expanded, nil
+}
+
+// expandDirs returns paths with every directory replaced by paths of Go files
+// directly in it or, if recursive is true, in it and all its subdirectories
+// but skipped ones, see skippedDirs. Paths which can’t be stat’ed are kept, so
+// opening them reports the error.
+func expandDirs(
+	paths []string, recursive bool, skipped map[string]bool,
+) ([]string, error) {
+	var expanded []string
+	for _, p := range paths {
+		if p == stdinPath {
+			expanded = append(expanded, p)
+			continue
+		}
+		info, err := os.Stat(p)
+		if err != nil || !info.IsDir() {
+			expanded = append(expanded, p)
+			continue
+		}
+		files, err := goFilesIn(p, recursive, skipped)
+		if err != nil {
+			return nil, fmt.Errorf("expandDirs: %v", err)
+		}
+		expanded = append(expanded, files...)
+	}
+	return expanded, nil
+}
+
+const (
+	// vendorDir is the name of directories of vendored third-party code.
+	vendorDir = "vendor"
+	// testdataDir is the name of directories of test fixtures, which are
+	// often broken on purpose.
+	testdataDir = "testdata"
+)
+
+// skippedDirs returns names of subdirectories which aren’t walked for Go files
+// as conf says: vendorDir unless ‘-include-vendor’ flag is passed, so runs on a
+// whole repository don’t edit third-party code, and testdataDir unless
+// ‘-include-testdata’ flag is passed. Directories given as paths are walked
+// anyway.
+func skippedDirs(conf *config) map[string]bool {
+	skipped := make(map[string]bool)
+	if !conf.includeVendor {
+		skipped[vendorDir] = true
+	}
+	if !conf.includeTestdata {
+		skipped[testdataDir] = true
+	}
+	return skipped
+}
+
+// goFilesIn returns sorted paths of Go files directly in the directory dir or,
+// if recursive is true, in it and all its subdirectories whose names aren’t
+// skipped.
+func goFilesIn(
+	dir string, recursive bool, skipped map[string]bool,
+) ([]string, error) {
+	var files []string
+	err := filepath.WalkDir(
+		dir, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() {
+				if p == dir {
+					return nil
+				}
+				if !recursive || skipped[d.Name()] {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if filepath.Ext(p) == core.GoFileExt {
+				files = append(files, p)
+			}
+			return nil
+		},
+	)
+	if err != nil {
+		format := "goFilesIn: in filepath.WalkDir: %v"
+		return nil, fmt.Errorf(format, err)
+	}
+	return files, nil
+}
+
+// defaultMaxAge is a default age over which audit reports fake usages.
+const defaultMaxAge = 30 * day
+
+// auditFiles writes to out every fake usage in files from paths which is
+// older than maxAge at now, one per line, prefixed with a path and a line
+// number. The age is taken from the date stamped into a fake usage or, if
+// there is none, from git blame. It returns the number of written fake
+// usages.
+func auditFiles(
+	ctx context.Context,
+	paths []string,
+	maxAge time.Duration,
+	now time.Time,
+	out file,
+
+	openFile osOpenFile,
+) (int, error) {
+	const thisName = "auditFiles"
+
+	var n int
+	for _, p := range paths {
+		f, err := openFile(p, os.O_RDONLY, os.ModeExclusive)
+		if err != nil {
+			return 0, fmt.Errorf("%s: %s: %v", thisName, p, err)
+		}
+		code, err := io.ReadAll(f)
+		f.Close()
+		if err != nil {
+			format := thisName + ": %s: in io.ReadAll: %v"
+			return 0, fmt.Errorf(format, p, err)
+		}
+		markers := core.FindMarkers(code)
+		if len(markers) == 0 {
+			continue
+		}
+		var blamed map[int]time.Time
+		var b bytes.Buffer
+		for _, c := range markers {
+			created, ok, err := creationTime(ctx, p, c, &blamed)
+			if err != nil {
+				format := thisName + ": %s: %v"
+				return 0, fmt.Errorf(format, p, err)
+			}
+			// Uncommitted fake usages are new.
+			if !ok {
+				continue
+			}
+			old := now.Sub(created)
+			if old <= maxAge {
+				continue
+			}
+			n++
+			// +1 is an adjustment for 1-based count.
+			fmt.Fprintf(
+				&b, "%s:%d: fake usage of %s",
+				p, c.LineNum+1, c.Name,
+			)
+			if c.Author != "" {
+				fmt.Fprintf(&b, " by %s", c.Author)
+			}
+			days := int(old / day)
+			fmt.Fprintf(&b, " is %d days old\n", days)
+		}
+		if _, err := out.Write(b.Bytes()); err != nil {
+			format := thisName + ": in *File.Write: %v"
+			return 0, fmt.Errorf(format, err)
+		}
+	}
+	return n, nil
+}
+
+// creationTime returns when the fake usage c in the file p was created. The
+// time is taken from the date stamped into c or, if there is none, from git
+// blame, which is cached in blamed. ok is false if c isn’t committed yet.
+func creationTime(
+	ctx context.Context, p string, c core.Change, blamed *map[int]time.Time,
+) (time.Time, bool, error) {
+	if c.Date != "" {
+		created, err := time.Parse(core.DateLayout, c.Date)
+		if err != nil {
+			format := "creationTime: in time.Parse: %v"
+			return time.Time{}, false, fmt.Errorf(format, err)
+		}
+		return created, true, nil
+	}
+	if *blamed == nil {
+		var err error
+		if *blamed, err = blame(ctx, p); err != nil {
+			format := "creationTime: %v"
+			return time.Time{}, false, fmt.Errorf(format, err)
+		}
+	}
+	created, ok := (*blamed)[c.LineNum]
+	return created, ok, nil
+}
+
+// blame returns times when lines of the file p were committed, keyed by
+// 0-based line numbers. Uncommitted lines are missing.
+func blame(ctx context.Context, p string) (map[int]time.Time, error) {
+	cmd := exec.CommandContext(
+		ctx,
+		"git", "-C", filepath.Dir(p),
+		"blame", "--line-porcelain", "--", filepath.Base(p),
+	)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf(
+			"blame: in *Cmd.Output: %v: %s", err, stderr.Bytes(),
+		)
+	}
+	times := make(map[int]time.Time)
+	var lineNum int
+	var uncommitted bool
+	s := bufio.NewScanner(bytes.NewReader(out))
+	for s.Scan() {
+		l := s.Text()
+		switch {
+		// Every line of the file is prefixed with a tab.
+		case strings.HasPrefix(l, "\t"):
+			lineNum++
+		case isBlameHeader(l):
+			// An uncommitted line has the zero hash.
+			uncommitted = strings.Trim(l[:40], "0") == ""
+		case strings.HasPrefix(l, "author-time ") && !uncommitted:
+			t := l[len("author-time "):]
+			sec, err := strconv.ParseInt(t, 10, 64)
+			if err != nil {
+				format := "blame: in strconv.ParseInt: %v"
+				return nil, fmt.Errorf(format, err)
+			}
+			times[lineNum] = time.Unix(sec, 0)
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, fmt.Errorf("blame: in *Scanner.Scan: %v", err)
+	}
+	return times, nil
+}
+
+// isBlameHeader reports whether l is the first line of a porcelain git blame
+// entry, which starts with a commit hash.
+func isBlameHeader(l string) bool {
+	if len(l) < 41 || l[40] != ' ' {
+		return false
+	}
+	for _, r := range l[:40] {
+		if !strings.ContainsRune("0123456789abcdef", r) {
+			return false
+		}
+	}
+	return true
+}
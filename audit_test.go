@@ -0,0 +1,203 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+const auditInput = `package p
+
+func main() {
+	notUsed0, notUsed1 := "", ""
+	_ = notUsed0 /* TODO(alice): gouse */
+	_ = notUsed1 /* TODO: gouse 2024-06-01 */
+}
+`
+
+func TestAuditFiles(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip(err)
+	}
+	dir := t.TempDir()
+	p := filepath.Join(dir, "main.go")
+	if err := os.WriteFile(p, []byte(auditInput), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"add", "main.go"},
+		{
+			"-c", "user.name=alice",
+			"-c", "user.email=alice@example.com",
+			"commit", "-q", "-m", "init",
+		},
+	} {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		cmd.Env = append(
+			os.Environ(), "GIT_AUTHOR_DATE=2020-01-01T00:00:00Z",
+		)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("%v: %s", err, out)
+		}
+	}
+	// The uncommitted fake usage is new.
+	uncommitted := auditInput +
+		"func f() { notUsed2 := 0; _ = notUsed2 /* TODO: gouse */ }\n"
+	if err := os.WriteFile(p, []byte(uncommitted), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Date(2024, 6, 20, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		maxAge time.Duration
+		want   string
+	}{
+		{
+			maxAge: defaultMaxAge,
+			want: p + ":5: fake usage of notUsed0 by alice " +
+				"is 1632 days old\n",
+		},
+		{
+			maxAge: 10 * day,
+			want: p + ":5: fake usage of notUsed0 by alice " +
+				"is 1632 days old\n" +
+				p + ":6: fake usage of notUsed1 " +
+				"is 19 days old\n",
+		},
+	}
+	for _, tt := range tests {
+		test := tt
+		t.Run(test.maxAge.String(), func(t *testing.T) {
+			t.Parallel()
+			out := newFakeFile()
+			_, err := auditFiles(
+				context.Background(),
+				[]string{p},
+				test.maxAge,
+				now,
+				out,
+				openFile,
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := out.contents.String(); got != test.want {
+				t.Errorf(filesCmpErr, got, test.want)
+			}
+		})
+	}
+}
+
+func TestExpandPatterns(t *testing.T) {
+	dir := t.TempDir()
+	for _, p := range []string{
+		"a.go", "b.txt", "sub/c.go", "sub/vendor/d.go",
+		"testdata/e.go",
+	} {
+		p = filepath.Join(dir, p)
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got, err := expandPatterns([]string{
+		"x.go", filepath.Join(dir, recursivePatternSuffix),
+	}, skippedDirs(&config{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"x.go",
+		filepath.Join(dir, "a.go"),
+		filepath.Join(dir, "sub", "c.go"),
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("got: %v, want: %v", got, want)
+	}
+}
+
+func TestExpandDirs(t *testing.T) {
+	dir := t.TempDir()
+	for _, p := range []string{"a.go", "b.txt", "sub/c.go"} {
+		p = filepath.Join(dir, p)
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct {
+		recursive bool
+		want      []string
+	}{
+		{
+			want: []string{
+				"x.go", stdinPath, filepath.Join(dir, "a.go"),
+			},
+		},
+		{
+			recursive: true,
+			want: []string{
+				"x.go",
+				stdinPath,
+				filepath.Join(dir, "a.go"),
+				filepath.Join(dir, "sub", "c.go"),
+			},
+		},
+	}
+	for _, tt := range tests {
+		test := tt
+		t.Run(fmt.Sprint(test.recursive), func(t *testing.T) {
+			t.Parallel()
+			paths := []string{"x.go", stdinPath, dir}
+			got, err := expandDirs(paths, test.recursive, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(got, test.want) {
+				t.Errorf("got: %v, want: %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestSkippedDirs(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name string
+		conf config
+		want []string
+	}{
+		{"default", config{}, []string{testdataDir, vendorDir}},
+		{
+			"vendor included",
+			config{includeVendor: true},
+			[]string{testdataDir},
+		},
+		{
+			"all included",
+			config{includeVendor: true, includeTestdata: true},
+			nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got := slices.Sorted(maps.Keys(skippedDirs(&tt.conf)))
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got: %v, want: %v", got, tt.want)
+			}
+		})
+	}
+}
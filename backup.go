@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/looshch/gouse/internal/core"
+)
+
+// lastRunName is the name of the file in a backup directory which lists paths
+// of files backed up by the last run.
+const lastRunName = "last"
+
+// cacheDir returns the directory of gouse under the user cache directory.
+func cacheDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("cacheDir: in os.UserCacheDir: %v", err)
+	}
+	return filepath.Join(dir, "gouse"), nil
+}
+
+// defaultBackupDir returns the directory backups are kept in, under the user
+// cache directory.
+func defaultBackupDir() (string, error) {
+	dir, err := cacheDir()
+	if err != nil {
+		return "", fmt.Errorf("defaultBackupDir: %v", err)
+	}
+	return filepath.Join(dir, "backup"), nil
+}
+
+// backups saves previous contents of files in dir before they’re written back,
+// so undo can restore them. Only the latest backup of every file is kept.
+type backups struct {
+	dir string
+	// paths are absolute paths of files backed up by this run.
+	paths []string
+}
+
+// hook returns a writeHook which backs up the file name as it was read, in
+// its encoding, if there are changes to it.
+func (b *backups) hook(name string) writeHook {
+	return func(read, _ []byte, changes []core.Change) error {
+		if len(changes) == 0 || name == stdinName {
+			return nil
+		}
+		if err := b.save(name, read); err != nil {
+			return fmt.Errorf("*backups.hook: %v", err)
+		}
+		return nil
+	}
+}
+
+// save backs up code of the file name with its permissions and records it as
+// backed up by the last run.
+func (b *backups) save(name string, code []byte) error {
+	const thisName = "*backups.save"
+	p, err := filepath.Abs(name)
+	if err != nil {
+		return fmt.Errorf(thisName+": in filepath.Abs: %v", err)
+	}
+	info, err := os.Stat(p)
+	if err != nil {
+		return fmt.Errorf(thisName+": in os.Stat: %v", err)
+	}
+	if err := os.MkdirAll(b.dir, 0o700); err != nil {
+		return fmt.Errorf(thisName+": in os.MkdirAll: %v", err)
+	}
+	var backup bytes.Buffer
+	perm := info.Mode().Perm()
+	fmt.Fprintf(&backup, "%o %s\n", perm, strconv.Quote(p))
+	backup.Write(code)
+	err = os.WriteFile(backupPath(b.dir, p), backup.Bytes(), 0o600)
+	if err != nil {
+		return fmt.Errorf(thisName+": in os.WriteFile: %v", err)
+	}
+	if !slices.Contains(b.paths, p) {
+		b.paths = append(b.paths, p)
+	}
+	last := []byte(strings.Join(b.paths, "\n") + "\n")
+	err = os.WriteFile(filepath.Join(b.dir, lastRunName), last, 0o600)
+	if err != nil {
+		return fmt.Errorf(thisName+": in os.WriteFile: %v", err)
+	}
+	return nil
+}
+
+// backupPath returns the path of the backup of the file with the absolute path
+// p in dir.
+func backupPath(dir, p string) string {
+	sum := sha256.Sum256([]byte(p))
+	return filepath.Join(dir, hex.EncodeToString(sum[:]))
+}
+
+var errNoBackup = errors.New("no backup")
+
+// restoreBackups restores the files at paths, or the ones backed up by the last
+// run if there are no paths, from their backups in dir exactly, including
+// permissions, and deletes the backups. Files of the last run which were
+// restored since are skipped. It returns the restored paths.
+func restoreBackups(dir string, paths []string) ([]string, error) {
+	const thisName = "restoreBackups"
+	lastRun := filepath.Join(dir, lastRunName)
+	fromLastRun := len(paths) == 0
+	if fromLastRun {
+		last, err := os.ReadFile(lastRun)
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf(thisName+": %v", errNoBackup)
+		}
+		if err != nil {
+			format := thisName + ": in os.ReadFile: %v"
+			return nil, fmt.Errorf(format, err)
+		}
+		last = bytes.TrimSuffix(last, []byte("\n"))
+		paths = strings.Split(string(last), "\n")
+	}
+	var restored []string
+	for _, p := range paths {
+		ok, err := restoreBackup(dir, p)
+		if err != nil {
+			return restored, fmt.Errorf(thisName+": %v", err)
+		}
+		if !ok && !fromLastRun {
+			return restored, fmt.Errorf(
+				thisName+": %s: %v", p, errNoBackup,
+			)
+		}
+		if ok {
+			restored = append(restored, p)
+		}
+	}
+	if fromLastRun {
+		if len(restored) == 0 {
+			return nil, fmt.Errorf(thisName+": %v", errNoBackup)
+		}
+		if err := os.Remove(lastRun); err != nil {
+			format := thisName + ": in os.Remove: %v"
+			return restored, fmt.Errorf(format, err)
+		}
+	}
+	return restored, nil
+}
+
+// restoreBackup restores the file at p from its backup in dir and deletes the
+// backup. It’s false if there is no backup.
+func restoreBackup(dir, p string) (bool, error) {
+	const thisName = "restoreBackup"
+	abs, err := filepath.Abs(p)
+	if err != nil {
+		return false, fmt.Errorf(thisName+": in filepath.Abs: %v", err)
+	}
+	bp := backupPath(dir, abs)
+	backup, err := os.ReadFile(bp)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf(thisName+": in os.ReadFile: %v", err)
+	}
+	header, code, ok := bytes.Cut(backup, []byte("\n"))
+	var perm uint64
+	if ok {
+		rawPerm, _, _ := strings.Cut(string(header), " ")
+		perm, err = strconv.ParseUint(rawPerm, 8, 32)
+	}
+	if !ok || err != nil {
+		format := thisName + ": %s: corrupted backup %s"
+		return false, fmt.Errorf(format, p, bp)
+	}
+	mode := fs.FileMode(perm)
+	if err := os.WriteFile(abs, code, mode); err != nil {
+		return false, fmt.Errorf(thisName+": in os.WriteFile: %v", err)
+	}
+	// The permissions of existing files aren’t changed by os.WriteFile.
+	if err := os.Chmod(abs, mode); err != nil {
+		return false, fmt.Errorf(thisName+": in os.Chmod: %v", err)
+	}
+	if err := os.Remove(bp); err != nil {
+		return false, fmt.Errorf(thisName+": in os.Remove: %v", err)
+	}
+	return true, nil
+}
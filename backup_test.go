@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/looshch/gouse/internal/core"
+)
+
+func TestBackups(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	a := filepath.Join(t.TempDir(), "a.go")
+	b := filepath.Join(t.TempDir(), "b.go")
+	// Line endings are kept.
+	const code = "package a\r\n\r\nfunc A() {\r\n\tnotUsed := 0\r\n}\r\n"
+	files := map[string]os.FileMode{a: 0o640, b: 0o600}
+	for p, perm := range files {
+		if err := os.WriteFile(p, []byte(code), perm); err != nil {
+			t.Fatal(err)
+		}
+		// os.WriteFile is subject to umask.
+		if err := os.Chmod(p, perm); err != nil {
+			t.Fatal(err)
+		}
+	}
+	saved := &backups{dir: dir}
+	changes := []core.Change{{Action: core.ActionAdd, Name: "notUsed"}}
+	for _, p := range []string{a, b, stdinName} {
+		err := saved.hook(p)([]byte(code), nil, changes)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Files without changes aren’t backed up.
+	if err := saved.hook(a)([]byte("changed"), nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	for p := range files {
+		err := os.WriteFile(p, []byte("toggled"), 0o644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chmod(p, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	restored, err := restoreBackups(dir, []string{b})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{b}; !slices.Equal(restored, want) {
+		t.Errorf("got: %v, want: %v", restored, want)
+	}
+	if _, err := restoreBackups(dir, []string{b}); err == nil {
+		t.Error("got: nil, want: error")
+	}
+	// b was restored already.
+	restored, err = restoreBackups(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{a}; !slices.Equal(restored, want) {
+		t.Errorf("got: %v, want: %v", restored, want)
+	}
+	for p, perm := range files {
+		got, err := os.ReadFile(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != code {
+			t.Errorf(filesCmpErr, got, code)
+		}
+		info, err := os.Stat(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := info.Mode().Perm(); got != perm {
+			t.Errorf("got: %v, want: %v", got, perm)
+		}
+	}
+}
+
+func TestRestoreBackupsOfLastRun(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	p := filepath.Join(t.TempDir(), "a.go")
+	const code = "package a\n"
+	if err := os.WriteFile(p, []byte(code), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	saved := &backups{dir: dir}
+	if err := saved.save(p, []byte(code)); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(p, []byte("toggled"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	restored, err := restoreBackups(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{p}; !slices.Equal(restored, want) {
+		t.Errorf("got: %v, want: %v", restored, want)
+	}
+	got, err := os.ReadFile(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != code {
+		t.Errorf(filesCmpErr, got, code)
+	}
+	// The last run was undone.
+	if _, err := restoreBackups(dir, nil); err == nil {
+		t.Error("got: nil, want: error")
+	}
+}
+
+func TestBackupOfUTF16File(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	p := filepath.Join(t.TempDir(), "a.go")
+	code := encodeCode(
+		[]byte("package a\n\nfunc A() {\n\tnotUsed := 0\n}\n"),
+		encodingUTF16LE,
+	)
+	if err := os.WriteFile(p, code, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.OpenFile(p, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	saved := &backups{dir: dir}
+	hooks := writeHooks{before: saved.hook(p)}
+	opts := core.Options{Backend: core.BackendTypeCheck}
+	changes, err := toggleFile(
+		context.Background(), opts, f, f, nil, hooks,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) == 0 {
+		t.Fatal("got: no changes, want: some")
+	}
+	if _, err := restoreBackups(dir, nil); err != nil {
+		t.Fatal(err)
+	}
+	// The file is restored in its encoding.
+	got, err := os.ReadFile(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(code) {
+		t.Errorf(filesCmpErr, got, code)
+	}
+}
@@ -0,0 +1,111 @@
+// Package builderr parses errors of Go files printed by go build and go vet,
+// like ‘./main.go:4:2: declared and not used: x’, into Errors with the name of
+// the symbol they are about, which gouse creates fake usages for.
+//
+//	out, _ := exec.Command("go", "build", "./...").CombinedOutput()
+//	for _, e := range builderr.Parse(out) {
+//		fmt.Println(e.File, e.Line, e.Symbol)
+//	}
+package builderr
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Error is an error at a position of a Go file.
+type Error struct {
+	// File is the path of the file as printed, e.g. relative to the
+	// working directory of the go command.
+	File string
+	// Line and Col are 1-based. Col is 0 if the error has none.
+	Line, Col int
+	// Message is the text of the error after its position.
+	Message string
+	// Symbol is the name Message is about, e.g. x of ‘declared and not
+	// used: x’ or the path of an import, or empty if it isn’t known.
+	Symbol string
+}
+
+// Error returns e as the go command prints it.
+func (e Error) Error() string {
+	if e.Col == 0 {
+		return fmt.Sprintf("%s:%d: %s", e.File, e.Line, e.Message)
+	}
+	return fmt.Sprintf("%s:%d:%d: %s", e.File, e.Line, e.Col, e.Message)
+}
+
+const (
+	fileIndex    = 1
+	lineIndex    = 2
+	colIndex     = 3
+	messageIndex = 4
+)
+
+var (
+	// position catches the file, line, optional column and message of an
+	// error, optionally prefixed with ‘vet: ’ like go vet prints type
+	// errors. The file is taken up to the first ‘.go’ followed by the
+	// position rather than split on colons, which are in Windows paths
+	// too.
+	position = regexp.MustCompile(
+		`^(?:vet: )?(.+?\.go):(\d+)(?::(\d+))?: (.*)$`,
+	)
+	// symbols catch the symbol of messages in their first submatch.
+	symbols = []*regexp.Regexp{
+		regexp.MustCompile(`^declared and not used: (\w+)$`),
+		// Before Go 1.20.
+		regexp.MustCompile(`^(\w+) declared (?:and|but) not used$`),
+		regexp.MustCompile(`^"([^"]+)" imported and not used$`),
+		regexp.MustCompile(`^"[^"]+" imported as (\w+) and not used$`),
+		regexp.MustCompile(`^label (\w+) defined and not used$`),
+		regexp.MustCompile(`^undefined: ([\w.]+)$`),
+		regexp.MustCompile(
+			`^no required module provides package ([^\s;]+)`,
+		),
+	}
+)
+
+// Parse returns errors of Go files in output of go build or go vet, one per
+// line. Other lines, e.g. ‘# package’ headers and continuations of messages,
+// are skipped.
+func Parse(output []byte) []Error {
+	var errs []Error
+	for _, l := range strings.Split(string(output), "\n") {
+		l = strings.TrimSuffix(l, "\r")
+		m := position.FindStringSubmatch(l)
+		if m == nil {
+			continue
+		}
+		line, err := strconv.Atoi(m[lineIndex])
+		if err != nil {
+			continue
+		}
+		var col int
+		if m[colIndex] != "" {
+			if col, err = strconv.Atoi(m[colIndex]); err != nil {
+				continue
+			}
+		}
+		errs = append(errs, Error{
+			File:    m[fileIndex],
+			Line:    line,
+			Col:     col,
+			Message: m[messageIndex],
+			Symbol:  symbol(m[messageIndex]),
+		})
+	}
+	return errs
+}
+
+// symbol returns the symbol message is about, if it’s known.
+func symbol(message string) string {
+	for _, r := range symbols {
+		if m := r.FindStringSubmatch(message); m != nil {
+			return m[1]
+		}
+	}
+	return ""
+}
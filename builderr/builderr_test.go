@@ -0,0 +1,111 @@
+package builderr_test
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/looshch/gouse/builderr"
+)
+
+func TestParse(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name   string
+		output string
+		want   []builderr.Error
+	}{
+		{
+			"build",
+			"# example.com/p\n" +
+				"./main.go:4:2: declared and not used: x\n" +
+				"./main.go:3:2: " +
+				"\"fmt\" imported and not used\n",
+			[]builderr.Error{
+				{
+					"./main.go", 4, 2,
+					"declared and not used: x", "x",
+				},
+				{
+					"./main.go", 3, 2,
+					`"fmt" imported and not used`, "fmt",
+				},
+			},
+		},
+		{
+			"vet",
+			"# example.com/p\n" +
+				"vet: p.go:7:5: undefined: y\n",
+			[]builderr.Error{{"p.go", 7, 5, "undefined: y", "y"}},
+		},
+		{
+			"windows path",
+			`C:\a:b\main.go:12:3: ` +
+				"declared and not used: y\r\n",
+			[]builderr.Error{{
+				`C:\a:b\main.go`, 12, 3,
+				"declared and not used: y", "y",
+			}},
+		},
+		{
+			"no column",
+			"main.go:5: label L defined and not used\n",
+			[]builderr.Error{{
+				"main.go", 5, 0,
+				"label L defined and not used", "L",
+			}},
+		},
+		{
+			"no provider",
+			"main.go:3:8: no required module provides package " +
+				"example.com/x; to add it:\n" +
+				"\tgo get example.com/x\n",
+			[]builderr.Error{{
+				"main.go", 3, 8,
+				"no required module provides package " +
+					"example.com/x; to add it:",
+				"example.com/x",
+			}},
+		},
+		{
+			"unknown symbol",
+			"a.go:1:1: expected 'package', found x\n",
+			[]builderr.Error{{
+				"a.go", 1, 1, "expected 'package', found x", "",
+			}},
+		},
+		{"no errors", "go: downloading example.com/x v1.0.0\n", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got := builderr.Parse([]byte(tt.output))
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got: %+v, want: %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestErrorError(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		e    builderr.Error
+		want string
+	}{
+		{
+			builderr.Error{
+				File: "a.go", Line: 4, Col: 2, Message: "m",
+			},
+			"a.go:4:2: m",
+		},
+		{
+			builderr.Error{File: "a.go", Line: 5, Message: "m"},
+			"a.go:5: m",
+		},
+	}
+	for _, tt := range tests {
+		if got := tt.e.Error(); got != tt.want {
+			t.Errorf("got: %s, want: %s", got, tt.want)
+		}
+	}
+}
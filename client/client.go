@@ -0,0 +1,268 @@
+// Package client runs gouse on a daemon, ‘gouse -daemon’, so editor helpers
+// and CI tools don’t start gouse for every file and share its build cache.
+//
+//	c := client.New(path)
+//	defer c.Close()
+//	toggled, err := c.Toggle(ctx, src, "-placement", "function")
+//
+// Runs are served one at a time in the working directory of the request with
+// the environment of the daemon. Connections are kept open between runs and
+// reused, so a Client is meant to be long-lived and shared; it’s safe for
+// concurrent use. A run on a connection the daemon has closed, e.g. when it
+// was restarted, is sent again on a new one only if none of the request was
+// sent; otherwise the daemon may have run it, so the error is returned.
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultTimeout is how long a run may take with a Client made without
+	// WithTimeout, including connecting to the daemon.
+	DefaultTimeout = time.Minute
+	// DefaultMaxIdle is how many idle connections a Client made without
+	// WithMaxIdle keeps open.
+	DefaultMaxIdle = 2
+)
+
+// ErrClosed is returned by runs of a closed Client.
+var ErrClosed = errors.New("client is closed")
+
+// Request is a run of gouse: Args are the arguments it’s run with, without
+// the name of the command, e.g. ‘-w main.go’, relative paths are resolved in
+// Dir, and Stdin is its stdin. Runs which are interactive or don’t exit on
+// their own, e.g. with ‘-watch’ or ‘-grpc’ flag, exit with status 1.
+type Request struct {
+	Args  []string `json:"args"`
+	Dir   string   `json:"dir"`
+	Stdin []byte   `json:"stdin"`
+}
+
+// Response is the output and the exit status of a run.
+type Response struct {
+	Stdout []byte `json:"stdout"`
+	Stderr []byte `json:"stderr"`
+	Status int    `json:"status"`
+}
+
+// DefaultSocketPath returns the path of the Unix socket ‘gouse -daemon’
+// listens on, under the user cache directory.
+func DefaultSocketPath() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		format := "DefaultSocketPath: in os.UserCacheDir: %v"
+		return "", fmt.Errorf(format, err)
+	}
+	return filepath.Join(dir, "gouse", "daemon.sock"), nil
+}
+
+// Option configures a Client.
+type Option func(*Client)
+
+// WithTimeout limits how long a run may take, including connecting to the
+// daemon. 0 means no limit other than the context of the run.
+func WithTimeout(d time.Duration) Option {
+	return func(c *Client) { c.timeout = d }
+}
+
+// WithMaxIdle sets how many idle connections are kept open for later runs.
+func WithMaxIdle(n int) Option {
+	return func(c *Client) { c.maxIdle = n }
+}
+
+// Client runs gouse on the daemon listening on a Unix socket.
+type Client struct {
+	path    string
+	timeout time.Duration
+	maxIdle int
+
+	mu     sync.Mutex
+	idle   []*conn
+	closed bool
+}
+
+// conn is a connection to the daemon. written counts bytes written to it.
+type conn struct {
+	net.Conn
+	enc     *json.Encoder
+	dec     *json.Decoder
+	written int
+}
+
+func (cn *conn) Write(p []byte) (int, error) {
+	n, err := cn.Conn.Write(p)
+	cn.written += n
+	return n, err
+}
+
+// New returns a Client of the daemon listening on the Unix socket at path,
+// e.g. of DefaultSocketPath. It connects on the first run.
+func New(path string, opts ...Option) *Client {
+	c := &Client{
+		path:    path,
+		timeout: DefaultTimeout,
+		maxIdle: DefaultMaxIdle,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Run runs req on the daemon and returns its response. A run which exits with
+// non-zero status isn’t an error. Runs are sent again only if a reused
+// connection failed before any of req was sent.
+func (c *Client) Run(ctx context.Context, req Request) (Response, error) {
+	const thisName = "*Client.Run"
+
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+	cn, reused, err := c.get(ctx)
+	if err != nil {
+		return Response{}, fmt.Errorf("%s: %v", thisName, err)
+	}
+	resp, sent, err := cn.roundTrip(ctx, req)
+	// The daemon may have closed an idle connection, e.g. when it was
+	// restarted. Runs which were sent aren’t sent again, as the daemon may
+	// have run them, e.g. written files, before the connection failed.
+	if err != nil && reused && !sent && ctx.Err() == nil {
+		cn.Close()
+		cn, err = c.dial(ctx)
+		if err != nil {
+			return Response{}, fmt.Errorf("%s: %v", thisName, err)
+		}
+		resp, _, err = cn.roundTrip(ctx, req)
+	}
+	if err != nil {
+		cn.Close()
+		return Response{}, fmt.Errorf("%s: %v", thisName, err)
+	}
+	// The connection may have been interrupted after the response.
+	if ctx.Err() != nil {
+		cn.Close()
+	} else {
+		c.put(cn)
+	}
+	return resp, nil
+}
+
+// Toggle returns src toggled by the daemon with args, e.g. ‘-strategy
+// comment’, like ‘gouse args < src’ does in the working directory.
+func (c *Client) Toggle(
+	ctx context.Context, src []byte, args ...string,
+) ([]byte, error) {
+	const thisName = "*Client.Toggle"
+
+	dir, err := os.Getwd()
+	if err != nil {
+		return nil, fmt.Errorf(thisName+": in os.Getwd: %v", err)
+	}
+	resp, err := c.Run(ctx, Request{Args: args, Dir: dir, Stdin: src})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", thisName, err)
+	}
+	if resp.Status != 0 {
+		format := "%s: exit status %d: %s"
+		return nil, fmt.Errorf(
+			format, thisName, resp.Status, resp.Stderr,
+		)
+	}
+	return resp.Stdout, nil
+}
+
+// Close closes idle connections and makes later runs fail with ErrClosed.
+// Runs in progress finish.
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+	for _, cn := range c.idle {
+		cn.Close()
+	}
+	c.idle = nil
+	return nil
+}
+
+// get returns an idle connection, reporting that it was used before, or a new
+// one.
+func (c *Client) get(ctx context.Context) (*conn, bool, error) {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil, false, ErrClosed
+	}
+	if n := len(c.idle); n > 0 {
+		cn := c.idle[n-1]
+		c.idle = c.idle[:n-1]
+		c.mu.Unlock()
+		return cn, true, nil
+	}
+	c.mu.Unlock()
+	cn, err := c.dial(ctx)
+	if err != nil {
+		return nil, false, fmt.Errorf("get: %v", err)
+	}
+	return cn, false, nil
+}
+
+// put keeps cn for later runs or closes it if there are enough idle ones.
+func (c *Client) put(cn *conn) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed || len(c.idle) >= c.maxIdle {
+		cn.Close()
+		return
+	}
+	c.idle = append(c.idle, cn)
+}
+
+// dial connects to the daemon.
+func (c *Client) dial(ctx context.Context) (*conn, error) {
+	var d net.Dialer
+	nc, err := d.DialContext(ctx, "unix", c.path)
+	if err != nil {
+		format := "dial: in *Dialer.DialContext: %v, start a daemon " +
+			"with ‘gouse -daemon’"
+		return nil, fmt.Errorf(format, err)
+	}
+	cn := &conn{Conn: nc, dec: json.NewDecoder(nc)}
+	cn.enc = json.NewEncoder(cn)
+	return cn, nil
+}
+
+// roundTrip sends req to the daemon and returns the response, reporting
+// whether any of req was sent. ctx being done interrupts it.
+func (cn *conn) roundTrip(
+	ctx context.Context, req Request,
+) (Response, bool, error) {
+	const thisName = "*conn.roundTrip"
+
+	var resp Response
+	// The deadline in the past makes pending reads and writes fail.
+	stop := context.AfterFunc(ctx, func() {
+		cn.SetDeadline(time.Unix(1, 0))
+	})
+	defer stop()
+	cn.written = 0
+	if err := cn.enc.Encode(req); err != nil {
+		format := thisName + ": in *Encoder.Encode: %v"
+		return resp, cn.written > 0, fmt.Errorf(format, err)
+	}
+	if err := cn.dec.Decode(&resp); err != nil {
+		format := thisName + ": in *Decoder.Decode: %v"
+		return resp, true, fmt.Errorf(format, err)
+	}
+	return resp, true, nil
+}
@@ -0,0 +1,212 @@
+package client_test
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/looshch/gouse/client"
+)
+
+// fakeCounts counts connections of fakeDaemon and the ones it closed.
+type fakeCounts struct {
+	conns, closed atomic.Int32
+}
+
+// fakeDaemon serves requests on a Unix socket like ‘gouse -daemon’ does,
+// responding after delay with args as stdout, stdin as stderr and status 1 if
+// there is stdin. If once is true, connections are closed after a response.
+// It returns the path of the socket and counts of connections.
+func fakeDaemon(
+	t *testing.T, delay time.Duration, once bool,
+) (string, *fakeCounts) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "d.sock")
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	counts := &fakeCounts{}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			counts.conns.Add(1)
+			go func() {
+				serveFake(conn, delay, once)
+				counts.closed.Add(1)
+			}()
+		}
+	}()
+	return path, counts
+}
+
+// serveFake serves requests read from conn like fakeDaemon says.
+func serveFake(conn net.Conn, delay time.Duration, once bool) {
+	defer conn.Close()
+	dec := json.NewDecoder(conn)
+	enc := json.NewEncoder(conn)
+	for {
+		var req client.Request
+		if err := dec.Decode(&req); err != nil {
+			return
+		}
+		time.Sleep(delay)
+		resp := client.Response{
+			Stdout: []byte(strings.Join(req.Args, " ")),
+			Stderr: req.Stdin,
+		}
+		if len(req.Stdin) > 0 {
+			resp.Status = 1
+		}
+		if enc.Encode(resp) != nil || once {
+			return
+		}
+	}
+}
+
+func TestClientRun(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name      string
+		once      bool
+		wantConns int32
+	}{
+		{"connection reused", false, 1},
+		{"connection closed by the daemon", true, 3},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			path, counts := fakeDaemon(t, 0, test.once)
+			c := client.New(path)
+			defer c.Close()
+			ctx := context.Background()
+			// Otherwise a request may be sent before the daemon
+			// closes the connection, and it isn’t sent again.
+			closed := func() bool {
+				conns := counts.conns.Load()
+				return counts.closed.Load() == conns
+			}
+			for range 3 {
+				for test.once && !closed() {
+					time.Sleep(time.Millisecond)
+				}
+				resp, err := c.Run(ctx, client.Request{
+					Args: []string{"-w", "a.go"},
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(resp.Stdout) != "-w a.go" ||
+					resp.Status != 0 {
+					t.Errorf("got: %+v", resp)
+				}
+			}
+			if got := counts.conns.Load(); got != test.wantConns {
+				t.Errorf("got: %d connections, want: %d",
+					got, test.wantConns)
+			}
+		})
+	}
+}
+
+func TestClientToggle(t *testing.T) {
+	t.Parallel()
+	path, _ := fakeDaemon(t, 0, false)
+	c := client.New(path)
+	defer c.Close()
+	ctx := context.Background()
+	got, err := c.Toggle(ctx, nil, "-strategy", "comment")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "-strategy comment" {
+		t.Errorf("got: %s, want: -strategy comment", got)
+	}
+	// The fake daemon fails with stdin as stderr.
+	_, err = c.Toggle(ctx, []byte("broken"))
+	if err == nil || !strings.Contains(err.Error(), "broken") {
+		t.Errorf("got: %v, want: an error with stderr", err)
+	}
+}
+
+func TestClientRunNotSentAgain(t *testing.T) {
+	t.Parallel()
+	path := filepath.Join(t.TempDir(), "d.sock")
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	// The daemon responds to the first request of a connection and closes
+	// it after reading the second one, like a daemon which was stopped
+	// during a run.
+	var requests atomic.Int32
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			dec := json.NewDecoder(conn)
+			for i := range 2 {
+				var req client.Request
+				if dec.Decode(&req) != nil {
+					break
+				}
+				requests.Add(1)
+				if i == 0 {
+					enc := json.NewEncoder(conn)
+					enc.Encode(client.Response{})
+				}
+			}
+			conn.Close()
+		}
+	}()
+	c := client.New(path)
+	defer c.Close()
+	ctx := context.Background()
+	if _, err := c.Run(ctx, client.Request{}); err != nil {
+		t.Fatal(err)
+	}
+	// The daemon may have run the request, so it isn’t sent again.
+	if _, err := c.Run(ctx, client.Request{}); err == nil {
+		t.Error("got: nil, want: the connection failed")
+	}
+	if got := requests.Load(); got != 2 {
+		t.Errorf("got: %d requests, want: 2", got)
+	}
+}
+
+func TestClientErrors(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	path, _ := fakeDaemon(t, time.Second, false)
+	c := client.New(path, client.WithTimeout(10*time.Millisecond))
+	if _, err := c.Run(ctx, client.Request{}); err == nil {
+		t.Error("got: nil, want: a timeout")
+	}
+
+	missing := filepath.Join(t.TempDir(), "missing.sock")
+	c = client.New(missing)
+	if _, err := c.Run(ctx, client.Request{}); err == nil {
+		t.Error("got: nil, want: no daemon")
+	}
+
+	c.Close()
+	_, err := c.Run(ctx, client.Request{})
+	if err == nil ||
+		!strings.Contains(err.Error(), client.ErrClosed.Error()) {
+		t.Errorf("got: %v, want: %v", err, client.ErrClosed)
+	}
+}
@@ -0,0 +1,19 @@
+// gouse-analyzer reports fake usages created by gouse and unused variables,
+// with suggested fixes which remove and create fake usages.
+//
+// Usage:
+//
+//	go vet -vettool=$(which gouse-analyzer) ./...
+//	gouse-analyzer [-fix] [packages]
+//
+// go vet only runs it on packages without type errors, so under go vet it
+// reports fake usages left in code, e.g. in CI. Run standalone, it creates
+// fake usages for unused variables too, like gouse add does, with ‘-fix’.
+package main
+
+import (
+	"github.com/looshch/gouse/analyzer"
+	"golang.org/x/tools/go/analysis/singlechecker"
+)
+
+func main() { singlechecker.Main(analyzer.Analyzer) }
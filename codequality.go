@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+
+	"github.com/looshch/gouse/internal/core"
+)
+
+// codeQualityReport collects results of files into a GitLab Code Quality
+// report, which merge request widgets show. Issues are fingerprinted with the
+// path, the rule, the name and the text of the line rather than the line
+// number, so they are tracked across commits which move them.
+type codeQualityReport struct {
+	issues []codeQualityIssue
+	// seen counts issues with the same fingerprint source, so they get
+	// different fingerprints.
+	seen map[string]int
+}
+
+// add is an editsReporter which adds issues of changes to code of the file
+// name.
+func (r *codeQualityReport) add(
+	name string, code []byte, changes []core.Change,
+) error {
+	if r.seen == nil {
+		r.seen = map[string]int{}
+	}
+	p := filepath.ToSlash(name)
+	for _, c := range changes {
+		rule, text := describeChange(c)
+		start := bytes.LastIndexByte(code[:c.Start], '\n') + 1
+		end := len(code)
+		if i := bytes.IndexByte(code[start:], '\n'); i >= 0 {
+			end = start + i
+		}
+		line := bytes.TrimSpace(code[start:end])
+		source := fmt.Sprintf(
+			"%s\x00%s\x00%s\x00%s", p, rule, c.Name, line,
+		)
+		r.seen[source]++
+		sum := sha256.Sum256(
+			fmt.Appendf(nil, "%s\x00%d", source, r.seen[source]),
+		)
+		issue := codeQualityIssue{
+			Description: text,
+			CheckName:   rule,
+			Fingerprint: hex.EncodeToString(sum[:]),
+			Severity:    "minor",
+		}
+		issue.Location.Path = p
+		// +1 is an adjustment for 1-based count.
+		issue.Location.Lines.Begin = c.LineNum + 1
+		r.issues = append(r.issues, issue)
+	}
+	return nil
+}
+
+// write writes the report of r to out.
+func (r *codeQualityReport) write(out file) error {
+	issues := r.issues
+	// The report is a list even if there are no issues.
+	if issues == nil {
+		issues = []codeQualityIssue{}
+	}
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(issues); err != nil {
+		format := "*codeQualityReport.write: in *Encoder.Encode: %v"
+		return fmt.Errorf(format, err)
+	}
+	return nil
+}
+
+// codeQualityIssue is an issue of GitLab Code Quality report.
+type codeQualityIssue struct {
+	Description string `json:"description"`
+	CheckName   string `json:"check_name"`
+	Fingerprint string `json:"fingerprint"`
+	Severity    string `json:"severity"`
+	Location    struct {
+		Path  string `json:"path"`
+		Lines struct {
+			Begin int `json:"begin"`
+		} `json:"lines"`
+	} `json:"location"`
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestCodeQualityReport(t *testing.T) {
+	t.Parallel()
+	// report returns issues of fake usages in code.
+	report := func(code string) []codeQualityIssue {
+		var r codeQualityReport
+		_, err := listFiles(
+			[]string{"-"}, "", lineTerminator, r.add,
+			newFakeFile([]byte(code)...), nil,
+			openFile,
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out := newFakeFile()
+		if err := r.write(out); err != nil {
+			t.Fatal(err)
+		}
+		var issues []codeQualityIssue
+		err = json.Unmarshal(out.contents.Bytes(), &issues)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return issues
+	}
+	const usage = "\ta := 0; _ = a /* TODO: gouse */\n"
+	got := report("package p\n\nfunc f() {\n" + usage + usage + "}\n")
+	if len(got) != 2 {
+		t.Fatalf("got: %d issues, want: 2", len(got))
+	}
+	if got[0].CheckName != ruleFakeUsage ||
+		got[0].Location.Path != stdinName ||
+		got[0].Location.Lines.Begin != 4 {
+		t.Errorf("got: %+v, want: %s on line 4", got[0], ruleFakeUsage)
+	}
+	if got[0].Fingerprint == got[1].Fingerprint {
+		t.Errorf("got: equal fingerprints, want: different")
+	}
+	moved := report("package p\n\n\nfunc f() {\n" + usage + "}\n")
+	if moved[0].Fingerprint != got[0].Fingerprint {
+		t.Errorf(
+			"got: %s, want: %s",
+			moved[0].Fingerprint, got[0].Fingerprint,
+		)
+	}
+	if empty := report("package p\n"); empty == nil || len(empty) != 0 {
+		t.Errorf("got: %v, want: []", empty)
+	}
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"text/template"
+)
+
+// shells are shells completion scripts are generated for.
+var shells = []string{"bash", "zsh", "fish", "powershell"}
+
+// completionFlag represents a flag in completion scripts.
+type completionFlag struct {
+	Name  string
+	Usage string
+	// TakesValue is false for boolean flags, including -stats and
+	// -author whose value is optional.
+	TakesValue bool
+}
+
+// completionCommand represents a command in completion scripts.
+type completionCommand struct {
+	Name  string
+	Flags []completionFlag
+}
+
+// FlagNames returns names of flags of c prefixed with ‘-’ and separated with
+// spaces.
+func (c completionCommand) FlagNames() string {
+	names := make([]string, len(c.Flags))
+	for i, f := range c.Flags {
+		names[i] = "-" + f.Name
+	}
+	return strings.Join(names, " ")
+}
+
+// completionCommands returns every command with its flags taken from
+// newFlagSet.
+func completionCommands() []completionCommand {
+	cc := make([]completionCommand, len(commands))
+	for i, name := range commands {
+		cc[i].Name = name
+		flags := newFlagSet(&config{command: name})
+		flags.VisitAll(func(f *flag.Flag) {
+			b, ok := f.Value.(interface{ IsBoolFlag() bool })
+			cc[i].Flags = append(cc[i].Flags, completionFlag{
+				Name:       f.Name,
+				Usage:      f.Usage,
+				TakesValue: !ok || !b.IsBoolFlag(),
+			})
+		})
+	}
+	return cc
+}
+
+var completionTemplates = template.Must(
+	template.New("").Funcs(template.FuncMap{
+		"join": strings.Join,
+		"without": func(ss []string, s string) []string {
+			isS := func(e string) bool { return e == s }
+			return slices.DeleteFunc(slices.Clone(ss), isS)
+		},
+		// zsh quotes s for a description in an _arguments spec.
+		"zsh": strings.NewReplacer(
+			"'", `'\''`, "[", `\[`, "]", `\]`, ":", `\:`,
+		).Replace,
+		// quote quotes s for a single-quoted fish or powershell
+		// string.
+		"quote": func(s string) string {
+			return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+		},
+	}).Parse(`
+{{- define "bash" -}}
+# bash completion for gouse, generated by ‘gouse completion bash’.
+_gouse() {
+	local cur=${COMP_WORDS[COMP_CWORD]} command=toggle flags
+	if ((COMP_CWORD > 1)); then
+		case ${COMP_WORDS[1]} in
+		{{join .Commands "|"}}) command=${COMP_WORDS[1]} ;;
+		esac
+	fi
+	case $command in
+	{{- range .Completion}}
+	{{.Name}}) flags="{{.FlagNames}}" ;;
+	{{- end}}
+	esac
+	if [[ $command == completion ]]; then
+		COMPREPLY=($(compgen -W "{{join .Shells " "}}" -- "$cur"))
+		return
+	fi
+	if [[ $cur == -* ]]; then
+		COMPREPLY=($(compgen -W "$flags" -- "$cur"))
+		return
+	fi
+	COMPREPLY=($(compgen -d -- "$cur") $(compgen -f -X '!*.go' -- "$cur"))
+	if ((COMP_CWORD == 1)); then
+		COMPREPLY+=($(compgen -W "{{join .Commands " "}}" -- "$cur"))
+	fi
+}
+complete -o filenames -F _gouse gouse
+{{end}}
+
+{{- define "zsh" -}}
+#compdef gouse
+# zsh completion for gouse, generated by ‘gouse completion zsh’.
+_gouse() {
+	local command=toggle
+	case $words[2] in
+	({{join .Commands "|"}})
+		command=$words[2]
+		shift words
+		(( CURRENT-- ))
+		;;
+	(*)
+		if (( CURRENT == 2 )) && [[ $PREFIX != -* ]]; then
+			_alternative \
+				'commands:command:({{join .Commands " "}})' \
+				'files:file:_files -g "*.go(-/)"'
+			return
+		fi
+		;;
+	esac
+	case $command in
+	(completion)
+		_arguments '1:shell:({{join .Shells " "}})'
+		;;
+	{{- range .Completion}}{{if ne .Name "completion"}}
+	({{.Name}})
+		_arguments \
+		{{- range .Flags}}
+			'-{{.Name}}[{{zsh .Usage}}]{{if .TakesValue}}:{{.Name}}:{{if eq .Name "o"}}_files{{else}} {{end}}{{end}}' \
+		{{- end}}
+			'*:file:_files -g "*.go(-/)"'
+		;;
+	{{- end}}{{end}}
+	esac
+}
+if [[ $zsh_eval_context[-1] == loadautofunc ]]; then
+	_gouse "$@"
+else
+	compdef _gouse gouse
+fi
+{{end}}
+
+{{- define "fish" -}}
+# fish completion for gouse, generated by ‘gouse completion fish’.
+complete -c gouse -f
+complete -c gouse -n "not __fish_seen_subcommand_from {{join .Commands " "}}" -a "{{join .Commands " "}}"
+complete -c gouse -n "__fish_seen_subcommand_from completion" -a "{{join .Shells " "}}"
+complete -c gouse -n "not __fish_seen_subcommand_from completion" -a "(__fish_complete_suffix .go)"
+{{- range .Completion}}
+{{- $condition := printf "__fish_seen_subcommand_from %s" .Name}}
+{{- if eq .Name "toggle"}}
+{{- $condition = printf "not __fish_seen_subcommand_from %s" (join (without $.Commands .Name) " ")}}
+{{- end}}
+{{- range .Flags}}
+complete -c gouse -n "{{$condition}}" -o {{.Name}}{{if .TakesValue}} -r{{end}} -d {{quote .Usage}}
+{{- end}}
+{{- end}}
+{{end}}
+
+{{- define "powershell" -}}
+# powershell completion for gouse, generated by ‘gouse completion powershell’.
+Register-ArgumentCompleter -Native -CommandName gouse -ScriptBlock {
+	param($wordToComplete, $commandAst, $cursorPosition)
+	$commands = @({{range $i, $c := .Commands}}{{if $i}}, {{end}}{{quote $c}}{{end}})
+	$words = @($commandAst.CommandElements | ForEach-Object { $_.ToString() })
+	$first = $words.Count -eq 1 -or ($words.Count -eq 2 -and $wordToComplete)
+	$command = 'toggle'
+	if (-not $first -and $commands -contains $words[1]) {
+		$command = $words[1]
+	}
+	$flags = switch ($command) {
+		{{- range .Completion}}
+		{{quote .Name}} { @({{range $i, $f := .Flags}}{{if $i}}, {{end}}{{quote (printf "-%s" $f.Name)}}{{end}}) }
+		{{- end}}
+	}
+	if ($command -eq 'completion') {
+		$candidates = @({{range $i, $s := .Shells}}{{if $i}}, {{end}}{{quote $s}}{{end}})
+	} elseif ($wordToComplete -like '-*') {
+		$candidates = $flags
+	} else {
+		$dir = [System.IO.Path]::GetDirectoryName($wordToComplete)
+		$candidates = @(Get-ChildItem -Path "$wordToComplete*" -ErrorAction SilentlyContinue |
+			Where-Object { $_.PSIsContainer -or $_.Extension -eq '.go' } |
+			ForEach-Object { [System.IO.Path]::Combine([string]$dir, $_.Name) })
+		if ($first) {
+			$candidates += $commands
+		}
+	}
+	$candidates | Where-Object { $_ -like "$wordToComplete*" } | ForEach-Object {
+		[System.Management.Automation.CompletionResult]::new($_, $_, 'ParameterValue', $_)
+	}
+}
+{{end}}
+`),
+)
+
+// writeCompletion writes to out a completion script for the shell.
+func writeCompletion(shell string, out io.Writer) error {
+	if !slices.Contains(shells, shell) {
+		return fmt.Errorf(
+			"writeCompletion: unknown shell %q, want one of: %s",
+			shell, strings.Join(shells, ", "),
+		)
+	}
+	data := struct {
+		Commands, Shells []string
+		Completion       []completionCommand
+	}{commands, shells, completionCommands()}
+	err := completionTemplates.ExecuteTemplate(out, shell, data)
+	if err != nil {
+		format := "writeCompletion: in *Template.ExecuteTemplate: %v"
+		return fmt.Errorf(format, err)
+	}
+	return nil
+}
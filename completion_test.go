@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestWriteCompletion(t *testing.T) {
+	for _, shell := range shells {
+		s := shell
+		t.Run(s, func(t *testing.T) {
+			t.Parallel()
+			var b bytes.Buffer
+			if err := writeCompletion(s, &b); err != nil {
+				t.Fatal(err)
+			}
+			script := b.String()
+			var want []string
+			want = append(want, commands...)
+			for _, c := range completionCommands() {
+				for _, f := range c.Flags {
+					want = append(want, f.Name)
+				}
+			}
+			for _, w := range want {
+				if !strings.Contains(script, w) {
+					t.Errorf("got: no %s, want: %s", w, w)
+				}
+			}
+		})
+	}
+	if err := writeCompletion("tcsh", &bytes.Buffer{}); err == nil {
+		t.Error("got: nil, want: error")
+	}
+}
+
+func TestBashCompletion(t *testing.T) {
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip(err)
+	}
+	var script bytes.Buffer
+	if err := writeCompletion("bash", &script); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		words string
+		want  string
+	}{
+		{
+			words: "gouse -max",
+			want:  "-max-errors -max-file-size -max-toggles",
+		},
+		{words: "gouse au", want: "audit"},
+		{words: "gouse audit -max", want: "-max-age"},
+		{words: "gouse completion z", want: "zsh"},
+		{words: "gouse -w m", want: "main.go"},
+	}
+	for _, tt := range tests {
+		test := tt
+		t.Run(test.words, func(t *testing.T) {
+			t.Parallel()
+			cword := len(strings.Fields(test.words)) - 1
+			cmd := exec.Command(
+				"bash", "-c",
+				script.String()+"\n"+
+					"COMP_WORDS=("+test.words+")\n"+
+					"COMP_CWORD="+strconv.Itoa(cword)+"\n"+
+					`_gouse; echo "${COMPREPLY[*]}"`,
+			)
+			cmd.Dir = t.TempDir()
+			for _, name := range []string{"main.go", "main.txt"} {
+				p := filepath.Join(cmd.Dir, name)
+				err := os.WriteFile(p, nil, 0o644)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			out, err := cmd.Output()
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := strings.TrimSpace(string(out))
+			if got != test.want {
+				t.Errorf("got: %s, want: %s", got, test.want)
+			}
+		})
+	}
+}
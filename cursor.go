@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/looshch/gouse/internal/core"
+)
+
+// cursorOffsets is a value of ‘-cursor’ flag: comma-separated byte offsets in
+// code, e.g. of cursors of an editor, which are printed moved to where they
+// are in the toggled code, so editors restore cursors after replacing buffers.
+type cursorOffsets []int
+
+func (o *cursorOffsets) String() string {
+	s := make([]string, len(*o))
+	for i, offset := range *o {
+		s[i] = strconv.Itoa(offset)
+	}
+	return strings.Join(s, ",")
+}
+
+func (o *cursorOffsets) Set(v string) error {
+	var offsets cursorOffsets
+	for _, s := range strings.Split(v, ",") {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			return fmt.Errorf("invalid cursor offset %q", s)
+		}
+		offsets = append(offsets, n)
+	}
+	*o = offsets
+	return nil
+}
+
+// moved returns o moved to where they are in code with changes applied.
+// Offsets inside replaced text are kept inside its replacement, and text
+// inserted at an offset goes after it.
+func (o cursorOffsets) moved(changes []core.Change) cursorOffsets {
+	moved := make(cursorOffsets, len(o))
+	for i, offset := range o {
+		moved[i] = offset
+		for _, c := range changes {
+			switch {
+			case c.End <= offset && c.Start < offset:
+				moved[i] += len(c.Text) - (c.End - c.Start)
+			case c.Start < offset:
+				moved[i] += min(offset-c.Start, len(c.Text)) -
+					(offset - c.Start)
+			}
+		}
+	}
+	return moved
+}
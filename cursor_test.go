@@ -0,0 +1,90 @@
+package main
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/looshch/gouse/internal/core"
+)
+
+func TestCursorOffsetsSet(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		value   string
+		want    cursorOffsets
+		wantErr bool
+	}{
+		{value: "0", want: cursorOffsets{0}},
+		{value: "12,3", want: cursorOffsets{12, 3}},
+		{value: "", wantErr: true},
+		{value: "1,", wantErr: true},
+		{value: "-1", wantErr: true},
+		{value: "a", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			t.Parallel()
+			var got cursorOffsets
+			err := got.Set(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf(
+					"got %v, want error: %t",
+					err, tt.wantErr,
+				)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCursorOffsetsMoved(t *testing.T) {
+	t.Parallel()
+	// In ‘a := 0\nb := 1\n’, a fake usage is added at the end of the
+	// first line and ‘:= 1’ is replaced with ‘= 2’.
+	changes := []core.Change{
+		{Start: 6, End: 6, Text: "; _ = a"},
+		{Start: 9, End: 13, Text: "= 2"},
+	}
+	tests := []struct {
+		name    string
+		offsets cursorOffsets
+		want    cursorOffsets
+	}{
+		{
+			name:    "before changes",
+			offsets: cursorOffsets{0, 5},
+			want:    cursorOffsets{0, 5},
+		},
+		{
+			name:    "at an insertion",
+			offsets: cursorOffsets{6},
+			want:    cursorOffsets{6},
+		},
+		{
+			name:    "after an insertion",
+			offsets: cursorOffsets{7, 9},
+			want:    cursorOffsets{14, 16},
+		},
+		{
+			name:    "inside a replacement",
+			offsets: cursorOffsets{10, 12},
+			want:    cursorOffsets{17, 19},
+		},
+		{
+			name:    "after all changes",
+			offsets: cursorOffsets{13, 14},
+			want:    cursorOffsets{19, 20},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got := tt.offsets.moved(changes)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
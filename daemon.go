@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/looshch/gouse/client"
+)
+
+var (
+	errDaemonRunning = errors.New("a daemon is already listening")
+	errMemFileSeek   = errors.New("cannot seek in a file in memory")
+)
+
+// runFunc runs gouse like run does.
+type runFunc func(
+	ctx context.Context, args []string, stdin, stdout, stderr file,
+) int
+
+// serveDaemon listens on the Unix socket at path, printing it to infoLog, and
+// serves forwarded runs with run one by one until ctx is done, counting them
+// in m. Connections are kept open for more runs until clients close them.
+// Errors of single connections are printed to errorLog and don’t stop
+// serving.
+func serveDaemon(
+	ctx context.Context,
+	path string,
+	run runFunc,
+	m *metrics,
+	infoLog, errorLog *log.Logger,
+) error {
+	const thisName = "serveDaemon"
+
+	if conn, err := net.Dial("unix", path); err == nil {
+		conn.Close()
+		format := thisName + ": %s: %v"
+		return fmt.Errorf(format, path, errDaemonRunning)
+	}
+	// A socket left by a killed daemon would fail listening.
+	err := os.Remove(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf(thisName+": in os.Remove: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf(thisName+": in os.MkdirAll: %v", err)
+	}
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return fmt.Errorf(thisName+": in net.Listen: %v", err)
+	}
+	defer l.Close()
+	infoLog.Printf(listeningFormat, path)
+	go func() {
+		<-ctx.Done()
+		l.Close()
+	}()
+	// Runs change the working directory, so they don’t overlap.
+	var runs sync.Mutex
+	for {
+		conn, err := l.Accept()
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			format := thisName + ": in *Listener.Accept: %v"
+			return fmt.Errorf(format, err)
+		}
+		go func() {
+			err := serveConn(ctx, conn, &runs, run, m)
+			if err != nil {
+				errorLog.Printf("%s: %v", thisName, err)
+			}
+		}()
+	}
+}
+
+// serveConn serves runs of requests read from conn with run, holding runs
+// meanwhile, until the client closes conn or ctx is done.
+func serveConn(
+	ctx context.Context,
+	conn net.Conn,
+	runs *sync.Mutex,
+	run runFunc,
+	m *metrics,
+) error {
+	const thisName = "serveConn"
+
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+	dec := json.NewDecoder(conn)
+	enc := json.NewEncoder(conn)
+	for {
+		var req client.Request
+		err := dec.Decode(&req)
+		// E.g. another daemon checked whether this one is listening.
+		if err == io.EOF || ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			format := thisName + ": in *Decoder.Decode: %v"
+			return fmt.Errorf(format, err)
+		}
+		runs.Lock()
+		resp, err := serveRun(ctx, req, run, m)
+		runs.Unlock()
+		if err != nil {
+			return fmt.Errorf("%s: %v", thisName, err)
+		}
+		if err := enc.Encode(resp); err != nil {
+			format := thisName + ": in *Encoder.Encode: %v"
+			return fmt.Errorf(format, err)
+		}
+	}
+}
+
+// serveRun runs req with run in the directory of the client, counting it in
+// m, and returns the response. Runs ‘-client’ flag refuses to forward, e.g.
+// sent by other clients of package client, exit with status 1 without
+// running.
+func serveRun(
+	ctx context.Context, req client.Request, run runFunc, m *metrics,
+) (client.Response, error) {
+	// Runs are served one at a time, so a run which doesn’t exit would
+	// block the daemon. Args which don’t parse are left for run to report.
+	conf, _, err := parseArgs(req.Args)
+	if err == nil && (conf.daemon || conf.client || longRunning(conf)) {
+		m.observe(time.Now(), nil, errDaemonRefusedRun)
+		msg := errorLogPrefix + errDaemonRefusedRun.Error() + "\n"
+		return client.Response{Stderr: []byte(msg), Status: 1}, nil
+	}
+	if err := os.Chdir(req.Dir); err != nil {
+		format := "serveRun: in os.Chdir: %v"
+		return client.Response{}, fmt.Errorf(format, err)
+	}
+	stdin := &memFile{}
+	stdin.Write(req.Stdin)
+	stdout, stderr := &memFile{}, &memFile{}
+	start := time.Now()
+	status := run(ctx, req.Args, stdin, stdout, stderr)
+	// Runs which exit with non-zero status, e.g. check which found fake
+	// usages, count as failed.
+	var failed error
+	if status != 0 {
+		failed = fmt.Errorf("exit status %d", status)
+	}
+	m.observe(start, nil, failed)
+	return client.Response{
+		Stdout: stdout.Bytes(),
+		Stderr: stderr.Bytes(),
+		Status: status,
+	}, nil
+}
+
+// longRunning reports whether the run of conf is interactive or doesn’t exit
+// on its own, e.g. of ‘-watch’ or ‘-grpc’ flag, so it can’t be forwarded to
+// the daemon.
+func longRunning(conf *config) bool {
+	return conf.interactive || conf.tui || conf.watch || conf.lsp ||
+		conf.goplsProxy != "" || conf.rpc || conf.serve != "" ||
+		conf.playground != "" || conf.grpc != ""
+}
+
+// clientArgs returns args without ‘-client’ flag, so the daemon doesn’t
+// forward the run again.
+func clientArgs(args []string) []string {
+	var forwarded []string
+	for _, a := range args {
+		name, _, _ := strings.Cut(strings.TrimLeft(a, "-"), "=")
+		if strings.HasPrefix(a, "-") && name == "client" {
+			continue
+		}
+		forwarded = append(forwarded, a)
+	}
+	return forwarded
+}
+
+// memFile is a file in memory, e.g. stdin and stdout of forwarded runs.
+type memFile struct {
+	bytes.Buffer
+}
+
+func (f *memFile) Seek(offset int64, whence int) (int64, error) {
+	return 0, errMemFileSeek
+}
+
+func (f *memFile) Truncate(size int64) error {
+	f.Buffer.Truncate(int(size))
+	return nil
+}
+
+func (f *memFile) Close() error { return nil }
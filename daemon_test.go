@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/looshch/gouse/client"
+)
+
+func TestDaemon(t *testing.T) {
+	// Runs change the working directory, which the daemon keeps here.
+	dir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "d.sock")
+	// echo writes args to stdout and stdin to stderr.
+	echo := func(
+		ctx context.Context, args []string, stdin, stdout, stderr file,
+	) int {
+		stdout.Write([]byte(strings.Join(args, " ")))
+		io.Copy(stderr, stdin)
+		return 3
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	discard := log.New(io.Discard, "", 0)
+	m := newMetrics()
+	served := make(chan error)
+	go func() {
+		served <- serveDaemon(ctx, path, echo, m, discard, discard)
+	}()
+	// The daemon is up once the socket accepts connections.
+	for {
+		conn, err := net.Dial("unix", path)
+		if err == nil {
+			conn.Close()
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	err = serveDaemon(ctx, path, echo, m, discard, discard)
+	if err == nil {
+		t.Error("got: nil, want: a daemon is already listening")
+	}
+
+	c := client.New(path)
+	defer c.Close()
+	// The second run reuses the connection of the first one.
+	for range 2 {
+		resp, err := c.Run(ctx, client.Request{
+			Args:  []string{"-n", "a.go"},
+			Dir:   dir,
+			Stdin: []byte("code"),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(resp.Stdout) != "-n a.go" ||
+			string(resp.Stderr) != "code" || resp.Status != 3 {
+			t.Errorf("got: %+v", resp)
+		}
+	}
+	// Runs which don’t exit on their own would block the daemon.
+	for _, args := range [][]string{
+		{"-watch", "a.go"}, {"--grpc=:0"}, {"-daemon"}, {"-client"},
+	} {
+		resp, err := c.Run(ctx, client.Request{Args: args, Dir: dir})
+		if err != nil {
+			t.Fatal(err)
+		}
+		msg := errDaemonRefusedRun.Error()
+		if len(resp.Stdout) > 0 || resp.Status != 1 ||
+			!strings.Contains(string(resp.Stderr), msg) {
+			t.Errorf("got: %+v, want: %s", resp, msg)
+		}
+	}
+	// Checks whether the daemon is listening aren’t runs.
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.requests != 6 || m.errors != 6 {
+		t.Errorf(
+			"got: %d runs, %d failed, want: 6 failed runs",
+			m.requests, m.errors,
+		)
+	}
+
+	cancel()
+	if err := <-served; err != nil {
+		t.Error(err)
+	}
+}
+
+func TestClientArgs(t *testing.T) {
+	t.Parallel()
+	args := []string{
+		"-client", "-w", "--client", "-client=true", "client.go", "-",
+	}
+	got := clientArgs(args)
+	want := []string{"-w", "client.go", "-"}
+	if !slices.Equal(got, want) {
+		t.Errorf("got: %v, want: %v", got, want)
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/looshch/gouse/internal/core"
+)
+
+// hunkHeader catches the first line of a hunk in the new file from a hunk
+// header of a unified diff, e.g. ‘@@ -1,2 +[3],4 @@’.
+var hunkHeader = regexp.MustCompile(`^@@ -\d+(?:,\d+)? \+(\d+)(?:,\d+)? @@`)
+
+// parseDiff reads a unified diff, e.g. of git diff, from r and returns added
+// and changed lines of every new file in it, keyed by cleaned paths and 0-based
+// line numbers. Deleted files are skipped.
+func parseDiff(r io.Reader) (map[string]map[int]bool, error) {
+	const thisName = "parseDiff"
+
+	changed := make(map[string]map[int]bool)
+	var lines map[int]bool
+	var lineNum int
+	s := bufio.NewScanner(r)
+	// Diffs of generated files may have long lines.
+	s.Buffer(nil, 1<<24)
+	for s.Scan() {
+		l := s.Text()
+		switch {
+		case strings.HasPrefix(l, "+++ "):
+			name := strings.TrimPrefix(l, "+++ ")
+			// diff -u appends a tab and the modification time.
+			name, _, _ = strings.Cut(name, "\t")
+			if name == "/dev/null" {
+				lines = nil
+				continue
+			}
+			name = strings.TrimPrefix(name, "b/")
+			p := filepath.Clean(filepath.FromSlash(name))
+			if changed[p] == nil {
+				changed[p] = make(map[int]bool)
+			}
+			lines = changed[p]
+		case strings.HasPrefix(l, "@@ "):
+			m := hunkHeader.FindStringSubmatch(l)
+			if m == nil {
+				format := thisName + ": invalid hunk header: %s"
+				return nil, fmt.Errorf(format, l)
+			}
+			start, err := strconv.Atoi(m[1])
+			if err != nil {
+				format := thisName + ": in strconv.Atoi: %v"
+				return nil, fmt.Errorf(format, err)
+			}
+			// -1 is an adjustment for 0-based count.
+			lineNum = start - 1
+		case lines == nil:
+			continue
+		case strings.HasPrefix(l, "+"):
+			lines[lineNum] = true
+			lineNum++
+		case strings.HasPrefix(l, " "), l == "":
+			lineNum++
+		}
+	}
+	if err := s.Err(); err != nil {
+		format := thisName + ": in *Scanner.Scan: %v"
+		return nil, fmt.Errorf(format, err)
+	}
+	return changed, nil
+}
+
+// diffPaths returns sorted paths of Go files in changed.
+func diffPaths(changed map[string]map[int]bool) []string {
+	var paths []string
+	for p := range changed {
+		if filepath.Ext(p) == core.GoFileExt {
+			paths = append(paths, p)
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// onlyChanged returns a changesFilter which keeps only changes on lines.
+func onlyChanged(lines map[int]bool) changesFilter {
+	return func(code []byte, changes []core.Change) ([]core.Change, error) {
+		var kept []core.Change
+		for _, c := range changes {
+			if lines[c.LineNum] {
+				kept = append(kept, c)
+			}
+		}
+		return kept, nil
+	}
+}
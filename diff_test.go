@@ -0,0 +1,75 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/looshch/gouse/internal/core"
+)
+
+const diffInput = `diff --git a/main.go b/main.go
+index 0000001..0000002 100644
+--- a/main.go
++++ b/main.go
+@@ -1,4 +1,5 @@
+ package main
+-var a = 1
++var a = 2
++var b = 3
+
+ func main() {}
+@@ -10 +11,2 @@ func f() {
+ 	x := 1
++	y := 2
+diff --git a/readme.md b/readme.md
+--- a/readme.md
++++ b/readme.md
+@@ -1 +1 @@
+-old
++new
+diff --git a/old.go b/old.go
+deleted file mode 100644
+--- a/old.go
++++ /dev/null
+@@ -1 +0,0 @@
+-package main
+`
+
+func TestParseDiff(t *testing.T) {
+	got, err := parseDiff(strings.NewReader(diffInput))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]map[int]bool{
+		"main.go":   {1: true, 2: true, 11: true},
+		"readme.md": {0: true},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %v, want: %v", got, want)
+	}
+	paths := diffPaths(got)
+	if want := []string{"main.go"}; !reflect.DeepEqual(paths, want) {
+		t.Errorf("got: %v, want: %v", paths, want)
+	}
+	_, err = parseDiff(strings.NewReader("+++ b/main.go\n@@ invalid @@\n"))
+	if err == nil {
+		t.Error("got: nil, want: error")
+	}
+}
+
+func TestOnlyChanged(t *testing.T) {
+	changes := []core.Change{
+		{Name: "a", LineNum: 1},
+		{Name: "b", LineNum: 2},
+		{Name: "c", LineNum: 3},
+	}
+	got, err := onlyChanged(map[int]bool{1: true, 3: true})(nil, changes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []core.Change{changes[0], changes[2]}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %v, want: %v", got, want)
+	}
+}
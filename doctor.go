@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/looshch/gouse/internal/core"
+	"github.com/looshch/gouse/toggle"
+)
+
+// diagnosis is the result of a check of the environment gouse runs in.
+type diagnosis struct {
+	name   string
+	result string
+	ok     bool
+	// hint tells how to fix the problem if the check failed.
+	hint string
+}
+
+// doctorEnv are variables of go env which affect builds gouse runs.
+var doctorEnv = []string{
+	"GOFLAGS", "GO111MODULE", "GOMODCACHE", "GOTOOLCHAIN",
+}
+
+// doctorSample is toggled by the self-test of doctor.
+const doctorSample = "package main\n\nfunc main() {\n\tnotUsed := 0\n}\n"
+
+// diagnose checks that the go command is reachable, reports variables of go
+// env in effect and toggles doctorSample back and forth.
+func diagnose(ctx context.Context) []diagnosis {
+	var ds []diagnosis
+	goPath, err := exec.LookPath("go")
+	if err != nil {
+		return append(ds, diagnosis{
+			name:   "go",
+			result: err.Error(),
+			hint: "install Go from https://go.dev/dl and add its " +
+				"bin directory to PATH",
+		})
+	}
+	cmd := exec.CommandContext(ctx, goPath, "version")
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return append(ds, diagnosis{
+			name: "go",
+			result: fmt.Sprintf(
+				"%v: %s", err, bytes.TrimSpace(out),
+			),
+			hint: "make sure ‘go version’ works in this " +
+				"directory",
+		})
+	}
+	ds = append(ds, diagnosis{
+		name:   "go",
+		result: goPath + ": " + string(bytes.TrimSpace(out)),
+		ok:     true,
+	})
+
+	args := append([]string{"env"}, doctorEnv...)
+	cmd = exec.CommandContext(ctx, goPath, args...)
+	out, err = cmd.CombinedOutput()
+	if err != nil {
+		ds = append(ds, diagnosis{
+			name: "go env",
+			result: fmt.Sprintf(
+				"%v: %s", err, bytes.TrimSpace(out),
+			),
+			hint: "fix the Go environment reported by ‘go env’",
+		})
+	} else {
+		// Empty values are printed as empty lines.
+		values := strings.Split(string(out), "\n")
+		for i, name := range doctorEnv {
+			var v string
+			if i < len(values) {
+				v = values[i]
+			}
+			ds = append(ds, envDiagnosis(name, v))
+		}
+	}
+
+	ds = append(ds, selfTest(ctx))
+	return ds
+}
+
+// envDiagnosis returns a diagnosis of the variable name of go env with the
+// value v.
+func envDiagnosis(name, v string) diagnosis {
+	d := diagnosis{name: name, result: fmt.Sprintf("%q", v), ok: true}
+	switch {
+	case name == "GO111MODULE" && v == "off":
+		d.ok = false
+		d.hint = "unset GO111MODULE, gouse builds code in module mode"
+	case name == "GOFLAGS" && strings.Contains(v, "-mod=vendor"):
+		d.ok = false
+		d.hint = "remove -mod=vendor from GOFLAGS, code is built " +
+			"outside of the module"
+	}
+	return d
+}
+
+// selfTest returns a diagnosis of toggling doctorSample back and forth.
+func selfTest(ctx context.Context) diagnosis {
+	d := diagnosis{
+		name: "self-test",
+		hint: "gouse runs ‘go build’ on code in a temporary " +
+			"directory; make sure it works there with the " +
+			"variables above",
+	}
+	added, err := toggle.Toggle(ctx, []byte(doctorSample))
+	if err != nil {
+		d.result = err.Error()
+		return d
+	}
+	if !bytes.Contains(added, []byte(core.FakeUsageSuffix)) {
+		d.result = "no fake usage was created"
+		return d
+	}
+	removed, err := toggle.Toggle(ctx, added)
+	if err != nil {
+		d.result = err.Error()
+		return d
+	}
+	if string(removed) != doctorSample {
+		d.result = "the fake usage wasn’t removed"
+		return d
+	}
+	return diagnosis{name: d.name, result: "toggled a sample", ok: true}
+}
+
+// writeDiagnoses writes ds to out, one per line, with hints of failed checks.
+// It reports whether all checks passed.
+func writeDiagnoses(ds []diagnosis, out file) (bool, error) {
+	var b bytes.Buffer
+	ok := true
+	for _, d := range ds {
+		status := "ok"
+		if !d.ok {
+			status = "FAIL"
+			ok = false
+		}
+		fmt.Fprintf(&b, "%-4s %s: %s\n", status, d.name, d.result)
+		if !d.ok && d.hint != "" {
+			fmt.Fprintf(&b, "     hint: %s\n", d.hint)
+		}
+	}
+	if _, err := out.Write(b.Bytes()); err != nil {
+		format := "writeDiagnoses: in *File.Write: %v"
+		return false, fmt.Errorf(format, err)
+	}
+	return ok, nil
+}
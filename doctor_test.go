@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+func TestDiagnose(t *testing.T) {
+	ctx := context.Background()
+	ctx, cancel := context.WithCancel(ctx)
+	t.Cleanup(cancel)
+	t.Setenv("GO111MODULE", "")
+	t.Setenv("GOFLAGS", "")
+	ds := diagnose(ctx)
+	// go, the variables of go env and the self-test.
+	if want := 1 + len(doctorEnv) + 1; len(ds) != want {
+		t.Fatalf("got: %d, want: %d", len(ds), want)
+	}
+	for _, d := range ds {
+		if !d.ok {
+			t.Errorf("%s: got: %s, want: ok", d.name, d.result)
+		}
+	}
+}
+
+func TestEnvDiagnosis(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name, v string
+		want    bool
+	}{
+		{"GO111MODULE", "", true},
+		{"GO111MODULE", "on", true},
+		{"GO111MODULE", "off", false},
+		{"GOFLAGS", "-trimpath", true},
+		{"GOFLAGS", "-trimpath -mod=vendor", false},
+		{"GOMODCACHE", "/go/pkg/mod", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name+"="+tt.v, func(t *testing.T) {
+			t.Parallel()
+			d := envDiagnosis(tt.name, tt.v)
+			if d.ok != tt.want {
+				t.Errorf("got: %t, want: %t", d.ok, tt.want)
+			}
+			if !d.ok && d.hint == "" {
+				t.Error("got: no hint, want: hint")
+			}
+		})
+	}
+}
+
+func TestWriteDiagnoses(t *testing.T) {
+	t.Parallel()
+	ds := []diagnosis{
+		{name: "go", result: "go1", ok: true},
+		{name: "GO111MODULE", result: `"off"`, hint: "unset it"},
+	}
+	out := newFakeFile()
+	ok, err := writeDiagnoses(ds, out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok {
+		t.Error("got: true, want: false")
+	}
+	want := "ok   go: go1\n" +
+		"FAIL GO111MODULE: \"off\"\n" +
+		"     hint: unset it\n"
+	if got := out.contents.String(); got != want {
+		t.Errorf(filesCmpErr, got, want)
+	}
+}
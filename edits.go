@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/looshch/gouse/internal/core"
+)
+
+// outputFormat is a format of reports of edits. It’s empty if toggling
+// commands print the toggled code and check and list print fake usages as
+// text.
+type outputFormat string
+
+const (
+	// outputJSON prints a fileEdits line per file.
+	outputJSON outputFormat = "json"
+	// outputSARIF prints a SARIF log of all files, see sarifReport.
+	outputSARIF outputFormat = "sarif"
+	// outputCodeQuality prints a GitLab Code Quality report of all files,
+	// see codeQualityReport.
+	outputCodeQuality outputFormat = "codequality"
+	// outputRDJSON prints a reviewdog diagnostic result of all files, see
+	// rdjsonReport.
+	outputRDJSON outputFormat = "rdjson"
+	// outputRDJSONL prints a reviewdog diagnostic per line, see
+	// rdjsonlEdits.
+	outputRDJSONL outputFormat = "rdjsonl"
+	// outputLSP prints an LSP WorkspaceEdit of all files, see lspReport.
+	outputLSP outputFormat = "lsp"
+	// outputVet prints diagnostics in the shape of ‘go vet -json’, see
+	// vetReport.
+	outputVet outputFormat = "vet"
+	// outputQuickfix prints a line per change in the format of compilers,
+	// see quickfixEdits.
+	outputQuickfix outputFormat = "quickfix"
+)
+
+func (f *outputFormat) String() string { return string(*f) }
+
+func (f *outputFormat) Set(s string) error {
+	switch outputFormat(s) {
+	case outputJSON, outputSARIF, outputCodeQuality, outputRDJSON,
+		outputRDJSONL, outputLSP, outputVet, outputQuickfix:
+		*f = outputFormat(s)
+		return nil
+	}
+	const want = "json, sarif, codequality, rdjson, rdjsonl, lsp, vet " +
+		"or quickfix"
+	return fmt.Errorf("unknown format %q, want %s", s, want)
+}
+
+// editsReporter reports changes to code of the file name.
+type editsReporter func(name string, code []byte, changes []core.Change) error
+
+// newReporter returns an editsReporter of the format f which writes to out and
+// a function which finishes the report, writing what it collected.
+func newReporter(f outputFormat, out file) (editsReporter, func() error) {
+	finish := func() error { return nil }
+	switch f {
+	case outputSARIF:
+		r := &sarifReport{}
+		return r.add, func() error { return r.write(out) }
+	case outputCodeQuality:
+		r := &codeQualityReport{}
+		return r.add, func() error { return r.write(out) }
+	case outputRDJSON:
+		r := &rdjsonReport{}
+		return r.add, func() error { return r.write(out) }
+	case outputRDJSONL:
+		return rdjsonlEdits(out), finish
+	case outputLSP:
+		r := &lspReport{}
+		return r.add, func() error { return r.write(out) }
+	case outputVet:
+		r := &vetReport{}
+		return r.add, func() error { return r.write(out) }
+	case outputQuickfix:
+		return quickfixEdits(out), finish
+	}
+	return jsonEdits(out), finish
+}
+
+// jsonEdits returns an editsReporter which writes a fileEdits line per file to
+// out.
+func jsonEdits(out file) editsReporter {
+	return func(name string, code []byte, changes []core.Change) error {
+		report := newFileEdits(name, code, changes)
+		if err := json.NewEncoder(out).Encode(report); err != nil {
+			format := "jsonEdits: in *Encoder.Encode: %v"
+			return fmt.Errorf(format, err)
+		}
+		return nil
+	}
+}
+
+// quickfixEdits returns an editsReporter which writes to out a line per change
+// in the format of compilers, ‘file:line:column: message’, so editors fill
+// their quickfix lists with it, e.g. Vim with ‘:cexpr system('gouse check
+// -format quickfix ./*.go')’. The column is the 1-based byte offset of the
+// change in its line.
+func quickfixEdits(out file) editsReporter {
+	const quickfixFormat = "%s:%d:%d: %s (%s %s)\n"
+	return func(name string, code []byte, changes []core.Change) error {
+		var b bytes.Buffer
+		for _, c := range changes {
+			lineStart := bytes.LastIndexByte(code[:c.Start], '\n')
+			// +1 is an adjustment for 1-based count; lineStart is
+			// the index of the previous line break, so the column
+			// is already 1-based.
+			fmt.Fprintf(
+				&b, quickfixFormat, name, c.LineNum+1,
+				c.Start-lineStart, c.Problem(), c.Action,
+				c.Kind,
+			)
+		}
+		if _, err := out.Write(b.Bytes()); err != nil {
+			format := "quickfixEdits: in *File.Write: %v"
+			return fmt.Errorf(format, err)
+		}
+		return nil
+	}
+}
+
+// fileEdits is a JSON report of edits toggle would make to a file.
+type fileEdits struct {
+	File  string `json:"file"`
+	Edits []edit `json:"edits"`
+}
+
+// edit is a JSON report of a change: Old, code[Start:End] in bytes, is
+// replaced with New.
+type edit struct {
+	Action string `json:"action"`
+	Name   string `json:"name"`
+	// Line is 1-based.
+	Line  int    `json:"line"`
+	Start int    `json:"start"`
+	End   int    `json:"end"`
+	Old   string `json:"old"`
+	New   string `json:"new"`
+}
+
+// newFileEdits returns a report of changes to code of the file name.
+func newFileEdits(name string, code []byte, changes []core.Change) fileEdits {
+	edits := make([]edit, len(changes))
+	for i, c := range changes {
+		edits[i] = edit{
+			Action: c.Action.String(),
+			Name:   c.Name,
+			// +1 is an adjustment for 1-based count.
+			Line:  c.LineNum + 1,
+			Start: c.Start,
+			End:   c.End,
+			Old:   string(code[c.Start:c.End]),
+			New:   c.Text,
+		}
+	}
+	return fileEdits{File: name, Edits: edits}
+}
+
+// editsFile takes code from in and reports edits toggle would make with opts to
+// the file name. If filter isn’t nil, only changes it returns are reported. It
+// returns the reported changes.
+func editsFile(
+	ctx context.Context,
+	opts core.Options,
+	name string,
+	in file,
+	report editsReporter,
+	filter changesFilter,
+) ([]core.Change, error) {
+	code, err := io.ReadAll(in)
+	if err != nil {
+		return nil, fmt.Errorf("editsFile: in io.ReadAll: %v", err)
+	}
+	changes, err := core.FindChanges(ctx, code, opts)
+	if err != nil {
+		return nil, fmt.Errorf("editsFile: %v", err)
+	}
+	if filter != nil {
+		changes, err = filter(code, changes)
+		if err != nil {
+			return nil, fmt.Errorf("editsFile: %v", err)
+		}
+	}
+	if err := report(name, code, changes); err != nil {
+		return nil, fmt.Errorf("editsFile: %v", err)
+	}
+	return changes, nil
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/looshch/gouse/internal/core"
+)
+
+func TestEditsFile(t *testing.T) {
+	ctx := context.Background()
+	ctx, cancel := context.WithCancel(ctx)
+	t.Cleanup(cancel)
+	const code = `package p
+
+func f() {
+	notUsed := 0
+}
+`
+	in := newFakeFile([]byte(code)...)
+	out := newFakeFile()
+	opts := core.Options{Mode: core.ModeAdd}
+	_, err := editsFile(ctx, opts, "p.go", in, jsonEdits(out), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got fileEdits
+	if err := json.Unmarshal(out.contents.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	want := fileEdits{File: "p.go", Edits: []edit{{
+		Action: "add",
+		Name:   "notUsed",
+		Line:   4,
+		Start:  35,
+		End:    35,
+		New:    "; _ = notUsed /* TODO: gouse */",
+	}}}
+	if len(got.Edits) != 1 || got.File != want.File ||
+		got.Edits[0] != want.Edits[0] {
+		t.Errorf("got: %+v, want: %+v", got, want)
+	}
+}
+
+func TestOutputFormatSet(t *testing.T) {
+	t.Parallel()
+	var f outputFormat
+	if err := f.Set("json"); err != nil || f != outputJSON {
+		t.Errorf("got: %s, %v, want: %s, nil", f, err, outputJSON)
+	}
+	if err := f.Set("xml"); err == nil {
+		t.Error("got: nil, want: error")
+	}
+}
+
+func TestQuickfixEdits(t *testing.T) {
+	t.Parallel()
+	const code = "package p\n\nfunc f(b int) {\n\ta := 0\n}\n"
+	changes := []core.Change{
+		{
+			Action:  core.ActionAdd,
+			Kind:    core.KindParam,
+			Name:    "b",
+			LineNum: 2,
+			Start:   18,
+			End:     19,
+		},
+		{
+			Action:  core.ActionAdd,
+			Name:    "a",
+			LineNum: 3,
+			Start:   34,
+			End:     34,
+		},
+	}
+	out := newFakeFile()
+	report := quickfixEdits(out)
+	if err := report("p.go", []byte(code), changes); err != nil {
+		t.Fatal(err)
+	}
+	const want = "p.go:3:8: unused parameter b (add renamed parameter)\n" +
+		"p.go:4:8: unused variable a (add fake usage)\n"
+	if got := out.contents.String(); got != want {
+		t.Errorf(filesCmpErr, got, want)
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// encoding is an encoding of Go files. Files in UTF-16, which some Windows
+// editors save, are transcoded to UTF-8 for toggling and back for writing.
+type encoding int
+
+const (
+	encodingUTF8 encoding = iota
+	encodingUTF16LE
+	encodingUTF16BE
+)
+
+var (
+	// bomUTF16LE and bomUTF16BE are byte order marks which UTF-16 files
+	// start with.
+	bomUTF16LE = []byte{0xff, 0xfe}
+	bomUTF16BE = []byte{0xfe, 0xff}
+)
+
+// errOddUTF16 is returned by decodeCode if a UTF-16 file has an odd number of
+// bytes.
+var errOddUTF16 = errors.New("UTF-16 code has an odd number of bytes")
+
+// decodeCode returns code in UTF-8 and its original encoding, told by the byte
+// order mark, which is dropped.
+func decodeCode(code []byte) ([]byte, encoding, error) {
+	var order binary.ByteOrder
+	var enc encoding
+	switch {
+	case bytes.HasPrefix(code, bomUTF16LE):
+		order, enc = binary.LittleEndian, encodingUTF16LE
+	case bytes.HasPrefix(code, bomUTF16BE):
+		order, enc = binary.BigEndian, encodingUTF16BE
+	default:
+		return code, encodingUTF8, nil
+	}
+	code = code[len(bomUTF16LE):]
+	if len(code)%2 != 0 {
+		return nil, 0, errOddUTF16
+	}
+	units := make([]uint16, len(code)/2)
+	for i := range units {
+		units[i] = order.Uint16(code[2*i:])
+	}
+	var decoded []byte
+	for _, r := range utf16.Decode(units) {
+		decoded = utf8.AppendRune(decoded, r)
+	}
+	return decoded, enc, nil
+}
+
+// encodeCode returns code in UTF-8 in the encoding enc, with the byte order
+// mark decodeCode dropped.
+func encodeCode(code []byte, enc encoding) []byte {
+	var order binary.AppendByteOrder
+	var encoded []byte
+	switch enc {
+	case encodingUTF16LE:
+		order, encoded = binary.LittleEndian, bytes.Clone(bomUTF16LE)
+	case encodingUTF16BE:
+		order, encoded = binary.BigEndian, bytes.Clone(bomUTF16BE)
+	default:
+		return code
+	}
+	for _, u := range utf16.Encode(bytes.Runes(code)) {
+		encoded = order.AppendUint16(encoded, u)
+	}
+	return encoded
+}
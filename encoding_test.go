@@ -0,0 +1,60 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestDecodeCode(t *testing.T) {
+	t.Parallel()
+	const code = "package p // ünicode 𝄞\n"
+	tests := []struct {
+		name    string
+		encoded []byte
+		want    encoding
+	}{
+		{"UTF-8", []byte(code), encodingUTF8},
+		{
+			"UTF-16LE",
+			encodeCode([]byte(code), encodingUTF16LE),
+			encodingUTF16LE,
+		},
+		{
+			"UTF-16BE",
+			encodeCode([]byte(code), encodingUTF16BE),
+			encodingUTF16BE,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			decoded, enc, err := decodeCode(tt.encoded)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if enc != tt.want {
+				t.Errorf("got: %d, want: %d", enc, tt.want)
+			}
+			if string(decoded) != code {
+				t.Errorf(filesCmpErr, decoded, code)
+			}
+			// Code is written back in its encoding.
+			got := encodeCode(decoded, enc)
+			if !bytes.Equal(got, tt.encoded) {
+				t.Errorf("got: %x, want: %x", got, tt.encoded)
+			}
+		})
+	}
+}
+
+func TestEncodeCode(t *testing.T) {
+	t.Parallel()
+	got := encodeCode([]byte("p\n"), encodingUTF16LE)
+	want := []byte{0xff, 0xfe, 'p', 0, '\n', 0}
+	if !bytes.Equal(got, want) {
+		t.Errorf("got: %x, want: %x", got, want)
+	}
+	if _, _, err := decodeCode(append(want, 0)); err == nil {
+		t.Error("got: nil, want: error")
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/looshch/gouse/internal/core"
+)
+
+// git runs git with args in the directory dir, passing stdin to it, and returns
+// its stdout.
+func git(
+	ctx context.Context, dir string, stdin []byte, args ...string,
+) ([]byte, error) {
+	args = append([]string{"-C", dir}, args...)
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Stdin = bytes.NewReader(stdin)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf(
+			"git: in *Cmd.Output: %v: %s",
+			err, bytes.TrimSpace(stderr.Bytes()),
+		)
+	}
+	return out, nil
+}
+
+// changedPaths returns tracked Go files in the directory dir which were
+// changed in the working tree since the merge base of the git revision rev and
+// HEAD and not deleted, relative to dir. If paths aren’t empty, only the ones
+// among them are returned.
+func changedPaths(
+	ctx context.Context, dir, rev string, paths []string,
+) ([]string, error) {
+	out, err := git(
+		ctx, dir, nil,
+		"diff", "--merge-base", "--name-only", "-z", "--no-renames",
+		"--diff-filter=d", "--relative", rev, "--", "*"+core.GoFileExt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("changedPaths: %v", err)
+	}
+	var changed []string
+	for _, p := range strings.Split(string(out), "\x00") {
+		if p == "" {
+			continue
+		}
+		p = filepath.FromSlash(p)
+		if len(paths) == 0 || containsPath(paths, p) {
+			changed = append(changed, p)
+		}
+	}
+	return changed, nil
+}
+
+// containsPath reports whether paths contain a path of the same file as p.
+func containsPath(paths []string, p string) bool {
+	for _, other := range paths {
+		if samePath(other, p) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestChangedPaths(t *testing.T) {
+	ctx := context.Background()
+	ctx, cancel := context.WithCancel(ctx)
+	t.Cleanup(cancel)
+	dir := t.TempDir()
+	gitRun := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("%v: %s", err, out)
+		}
+	}
+	write := func(name, contents string) {
+		t.Helper()
+		p := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(contents), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, name := range []string{"a.go", "b.go", "c.go", "d.txt"} {
+		write(name, "package main\n")
+	}
+	gitRun("init", "-q")
+	gitRun("add", ".")
+	gitRun(
+		"-c", "user.name=alice", "-c", "user.email=alice@example.com",
+		"commit", "-q", "-m", "init",
+	)
+	gitRun("tag", "base")
+	write("a.go", "package main\n\n// Changed.\n")
+	write("sub/e.go", "package sub\n")
+	write("d.txt", "changed\n")
+	gitRun("add", "sub/e.go")
+	gitRun("rm", "-q", "b.go")
+
+	tests := []struct {
+		paths []string
+		want  []string
+	}{
+		{want: []string{"a.go", filepath.Join("sub", "e.go")}},
+		{paths: []string{"a.go", "c.go"}, want: []string{"a.go"}},
+	}
+	for _, test := range tests {
+		got, err := changedPaths(ctx, dir, "base", test.paths)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("got: %v, want: %v", got, test.want)
+		}
+	}
+	if _, err := changedPaths(ctx, dir, "unknown", nil); err == nil {
+		t.Error("got: nil, want: error")
+	}
+}
@@ -1,3 +1,22 @@
 module github.com/looshch/gouse
 
 go 1.23.2
+
+require (
+	github.com/fsnotify/fsnotify v1.10.1
+	github.com/golangci/plugin-module-register v0.1.1
+	golang.org/x/mod v0.24.0
+	golang.org/x/term v0.30.0
+	golang.org/x/tools v0.31.0
+	google.golang.org/grpc v1.70.0
+	google.golang.org/protobuf v1.36.5
+)
+
+require (
+	github.com/gorilla/mux v1.8.1 // indirect
+	golang.org/x/net v0.37.0 // indirect
+	golang.org/x/sync v0.12.0 // indirect
+	golang.org/x/sys v0.31.0 // indirect
+	golang.org/x/text v0.23.0 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20241202173237-19429a94021a // indirect
+)
@@ -0,0 +1,71 @@
+// Package golangci registers gouse as a golangci-lint module plugin, so its
+// check of fake usages left in code runs with other linters.
+//
+// Build a custom golangci-lint with ‘golangci-lint custom’ and
+// .custom-gcl.yml:
+//
+//	version: v2.1.0
+//	plugins:
+//	  - module: github.com/looshch/gouse
+//	    import: github.com/looshch/gouse/golangci
+//	    version: latest
+//
+// and enable it in .golangci.yml:
+//
+//	linters:
+//	  enable:
+//	    - gouse
+//	  settings:
+//	    custom:
+//	      gouse:
+//	        type: module
+//	        settings:
+//	          unused: false
+//
+// golangci-lint reports type errors, including unused variables, itself, so
+// ‘unused’ setting, which adds suggested fixes creating fake usages for them,
+// is off by default.
+package golangci
+
+import (
+	"fmt"
+
+	"github.com/golangci/plugin-module-register/register"
+	"github.com/looshch/gouse/analyzer"
+	"golang.org/x/tools/go/analysis"
+)
+
+func init() { register.Plugin("gouse", New) }
+
+// Settings are settings of the plugin in .golangci.yml.
+type Settings struct {
+	// Unused makes gouse report unused variables too.
+	Unused bool `json:"unused"`
+}
+
+type plugin struct {
+	settings Settings
+}
+
+// New returns the plugin configured with settings from .golangci.yml.
+func New(settings any) (register.LinterPlugin, error) {
+	s, err := register.DecodeSettings[Settings](settings)
+	if err != nil {
+		format := "New: in register.DecodeSettings: %v"
+		return nil, fmt.Errorf(format, err)
+	}
+	return &plugin{settings: s}, nil
+}
+
+func (p *plugin) BuildAnalyzers() ([]*analysis.Analyzer, error) {
+	return []*analysis.Analyzer{analyzer.New(p.settings.Unused)}, nil
+}
+
+// GetLoadMode returns the load mode the analyzer needs: unused variables are
+// only known from type errors.
+func (p *plugin) GetLoadMode() string {
+	if p.settings.Unused {
+		return register.LoadModeTypesInfo
+	}
+	return register.LoadModeSyntax
+}
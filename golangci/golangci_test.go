@@ -0,0 +1,42 @@
+package golangci
+
+import (
+	"testing"
+
+	"github.com/golangci/plugin-module-register/register"
+)
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		settings any
+		loadMode string
+	}{
+		{settings: nil, loadMode: register.LoadModeSyntax},
+		{
+			settings: map[string]any{"unused": true},
+			loadMode: register.LoadModeTypesInfo,
+		},
+	}
+	for _, test := range tests {
+		p, err := New(test.settings)
+		if err != nil {
+			t.Fatal(err)
+		}
+		analyzers, err := p.BuildAnalyzers()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(analyzers) != 1 || analyzers[0].Name != "gouse" {
+			t.Errorf("got: %v, want: gouse analyzer", analyzers)
+		}
+		if got := p.GetLoadMode(); got != test.loadMode {
+			t.Errorf("got: %s, want: %s", got, test.loadMode)
+		}
+	}
+	if _, err := New(map[string]any{"unknown": true}); err == nil {
+		t.Error("got: nil, want: error")
+	}
+	if _, err := register.GetPlugin("gouse"); err != nil {
+		t.Error(err)
+	}
+}
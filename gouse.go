@@ -3,17 +3,452 @@
 //
 // Usage:
 //
-//	gouse [-w] [file paths...]
+//	gouse [toggle|add|remove] [flags] [file paths...]
+//	gouse check|list [flags] [file paths...]
+//	gouse audit [flags] [file paths or patterns...]
+//	gouse purge [flags] [file paths or patterns...]
+//	gouse report [flags] [file paths or patterns...]
+//	gouse undo [file paths...]
+//	gouse completion bash|zsh|fish|powershell
+//	gouse install-hook [-action strip|block] pre-commit
+//	gouse doctor
+//	gouse update
 //
 // By default, gouse accepts code from stdin or from a file provided as a path
 // argument and writes the toggled version to stdout. ‘-w’ flag writes the
 // result back to the file. If multiple paths provided, ‘-w’ flag is required.
+// A directory path stands for Go files directly in it, and ‘-’ stands for
+// stdin, so piped code can be toggled along with files in the given order; with
+// ‘-w’ flag, it’s written to stdout. A file given more than once, e.g. by
+// relative and absolute paths or via symbolic links, is taken once. A file
+// which fails doesn’t stop the others: failures are printed at the end,
+// prefixed with paths, along with how many and which files failed, and gouse
+// exits with status 1. With ‘-atomic’ flag, the files toggled are written back
+// only if none failed, and if writing one fails or gouse is interrupted, the
+// ones already written get their contents back.
+//
+// Unused imports are toggled along with unused variables: "fmt" becomes
+// _ "fmt" // TODO: gouse and is restored on removal. Names of named imports are
+// kept in the comment, like in // TODO: gouse as log, and restored too.
+//
+// Unused range variables are renamed to _ rather than used, keeping their names
+// in TODO comments, like in for i, _ /* TODO: gouse v */ := range xs, if
+// another variable of the range clause is used.
+// Unused labels are commented out, like in /* L: TODO: gouse */, and restored
+// on removal.
+//
+// Files in UTF-16 with a byte order mark, which some Windows editors save, are
+// toggled as UTF-8 and written back in UTF-16.
+//
+// gouse builds code in temporary directories named ‘gouse-<PID>-<random>’.
+// Ones left by killed runs are removed by the next run after a day, printing
+// each one.
+//
+// The commands are:
+//
+//	toggle
+//		remove fake usages if there are any and create them otherwise.
+//		It’s the default command.
+//	add
+//		only create fake usages, keeping existing ones.
+//	remove
+//		only remove fake usages.
+//	check
+//		print fake usages and exit with status 1 if there are any.
+//	list
+//		print fake usages.
+//	audit
+//		print fake usages older than ‘-max-age’, 30 days by default, and
+//		exit with status 1 if there are any. The age is taken from the
+//		date stamped with ‘-date’ flag or, if there is none, from git
+//		blame. Patterns like ‘./...’ match Go files in a directory and
+//		all its subdirectories; without paths, it’s ‘./...’.
+//	purge
+//		remove every fake usage, writing files back, print where they
+//		were and exit with status 1 if packages of changed files don’t
+//		build anymore, e.g. before a release. Patterns are accepted as
+//		in audit; without paths, it’s ‘./...’. Fake usages recorded
+//		with ‘-journal’ flag are removed exactly.
+//	report
+//		print a table of packages with the numbers of unused variables
+//		and fake usages in them and files with any, the packages which
+//		accumulate the most first, and the total. Patterns are accepted
+//		as in audit; without paths, it’s ‘./...’.
+//	undo
+//		remove fake usages recorded with ‘-journal’ flag by the last run
+//		which changed the files, keeping edits made since, and restore
+//		the rest of the files backed up with ‘-backup’ flag to their
+//		previous contents exactly, including permissions and line
+//		endings. Without paths, the last run with ‘-journal’ or, if
+//		there is none, with ‘-backup’ is undone.
+//	completion
+//		print a completion script of commands, their flags and Go file
+//		paths for the shell, e.g. ‘source <(gouse completion bash)’.
+//	install-hook
+//		install a git pre-commit hook which handles staged fake usages
+//		as ‘-action’ says: ‘strip’, the default, removes them from the
+//		commit and keeps them in the working tree, and ‘block’ aborts
+//		the commit. An existing hook is kept and run first.
+//	doctor
+//		check that the go command is reachable, print variables of go
+//		env which affect builds, toggle a sample back and forth and
+//		print hints on how to fix failed checks, exiting with status 1
+//		if there are any. Useful when gouse fails in a new environment.
+//	update
+//		replace the running executable with the latest released
+//		version if it’s newer. The go command builds it for the
+//		platform and verifies it against the checksum database.
+//
+// The flags of all commands but undo, completion, install-hook, doctor and
+// update are:
+//
+//	-since rev
+//		only take Go files changed since the merge base of the git
+//		revision and HEAD into account, e.g. ‘-since origin/main’, which
+//		keeps CI runs on large repositories fast. Without paths, all of
+//		them are taken.
+//	-filelist path
+//		also take paths listed in the file, one per line, skipping
+//		blank lines and comments starting with ‘#’, which works around
+//		OS limits of the arguments length with thousands of files.
+//	-exit-zero
+//		exit with status 0 even if there were errors or fake usages
+//		were found, still printing them to stderr, for editor pipelines
+//		which don’t replace the buffer otherwise.
+//	-r
+//		take Go files in subdirectories of directory paths too; without
+//		it, only Go files directly in them are taken.
+//	-include-vendor
+//		also take Go files in vendor directories with ‘-r’ flag and
+//		patterns; without it, they are skipped, so runs on a whole
+//		repository don’t edit third-party code.
+//	-include-testdata
+//		also take Go files in testdata directories with ‘-r’ flag and
+//		patterns; without it, they are skipped, as test fixtures are
+//		often broken on purpose.
+//	-0
+//		read paths from stdin, each ended with NUL, e.g. of ‘find
+//		-print0’, ignoring ‘-’ argument; check and list end every
+//		printed fake usage with NUL too, so paths with spaces and line
+//		breaks are safe.
+//	-log-format text|json
+//		print errors and other messages to stderr as text, by default,
+//		or as JSON lines with the level, error or info, the file being
+//		processed, if any, and the message, for editor wrappers and CI.
+//
+// The flags of check, list and audit are:
+//
+//	-max-age age
+//		only take fake usages which are older than age, e.g. ‘30d’ or
+//		‘12h’, into account. check and list only know the age of fake
+//		usages stamped with ‘-date’ flag.
+//	-format json|sarif|codequality|rdjson|rdjsonl|lsp|vet|quickfix
+//		print fake usages of check and list as edits removing them, in
+//		the format of the toggling flag below.
+//	-print0
+//		print only names of files with fake usages for check and list,
+//		each ended with NUL, like ‘find -print0’, for ‘xargs -0’.
+//
+// The flags of toggle, add and remove are:
+//
+//	-w
+//		write the result back to the file. It’s replaced atomically
+//		with a temporary file next to it, so it’s never half-written,
+//		keeping its mode and owner. The file is locked meanwhile, so
+//		concurrent runs, e.g. with ‘-watch’ flag, take turns. If the
+//		file changed since it was read, e.g. was saved by an editor, it
+//		isn’t overwritten and the run fails.
+//		Results of pipes, e.g. of process substitution, are printed,
+//		as they can’t be written back.
+//	-o path
+//		write the result to the path instead of stdout, so code from
+//		stdin or a read-only file can be toggled into a new file. It
+//		gets the mode of the input file, e.g. stays executable. It’s
+//		replaced only once the run succeeds, so a failed run leaves it
+//		as it was.
+//	-rcs
+//		print an RCS diff, the format of ‘diff -n’, of the result
+//		instead, which editors apply to a buffer in place, e.g. Emacs
+//		with go-mode.
+//	-cursor offsets
+//		print to stderr ‘cursor’ followed by the comma-separated byte
+//		offsets in the input, e.g. of cursors of an editor, moved to
+//		where they are in the result, so editors restore cursors
+//		exactly after replacing buffers. Offsets inside removed text
+//		move to its start, and text inserted at an offset goes after
+//		it. Only one file or stdin can be toggled.
+//	-format json|sarif|codequality|rdjson|rdjsonl|lsp|vet|quickfix
+//		print edits instead. json prints a JSON object per file with
+//		its path and a list of edits: the action, add or remove, the
+//		name of the variable, the line, byte offsets of the old text
+//		and the old and the new text. sarif prints a SARIF 2.1.0 log of
+//		all files for code scanning dashboards, e.g. of GitHub, with a
+//		result per edit and a fix making it. codequality prints a
+//		GitLab Code Quality report of all files for merge request
+//		widgets, with fingerprints which survive moving lines. rdjson
+//		and rdjsonl print reviewdog diagnostics with suggestions, all
+//		in one result or one per line, which reviewdog posts as review
+//		suggestions. lsp prints an LSP WorkspaceEdit of all files,
+//		lists of TextEdits keyed by file URIs, which editor plugins
+//		apply as is. vet prints diagnostics with suggested fixes in the
+//		shape of ‘go vet -json’, keyed by the import path of a package
+//		and ‘gouse’. quickfix prints a line per edit like compilers do,
+//		‘file:line:column: message’, which editors load into quickfix
+//		lists. Multiple paths are accepted too.
+//	-patch path
+//		write a unified diff of all files to the path instead, changing
+//		none of them, so the patch is reviewed and applied later with
+//		‘git apply’. Multiple paths are accepted too, but not stdin.
+//	-n
+//		print which fake usages would be added or removed and on which
+//		lines instead, writing nothing; multiple paths are accepted too.
+//	-i
+//		show every change with its context and ask whether to apply
+//		it: ‘y’ applies it, ‘n’ skips it, ‘a’ applies it and all later
+//		changes in the file, and ‘q’ skips it and all remaining changes.
+//	-tui
+//		list changes of all files full-screen with a preview of the
+//		one under the cursor: ‘j’ and ‘k’ move, space toggles, ‘a’ and
+//		‘n’ check all and none, enter applies checked changes and ‘q’
+//		aborts.
+//	-watch
+//		watch the files, or Go files directly in the directories, and
+//		create fake usages every time they change until interrupted.
+//		It never removes fake usages, otherwise every save would
+//		toggle them back and forth, and it implies ‘-w’.
+//	-lsp
+//		serve the Language Server Protocol over stdin and stdout: open
+//		documents get a ‘Toggle unused variables’ code action, whose
+//		WorkspaceEdit the editor applies, a quick fix per variable,
+//		titled like suggested fixes of gouse-analyzer, and diagnostics
+//		of their fake usages. Other flags set how documents are
+//		toggled.
+//	-gopls-proxy[=path]
+//		run gopls at the path, or from PATH without it, with paths as
+//		its arguments and pass LSP messages between the client on stdin
+//		and stdout and it, adding the code actions and diagnostics of
+//		‘-lsp’ flag to the ones of gopls, so editors running gouse
+//		instead of gopls get them without changing their gopls setup.
+//		Documents are synced in full, so gouse knows their contents.
+//	-rpc
+//		serve JSON-RPC 2.0 over stdin and stdout, a message per line,
+//		for editor plugins: ‘toggle’ and ‘removeAll’ take ‘{"code":
+//		"..."}’ and return the code toggled, or without fake usages,
+//		and how many were changed, and ‘check’ returns lines and names
+//		of fake usages. ‘"path"’ sets the file .editorconfig files are
+//		looked up for. Other flags set how code is toggled.
+//	-serve address
+//		serve HTTP on the address, e.g. ‘:8080’, until interrupted:
+//		POST /toggle responds with Go source from the body toggled, and
+//		the number of changes in X-Gouse-Changes header. Query
+//		parameters ‘mode’ (toggle, add or remove), ‘strategy’ and
+//		‘placement’ override the flags, and ‘filename’ sets the file
+//		.editorconfig files are looked up for. Bodies over
+//		‘-max-file-size’ are refused. GET /healthz responds with ‘ok’,
+//		and GET /metrics with metrics, like of ‘-metrics’ flag.
+//	-serve-playground address
+//		serve HTTP on the address like ‘-serve’ flag, and on GET / a
+//		web UI for demos and teaching: Go source typed in the input
+//		pane is toggled in the output pane, with created and removed
+//		lines highlighted, and selects of the mode, strategy and
+//		placement.
+//	-grpc address
+//		serve gRPC on the address until interrupted: Toggle, Check and
+//		Purge of the gouse.v1.Gouse service in gousepb/gouse.proto take
+//		Go source streamed in chunks with options like of ‘-serve’
+//		flag and other files of the package to build with, and Toggle
+//		and Purge stream back the result and its edits. Sources over
+//		‘-max-file-size’ are refused. Package gousepb has client stubs.
+//	-remote address
+//		find changes on a server of ‘-grpc’ flag on the address, e.g.
+//		in a dev container with the right toolchain and module cache,
+//		instead of building code locally, and apply them locally.
+//		Files are streamed to the server, with the other files of the
+//		archive with ‘-txtar’ flag, and the mode of ‘add’ and ‘remove’
+//		commands, ‘-strategy’ and ‘-placement’ are sent along; other
+//		options, and the mode otherwise, are the flags of the server.
+//		The connection isn’t encrypted or authenticated, so the
+//		address must be of a trusted server on the machine, e.g. a
+//		forwarded port of a dev container.
+//	-daemon
+//		listen on a Unix socket under the user cache directory and run
+//		gouse for clients with ‘-client’ flag one at a time, in their
+//		working directories, until interrupted, so editor save hooks
+//		don’t start gouse every time. Runs have the environment of the
+//		daemon, not of clients, e.g. GOFLAGS, GOOS, GOARCH and GOPATH,
+//		so it’s to be started in the environment runs build with.
+//		Runs which are interactive or don’t exit on their own, e.g.
+//		with ‘-watch’ or ‘-grpc’ flag, are refused. Builds of code are
+//		cached in memory by contents of the file, files built with it,
+//		go.mod and go.sum of the module and the build environment, so
+//		unchanged code isn’t built again, and changed code is. Package
+//		github.com/looshch/gouse/client is a client of it for tools.
+//	-metrics address
+//		with ‘-daemon’ or ‘-grpc’ flag, serve GET /metrics on the
+//		address with Prometheus metrics of requests: counts of served
+//		and failed ones, created and removed fake usages, builds taken
+//		from the cache, and a latency histogram. Daemon runs exiting
+//		with non-zero status count as failed.
+//	-client
+//		forward the run with the other flags and paths, and stdin if
+//		it’s read, to the daemon, and print its output. Only the
+//		working directory is forwarded along, so the run has the
+//		environment of the daemon, and it may toggle differently from
+//		a run without ‘-client’ flag in a shell with e.g. other
+//		GOFLAGS or GOOS.
+//	-stats[=json]
+//		print to stderr how many files were changed and how many fake
+//		usages were added and removed, either as text or as JSON.
+//	-date
+//		stamp created fake usages with the current date, e.g.
+//		‘/* TODO: gouse 2024-06-01 */’, so ‘-max-age’ flag of check and
+//		list can find expired ones.
+//	-author[=name]
+//		stamp created fake usages with the name, e.g.
+//		‘/* TODO(alice): gouse */’, so reviewers can see who parked
+//		the variable. Without the name, git config user.name is used.
+//	-max-errors n
+//		create at most n fake usages per file, top-down, and print how
+//		many were skipped.
+//	-max-toggles n
+//		make at most n changes in all files, in order, so cleanups of
+//		a tree can be done in reviewable chunks, and print the file
+//		and the line where it stopped.
+//	-max-file-size size
+//		skip files larger than size, e.g. ‘512KB’ or ‘20MB’, with a
+//		warning, as toggling multi-megabyte generated files takes long.
+//		It’s 5MB by default, and 0 means no limit.
+//	-backup
+//		with ‘-w’ flag, back up files under the user cache directory
+//		before writing them back, so ‘gouse undo’ can restore them.
+//	-journal
+//		with ‘-w’ flag, record every created fake usage, its position
+//		and the hash of the file in a journal under the user cache
+//		directory, so ‘gouse undo’ and ‘gouse purge’ can remove it
+//		exactly even after unrelated edits shifted it.
+//	-preserve-mtime[=same|always]
+//		with ‘-w’ flag, give a file written back the modification time
+//		it had with the same contents, e.g. before fake usages were
+//		removed and added back, so make and other tools which compare
+//		times don’t rebuild; the times are kept under the user cache
+//		directory. With ‘always’, every file keeps its time.
+//	-no-follow-symlinks
+//		with ‘-w’ flag, refuse to write back files which are symbolic
+//		links. By default, the files they point to are written back and
+//		the links are kept.
+//	-force
+//		with ‘-w’ flag, write back read-only files, e.g. checked out
+//		by some version control systems: make them writable for the
+//		owner, write them and restore their modes, printing both steps.
+//	-atomic
+//		with ‘-w’ flag, toggle all files before writing any back, and
+//		write none if any failed. If writing fails or is interrupted,
+//		files already written are rolled back, printing each one.
+//	-diff-filter
+//		read a unified diff, e.g. of git diff, from stdin and only add
+//		or remove fake usages on lines it adds or changes. Without
+//		paths, files from the diff are toggled.
+//	-staged
+//		toggle the staged contents of Go files in the git index
+//		instead of files and stage the results, leaving the working
+//		tree intact, e.g. ‘gouse remove -staged’ in a pre-commit hook.
+//		‘-n’ and ‘-i’ flags are accepted too.
+//	-strategy use|comment|delete
+//		how unused variables are handled: ‘use’, the default, creates
+//		fake usages, ‘comment’ comments out their declarations, and
+//		‘delete’ deletes them, leaving a TODO comment with the quoted
+//		code. Removal restores the declarations. Only declarations
+//		which take a line of their own and whose variables aren’t
+//		assigned later are commented out or deleted; others get fake
+//		usages.
+//	-backend build|typecheck
+//		how unused variables are found: ‘build’, the default, builds
+//		the input with the go command and takes them from build errors,
+//		and ‘typecheck’ type-checks it in process without resolving
+//		imports, so it needs no go command, module cache or network but
+//		misses errors only full builds report. It’s the default of the
+//		WebAssembly builds, which have no go command.
+//	-adopt
+//		also remove hand-written ‘_ = x’ statements, which have no TODO
+//		comment, if x is declared in the same function and has no
+//		other use.
+//	-number
+//		stamp every created fake usage with an ID following the
+//		greatest one in the file, e.g. ‘/* TODO: gouse#3 */’, which
+//		list prints.
+//	-params
+//		also rename parameters which bodies of their functions don’t
+//		reference to ‘_’, keeping their names in TODO comments, e.g.
+//		‘_ /* TODO: gouse ctx */’. Removal restores the names.
+//	-receivers
+//		also rename receivers which bodies of their methods don’t
+//		reference to ‘_’ like ‘-params’ does parameters, e.g. while
+//		methods are stubbed out.
+//	-results
+//		also assign results of calls which are statements of their
+//		own to ‘_’, like ‘_, _ = f() /* TODO: gouse results */’, e.g.
+//		while code is sketched before errors are handled. Only calls
+//		whose results are known from packages found by the go command
+//		are taken. Removal restores the calls.
+//	-id n
+//		only apply changes of the fake usage with the ID n, e.g.
+//		‘gouse remove -id 3 main.go’ removes only it.
+//	-placement line|function
+//		where fake usages are created: ‘line’, the default, creates
+//		them at the ends of lines of their variables, and ‘function’
+//		gathers the ones of variables declared in the top-level scope
+//		of a function into one statement like ‘_, _ = a, b’ at the end
+//		of its body or, if the function has results, before its last
+//		statement, keeping declaration lines clean. The statement is
+//		indented and ended as .editorconfig files of the file say, with
+//		indent_style, indent_size and end_of_line.
+//	-txtar
+//		read a txtar archive from stdin, toggle every Go file in it in
+//		the context of other Go files in its directory and write the
+//		toggled archive to stdout, so editors can toggle several
+//		buffers at once without touching disk.
+//	-selection
+//		read a selection from stdin, e.g. piped by Kakoune or Helix,
+//		and write to stdout only the selection toggled in the context
+//		of the file of ‘-stdin-filename’ flag as saved, never the whole
+//		file. Fake usages are removed if the selection has any and
+//		created for variables declared in it otherwise; changes outside
+//		the selection are dropped, so its indentation is kept.
+//	-acme
+//		‘-selection’ with the file in $samfile, which Acme sets, for
+//		‘Edit |gouse -acme’.
+//	-stdin-filename path
+//		name code from stdin after the file it’s from in messages and
+//		reports, look .editorconfig files up for it and, with
+//		‘-selection’, take the file as the context of the selection.
+//	-v
+//		print the version, the Go version gouse was built with and,
+//		if built from a checkout, the VCS revision, its time and
+//		whether the working tree was modified.
+//
+// gouse also builds for WebAssembly. ‘GOOS=wasip1 GOARCH=wasm go build’ makes a
+// command for WASI runtimes, e.g. ‘wasmtime gouse.wasm < main.go’, and
+// ‘GOOS=js GOARCH=wasm go build’ makes a module for browsers and Node.js which,
+// run with wasm_exec.js of the Go distribution, sets globalThis.gouse.toggle to
+// a function of the source and an object of mode, strategy and placement
+// strings, like the fields of ‘-serve’ requests, returning an object of the
+// toggled code and changes, like edits of ‘-format json’, or of error. Both use
+// ‘-backend typecheck’.
+//
+// Other tools can toggle code with package github.com/looshch/gouse/toggle,
+// whose options are like the flags.
 //
 // First it tries to remove previously created fake usages. If there is nothing
 // to remove, it tries to build an input and checks the build stdout for
 // ‘declared and not used’ errors. If there is any, it creates fake usages for
 // unused variables from the errors.
 //
+// A ‘//gouse:ignore’ comment on or above the line of a declaration makes gouse
+// never create fake usages for variables declared there, so deliberately
+// unused ones keep producing compiler errors. A ‘//gouse:file ignore’ comment
+// on a line of its own before the package clause excludes the whole file from
+// toggling, e.g. a generated one.
+//
 // Examples
 //
 //	$ gouse
@@ -39,6 +474,20 @@
 //	...
 //	notUsedFromCore = true; _ = notUsedFromCore /* TODO: gouse */
 //	...
+//
+//	$ gouse -o main_toggled.go main.go
+//	$ cat main_toggled.go
+//	...
+//	notUsed = true; _ = notUsed /* TODO: gouse */
+//	...
+//
+//	$ gouse -n main.go io.go
+//	main.go:12: add fake usage of notUsedFromMain
+//	io.go:7: remove fake usage of notUsedFromIo
+//
+//	$ gouse check main.go io.go
+//	io.go:7: fake usage of notUsedFromIo
+//	error: found 1 fake usages
 package main
 
 import (
@@ -46,45 +495,185 @@ import (
 	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"runtime/debug"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/looshch/gouse/client"
+	"github.com/looshch/gouse/internal/core"
 )
 
 const (
 	errorLogPrefix = "error: "
 	logFlag        = 0
 	currentVersion = "1.3.2"
+
+	fakeUsagesLeftFormat    = "found %d fake usages"
+	failedFilesFormat       = "failed to toggle %d of %d files: %s"
+	madeWritableFormat      = "made read-only %s writable to write it back"
+	modeRestoredFormat      = "restored mode %v of %s"
+	nothingWrittenFormat    = "wrote back none of %d toggled files"
+	rolledBackFormat        = "rolled back %s"
+	expiredFakeUsagesFormat = "found %d fake usages older than %s"
+	hookInstalledFormat     = "installed %s hook to %s"
+	purgedFakeUsagesFormat  = "removed %d fake usages"
+	restoredFormat          = "restored %s"
+	upToDateFormat          = "gouse %s is up to date, the latest is %s"
+	updatedFormat           = "updated gouse from %s to %s at %s"
+	staleTempDirFormat      = "removed stale temporary directory %s"
+	listeningFormat         = "listening on %s"
+	cursorFormat            = "cursor %s"
 )
 
 var (
 	errCannotWriteToStdin = errors.New(
 		"cannot use ‘-w’ flag with standard input",
 	)
-	errMustWriteToFiles   = errors.New(
+	errMustWriteToFiles = errors.New(
 		"must use ‘-w’ flag with more than one path",
 	)
+	errDryRunWithWrite = errors.New(
+		"cannot use ‘-n’ flag with ‘-w’ flag",
+	)
+	errInteractiveWithStdin = errors.New(
+		"cannot use ‘-i’ flag with standard input",
+	)
+	errInteractiveWithDryRun = errors.New(
+		"cannot use ‘-i’ flag with ‘-n’ flag",
+	)
+	errTUIWithStdin = errors.New(
+		"cannot use ‘-tui’ flag with standard input",
+	)
+	errTUIWithOtherModes = errors.New(
+		"cannot use ‘-tui’ flag with ‘-n’ or ‘-i’ flag",
+	)
+	errOutputWithOtherModes = errors.New(
+		"cannot use ‘-o’ flag with ‘-w’ or ‘-n’ flag",
+	)
+	errOutputIsInput = errors.New(
+		"‘-o’ path is the input path, use ‘-w’ flag instead",
+	)
+	errWatchWithStdin = errors.New(
+		"cannot use ‘-watch’ flag with standard input",
+	)
+	errWatchWithOtherModes = errors.New(
+		"cannot use ‘-watch’ flag with other flags or remove command",
+	)
+	errDaemonWithOtherModes = errors.New(
+		"cannot use ‘-daemon’ or ‘-client’ flag with each other or " +
+			"‘-i’, ‘-tui’, ‘-watch’, ‘-lsp’, ‘-gopls-proxy’, " +
+			"‘-rpc’, ‘-serve’, ‘-serve-playground’ and ‘-grpc’ " +
+			"flags",
+	)
+	errDaemonRefusedRun = errors.New(
+		"the daemon doesn’t run ‘-daemon’, ‘-client’, ‘-i’, ‘-tui’, " +
+			"‘-watch’, ‘-lsp’, ‘-gopls-proxy’, ‘-rpc’, ‘-serve’, " +
+			"‘-serve-playground’ and ‘-grpc’ flags",
+	)
+	errMetricsWithoutServer = errors.New(
+		"cannot use ‘-metrics’ flag without ‘-daemon’ or ‘-grpc’ flag",
+	)
+	errServerWithOtherModes = errors.New(
+		"cannot use ‘-lsp’, ‘-gopls-proxy’, ‘-rpc’, ‘-serve’, " +
+			"‘-serve-playground’ or ‘-grpc’ flag with each " +
+			"other, file paths or other flags",
+	)
+	errTxtarWithOtherModes = errors.New(
+		"cannot use ‘-txtar’ flag with paths or other modes",
+	)
+	errDiffFilterWithOtherModes = errors.New(
+		"cannot use ‘-diff-filter’ flag with ‘-i’, ‘-txtar’ or " +
+			"‘-watch’ flag",
+	)
+	errStagedWithOtherModes = errors.New(
+		"cannot use ‘-staged’ flag with paths or other modes",
+	)
+	errCompletionNeedsShell = errors.New(
+		"completion needs one shell: bash, zsh, fish or powershell",
+	)
+	errInstallHookNeedsHook = errors.New(
+		"install-hook needs one hook: pre-commit",
+	)
+	errRCSWithOtherModes = errors.New(
+		"cannot use ‘-rcs’ flag with more than one path or with " +
+			"‘-w’, ‘-n’, ‘-tui’, ‘-txtar’ or ‘-staged’ flag",
+	)
+	errCursorWithOtherModes = errors.New(
+		"cannot use ‘-cursor’ flag with more than one path or with " +
+			"‘-n’, ‘-tui’, ‘-rcs’, ‘-format’, ‘-patch’, " +
+			"‘-watch’, ‘-txtar’ or ‘-staged’ flag",
+	)
+	errSelectionWithOtherModes = errors.New(
+		"cannot use ‘-selection’ or ‘-acme’ flag with paths or other " +
+			"modes",
+	)
+	errSelectionWithoutFile = errors.New(
+		"cannot use ‘-selection’ flag without ‘-stdin-filename’ flag",
+	)
+	errStdinFilenameWithPaths = errors.New(
+		"cannot use ‘-stdin-filename’ flag with paths",
+	)
+	errAcmeWithoutFile = errors.New(
+		"cannot use ‘-acme’ flag without $" + acmeFileEnv +
+			", run it from Acme",
+	)
+	errFormatWithOtherModes = errors.New(
+		"cannot use ‘-format’ flag with ‘-w’, ‘-n’, ‘-tui’, ‘-rcs’, " +
+			"‘-txtar’ or ‘-staged’ flag",
+	)
+	errPatchWithOtherModes = errors.New(
+		"cannot use ‘-patch’ flag with ‘-w’, ‘-n’, ‘-tui’, ‘-o’, " +
+			"‘-rcs’, ‘-format’, ‘-txtar’ or ‘-staged’ flag",
+	)
+	errPatchWithStdin = errors.New(
+		"cannot use ‘-patch’ flag with standard input",
+	)
+	errPrint0WithFormat = errors.New(
+		"cannot use ‘-print0’ flag with ‘-format’ flag",
+	)
+	errStdinPathRepeated = errors.New(
+		"cannot use ‘-’ path more than once",
+	)
 )
 
-func main() {
-	ctx := context.Background()
-	os.Exit(run(
-		ctx,
-		os.Args[1:],
-		os.Stdin, os.Stdout, os.Stderr,
-
-		openFile,
-	))
+// version returns the version of gouse followed by details of the build
+// which make bug reports actionable: the Go version gouse was built with, VCS
+// revision and time, and whether the working tree was modified. ok is false if
+// the details aren’t available, and then only currentVersion is returned.
+func version(info *debug.BuildInfo, ok bool) string {
+	if !ok {
+		return currentVersion
+	}
+	v := currentVersion
+	// Binaries built from a checkout have no module version.
+	if mv := info.Main.Version; mv != "" && mv != "(devel)" {
+		v = strings.TrimPrefix(mv, "v")
+	}
+	lines := []string{v, "go: " + info.GoVersion}
+	for _, s := range info.Settings {
+		switch s.Key {
+		case "vcs.revision", "vcs.time", "vcs.modified":
+			lines = append(lines, s.Key+": "+s.Value)
+		}
+	}
+	return strings.Join(lines, "\n")
 }
 
-// run manages logging, parses arguments and toggles the passed files.
+// run manages logging, parses arguments and either toggles the passed files,
+// lists fake usages in them or prints a completion script.
 func run(
 	ctx context.Context,
 	args []string,
 	stdin, stdout, stderr file,
 
 	openFile osOpenFile,
-) int {
+) (status int) {
 	ctx, cancel := signal.NotifyContext(ctx, os.Interrupt, os.Kill)
 	defer cancel()
 
@@ -101,48 +690,1090 @@ func run(
 		)
 		return 1
 	}
+	// Paths of ‘-gopls-proxy’ flag are arguments of gopls, which aren’t
+	// expanded like paths.
+	goplsArgs := slices.Clone(conf.paths)
+	logs := &jsonLog{out: stderr}
+	if conf.logFormat == logJSON {
+		errorLog = logs.logger(levelError)
+		infoLog = logs.logger(levelInfo)
+	}
+	// Errors are still printed to stderr.
+	if conf.exitZero {
+		defer func() { status = 0 }()
+	}
 
 	if conf.version {
-		infoLog.Print(currentVersion)
+		infoLog.Print(version(debug.ReadBuildInfo()))
 		return 0
 	}
 
+	if conf.metrics != "" && !conf.daemon && conf.grpc == "" {
+		errorLog.Print(errMetricsWithoutServer)
+		return 1
+	}
+	m := newMetrics()
+	// serveMetricsOf serves m on the address of ‘-metrics’ flag, if any,
+	// meanwhile a server which doesn’t speak HTTP runs.
+	serveMetricsOf := func() {
+		if conf.metrics == "" {
+			return
+		}
+		go func() {
+			// Without metrics requests are still served.
+			err := serveMetrics(ctx, conf.metrics, m, infoLog)
+			if err != nil {
+				errorLog.Print(err)
+			}
+		}()
+	}
+	if conf.daemon || conf.client {
+		// Forwarded runs have no terminal and can’t be long-running.
+		if conf.daemon && conf.client || longRunning(conf) {
+			errorLog.Print(errDaemonWithOtherModes)
+			return 1
+		}
+		path, err := client.DefaultSocketPath()
+		if err != nil {
+			errorLog.Print(err)
+			return 1
+		}
+		if conf.daemon {
+			forwarded := func(
+				ctx context.Context,
+				args []string,
+				stdin, stdout, stderr file,
+			) int {
+				return run(
+					ctx, args, stdin, stdout, stderr,
+					openFile,
+				)
+			}
+			serveMetricsOf()
+			err := serveDaemon(
+				ctx, path, forwarded, m, infoLog, errorLog,
+			)
+			if err != nil {
+				errorLog.Print(err)
+				return 1
+			}
+			return 0
+		}
+		req := client.Request{Args: clientArgs(args)}
+		req.Dir, err = os.Getwd()
+		if err != nil {
+			errorLog.Print(err)
+			return 1
+		}
+		// Only code and paths are read from stdin, which may be a
+		// terminal otherwise.
+		if !slices.Contains(noFileCommands, conf.command) &&
+			(len(conf.paths) == 0 ||
+				slices.Contains(conf.paths, stdinPath) ||
+				conf.nul || conf.diffFilter || conf.txtar) {
+			req.Stdin, err = io.ReadAll(stdin)
+			if err != nil {
+				errorLog.Print(err)
+				return 1
+			}
+		}
+		// Runs on many files may take long, and an interrupt stops
+		// waiting for the daemon.
+		c := client.New(path, client.WithTimeout(0))
+		defer c.Close()
+		resp, err := c.Run(ctx, req)
+		if err != nil {
+			errorLog.Print(err)
+			return 1
+		}
+		stdout.Write(resp.Stdout)
+		stderr.Write(resp.Stderr)
+		return resp.Status
+	}
+	// Temporary directories of killed runs would be left forever. Only
+	// builds make them, and there may be no temporary directory to clean
+	// up where the go command doesn’t run.
+	if conf.backend == core.BackendBuild {
+		removed, err := core.RemoveStaleTempDirs(
+			os.TempDir(), time.Now(), core.StaleTempDirAge,
+		)
+		for _, p := range removed {
+			infoLog.Printf(staleTempDirFormat, p)
+		}
+		// Cleaning up is no reason to fail the run.
+		if err != nil {
+			errorLog.Print(err)
+		}
+	}
+
+	if conf.filelist != "" {
+		paths, err := readFileList(conf.filelist, openFile)
+		if err != nil {
+			errorLog.Print(err)
+			return 1
+		}
+		conf.paths = append(conf.paths, paths...)
+		// Otherwise stdin would be read.
+		if len(conf.paths) == 0 {
+			return 0
+		}
+	}
+	if conf.nul {
+		paths, err := readNULPaths(stdin)
+		if err != nil {
+			errorLog.Print(err)
+			return 1
+		}
+		// ‘-’ only stands for stdin the paths are read from.
+		conf.paths = slices.DeleteFunc(conf.paths, func(p string) bool {
+			return p == stdinPath
+		})
+		conf.paths = append(conf.paths, paths...)
+		// Otherwise stdin would be read.
+		if len(conf.paths) == 0 {
+			return 0
+		}
+	}
+	skipped := skippedDirs(conf)
+	conf.paths, err = expandDirs(conf.paths, conf.recursive, skipped)
+	if err != nil {
+		errorLog.Print(err)
+		return 1
+	}
+	conf.paths = dedupePaths(conf.paths)
+	// audit and purge restrict paths after expanding patterns.
+	if conf.since != "" && conf.command != commandAudit &&
+		conf.command != commandPurge && conf.command != commandReport {
+		withStdin := slices.Contains(conf.paths, stdinPath)
+		conf.paths, err = changedPaths(
+			ctx, ".", conf.since, conf.paths,
+		)
+		if err != nil {
+			errorLog.Print(err)
+			return 1
+		}
+		// Code from stdin isn’t tracked, so it’s always taken.
+		if withStdin {
+			conf.paths = append(conf.paths, stdinPath)
+		}
+		// Otherwise stdin would be read.
+		if len(conf.paths) == 0 {
+			return 0
+		}
+	}
+
+	// Stdin can only be read once.
+	if n := countPath(conf.paths, stdinPath); n > 1 {
+		errorLog.Print(errStdinPathRepeated)
+		return 1
+	}
+	// Alone, ‘-’ is the same as no paths.
+	if len(conf.paths) == 1 && conf.paths[0] == stdinPath {
+		conf.paths = nil
+	}
+	// fromStdin reports whether code is read from stdin among files.
+	fromStdin := slices.Contains(conf.paths, stdinPath)
+
+	switch conf.command {
+	case commandCheck, commandList:
+		var expiredBefore string
+		if conf.maxAge > 0 {
+			expiredBefore = time.Now().
+				Add(-time.Duration(conf.maxAge)).
+				Format(core.DateLayout)
+		}
+		var terminator byte = lineTerminator
+		if conf.nul {
+			terminator = nulTerminator
+		}
+		var report editsReporter
+		finishReport := func() error { return nil }
+		if conf.format != "" {
+			report, finishReport = newReporter(conf.format, stdout)
+		}
+		if conf.print0 {
+			if conf.format != "" {
+				errorLog.Print(errPrint0WithFormat)
+				return 1
+			}
+			report = fileNames(stdout)
+		}
+		n, err := listFiles(
+			conf.paths,
+			expiredBefore,
+			terminator,
+			report,
+			stdin,
+			stdout,
+			openFile,
+		)
+		if err == nil {
+			err = finishReport()
+		}
+		if err != nil {
+			errorLog.Print(err)
+			return 1
+		}
+		if conf.command == commandCheck && n > 0 {
+			errorLog.Printf(fakeUsagesLeftFormat, n)
+			return 1
+		}
+		return 0
+	case commandAudit, commandPurge, commandReport:
+		patterns := conf.paths
+		if len(patterns) == 0 {
+			patterns = []string{"./" + recursivePatternSuffix}
+		}
+		paths, err := expandPatterns(patterns, skipped)
+		if err != nil {
+			errorLog.Print(err)
+			return 1
+		}
+		paths = dedupePaths(paths)
+		if conf.since != "" {
+			paths, err = changedPaths(
+				ctx, ".", conf.since, paths,
+			)
+			if err != nil {
+				errorLog.Print(err)
+				return 1
+			}
+		}
+		if conf.command == commandReport {
+			reports, err := reportPackages(ctx, paths, openFile)
+			if err == nil {
+				err = writePackageReports(reports, stdout)
+			}
+			if err != nil {
+				errorLog.Print(err)
+				return 1
+			}
+			return 0
+		}
+		if conf.command == commandPurge {
+			journalPath, err := defaultJournalPath()
+			if err != nil {
+				errorLog.Print(err)
+				return 1
+			}
+			dirs, n, err := purgeFiles(
+				ctx, paths, journalPath, stdout, openFile,
+			)
+			if err != nil {
+				errorLog.Print(err)
+				return 1
+			}
+			infoLog.Printf(purgedFakeUsagesFormat, n)
+			if err := buildDirs(ctx, dirs); err != nil {
+				errorLog.Print(err)
+				return 1
+			}
+			return 0
+		}
+		maxAge := time.Duration(conf.maxAge)
+		n, err := auditFiles(
+			ctx, paths, maxAge, time.Now(), stdout, openFile,
+		)
+		if err != nil {
+			errorLog.Print(err)
+			return 1
+		}
+		if n > 0 {
+			maxAge := &conf.maxAge
+			errorLog.Printf(expiredFakeUsagesFormat, n, maxAge)
+			return 1
+		}
+		return 0
+	case commandInstallHook:
+		if len(conf.paths) != 1 {
+			errorLog.Print(errInstallHookNeedsHook)
+			return 1
+		}
+		p, err := installHook(
+			ctx, ".", conf.paths[0], conf.hookAction,
+		)
+		if err != nil {
+			errorLog.Print(err)
+			return 1
+		}
+		infoLog.Printf(hookInstalledFormat, conf.paths[0], p)
+		return 0
+	case commandUndo:
+		dir, err := defaultBackupDir()
+		if err != nil {
+			errorLog.Print(err)
+			return 1
+		}
+		journalPath, err := defaultJournalPath()
+		if err != nil {
+			errorLog.Print(err)
+			return 1
+		}
+		undone, err := undoFiles(dir, journalPath, conf.paths)
+		for _, p := range undone {
+			infoLog.Printf(restoredFormat, p)
+		}
+		if err != nil {
+			errorLog.Print(err)
+			return 1
+		}
+		return 0
+	case commandDoctor:
+		ok, err := writeDiagnoses(diagnose(ctx), stdout)
+		if err != nil {
+			errorLog.Print(err)
+			return 1
+		}
+		if !ok {
+			return 1
+		}
+		return 0
+	case commandUpdate:
+		exe, err := os.Executable()
+		if err == nil {
+			exe, err = filepath.EvalSymlinks(exe)
+		}
+		if err != nil {
+			errorLog.Print(err)
+			return 1
+		}
+		var mv string
+		if info, ok := debug.ReadBuildInfo(); ok {
+			mv = info.Main.Version
+		}
+		current := moduleVersion(mv)
+		latest, updated, err := update(ctx, current, exe)
+		if err != nil {
+			errorLog.Print(err)
+			return 1
+		}
+		if !updated {
+			infoLog.Printf(upToDateFormat, current, latest)
+			return 0
+		}
+		infoLog.Printf(updatedFormat, current, latest, exe)
+		return 0
+	case commandCompletion:
+		if len(conf.paths) != 1 {
+			errorLog.Print(errCompletionNeedsShell)
+			return 1
+		}
+		if err := writeCompletion(conf.paths[0], stdout); err != nil {
+			errorLog.Print(err)
+			return 1
+		}
+		return 0
+	}
+	opts := core.Options{
+		Mode:      modes[conf.command],
+		Strategy:  conf.strategy,
+		Backend:   conf.backend,
+		Adopt:     conf.adopt,
+		Number:    conf.number,
+		Params:    conf.params,
+		Receivers: conf.receivers,
+		Results:   conf.results,
+		Placement: conf.placement,
+	}
+	if conf.date {
+		opts.Date = time.Now().Format(core.DateLayout)
+	}
+	opts.Author = conf.author.name
+	if conf.author.fromGit {
+		opts.Author, err = gitUserName(ctx)
+		if err != nil {
+			errorLog.Print(err)
+			return 1
+		}
+	}
+	if conf.remote != "" {
+		r, conn, err := dialRemote(conf.remote)
+		if err != nil {
+			errorLog.Print(err)
+			return 1
+		}
+		defer conn.Close()
+		opts.Finder = r
+	}
+	var servers int
+	for _, on := range []bool{
+		conf.lsp, conf.goplsProxy != "", conf.rpc, conf.serve != "",
+		conf.playground != "", conf.grpc != "",
+	} {
+		if on {
+			servers++
+		}
+	}
+	if servers > 0 {
+		// Stdin and stdout are taken by the protocol. Paths of
+		// ‘-gopls-proxy’ flag are arguments of gopls.
+		if servers > 1 ||
+			len(conf.paths) > 0 && conf.goplsProxy == "" ||
+			conf.write || conf.dryRun ||
+			conf.interactive || conf.tui || conf.output != "" ||
+			conf.watch || conf.rcs || conf.format != "" ||
+			conf.patch != "" || conf.txtar || conf.diffFilter ||
+			conf.staged {
+			errorLog.Print(errServerWithOtherModes)
+			return 1
+		}
+		var err error
+		switch {
+		case conf.serve != "":
+			handler := newHTTPHandler(opts, conf.maxFileSize, m)
+			err = serveHTTP(ctx, conf.serve, handler, infoLog)
+		case conf.playground != "":
+			handler := newPlaygroundHandler(
+				opts, conf.maxFileSize, m,
+			)
+			err = serveHTTP(ctx, conf.playground, handler, infoLog)
+		case conf.grpc != "":
+			srv := &grpcServer{
+				opts:    opts,
+				maxSize: conf.maxFileSize,
+				metrics: m,
+			}
+			serveMetricsOf()
+			err = serveGRPC(ctx, conf.grpc, srv, infoLog)
+		case conf.goplsProxy != "":
+			err = serveGoplsProxy(
+				ctx, opts, string(conf.goplsProxy), goplsArgs,
+				stdin, stdout, stderr,
+			)
+		case conf.rpc:
+			err = serveRPC(ctx, opts, stdin, stdout)
+		default:
+			err = serveLSP(ctx, opts, stdin, stdout)
+		}
+		if err != nil {
+			errorLog.Print(err)
+			return 1
+		}
+		return 0
+	}
+	var st stats
+	if conf.stats != "" {
+		defer func() {
+			// Counters are about all files.
+			logs.file = ""
+			infoLog.Print(st.format(conf.stats))
+		}()
+	}
+	// changed are lines of files from the diff read from stdin.
+	var changed map[string]map[int]bool
+	if conf.diffFilter {
+		// Stdin is taken by the diff.
+		if conf.interactive || conf.txtar || conf.watch || fromStdin {
+			errorLog.Print(errDiffFilterWithOtherModes)
+			return 1
+		}
+		changed, err = parseDiff(stdin)
+		if err != nil {
+			errorLog.Print(err)
+			return 1
+		}
+		if len(conf.paths) == 0 {
+			conf.paths = diffPaths(changed)
+			if len(conf.paths) == 0 {
+				return 0
+			}
+		}
+	}
+	// Pipes, e.g. of process substitution, can’t be written back, so
+	// their results are written to stdout like of stdin.
+	pipes := make(map[string]bool)
+	if conf.write {
+		for _, p := range conf.paths {
+			if p != stdinPath && !isRegularFile(p) {
+				pipes[p] = true
+			}
+		}
+	}
+	if conf.write && conf.noFollowSymlinks {
+		if err := refuseSymlinks(conf.paths); err != nil {
+			errorLog.Print(err)
+			return 1
+		}
+	}
+	var prompt *prompter
+	if conf.interactive {
+		prompt = newPrompter(stdin, stderr)
+	}
+	var total *budget
+	if conf.maxToggles > 0 {
+		total = newBudget(conf.maxToggles, infoLog)
+	}
+	// Only files written back are backed up.
+	var saved *backups
+	if conf.backup && conf.write && !conf.dryRun {
+		dir, err := defaultBackupDir()
+		if err != nil {
+			errorLog.Print(err)
+			return 1
+		}
+		saved = &backups{dir: dir}
+	}
+	var recorded *journal
+	if conf.journal && conf.write && !conf.dryRun {
+		p, err := defaultJournalPath()
+		if err != nil {
+			errorLog.Print(err)
+			return 1
+		}
+		recorded = &journal{path: p, run: time.Now().UnixNano()}
+	}
+	var kept *mtimes
+	if conf.mtime != "" && conf.write && !conf.dryRun {
+		p, err := defaultMtimesPath()
+		if err != nil {
+			errorLog.Print(err)
+			return 1
+		}
+		kept = &mtimes{path: p, policy: conf.mtime}
+	}
+	// filterFor returns a changesFilter for the file name.
+	filterFor := func(name string) changesFilter {
+		var diff, id, limit, capped, ask changesFilter
+		if changed != nil {
+			diff = onlyChanged(changed[filepath.Clean(name)])
+		}
+		if conf.id > 0 {
+			id = onlyID(conf.id)
+		}
+		if conf.maxErrors > 0 {
+			limit = limitAdditions(name, conf.maxErrors, infoLog)
+		}
+		if total != nil {
+			capped = total.filter(name)
+		}
+		if prompt != nil {
+			ask = prompt.filter(name)
+		}
+		return chainFilters(diff, id, limit, capped, ask)
+	}
+	// hooksFor returns writeHooks for the file name. Files are backed up
+	// and changes are recorded only when they’re written back.
+	hooksFor := func(name string) writeHooks {
+		var hooks writeHooks
+		if pipes[name] {
+			return hooks
+		}
+		var backup, record, mtime, restore writeHook
+		if saved != nil {
+			backup = saved.hook(name)
+		}
+		if recorded != nil {
+			record = recorded.hook(name)
+		}
+		if kept != nil {
+			mtime = kept.hook(name)
+			restore = func([]byte, []byte, []core.Change) error {
+				return kept.restore(name)
+			}
+		}
+		hooks.before = chainHooks(backup, mtime)
+		hooks.after = chainHooks(record, restore)
+		return hooks
+	}
+
+	if fromStdin {
+		switch {
+		case conf.watch:
+			errorLog.Print(errWatchWithStdin)
+			return 1
+		// Answers are read from stdin, so it can’t provide code too.
+		case conf.interactive:
+			errorLog.Print(errInteractiveWithStdin)
+			return 1
+		case conf.tui:
+			errorLog.Print(errTUIWithStdin)
+			return 1
+		}
+	}
+	// Offsets are in a single file, and only its toggled code is printed
+	// or written back.
+	if conf.cursor != nil && (len(conf.paths) > 1 || conf.dryRun ||
+		conf.tui || conf.rcs || conf.format != "" || conf.patch != "" ||
+		conf.watch || conf.txtar || conf.staged) {
+		errorLog.Print(errCursorWithOtherModes)
+		return 1
+	}
+	if conf.watch {
+		if len(conf.paths) == 0 {
+			errorLog.Print(errWatchWithStdin)
+			return 1
+		}
+		if opts.Mode == core.ModeRemove || conf.dryRun ||
+			conf.interactive || conf.tui || conf.output != "" ||
+			conf.rcs || conf.format != "" || conf.patch != "" {
+			errorLog.Print(errWatchWithOtherModes)
+			return 1
+		}
+		err := watchFiles(
+			ctx,
+			opts,
+			conf.paths,
+			filterFor,
+			hooksFor,
+			errorLog,
+			openFile,
+		)
+		if err != nil {
+			errorLog.Print(err)
+			return 1
+		}
+		return 0
+	}
+
+	if conf.dryRun && conf.write {
+		errorLog.Print(errDryRunWithWrite)
+		return 1
+	}
+	if conf.interactive && conf.dryRun {
+		errorLog.Print(errInteractiveWithDryRun)
+		return 1
+	}
+	if conf.tui && (conf.dryRun || conf.interactive) {
+		errorLog.Print(errTUIWithOtherModes)
+		return 1
+	}
+	if conf.rcs && (len(conf.paths) > 1 || conf.write || conf.dryRun ||
+		conf.tui || conf.txtar || conf.staged) {
+		errorLog.Print(errRCSWithOtherModes)
+		return 1
+	}
+	if conf.format != "" && (conf.write || conf.dryRun || conf.tui ||
+		conf.rcs || conf.txtar || conf.staged) {
+		errorLog.Print(errFormatWithOtherModes)
+		return 1
+	}
+	if conf.patch != "" {
+		if conf.write || conf.dryRun || conf.tui || conf.output != "" ||
+			conf.rcs || conf.format != "" || conf.txtar ||
+			conf.staged {
+			errorLog.Print(errPatchWithOtherModes)
+			return 1
+		}
+		// Patches name files by their paths.
+		if len(conf.paths) == 0 ||
+			slices.Contains(conf.paths, stdinPath) {
+			errorLog.Print(errPatchWithStdin)
+			return 1
+		}
+	}
+	if conf.staged {
+		if len(conf.paths) > 0 || conf.write || conf.tui ||
+			conf.output != "" || conf.txtar || conf.diffFilter {
+			errorLog.Print(errStagedWithOtherModes)
+			return 1
+		}
+		toggled, err := toggleStaged(
+			ctx, opts, ".", conf.dryRun, stdout, filterFor,
+		)
+		for _, changes := range toggled {
+			st.add(changes)
+		}
+		if err != nil {
+			errorLog.Print(err)
+			return 1
+		}
+		return 0
+	}
+	if conf.output != "" {
+		if conf.write || conf.dryRun {
+			errorLog.Print(errOutputWithOtherModes)
+			return 1
+		}
+		if len(conf.paths) > 1 {
+			errorLog.Print(errMustWriteToFiles)
+			return 1
+		}
+		paths := conf.paths
+		if len(paths) == 1 && samePath(paths[0], conf.output) {
+			errorLog.Print(errOutputIsInput)
+			return 1
+		}
+		var in string
+		if len(paths) == 1 && paths[0] != stdinPath {
+			in = paths[0]
+		}
+		// The result is written once the run succeeds, so a failed
+		// run leaves the output as it was.
+		result := &memFile{}
+		defer func() {
+			if status != 0 {
+				return
+			}
+			err := writeOutput(
+				conf.output, in, result.Bytes(), openFile,
+			)
+			if err != nil {
+				errorLog.Print(err)
+				status = 1
+			}
+		}()
+		stdout = result
+	}
+
+	if conf.stdinFilename != "" && len(conf.paths) > 0 {
+		errorLog.Print(errStdinFilenameWithPaths)
+		return 1
+	}
+	if conf.selection || conf.acme {
+		// Only the selection is read and written.
+		if len(conf.paths) > 0 || conf.write || conf.dryRun ||
+			conf.interactive || conf.tui || conf.rcs ||
+			conf.format != "" || conf.patch != "" || conf.txtar ||
+			conf.staged || conf.diffFilter || conf.cursor != nil {
+			errorLog.Print(errSelectionWithOtherModes)
+			return 1
+		}
+		name := conf.stdinFilename
+		if name == "" && conf.acme {
+			name = os.Getenv(acmeFileEnv)
+			if name == "" {
+				errorLog.Print(errAcmeWithoutFile)
+				return 1
+			}
+		}
+		if name == "" {
+			errorLog.Print(errSelectionWithoutFile)
+			return 1
+		}
+		if opts.Placement == core.PlacementFunction {
+			opts.Style, err = core.EditorStyleFor(name)
+			if err != nil {
+				errorLog.Print(err)
+				return 1
+			}
+		}
+		changes, err := toggleSelection(
+			ctx, opts, name, stdin, stdout, filterFor(name),
+		)
+		st.add(changes)
+		if err != nil {
+			errorLog.Print(err)
+			return 1
+		}
+		return 0
+	}
+	if conf.txtar {
+		if len(conf.paths) > 0 || conf.write || conf.dryRun ||
+			conf.interactive || conf.tui {
+			errorLog.Print(errTxtarWithOtherModes)
+			return 1
+		}
+		toggled, err := toggleTxtar(ctx, opts, stdin, stdout, filterFor)
+		for _, changes := range toggled {
+			st.add(changes)
+		}
+		if err != nil {
+			errorLog.Print(err)
+			return 1
+		}
+		return 0
+	}
+
+	var report editsReporter
+	var finishReport func() error
+	if conf.format != "" {
+		report, finishReport = newReporter(conf.format, stdout)
+	}
+	if conf.patch != "" {
+		f, err := openFile(
+			conf.patch, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644,
+		)
+		if err != nil {
+			errorLog.Print(err)
+			return 1
+		}
+		defer f.Close()
+		report = patchEdits(f)
+		finishReport = func() error { return nil }
+	}
+
 	if len(conf.paths) == 0 {
+		// Code from stdin is named like the file it’s from, if known.
+		name := stdinName
+		if conf.stdinFilename != "" {
+			name = conf.stdinFilename
+		}
+		if name != stdinName &&
+			opts.Placement == core.PlacementFunction {
+			opts.Style, err = core.EditorStyleFor(name)
+			if err != nil {
+				errorLog.Print(err)
+				return 1
+			}
+		}
+		if conf.dryRun {
+			changes, err := dryRunFile(
+				ctx,
+				opts,
+				name,
+				stdin, stdout,
+				filterFor(name),
+			)
+			st.add(changes)
+			if err != nil {
+				errorLog.Print(err)
+				return 1
+			}
+			return 0
+		}
+		if report != nil {
+			changes, err := editsFile(
+				ctx,
+				opts,
+				name,
+				stdin,
+				report,
+				filterFor(name),
+			)
+			st.add(changes)
+			if err == nil {
+				err = finishReport()
+			}
+			if err != nil {
+				errorLog.Print(err)
+				return 1
+			}
+			return 0
+		}
+		if conf.rcs {
+			changes, err := rcsFile(
+				ctx, opts, stdin, stdout, filterFor(name),
+			)
+			st.add(changes)
+			if err != nil {
+				errorLog.Print(err)
+				return 1
+			}
+			return 0
+		}
 		if conf.write {
 			errorLog.Print(errCannotWriteToStdin)
 			return 1
 		}
-		if err := toggleFile(ctx, stdin, stdout); err != nil {
+		// Answers are read from stdin, so it can’t provide code too.
+		if conf.interactive {
+			errorLog.Print(errInteractiveWithStdin)
+			return 1
+		}
+		if conf.tui {
+			errorLog.Print(errTUIWithStdin)
+			return 1
+		}
+		changes, err := toggleFile(
+			ctx, opts, stdin, stdout, filterFor(name), writeHooks{},
+		)
+		st.add(changes)
+		if err != nil {
 			errorLog.Print(err)
 			return 1
 		}
+		if conf.cursor != nil {
+			moved := conf.cursor.moved(changes)
+			infoLog.Printf(cursorFormat, &moved)
+		}
 		return 0
 	}
-	if len(conf.paths) > 1 && !conf.write {
+	// Reports of multiple files are written one after another.
+	if len(conf.paths) > 1 && !conf.write && !conf.dryRun &&
+		report == nil {
 		errorLog.Print(errMustWriteToFiles)
 		return 1
 	}
-	for _, p := range conf.paths {
-		var in file
-		var out *file
-		var access int
-		if conf.write {
-			out = &in
-			access = os.O_RDWR
-		} else {
-			out = &stdout
-			access = os.O_RDONLY
+	if conf.tui {
+		selected, err := toggleFilesInTUI(
+			ctx,
+			opts,
+			conf.paths,
+			conf.write,
+			stdout,
+			filterFor,
+			hooksFor,
+
+			openFile,
+		)
+		for _, changes := range selected {
+			st.add(changes)
 		}
-		in, err := openFile(p, access, os.ModeExclusive)
 		if err != nil {
 			errorLog.Print(err)
 			return 1
 		}
-		defer in.Close()
-		if err := toggleFile(ctx, in, *out); err != nil {
+		return 0
+	}
+	// writable makes the file at p writable if it’s read-only and conf
+	// says so, and returns a func which restores its mode.
+	writable := func(p string) (func() error, error) {
+		keep := func() error { return nil }
+		if !conf.force {
+			return keep, nil
+		}
+		mode, changed, err := makeWritable(p)
+		if err != nil || !changed {
+			return keep, err
+		}
+		infoLog.Printf(madeWritableFormat, p)
+		return func() error {
+			if err := restoreMode(p, mode); err != nil {
+				return err
+			}
+			infoLog.Printf(modeRestoredFormat, mode, p)
+			return nil
+		}, nil
+	}
+	// Files toggled with ‘-atomic’ flag are staged and written back
+	// after all of them are toggled.
+	var staged []stagedWrite
+	// toggleOne toggles the file at p or code from stdin as conf says.
+	toggleOne := func(p string) (err error) {
+		name, in, out := stdinName, stdin, stdout
+		if p != stdinPath {
+			size, over := sizeOver(p, conf.maxFileSize)
+			if over {
+				infoLog.Printf(skippedLargeFileFormat, p, size)
+				return nil
+			}
+		}
+		stage := conf.write && conf.atomic && !pipes[p] &&
+			p != stdinPath
+		write := conf.write && !pipes[p] && !stage
+		if p != stdinPath && write {
+			restore, err := writable(p)
+			if err != nil {
+				return err
+			}
+			// The mode is restored after the file is written
+			// back or toggling failed.
+			defer func() { err = errors.Join(err, restore()) }()
+		}
+		if p != stdinPath {
+			var f file
+			var err error
+			if write {
+				f, err = openLocked(p, openFile)
+			} else {
+				f, err = openFile(
+					p, os.O_RDONLY, os.ModeExclusive,
+				)
+			}
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			name, in = p, f
+			if write {
+				out = f
+			}
+		}
+		opts := opts
+		if p != stdinPath && opts.Placement == core.PlacementFunction {
+			opts.Style, err = core.EditorStyleFor(p)
+			if err != nil {
+				return err
+			}
+		}
+		filter := filterFor(name)
+		var changes []core.Change
+		switch {
+		case conf.dryRun:
+			changes, err = dryRunFile(
+				ctx, opts, name, in, stdout, filter,
+			)
+		case report != nil:
+			changes, err = editsFile(
+				ctx, opts, name, in, report, filter,
+			)
+		case conf.rcs:
+			changes, err = rcsFile(ctx, opts, in, stdout, filter)
+		case stage:
+			var s stagedWrite
+			s, changes, err = stageFile(
+				ctx, opts, name, in, filter, hooksFor(name),
+			)
+			if s.toggled != nil {
+				staged = append(staged, s)
+			}
+		default:
+			changes, err = toggleFile(
+				ctx, opts, in, out, filter, hooksFor(name),
+			)
+			if err == nil && conf.cursor != nil {
+				moved := conf.cursor.moved(changes)
+				infoLog.Printf(cursorFormat, &moved)
+			}
+		}
+		st.add(changes)
+		return err
+	}
+	// Paths are toggled in the given order, and code from stdin is written
+	// to stdout even with ‘-w’ flag. A failed file doesn’t stop the others,
+	// and failures are reported at the end.
+	var failures []failure
+	for _, p := range conf.paths {
+		logs.file = p
+		if err := toggleOne(p); err != nil {
+			failures = append(failures, failure{p, err})
+			// An interrupt stops the run.
+			if ctx.Err() != nil {
+				break
+			}
+		}
+	}
+	if finishReport != nil {
+		if err := finishReport(); err != nil {
 			errorLog.Print(err)
 			return 1
 		}
 	}
+	if len(failures) > 0 {
+		for _, f := range failures {
+			logs.file = f.path
+			errorLog.Print(f)
+		}
+		logs.file = ""
+		// A single failure speaks for itself.
+		if len(conf.paths) > 1 {
+			names := make([]string, len(failures))
+			for i, f := range failures {
+				names[i] = f.path
+				if f.path == stdinPath {
+					names[i] = stdinName
+				}
+			}
+			n, total := len(failures), len(conf.paths)
+			list := strings.Join(names, ", ")
+			errorLog.Printf(failedFilesFormat, n, total, list)
+		}
+		if len(staged) > 0 {
+			infoLog.Printf(nothingWrittenFormat, len(staged))
+		}
+		return 1
+	}
+	// writeBack writes a staged file back like toggleOne does.
+	writeBack := func(p string, code, toggled []byte) (err error) {
+		restore, err := writable(p)
+		if err != nil {
+			return err
+		}
+		defer func() { err = errors.Join(err, restore()) }()
+		f, err := openLocked(p, openFile)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		return writeToggled(f, f, code, toggled)
+	}
+	rolledBack, err := commitWrites(ctx, staged, writeBack)
+	for _, p := range rolledBack {
+		infoLog.Printf(rolledBackFormat, p)
+	}
+	if err != nil {
+		errorLog.Print(err)
+		return 1
+	}
 	return 0
 }
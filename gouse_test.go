@@ -3,9 +3,13 @@ package main
 import (
 	"bytes"
 	"context"
+	"errors"
+	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"runtime/debug"
+	"slices"
 	"strings"
 	"testing"
 )
@@ -64,7 +68,7 @@ func TestRun(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	mockPath := "filename"
+	mockPath, otherMockPath := "filename", "other"
 	tests := []struct {
 		args         []string
 		wantFilename string
@@ -73,7 +77,7 @@ func TestRun(t *testing.T) {
 	}{
 		{
 			args:       []string{"-v"},
-			wantOutput: currentVersion + "\n",
+			wantOutput: version(debug.ReadBuildInfo()) + "\n",
 			wantStatus: 0,
 		},
 		{
@@ -89,27 +93,227 @@ func TestRun(t *testing.T) {
 			wantStatus: 1,
 		},
 		{
-			args: []string{mockPath, mockPath},
+			args: []string{mockPath, otherMockPath},
 			wantOutput: errorLogPrefix +
 				errMustWriteToFiles.Error() +
 				"\n",
 			wantStatus: 1,
 		},
 		{
-			args:         []string{},
+			args: []string{"-exit-zero", "-w"},
+			wantOutput: errorLogPrefix +
+				errCannotWriteToStdin.Error() +
+				"\n",
+			wantStatus: 0,
+		},
+		{
+			args: []string{"-log-format", "json", "-w"},
+			wantOutput: `{"level":"error","message":"` +
+				errCannotWriteToStdin.Error() +
+				`"}` + "\n",
+			wantStatus: 1,
+		},
+		{
+			args: []string{"-patch", "p.patch", "-w", mockPath},
+			wantOutput: errorLogPrefix +
+				errPatchWithOtherModes.Error() +
+				"\n",
+			wantStatus: 1,
+		},
+		{
+			args: []string{"-cursor", "0", "-n", mockPath},
+			wantOutput: errorLogPrefix +
+				errCursorWithOtherModes.Error() +
+				"\n",
+			wantStatus: 1,
+		},
+		{
+			args: []string{
+				"-serve", ":8080", "-serve-playground", ":8081",
+			},
+			wantOutput: errorLogPrefix +
+				errServerWithOtherModes.Error() +
+				"\n",
+			wantStatus: 1,
+		},
+		{
+			args: []string{"-metrics", ":9090"},
+			wantOutput: errorLogPrefix +
+				errMetricsWithoutServer.Error() +
+				"\n",
+			wantStatus: 1,
+		},
+		{
+			args: []string{"-acme", "-w"},
+			wantOutput: errorLogPrefix +
+				errSelectionWithOtherModes.Error() +
+				"\n",
+			wantStatus: 1,
+		},
+		{
+			args: []string{"-selection"},
+			wantOutput: errorLogPrefix +
+				errSelectionWithoutFile.Error() +
+				"\n",
+			wantStatus: 1,
+		},
+		{
+			args: []string{"-stdin-filename", mockPath, mockPath},
+			wantOutput: errorLogPrefix +
+				errStdinFilenameWithPaths.Error() +
+				"\n",
+			wantStatus: 1,
+		},
+		{
+			args: []string{"-patch", "p.patch"},
+			wantOutput: errorLogPrefix +
+				errPatchWithStdin.Error() +
+				"\n",
+			wantStatus: 1,
+		},
+		{
+			args: []string{"install-hook"},
+			wantOutput: errorLogPrefix +
+				errInstallHookNeedsHook.Error() +
+				"\n",
+			wantStatus: 1,
+		},
+		{
+			args: []string{"completion"},
+			wantOutput: errorLogPrefix +
+				errCompletionNeedsShell.Error() +
+				"\n",
+			wantStatus: 1,
+		},
+		{
+			args: []string{"-i"},
+			wantOutput: errorLogPrefix +
+				errInteractiveWithStdin.Error() +
+				"\n",
+			wantStatus: 1,
+		},
+		{
+			args: []string{"-o", mockPath, "-w", mockPath},
+			wantOutput: errorLogPrefix +
+				errOutputWithOtherModes.Error() +
+				"\n",
+			wantStatus: 1,
+		},
+		{
+			args: []string{"-format", "json", "-n", mockPath},
+			wantOutput: errorLogPrefix +
+				errFormatWithOtherModes.Error() +
+				"\n",
+			wantStatus: 1,
+		},
+		{
+			args: []string{"-diff-filter", "-i", mockPath},
+			wantOutput: errorLogPrefix +
+				errDiffFilterWithOtherModes.Error() +
+				"\n",
+			wantStatus: 1,
+		},
+		{
+			args: []string{"-staged", "-w"},
+			wantOutput: errorLogPrefix +
+				errStagedWithOtherModes.Error() +
+				"\n",
+			wantStatus: 1,
+		},
+		{
+			args: []string{"-txtar", mockPath},
+			wantOutput: errorLogPrefix +
+				errTxtarWithOtherModes.Error() +
+				"\n",
+			wantStatus: 1,
+		},
+		{
+			args: []string{"-o", mockPath, mockPath},
+			wantOutput: errorLogPrefix +
+				errOutputIsInput.Error() +
+				"\n",
+			wantStatus: 1,
+		},
+		{
+			args: []string{"-n", "-w", mockPath},
+			wantOutput: errorLogPrefix +
+				errDryRunWithWrite.Error() +
+				"\n",
+			wantStatus: 1,
+		},
+		{
+			args: []string{"-n", mockPath, stdinPath},
+			wantOutput: mockPath +
+				":8: add fake usage of notUsed0\n" +
+				mockPath + ":11: add fake usage of notUsed1\n" +
+				stdinName + ":8: add fake usage of notUsed0\n" +
+				stdinName + ":11: add fake usage of notUsed1\n",
+			wantStatus: 0,
+		},
+		{
+			args: []string{stdinPath, mockPath, stdinPath},
+			wantOutput: errorLogPrefix +
+				errStdinPathRepeated.Error() +
+				"\n",
+			wantStatus: 1,
+		},
+		{
+			// A repeated path is taken once.
+			args: []string{"-n", mockPath, "./" + mockPath},
+			wantOutput: mockPath +
+				":8: add fake usage of notUsed0\n" +
+				mockPath + ":11: add fake usage of notUsed1\n",
+			wantStatus: 0,
+		},
+		{
+			args: []string{"-n", "-stats", mockPath},
+			wantOutput: mockPath +
+				":8: add fake usage of notUsed0\n" +
+				mockPath + ":11: add fake usage of notUsed1\n" +
+				"files: 1, added: 2, removed: 0\n",
+			wantStatus: 0,
+		},
+		{
+			args: []string{
+				"-n", "-stats=json", mockPath, otherMockPath,
+			},
+			wantOutput: mockPath +
+				":8: add fake usage of notUsed0\n" +
+				mockPath + ":11: add fake usage of notUsed1\n" +
+				otherMockPath +
+				":8: add fake usage of notUsed0\n" +
+				otherMockPath +
+				":11: add fake usage of notUsed1\n" +
+				`{"files":2,"added":4,"removed":0}` + "\n",
+			wantStatus: 0,
+		},
+		{
+			args: []string{"-n", "-max-errors", "1", mockPath},
+			wantOutput: mockPath +
+				":8: add fake usage of notUsed0\n" +
+				fmt.Sprintf(
+					skippedAdditionsFormat, mockPath, 1,
+				) + "\n",
+			wantStatus: 0,
+		},
+		{
+			args:         []string{commandAdd, mockPath},
 			wantFilename: "not_used.golden",
 			wantStatus:   0,
 		},
 		{
-			args:         []string{mockPath},
+			args:         []string{commandRemove, mockPath},
+			wantFilename: "not_used.input",
+			wantStatus:   0,
+		},
+		{
+			args:         []string{},
 			wantFilename: "not_used.golden",
 			wantStatus:   0,
 		},
 		{
-			// Double processing of the same file must return to
-			// exact previous state.
-			args:         []string{"-w", mockPath, mockPath},
-			wantFilename: "not_used.input",
+			args:         []string{mockPath},
+			wantFilename: "not_used.golden",
 			wantStatus:   0,
 		},
 	}
@@ -123,7 +327,7 @@ func TestRun(t *testing.T) {
 				stdout = newFakeFile()
 				stderr = newFakeFile()
 			)
-			if len(args) == 0 {
+			if len(args) == 0 || slices.Contains(args, stdinPath) {
 				if _, err = stdin.Write(input); err != nil {
 					t.Fatal(err)
 				}
@@ -181,3 +385,201 @@ func TestRun(t *testing.T) {
 		})
 	}
 }
+
+func TestRunContinuesOnError(t *testing.T) {
+	t.Parallel()
+	input, err := os.ReadFile(filepath.Join("testdata", "not_used.input"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	errBroken := errors.New("broken")
+	var openFiles osOpenFile = func(
+		name string, flag int, perm os.FileMode,
+	) (file, error) {
+		if strings.HasPrefix(name, "broken") {
+			return nil, errBroken
+		}
+		return newFakeFile(input...), nil
+	}
+	stdout, stderr := newFakeFile(), newFakeFile()
+	status := run(
+		context.Background(),
+		[]string{"-n", "broken0.go", "a.go", "broken1.go"},
+		newFakeFile(), stdout, stderr,
+
+		openFiles,
+	)
+	if status != 1 {
+		t.Errorf("got: %d, want: 1", status)
+	}
+	// The file after a broken one is toggled anyway.
+	wantOutput := "a.go:8: add fake usage of notUsed0\n" +
+		"a.go:11: add fake usage of notUsed1\n"
+	if got := stdout.contents.String(); got != wantOutput {
+		t.Errorf(filesCmpErr, got, wantOutput)
+	}
+	summary := fmt.Sprintf(
+		failedFilesFormat, 2, 3, "broken0.go, broken1.go",
+	)
+	wantErrors := errorLogPrefix + "broken0.go: broken\n" +
+		errorLogPrefix + "broken1.go: broken\n" +
+		errorLogPrefix + summary + "\n"
+	if got := stderr.contents.String(); got != wantErrors {
+		t.Errorf(filesCmpErr, got, wantErrors)
+	}
+}
+
+func TestRunKeepsBrokenCode(t *testing.T) {
+	t.Parallel()
+	// Code being typed, e.g. in a save hook, is passed through as is.
+	const broken = "package p\n\nfunc f() {\n\tnotUsed := 0\n"
+	stdout, stderr := newFakeFile(), newFakeFile()
+	status := run(
+		context.Background(),
+		[]string{"-backend", "typecheck"},
+		newFakeFile([]byte(broken)...), stdout, stderr,
+
+		openFile,
+	)
+	if status != 0 {
+		format := "got: %d, want: 0, stderr: %s"
+		t.Errorf(format, status, stderr.contents.String())
+	}
+	if got := stdout.contents.String(); got != broken {
+		t.Errorf(filesCmpErr, got, broken)
+	}
+}
+
+func TestRunOutput(t *testing.T) {
+	t.Parallel()
+	input, err := os.ReadFile(filepath.Join("testdata", "not_used.input"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	golden, err := os.ReadFile(filepath.Join("testdata", "not_used.golden"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	const old = "old output\n"
+	tests := []struct {
+		name string
+		// missing makes the input path one of a file which doesn’t
+		// exist, so the run fails.
+		missing bool
+		// exists makes the output exist before the run.
+		exists     bool
+		want       string
+		wantStatus int
+	}{
+		{name: "new", want: string(golden)},
+		{name: "existing", exists: true, want: string(golden)},
+		{
+			name:       "failed run",
+			missing:    true,
+			exists:     true,
+			want:       old,
+			wantStatus: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			dir := t.TempDir()
+			in := filepath.Join(dir, "in.go")
+			if !tt.missing {
+				err := os.WriteFile(in, input, 0o755)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			out := filepath.Join(dir, "out.go")
+			if tt.exists {
+				err := os.WriteFile(out, []byte(old), 0o644)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			stderr := newFakeFile()
+			status := run(
+				context.Background(),
+				[]string{"-o", out, in},
+				newFakeFile(), newFakeFile(), stderr,
+
+				openFile,
+			)
+			if status != tt.wantStatus {
+				format := "got: %d, want: %d, stderr: %s"
+				t.Errorf(
+					format, status, tt.wantStatus,
+					stderr.contents.String(),
+				)
+			}
+			got, err := os.ReadFile(out)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf(filesCmpErr, got, tt.want)
+			}
+			if tt.missing {
+				return
+			}
+			// The output takes the mode of the input.
+			info, err := os.Stat(out)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if mode := info.Mode().Perm(); mode != 0o755 {
+				t.Errorf("got: %o, want: %o", mode, 0o755)
+			}
+		})
+	}
+}
+
+func TestVersion(t *testing.T) {
+	tests := []struct {
+		name string
+		info *debug.BuildInfo
+		ok   bool
+		want string
+	}{
+		{
+			name: "no build info",
+			want: currentVersion,
+		},
+		{
+			name: "installed",
+			info: &debug.BuildInfo{
+				GoVersion: "go1.23.2",
+				Main:      debug.Module{Version: "v1.4.0"},
+			},
+			ok:   true,
+			want: "1.4.0\ngo: go1.23.2",
+		},
+		{
+			name: "built from a checkout",
+			info: &debug.BuildInfo{
+				GoVersion: "go1.23.2",
+				Main:      debug.Module{Version: "(devel)"},
+				Settings: []debug.BuildSetting{
+					{Key: "-trimpath", Value: "true"},
+					{Key: "vcs.revision", Value: "abc"},
+					{Key: "vcs.modified", Value: "true"},
+				},
+			},
+			ok: true,
+			want: currentVersion + "\ngo: go1.23.2" +
+				"\nvcs.revision: abc\nvcs.modified: true",
+		},
+	}
+	for _, tt := range tests {
+		test := tt
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			got := version(test.info, test.ok)
+			if got != test.want {
+				t.Errorf("got: %s, want: %s", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,5 @@
+// Package gousepb is the gRPC API of gouse, which ‘gouse -grpc address’ serves,
+// with client stubs generated from gouse.proto.
+package gousepb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative gouse.proto
@@ -0,0 +1,194 @@
+// Gouse toggles ‘declared and not used’ errors in Go source, see
+// https://github.com/looshch/gouse. ‘gouse -grpc address’ serves it.
+//
+// Source is streamed in chunks, so files of any size fit in messages. The
+// options go in the first chunk.
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: gouse.proto
+
+package gousepb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	Gouse_Toggle_FullMethodName = "/gouse.v1.Gouse/Toggle"
+	Gouse_Check_FullMethodName  = "/gouse.v1.Gouse/Check"
+	Gouse_Purge_FullMethodName  = "/gouse.v1.Gouse/Purge"
+)
+
+// GouseClient is the client API for Gouse service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type GouseClient interface {
+	// Toggle removes fake usages from the source if there are any and creates
+	// them otherwise, and streams back the result.
+	Toggle(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[SourceChunk, ResultChunk], error)
+	// Check lists fake usages in the source.
+	Check(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[SourceChunk, CheckResponse], error)
+	// Purge removes all fake usages from the source and streams back the
+	// result.
+	Purge(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[SourceChunk, ResultChunk], error)
+}
+
+type gouseClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewGouseClient(cc grpc.ClientConnInterface) GouseClient {
+	return &gouseClient{cc}
+}
+
+func (c *gouseClient) Toggle(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[SourceChunk, ResultChunk], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Gouse_ServiceDesc.Streams[0], Gouse_Toggle_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[SourceChunk, ResultChunk]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Gouse_ToggleClient = grpc.BidiStreamingClient[SourceChunk, ResultChunk]
+
+func (c *gouseClient) Check(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[SourceChunk, CheckResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Gouse_ServiceDesc.Streams[1], Gouse_Check_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[SourceChunk, CheckResponse]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Gouse_CheckClient = grpc.ClientStreamingClient[SourceChunk, CheckResponse]
+
+func (c *gouseClient) Purge(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[SourceChunk, ResultChunk], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Gouse_ServiceDesc.Streams[2], Gouse_Purge_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[SourceChunk, ResultChunk]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Gouse_PurgeClient = grpc.BidiStreamingClient[SourceChunk, ResultChunk]
+
+// GouseServer is the server API for Gouse service.
+// All implementations must embed UnimplementedGouseServer
+// for forward compatibility.
+type GouseServer interface {
+	// Toggle removes fake usages from the source if there are any and creates
+	// them otherwise, and streams back the result.
+	Toggle(grpc.BidiStreamingServer[SourceChunk, ResultChunk]) error
+	// Check lists fake usages in the source.
+	Check(grpc.ClientStreamingServer[SourceChunk, CheckResponse]) error
+	// Purge removes all fake usages from the source and streams back the
+	// result.
+	Purge(grpc.BidiStreamingServer[SourceChunk, ResultChunk]) error
+	mustEmbedUnimplementedGouseServer()
+}
+
+// UnimplementedGouseServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedGouseServer struct{}
+
+func (UnimplementedGouseServer) Toggle(grpc.BidiStreamingServer[SourceChunk, ResultChunk]) error {
+	return status.Errorf(codes.Unimplemented, "method Toggle not implemented")
+}
+func (UnimplementedGouseServer) Check(grpc.ClientStreamingServer[SourceChunk, CheckResponse]) error {
+	return status.Errorf(codes.Unimplemented, "method Check not implemented")
+}
+func (UnimplementedGouseServer) Purge(grpc.BidiStreamingServer[SourceChunk, ResultChunk]) error {
+	return status.Errorf(codes.Unimplemented, "method Purge not implemented")
+}
+func (UnimplementedGouseServer) mustEmbedUnimplementedGouseServer() {}
+func (UnimplementedGouseServer) testEmbeddedByValue()               {}
+
+// UnsafeGouseServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to GouseServer will
+// result in compilation errors.
+type UnsafeGouseServer interface {
+	mustEmbedUnimplementedGouseServer()
+}
+
+func RegisterGouseServer(s grpc.ServiceRegistrar, srv GouseServer) {
+	// If the following call pancis, it indicates UnimplementedGouseServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&Gouse_ServiceDesc, srv)
+}
+
+func _Gouse_Toggle_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(GouseServer).Toggle(&grpc.GenericServerStream[SourceChunk, ResultChunk]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Gouse_ToggleServer = grpc.BidiStreamingServer[SourceChunk, ResultChunk]
+
+func _Gouse_Check_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(GouseServer).Check(&grpc.GenericServerStream[SourceChunk, CheckResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Gouse_CheckServer = grpc.ClientStreamingServer[SourceChunk, CheckResponse]
+
+func _Gouse_Purge_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(GouseServer).Purge(&grpc.GenericServerStream[SourceChunk, ResultChunk]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Gouse_PurgeServer = grpc.BidiStreamingServer[SourceChunk, ResultChunk]
+
+// Gouse_ServiceDesc is the grpc.ServiceDesc for Gouse service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Gouse_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "gouse.v1.Gouse",
+	HandlerType: (*GouseServer)(nil),
+	Methods:     []grpc.MethodDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Toggle",
+			Handler:       _Gouse_Toggle_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "Check",
+			Handler:       _Gouse_Check_Handler,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "Purge",
+			Handler:       _Gouse_Purge_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "gouse.proto",
+}
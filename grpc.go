@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"time"
+
+	"github.com/looshch/gouse/gousepb"
+	"github.com/looshch/gouse/internal/core"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// grpcChunkSize is the size of chunks of results streamed back to clients.
+const grpcChunkSize = 64 << 10
+
+// grpcModes maps modes of requests to names of toggling commands.
+// Mode_MODE_UNSPECIFIED has none, so the mode of the server is kept.
+var grpcModes = map[gousepb.Mode]string{
+	gousepb.Mode_MODE_TOGGLE: commandToggle,
+	gousepb.Mode_MODE_ADD:    commandAdd,
+	gousepb.Mode_MODE_REMOVE: commandRemove,
+}
+
+// grpcServer is the gRPC service of ‘-grpc’ flag, see gousepb/gouse.proto.
+// Source is toggled with opts, which options of requests override, and
+// sources over maxSize are refused unless it’s 0. Calls are counted in
+// metrics.
+type grpcServer struct {
+	gousepb.UnimplementedGouseServer
+	opts    core.Options
+	maxSize fileSize
+	metrics *metrics
+}
+
+func (s *grpcServer) Toggle(stream gousepb.Gouse_ToggleServer) error {
+	start := time.Now()
+	changes, err := s.toggle(stream, false)
+	return s.metrics.observe(start, changes, err)
+}
+
+func (s *grpcServer) Purge(stream gousepb.Gouse_PurgeServer) error {
+	start := time.Now()
+	changes, err := s.toggle(stream, true)
+	return s.metrics.observe(start, changes, err)
+}
+
+func (s *grpcServer) Check(stream gousepb.Gouse_CheckServer) error {
+	start := time.Now()
+	return s.metrics.observe(start, nil, s.check(stream))
+}
+
+// check sends back fake usages in the source from stream.
+func (s *grpcServer) check(stream gousepb.Gouse_CheckServer) error {
+	code, _, err := receiveSource(stream.Recv, s.maxSize)
+	if err != nil {
+		return err
+	}
+	var resp gousepb.CheckResponse
+	for _, c := range core.FindMarkers(code) {
+		resp.FakeUsages = append(resp.FakeUsages, &gousepb.FakeUsage{
+			// +1 is an adjustment for 1-based count.
+			Line: int32(c.LineNum + 1),
+			Name: c.Name,
+		})
+	}
+	return stream.SendAndClose(&resp)
+}
+
+// toggle streams back the source from stream toggled, or without fake usages
+// if purge is true, and returns the changes.
+func (s *grpcServer) toggle(
+	stream gousepb.Gouse_ToggleServer, purge bool,
+) ([]core.Change, error) {
+	code, o, err := receiveSource(stream.Recv, s.maxSize)
+	if err != nil {
+		return nil, err
+	}
+	mode, ok := grpcModes[o.GetMode()]
+	if !ok && o.GetMode() != gousepb.Mode_MODE_UNSPECIFIED {
+		format := "unknown mode %d"
+		return nil, status.Errorf(
+			codes.InvalidArgument, format, o.GetMode(),
+		)
+	}
+	opts := s.opts
+	err = overrideOptions(
+		&opts,
+		mode,
+		o.GetStrategy(),
+		o.GetPlacement(),
+		o.GetFilename(),
+	)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if purge {
+		opts.Mode = core.ModeRemove
+	}
+	if siblings := o.GetSiblings(); len(siblings) > 0 {
+		opts.Siblings = siblings
+	}
+	changes, err := core.FindChanges(stream.Context(), code, opts)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	toggled := core.ApplyChanges(code, changes)
+	// The first chunk is sent even if there is no source, as it has the
+	// number of changes.
+	for i := 0; i == 0 || i < len(toggled); i += grpcChunkSize {
+		chunk := &gousepb.ResultChunk{
+			Data: toggled[i:min(i+grpcChunkSize, len(toggled))],
+		}
+		if i == 0 {
+			chunk.Changes = int32(len(changes))
+			chunk.Edits = grpcEdits(changes)
+		}
+		if err := stream.Send(chunk); err != nil {
+			return nil, err
+		}
+	}
+	return changes, nil
+}
+
+// grpcEdits returns changes as edits of responses.
+func grpcEdits(changes []core.Change) []*gousepb.Edit {
+	edits := make([]*gousepb.Edit, len(changes))
+	for i, c := range changes {
+		edits[i] = &gousepb.Edit{
+			Action: gousepb.Action(c.Action),
+			Name:   c.Name,
+			// +1 is an adjustment for 1-based count.
+			Line:  int32(c.LineNum + 1),
+			Start: int32(c.Start),
+			End:   int32(c.End),
+			Text:  c.Text,
+		}
+	}
+	return edits
+}
+
+// receiveSource returns the source streamed by a client with recv and options
+// of its first chunk. Sources over maxSize are refused unless it’s 0.
+func receiveSource(
+	recv func() (*gousepb.SourceChunk, error), maxSize fileSize,
+) ([]byte, *gousepb.Options, error) {
+	var code []byte
+	var o *gousepb.Options
+	for first := true; ; first = false {
+		chunk, err := recv()
+		if err == io.EOF {
+			return code, o, nil
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		if first {
+			o = chunk.GetOptions()
+		}
+		code = append(code, chunk.GetData()...)
+		if maxSize > 0 && len(code) > int(maxSize) {
+			return nil, nil, status.Errorf(
+				codes.ResourceExhausted,
+				"the source is over %d bytes", maxSize,
+			)
+		}
+	}
+}
+
+// serveGRPC serves srv on the TCP address addr, printing it to infoLog, until
+// ctx is done, and then waits for requests in flight.
+func serveGRPC(
+	ctx context.Context, addr string, srv gousepb.GouseServer,
+	infoLog *log.Logger,
+) error {
+	const thisName = "serveGRPC"
+
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf(thisName+": in net.Listen: %v", err)
+	}
+	infoLog.Printf(listeningFormat, l.Addr())
+	s := grpc.NewServer()
+	gousepb.RegisterGouseServer(s, srv)
+	served := make(chan error, 1)
+	go func() { served <- s.Serve(l) }()
+	select {
+	case err := <-served:
+		return fmt.Errorf(thisName+": in *Server.Serve: %v", err)
+	case <-ctx.Done():
+	}
+	s.GracefulStop()
+	return nil
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/looshch/gouse/gousepb"
+	"github.com/looshch/gouse/internal/core"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// newGRPCClient returns a client of srv served in memory.
+func newGRPCClient(
+	t *testing.T, srv gousepb.GouseServer,
+) gousepb.GouseClient {
+	t.Helper()
+	l := bufconn.Listen(1 << 20)
+	s := grpc.NewServer()
+	gousepb.RegisterGouseServer(s, srv)
+	go s.Serve(l)
+	t.Cleanup(s.Stop)
+	conn, err := grpc.NewClient(
+		"passthrough:///bufconn",
+		grpc.WithContextDialer(
+			func(ctx context.Context, _ string) (net.Conn, error) {
+				return l.DialContext(ctx)
+			},
+		),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return gousepb.NewGouseClient(conn)
+}
+
+func TestGRPCServer(t *testing.T) {
+	t.Parallel()
+	const added = "package p\n\nfunc f() {\n" +
+		"\ta := 0; _ = a /* TODO: gouse */\n}\n"
+	const removed = "package p\n\nfunc f() {\n\ta := 0\n}\n"
+	// Over grpcChunkSize, so both ways are streamed in several chunks.
+	padding := "\n" + strings.Repeat("// padding\n", grpcChunkSize/8)
+	add := &gousepb.Options{Mode: gousepb.Mode_MODE_ADD}
+	tests := []struct {
+		name  string
+		purge bool
+		// addServer makes the request to a server which only adds fake
+		// usages.
+		addServer   bool
+		options     *gousepb.Options
+		code        string
+		want        string
+		wantChanges int32
+		wantCode    codes.Code
+	}{
+		{
+			name: "toggle",
+			code: added,
+			want: removed,
+			// The first chunk has the number of changes.
+			wantChanges: 1,
+		},
+		{
+			name:        "toggle large source",
+			code:        removed + padding,
+			want:        added + padding,
+			wantChanges: 1,
+		},
+		{
+			name:    "add nothing",
+			options: add,
+			code:    added,
+			want:    added,
+		},
+		{
+			name:        "purge",
+			purge:       true,
+			options:     add,
+			code:        added,
+			want:        removed,
+			wantChanges: 1,
+		},
+		{
+			name:      "mode of the server",
+			addServer: true,
+			code:      added,
+			want:      added,
+		},
+		{
+			name:      "toggle on an add server",
+			addServer: true,
+			options: &gousepb.Options{
+				Mode: gousepb.Mode_MODE_TOGGLE,
+			},
+			code:        added,
+			want:        removed,
+			wantChanges: 1,
+		},
+		{
+			name:     "unknown mode",
+			options:  &gousepb.Options{Mode: gousepb.Mode(9)},
+			code:     added,
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			name:     "unknown strategy",
+			options:  &gousepb.Options{Strategy: "flip"},
+			code:     added,
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			name:     "too large",
+			code:     added + padding + padding,
+			wantCode: codes.ResourceExhausted,
+		},
+	}
+	srv := &grpcServer{maxSize: fileSize(len(removed + padding))}
+	client := newGRPCClient(t, srv)
+	addClient := newGRPCClient(t, &grpcServer{
+		opts: core.Options{Mode: core.ModeAdd},
+	})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			ctx := context.Background()
+			client := client
+			if tt.addServer {
+				client = addClient
+			}
+			toggle := client.Toggle
+			if tt.purge {
+				toggle = client.Purge
+			}
+			stream, err := toggle(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = sendSource(stream.Send, tt.code, tt.options)
+			if err != nil && err != io.EOF {
+				t.Fatal(err)
+			}
+			if err := stream.CloseSend(); err != nil {
+				t.Fatal(err)
+			}
+			var got strings.Builder
+			var changes int32
+			for {
+				chunk, err := stream.Recv()
+				if err == io.EOF {
+					break
+				}
+				code := status.Code(err)
+				if code != tt.wantCode {
+					t.Fatalf(
+						"got %v, want %v",
+						code, tt.wantCode,
+					)
+				}
+				if err != nil {
+					return
+				}
+				got.Write(chunk.GetData())
+				changes += chunk.GetChanges()
+			}
+			if tt.wantCode != codes.OK {
+				t.Fatalf("got OK, want %v", tt.wantCode)
+			}
+			if got := got.String(); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+			if changes != tt.wantChanges {
+				t.Errorf(
+					"got %d changes, want %d",
+					changes, tt.wantChanges,
+				)
+			}
+		})
+	}
+}
+
+func TestGRPCServerCheck(t *testing.T) {
+	t.Parallel()
+	const code = "package p\n\nfunc f() {\n" +
+		"\ta := 0; _ = a /* TODO: gouse */\n}\n"
+	client := newGRPCClient(t, &grpcServer{})
+	stream, err := client.Check(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sendSource(stream.Send, code, nil); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := stream.CloseAndRecv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	usages := resp.GetFakeUsages()
+	if len(usages) != 1 || usages[0].GetLine() != 4 ||
+		usages[0].GetName() != "a" {
+		t.Errorf("got %v, want a on line 4", usages)
+	}
+}
+
+// sendSource streams code with send in chunks of grpcChunkSize, with o in the
+// first one.
+func sendSource(
+	send func(*gousepb.SourceChunk) error, code string, o *gousepb.Options,
+) error {
+	for i := 0; i == 0 || i < len(code); i += grpcChunkSize {
+		chunk := &gousepb.SourceChunk{
+			Data: []byte(code[i:min(i+grpcChunkSize, len(code))]),
+		}
+		if i == 0 {
+			chunk.Options = o
+		}
+		if err := send(chunk); err != nil {
+			return err
+		}
+	}
+	return nil
+}
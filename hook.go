@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// hookAction is what a hook installed with install-hook command does with
+// staged fake usages.
+type hookAction string
+
+const (
+	// hookStrip removes staged fake usages, keeping them in the working
+	// tree.
+	hookStrip hookAction = "strip"
+	// hookBlock aborts the commit if there are staged fake usages.
+	hookBlock hookAction = "block"
+)
+
+func (a *hookAction) String() string { return string(*a) }
+
+func (a *hookAction) Set(s string) error {
+	switch hookAction(s) {
+	case hookStrip, hookBlock:
+		*a = hookAction(s)
+		return nil
+	}
+	return fmt.Errorf("unknown action %q, want strip or block", s)
+}
+
+const (
+	preCommitHook = "pre-commit"
+	// hookMarker tells hooks installed by gouse from others.
+	hookMarker = "# Generated by gouse install-hook."
+	// chainedHookSuffix is appended to the name of an existing hook which
+	// is kept and run first by the installed one.
+	chainedHookSuffix = ".pre-gouse"
+)
+
+// hookScript returns the script of a hook which does action.
+func hookScript(hook string, action hookAction) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, `#!/bin/sh
+%s
+chained="$(dirname "$0")/%s%s"
+if [ -x "$chained" ]; then
+	"$chained" "$@" || exit
+fi
+`, hookMarker, hook, chainedHookSuffix)
+	switch action {
+	case hookStrip:
+		b.WriteString("exec gouse remove -staged\n")
+	case hookBlock:
+		b.WriteString(`found=$(gouse remove -staged -n) || exit
+if [ -n "$found" ]; then
+	printf '%s\n' "$found" >&2
+	echo 'error: fake usages are staged, remove them with' \
+		'‘gouse remove -staged’ or skip the check with --no-verify' >&2
+	exit 1
+fi
+`)
+	}
+	return b.Bytes()
+}
+
+// installHook installs the git hook which does action to the repository
+// containing the directory dir and returns its path. A hook previously
+// installed by gouse is replaced. Any other existing hook is kept with
+// chainedHookSuffix and run first.
+func installHook(
+	ctx context.Context, dir, hook string, action hookAction,
+) (string, error) {
+	const thisName = "installHook"
+
+	if hook != preCommitHook {
+		format := "%s: unknown hook %q, want %s"
+		return "", fmt.Errorf(format, thisName, hook, preCommitHook)
+	}
+	// hooks may be moved with core.hooksPath.
+	out, err := git(
+		ctx, dir, nil, "rev-parse", "--git-path", "hooks/"+hook,
+	)
+	if err != nil {
+		return "", fmt.Errorf("%s: %v", thisName, err)
+	}
+	p := strings.TrimSpace(string(out))
+	if !filepath.IsAbs(p) {
+		p = filepath.Join(dir, p)
+	}
+	existing, err := os.ReadFile(p)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+	case err != nil:
+		return "", fmt.Errorf("%s: in os.ReadFile: %v", thisName, err)
+	case !bytes.Contains(existing, []byte(hookMarker)):
+		chained := p + chainedHookSuffix
+		if _, err := os.Stat(chained); err == nil {
+			format := "%s: both %s and %s exist"
+			return "", fmt.Errorf(format, thisName, p, chained)
+		}
+		if err := os.Rename(p, chained); err != nil {
+			format := thisName + ": in os.Rename: %v"
+			return "", fmt.Errorf(format, err)
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return "", fmt.Errorf("%s: in os.MkdirAll: %v", thisName, err)
+	}
+	script := hookScript(hook, action)
+	if err := os.WriteFile(p, script, 0o755); err != nil {
+		return "", fmt.Errorf("%s: in os.WriteFile: %v", thisName, err)
+	}
+	// The mode is only applied to new files, so an existing one is
+	// changed explicitly.
+	if err := os.Chmod(p, 0o755); err != nil {
+		return "", fmt.Errorf("%s: in os.Chmod: %v", thisName, err)
+	}
+	return p, nil
+}
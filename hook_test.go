@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestInstallHook(t *testing.T) {
+	ctx := context.Background()
+	ctx, cancel := context.WithCancel(ctx)
+	t.Cleanup(cancel)
+	dir := t.TempDir()
+	cmd := exec.Command("git", "init", "-q")
+	cmd.Dir = dir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("%v: %s", err, out)
+	}
+	hooks := filepath.Join(dir, ".git", "hooks")
+	if err := os.MkdirAll(hooks, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	existing := []byte("#!/bin/sh\necho existing\n")
+	p := filepath.Join(hooks, preCommitHook)
+	if err := os.WriteFile(p, existing, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, action := range []hookAction{hookStrip, hookBlock} {
+		got, err := installHook(ctx, dir, preCommitHook, action)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !samePath(got, p) {
+			t.Errorf("got: %s, want: %s", got, p)
+		}
+		script, err := os.ReadFile(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := hookScript(preCommitHook, action)
+		if !bytes.Equal(script, want) {
+			t.Errorf("got: %s, want: %s", script, want)
+		}
+		out, err := exec.Command("sh", "-n", p).CombinedOutput()
+		if err != nil {
+			t.Errorf("got: %v: %s, want: valid script", err, out)
+		}
+		// The existing hook is kept once.
+		chained, err := os.ReadFile(p + chainedHookSuffix)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(chained, existing) {
+			t.Errorf("got: %s, want: %s", chained, existing)
+		}
+	}
+
+	_, err := installHook(ctx, dir, "post-commit", hookStrip)
+	if err == nil {
+		t.Error("got: nil, want: error")
+	}
+}
+
+func TestHookActionSet(t *testing.T) {
+	var a hookAction
+	if err := a.Set("block"); err != nil || a != hookBlock {
+		t.Errorf("got: %s, %v, want: %s, nil", a, err, hookBlock)
+	}
+	if err := a.Set("ignore"); err == nil {
+		t.Error("got: nil, want: error")
+	}
+}
@@ -0,0 +1,107 @@
+package core
+
+import (
+	"bytes"
+	"go/ast"
+	"go/parser"
+	"go/token"
+)
+
+// findAdoptions returns changes which remove hand-written fake usages, bare
+// ‘_ = x’ statements whose variable x is declared in the same function and has
+// no other use. Only statements which end their lines and either take them or
+// follow another statement after ‘;’ are removed.
+func findAdoptions(code []byte) []Change {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(
+		fset, "", code, parser.SkipObjectResolution,
+	)
+	if err != nil {
+		return nil
+	}
+	tf := fset.File(f.FileStart)
+	var changes []Change
+	for _, d := range f.Decls {
+		fd, ok := d.(*ast.FuncDecl)
+		if !ok || fd.Body == nil {
+			continue
+		}
+		// Parameters count as declarations.
+		refs := make(map[string]int)
+		ast.Inspect(fd, func(n ast.Node) bool {
+			if ident, ok := n.(*ast.Ident); ok {
+				refs[ident.Name]++
+			}
+			return true
+		})
+		ast.Inspect(fd.Body, func(n ast.Node) bool {
+			name, ok := blankAssignment(n)
+			// The declaration and the statement are the only
+			// references.
+			if !ok || refs[name] != 2 {
+				return true
+			}
+			c, ok := adoption(code, tf, n, name)
+			if ok {
+				changes = append(changes, c)
+			}
+			return true
+		})
+	}
+	return changes
+}
+
+// blankAssignment returns the name of the variable n assigns to ‘_’ if it’s a
+// statement like ‘_ = x’.
+func blankAssignment(n ast.Node) (string, bool) {
+	s, ok := n.(*ast.AssignStmt)
+	if !ok || s.Tok != token.ASSIGN || len(s.Lhs) != 1 || len(s.Rhs) != 1 {
+		return "", false
+	}
+	lhs, ok := s.Lhs[0].(*ast.Ident)
+	if !ok || lhs.Name != "_" {
+		return "", false
+	}
+	rhs, ok := s.Rhs[0].(*ast.Ident)
+	if !ok || rhs.Name == "_" {
+		return "", false
+	}
+	return rhs.Name, true
+}
+
+// adoption returns a change which removes the statement n using the variable
+// name in code with the token file tf.
+func adoption(
+	code []byte, tf *token.File, n ast.Node, name string,
+) (Change, bool) {
+	start, end := tf.Offset(n.Pos()), tf.Offset(n.End())
+	// -1 is an adjustment for 0-based count.
+	lineNum := tf.Line(n.Pos()) - 1
+	lineStart := tf.Offset(tf.LineStart(lineNum + 1))
+	rest := code[end:]
+	if i := bytes.IndexByte(rest, '\n'); i >= 0 {
+		rest = rest[:i]
+	}
+	if len(bytes.TrimSpace(rest)) > 0 {
+		return Change{}, false
+	}
+	end += len(rest)
+	before := bytes.TrimRight(code[lineStart:start], " \t")
+	switch {
+	// The statement is removed with the preceding line break, like a fake
+	// usage moved by gofmt.
+	case len(bytes.TrimSpace(before)) == 0 && lineStart > 0:
+		start = lineStart - 1
+	case bytes.HasSuffix(before, []byte(";")):
+		start = lineStart + len(before) - 1
+	default:
+		return Change{}, false
+	}
+	return Change{
+		Action:  ActionRemove,
+		Name:    name,
+		LineNum: lineNum,
+		Start:   start,
+		End:     end,
+	}, true
+}
@@ -0,0 +1,61 @@
+package core
+
+import (
+	"context"
+	"testing"
+)
+
+func TestFindAdoptions(t *testing.T) {
+	input := []byte(`package p
+
+var global int
+
+func f(param int) {
+	notUsed0 := 1; _ = notUsed0
+	notUsed1 := 2
+	_ = notUsed1
+	used := 3
+	_ = used
+	println(used)
+	_ = global
+	_ = param
+	notUsed2 := 4; _ = notUsed2 // Keep it.
+	notUsed3 := 5; _ = notUsed3 /* TODO: gouse */
+}
+`)
+	want := `package p
+
+var global int
+
+func f(param int) {
+	notUsed0 := 1
+	notUsed1 := 2
+	used := 3
+	_ = used
+	println(used)
+	_ = global
+	notUsed2 := 4; _ = notUsed2 // Keep it.
+	notUsed3 := 5
+}
+`
+	ctx := context.Background()
+	ctx, cancel := context.WithCancel(ctx)
+	t.Cleanup(cancel)
+	opts := Options{Mode: ModeRemove, Adopt: true}
+	changes, err := FindChanges(ctx, input, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := ApplyChanges(input, changes)
+	if string(got) != want {
+		t.Errorf(filesCmpErr, got, want)
+	}
+	var names string
+	for _, c := range changes {
+		names += c.Name + " "
+	}
+	wantNames := "notUsed0 notUsed1 param notUsed3 "
+	if names != wantNames {
+		t.Errorf("got: %s, want: %s", names, wantNames)
+	}
+}
@@ -0,0 +1,6 @@
+//go:build !js && !wasip1
+
+package core
+
+// DefaultBackend is the default of ‘-backend’ flag.
+const DefaultBackend = BackendBuild
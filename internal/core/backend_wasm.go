@@ -0,0 +1,7 @@
+//go:build js || wasip1
+
+package core
+
+// DefaultBackend is the default of ‘-backend’ flag. WebAssembly can’t run the
+// go command.
+const DefaultBackend = BackendTypeCheck
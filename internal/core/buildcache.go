@@ -0,0 +1,157 @@
+package core
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+)
+
+// buildCacheSize is how many builds buildCache keeps.
+const buildCacheSize = 256
+
+// Builds caches symbols from build errors for the life of the process, so
+// servers and daemons, e.g. of ‘-daemon’ flag, don’t build unchanged code
+// again.
+var Builds = newBuildCache(buildCacheSize)
+
+// buildKey identifies a build of code with siblings checked for errors caught
+// by suffix in a build context. Builds are keyed by contents, so changed files
+// are built again.
+type buildKey [sha256.Size]byte
+
+// buildEnvVars are variables of the environment which change builds. Build
+// tags are passed in GOFLAGS, as gouse doesn’t pass ‘-tags’ itself.
+var buildEnvVars = []string{
+	"GOFLAGS", "GOOS", "GOARCH", "CGO_ENABLED", "GOEXPERIMENT",
+	"GO111MODULE", "GOWORK", "GOTOOLCHAIN",
+}
+
+// buildContext is what builds depend on besides the built files: the module
+// the go command runs in and the environment.
+type buildContext struct {
+	// modRoot is the directory of go.mod, empty outside of modules.
+	modRoot string
+	// mod and sum are the contents of go.mod and go.sum in modRoot.
+	mod, sum []byte
+	// env are the values of buildEnvVars.
+	env []string
+}
+
+// buildContextOf returns the build context of the go command run in dir.
+// The module is looked up in dir and its parents like the go command does.
+func buildContextOf(dir string) (buildContext, error) {
+	const thisName = "buildContextOf"
+
+	var bc buildContext
+	for _, name := range buildEnvVars {
+		bc.env = append(bc.env, os.Getenv(name))
+	}
+	for d := dir; ; d = filepath.Dir(d) {
+		mod, err := os.ReadFile(filepath.Join(d, "go.mod"))
+		if err == nil {
+			bc.modRoot, bc.mod = d, mod
+			break
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			format := thisName + ": in os.ReadFile: %v"
+			return buildContext{}, fmt.Errorf(format, err)
+		}
+		if filepath.Dir(d) == d {
+			return bc, nil
+		}
+	}
+	sum, err := os.ReadFile(filepath.Join(bc.modRoot, "go.sum"))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		format := thisName + ": in os.ReadFile: %v"
+		return buildContext{}, fmt.Errorf(format, err)
+	}
+	bc.sum = sum
+	return bc, nil
+}
+
+// newBuildKey returns the key of a build like getSymbolsInfoFromBuildErrors
+// takes.
+func newBuildKey(
+	code []byte, siblings map[string][]byte, suffix string, bc buildContext,
+) buildKey {
+	h := sha256.New()
+	// Lengths make the concatenation unambiguous.
+	write := func(b []byte) {
+		binary.Write(h, binary.LittleEndian, int64(len(b)))
+		h.Write(b)
+	}
+	write([]byte(bc.modRoot))
+	write(bc.mod)
+	write(bc.sum)
+	for _, v := range bc.env {
+		write([]byte(v))
+	}
+	write([]byte(suffix))
+	write(code)
+	names := make([]string, 0, len(siblings))
+	for name := range siblings {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		write([]byte(name))
+		write(siblings[name])
+	}
+	var k buildKey
+	h.Sum(k[:0])
+	return k
+}
+
+// buildCache keeps symbols of the latest builds, evicting the oldest ones
+// over its size.
+type buildCache struct {
+	mu      sync.Mutex
+	size    int
+	entries map[buildKey][]symbolInfo
+	// order are keys of entries, the oldest first.
+	order []buildKey
+	hits  int
+}
+
+func newBuildCache(size int) *buildCache {
+	return &buildCache{size: size, entries: map[buildKey][]symbolInfo{}}
+}
+
+// get returns the symbols of the build with the key, if it’s cached.
+func (c *buildCache) get(k buildKey) ([]symbolInfo, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	info, ok := c.entries[k]
+	if ok {
+		c.hits++
+	}
+	return slices.Clone(info), ok
+}
+
+// put caches the symbols of the build with the key.
+func (c *buildCache) put(k buildKey, info []symbolInfo) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.entries[k]; ok {
+		return
+	}
+	if len(c.order) == c.size {
+		delete(c.entries, c.order[0])
+		c.order = c.order[1:]
+	}
+	c.entries[k] = slices.Clone(info)
+	c.order = append(c.order, k)
+}
+
+// HitCount returns how many builds were taken from the cache.
+func (c *buildCache) HitCount() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.hits
+}
@@ -0,0 +1,162 @@
+package core
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestNewBuildKey(t *testing.T) {
+	t.Parallel()
+	code := []byte("package p")
+	siblings := map[string][]byte{"a.go": []byte("package p")}
+	suffix := notUsedErrorRegexpSuffix
+	bc := buildContext{modRoot: "/m", mod: []byte("module m")}
+	key := newBuildKey(code, siblings, suffix, bc)
+	for _, other := range []buildKey{
+		newBuildKey(code, nil, suffix, bc),
+		newBuildKey(code, siblings, noProviderErrorRegexpSuffix, bc),
+		newBuildKey([]byte("package q"), siblings, suffix, bc),
+		newBuildKey(
+			code,
+			map[string][]byte{"b.go": []byte("package p")},
+			suffix,
+			bc,
+		),
+		newBuildKey(code, siblings, suffix, buildContext{}),
+		newBuildKey(code, siblings, suffix, buildContext{
+			modRoot: "/n", mod: bc.mod,
+		}),
+		newBuildKey(code, siblings, suffix, buildContext{
+			modRoot: bc.modRoot, mod: bc.mod, sum: []byte("sum"),
+		}),
+		newBuildKey(code, siblings, suffix, buildContext{
+			modRoot: bc.modRoot, mod: bc.mod, env: []string{"js"},
+		}),
+	} {
+		if other == key {
+			t.Errorf("got: the same key for a different build")
+		}
+	}
+	if newBuildKey(code, siblings, suffix, bc) != key {
+		t.Errorf("got: a different key for the same build")
+	}
+}
+
+func TestBuildContextOf(t *testing.T) {
+	// Not parallel, as it sets the environment.
+	t.Setenv("GOFLAGS", "-tags=a")
+	root := t.TempDir()
+	dir := filepath.Join(root, "sub")
+	if err := os.Mkdir(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	mod := filepath.Join(root, "go.mod")
+	if err := os.WriteFile(mod, []byte("module m\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	code := []byte("package p")
+	suffix := notUsedErrorRegexpSuffix
+	keyIn := func() buildKey {
+		t.Helper()
+		bc, err := buildContextOf(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bc.modRoot != root {
+			format := "got: module root %q, want: %q"
+			t.Errorf(format, bc.modRoot, root)
+		}
+		return newBuildKey(code, nil, suffix, bc)
+	}
+	key := keyIn()
+	if keyIn() != key {
+		t.Errorf("got: a different key for the same build")
+	}
+	// A changed go.mod may change the build, e.g. of a newer go directive.
+	err := os.WriteFile(mod, []byte("module m\n\ngo 1.23\n"), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edited := keyIn()
+	if edited == key {
+		t.Errorf("got: the same key after go.mod was edited")
+	}
+	t.Setenv("GOFLAGS", "-tags=b")
+	if keyIn() == edited {
+		t.Errorf("got: the same key after GOFLAGS was changed")
+	}
+}
+
+func TestBuildCache(t *testing.T) {
+	t.Parallel()
+	c := newBuildCache(2)
+	keys := make([]buildKey, 3)
+	for i := range keys {
+		keys[i][0] = byte(i)
+	}
+	info := []symbolInfo{{name: "a", lineNum: 1}}
+	c.put(keys[0], info)
+	c.put(keys[1], nil)
+	got, ok := c.get(keys[0])
+	if !ok || !slices.Equal(got, info) {
+		t.Errorf("got: %v, %t, want: %v, true", got, ok, info)
+	}
+	// The oldest build is evicted.
+	c.put(keys[2], nil)
+	if _, ok := c.get(keys[0]); ok {
+		t.Errorf("got: %v cached, want: evicted", keys[0])
+	}
+	if _, ok := c.get(keys[2]); !ok {
+		t.Errorf("got: %v evicted, want: cached", keys[2])
+	}
+	if got := c.HitCount(); got != 2 {
+		t.Errorf("got: %d hits, want: 2", got)
+	}
+}
+
+func TestBuildsAfterGoModEdit(t *testing.T) {
+	// Not parallel, as it changes the working directory and counts hits of
+	// Builds.
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	mod := filepath.Join(dir, "go.mod")
+	// The go directive is set, so the go command doesn’t add it itself.
+	err = os.WriteFile(mod, []byte("module m\n\ngo 1.21\n"), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+	code := []byte("package main\n\nfunc main() {\n\tv := 1\n}\n")
+	build := func() {
+		t.Helper()
+		ctx := context.Background()
+		suffix := notUsedErrorRegexpSuffix
+		_, err := getSymbolsInfoFromBuildErrors(ctx, code, nil, suffix)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	build()
+	hits := Builds.HitCount()
+	build()
+	if got := Builds.HitCount(); got != hits+1 {
+		t.Errorf("got: %d hits, want: %d", got, hits+1)
+	}
+	err = os.WriteFile(mod, []byte("module m\n\ngo 1.22\n"), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	build()
+	if got := Builds.HitCount(); got != hits+1 {
+		t.Errorf("got: a cached build after go.mod was edited")
+	}
+}
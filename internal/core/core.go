@@ -0,0 +1,799 @@
+// Package core finds and applies changes which toggle fake usages of unused
+// variables. It’s the engine of the gouse command and of package toggle, which
+// exposes it to other tools.
+package core
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"go/parser"
+	"go/token"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/looshch/gouse/builderr"
+)
+
+const (
+	fakeUsageCommentPrefix = " /* TODO"
+	fakeUsageCommentTag    = ": gouse"
+	fakeUsageCommentSuffix = " */"
+	FakeUsageSuffix        = fakeUsageCommentPrefix + fakeUsageCommentTag +
+		fakeUsageCommentSuffix
+	fakeUsagePrefix = "; _ ="
+	// DateLayout is a layout of dates stamped into fake usages.
+	DateLayout = time.DateOnly
+	// IDPrefix precedes IDs stamped into fake usages, like in ‘gouse#3’.
+	IDPrefix = "#"
+
+	noProviderErrorRegexpSuffix = "no required module provides package"
+	commentPrefix               = "// "
+
+	notUsedErrorRegexpSuffix = "declared and not used:"
+)
+
+var (
+	// ErrNoToolchain is returned if code is to be built and the go
+	// command isn’t found.
+	ErrNoToolchain = errors.New("go command not found, install Go " +
+		"or use ‘-backend typecheck’")
+	// ErrBuildFailed is returned if the go command fails without
+	// errors of files.
+	ErrBuildFailed = errors.New("go build failed")
+)
+
+var (
+	// fakeUsageCommentRegexp catches an optional author, ID and date of a
+	// fake usage.
+	fakeUsageCommentRegexp = regexp.QuoteMeta(fakeUsageCommentPrefix) +
+		`(?:\(([^()*\n]+)\))?` +
+		regexp.QuoteMeta(fakeUsageCommentTag) +
+		`(?:` + IDPrefix + `(\d+))?` +
+		`(?: (\d{4}-\d{2}-\d{2}))?` +
+		regexp.QuoteMeta(fakeUsageCommentSuffix)
+	fakeUsageComment = regexp.MustCompile(fakeUsageCommentRegexp)
+	fakeUsage        = regexp.MustCompile(
+		fakeUsagePrefix + ".*?" + fakeUsageCommentRegexp,
+	)
+	fakeUsageAfterGofmt = regexp.MustCompile(
+		`\s*_\s*= \w*\s*` + fakeUsageCommentRegexp,
+	)
+)
+
+// Action is a kind of change toggle makes to code.
+type Action int
+
+const (
+	ActionAdd Action = iota
+	ActionRemove
+)
+
+func (a Action) String() string {
+	if a == ActionRemove {
+		return "remove"
+	}
+	return "add"
+}
+
+// Kind is what a change adds or removes.
+type Kind int
+
+const (
+	// KindVar is a fake usage of a variable.
+	KindVar Kind = iota
+	// KindImport is an import blanked by importAddition.
+	KindImport
+	// KindLabel is a label commented out by labelAddition.
+	KindLabel
+	// KindParam is a parameter renamed to ‘_’ by renameChange.
+	KindParam
+	// KindReceiver is a receiver renamed to ‘_’ by renameChange.
+	KindReceiver
+	// KindRange is a range variable renamed to ‘_’ by renameChange.
+	KindRange
+	// KindResults are results of a call assigned to ‘_’ by
+	// resultsAdditions.
+	KindResults
+	// KindDecl is a declaration commented out or deleted by declChange.
+	KindDecl
+)
+
+func (k Kind) String() string {
+	switch k {
+	case KindImport:
+		return "blanked import"
+	case KindLabel:
+		return "commented out label"
+	case KindParam:
+		return "renamed parameter"
+	case KindReceiver:
+		return "renamed receiver"
+	case KindRange:
+		return "renamed range variable"
+	case KindResults:
+		return "ignored results"
+	case KindDecl:
+		return "commented out declaration"
+	}
+	return "fake usage"
+}
+
+// Summary returns what c adds or removes with its name, e.g. ‘fake usage of
+// a’ or ‘renamed parameter ctx’.
+func (c Change) Summary() string {
+	switch c.Kind {
+	case KindLabel, KindParam, KindReceiver, KindRange:
+		return c.Kind.String() + " " + c.Name
+	}
+	return c.Kind.String() + " of " + c.Name
+}
+
+// Problem returns what c makes up for with its name, e.g. ‘unused variable
+// a’ or ‘unused import fmt’.
+func (c Change) Problem() string {
+	var symbol string
+	switch c.Kind {
+	case KindImport:
+		symbol = "import"
+	case KindLabel:
+		symbol = "label"
+	case KindParam:
+		symbol = "parameter"
+	case KindReceiver:
+		symbol = "receiver"
+	case KindRange:
+		symbol = "range variable"
+	case KindResults:
+		symbol = "results of"
+	default:
+		symbol = "variable"
+	}
+	return "unused " + symbol + " " + c.Name
+}
+
+// Change represents a single edit toggle makes to code: code[Start:End] is
+// replaced with Text. Kind is what is added or removed, and Name and LineNum
+// are the name of the variable, or another symbol Kind is of, and the 0-based
+// number of the line it’s on. Author, ID and Date are the ones stamped into
+// the fake usage, if any; ID is 0 if there is none.
+type Change struct {
+	Action     Action
+	Kind       Kind
+	Name       string
+	LineNum    int
+	Start, End int
+	Text       string
+	Author     string
+	ID         int
+	Date       string
+}
+
+// Mode limits which changes FindChanges looks for.
+type Mode int
+
+const (
+	// ModeToggle removes fake usages if there are any and adds them
+	// otherwise.
+	ModeToggle Mode = iota
+	ModeAdd
+	ModeRemove
+)
+
+// Options configures FindChanges.
+type Options struct {
+	Mode Mode
+	// Author and Date are stamped into created fake usages if they
+	// aren’t empty.
+	Author string
+	Date   string
+	// Siblings are other files of the package of code, keyed by names,
+	// which code is built with.
+	Siblings map[string][]byte
+	// Strategy is how unused variables are handled. The zero value is
+	// StrategyUse.
+	Strategy Strategy
+	// Adopt makes removal take hand-written fake usages found by
+	// findAdoptions too.
+	Adopt bool
+	// Number makes created fake usages stamped with IDs which follow the
+	// greatest one in code.
+	Number bool
+	// Params makes parameters which bodies of their functions don’t
+	// reference renamed to ‘_’, keeping their names in TODO comments.
+	Params bool
+	// Receivers makes receivers which bodies of their methods don’t
+	// reference renamed like Params does parameters.
+	Receivers bool
+	// Results makes results of calls which are statements of their own
+	// assigned to ‘_’, like ‘_, _ = f()’, with TODO comments.
+	Results bool
+	// Placement is where fake usages are created. The zero value is
+	// PlacementLine.
+	Placement Placement
+	// Style is how statements created on lines of their own with
+	// PlacementFunction are indented and ended.
+	Style EditorStyle
+	// Backend is how unused variables are found. The zero value is
+	// BackendBuild.
+	Backend Backend
+	// Finder, if it isn’t nil, finds changes instead, e.g. on a server
+	// with ‘-remote’ flag.
+	Finder Finder
+	// Render, if it isn’t nil, returns the text inserted at the end of
+	// the line of decl to create a fake usage of the variable name in
+	// place of ‘; _ = name’ followed by decl.Comment. Statements
+	// gathered with PlacementFunction and declarations handled with
+	// other strategies aren’t rendered with it.
+	Render func(name string, decl SyntaxInfo) string
+}
+
+// SyntaxInfo describes the declaration of a variable a fake usage is created
+// for.
+type SyntaxInfo struct {
+	// Line is the 1-based number of the line of the declaration.
+	Line int
+	// Code is the line without its line break.
+	Code string
+	// Comment is the comment of the fake usage, e.g.
+	// ‘ /* TODO(author): gouse */’. For the fake usage to be removed, the
+	// text of Options.Render must start with ‘; _ =’ and end with it.
+	Comment string
+}
+
+// Finder finds changes in code with opts in place of FindChanges.
+type Finder interface {
+	FindChanges(
+		ctx context.Context, code []byte, opts Options,
+	) ([]Change, error)
+}
+
+// FindChanges returns changes which toggle code. First it tries to find
+// previously created fake usages to remove. If there is none, it finds
+// unused variables to create fake usages for. opts.Mode limits it to either
+// of the two. Files marked with fileIgnoreDirective have no changes.
+func FindChanges(
+	ctx context.Context, code []byte, opts Options,
+) ([]Change, error) {
+	if fileIgnored(code) {
+		return nil, nil
+	}
+	if opts.Finder != nil {
+		changes, err := opts.Finder.FindChanges(ctx, code, opts)
+		if err != nil {
+			return nil, fmt.Errorf("FindChanges: %w", err)
+		}
+		return changes, nil
+	}
+	if opts.Mode != ModeAdd {
+		markers := FindMarkers(code)
+		if opts.Adopt {
+			for _, c := range findAdoptions(code) {
+				if !overlaps(markers, c) {
+					markers = append(markers, c)
+				}
+			}
+			sort.SliceStable(markers, func(i, j int) bool {
+				return markers[i].Start < markers[j].Start
+			})
+		}
+		if len(markers) > 0 {
+			return markers, nil
+		}
+	}
+	if opts.Mode == ModeRemove {
+		return nil, nil
+	}
+	changes, err := findAdditions(ctx, code, opts)
+	if err != nil {
+		return nil, fmt.Errorf("FindChanges: %w", err)
+	}
+	return changes, nil
+}
+
+// FindMarkers returns changes which remove every previously created fake
+// usage and restore every declaration commented out or deleted instead, every
+// import blanked, every identifier renamed to ‘_’, every label commented out
+// and every call whose results are assigned to ‘_’.
+func FindMarkers(code []byte) []Change {
+	// fakeUsage must be before fakeUsageAfterGofmt because it also removes
+	// the leading ‘;’.
+	markers := findRemovals(code, fakeUsage)
+	for _, c := range findRemovals(code, fakeUsageAfterGofmt) {
+		if !overlaps(markers, c) {
+			markers = append(markers, c)
+		}
+	}
+	for _, c := range findRemovals(code, gatheredFakeUsage) {
+		if !overlaps(markers, c) {
+			markers = append(markers, c)
+		}
+	}
+	for _, c := range findDeclMarkers(code) {
+		if !overlaps(markers, c) {
+			markers = append(markers, c)
+		}
+	}
+	for _, c := range findImportMarkers(code) {
+		if !overlaps(markers, c) {
+			markers = append(markers, c)
+		}
+	}
+	for _, c := range findRenameMarkers(code) {
+		if !overlaps(markers, c) {
+			markers = append(markers, c)
+		}
+	}
+	for _, c := range findLabelMarkers(code) {
+		if !overlaps(markers, c) {
+			markers = append(markers, c)
+		}
+	}
+	for _, c := range findResultsMarkers(code) {
+		if !overlaps(markers, c) {
+			markers = append(markers, c)
+		}
+	}
+	sort.SliceStable(markers, func(i, j int) bool {
+		return markers[i].Start < markers[j].Start
+	})
+	return markers
+}
+
+// maxMarkerID returns the greatest ID stamped into fake usages and other
+// markers in code or 0 if there is none.
+func maxMarkerID(code []byte) int {
+	var ids [][]byte
+	for _, m := range fakeUsageComment.FindAllSubmatch(code, -1) {
+		ids = append(ids, m[2])
+	}
+	for _, m := range deletedDecl.FindAllSubmatch(code, -1) {
+		ids = append(ids, m[3])
+	}
+	for _, m := range blankedImport.FindAllSubmatch(code, -1) {
+		ids = append(ids, m[5])
+	}
+	for _, m := range renamedIdent.FindAllSubmatch(code, -1) {
+		ids = append(ids, m[2])
+	}
+	for _, m := range commentedLabel.FindAllSubmatch(code, -1) {
+		ids = append(ids, m[3])
+	}
+	for _, m := range silencedCall.FindAllSubmatch(code, -1) {
+		ids = append(ids, m[4])
+	}
+	var maxID int
+	for _, b := range ids {
+		if id, err := strconv.Atoi(string(b)); err == nil {
+			maxID = max(maxID, id)
+		}
+	}
+	return maxID
+}
+
+// overlaps reports whether c overlaps any of changes.
+func overlaps(changes []Change, c Change) bool {
+	for _, other := range changes {
+		if c.Start < other.End && other.Start < c.End {
+			return true
+		}
+	}
+	return false
+}
+
+// fakeUsageName catches the name of a variable from a fake usage or names of
+// variables from a gathered one.
+var fakeUsageName = regexp.MustCompile(`_\s*=\s*(\w+(?:,\s*\w+)*)`)
+
+// findRemovals returns changes which remove every fake usage matched by r.
+func findRemovals(code []byte, r *regexp.Regexp) []Change {
+	var changes []Change
+	for _, m := range r.FindAllIndex(code, -1) {
+		start, end := m[0], m[1]
+		c := Change{Action: ActionRemove, Start: start, End: end}
+		n := fakeUsageName.FindSubmatchIndex(code[start:end])
+		if n != nil {
+			nameStart := start + n[2]
+			c.Name = string(code[nameStart : start+n[3]])
+			// fakeUsageAfterGofmt catches the preceding line
+			// break, so the line number is counted from the name.
+			c.LineNum = bytes.Count(code[:nameStart], []byte("\n"))
+		}
+		comment := fakeUsageComment.FindSubmatch(code[start:end])
+		c.Author, c.Date = string(comment[1]), string(comment[3])
+		c.ID, _ = strconv.Atoi(string(comment[2]))
+		changes = append(changes, c)
+	}
+	return changes
+}
+
+// findAdditions returns changes which create fake usages for unused variables
+// from build errors.
+func findAdditions(
+	ctx context.Context, code []byte, opts Options,
+) ([]Change, error) {
+	// Code which doesn’t parse doesn’t build either, so there are no
+	// unused variables to find, and it’s kept as is, e.g. while it’s
+	// being typed.
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(
+		fset, "", code, parser.SkipObjectResolution,
+	)
+	if err != nil {
+		return nil, nil
+	}
+	tf := fset.File(f.FileStart)
+	// Lines are found by offsets rather than by splitting code, so large
+	// files aren’t copied line by line.
+	starts := lineStarts(code)
+	symbols := getSymbolsInfoFromBuildErrors
+	if opts.Backend == BackendTypeCheck {
+		symbols = func(
+			_ context.Context,
+			code []byte,
+			siblings map[string][]byte,
+			suffix string,
+		) ([]symbolInfo, error) {
+			return typeCheckSymbols(code, siblings, suffix)
+		}
+	}
+	// Check for problematic imports and comment them out if any.
+	importsWithoutProviderInfo, err := symbols(
+		ctx, code, opts.Siblings, noProviderErrorRegexpSuffix,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("findAdditions: %w", err)
+	}
+	// code is only copied if there are imports to comment out.
+	commented := code
+	if len(importsWithoutProviderInfo) > 0 {
+		comments := make([]Change, len(importsWithoutProviderInfo))
+		for i, info := range importsWithoutProviderInfo {
+			start := starts[info.lineNum]
+			comments[i] = Change{
+				Start: start, End: start, Text: commentPrefix,
+			}
+		}
+		commented = ApplyChanges(code, comments)
+	}
+	// Check for ‘declared and not used’ errors and create fake usages for
+	// them if any. Unused imports are blanked.
+	notUsedVarsInfo, err := symbols(
+		ctx, commented, opts.Siblings, notUsedErrorRegexpSuffix,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("findAdditions: %w", err)
+	}
+	var id int
+	if opts.Number {
+		id = maxMarkerID(code)
+	}
+	unused := make(map[int]map[string]bool)
+	for _, info := range notUsedVarsInfo {
+		if info.kind != symbolVar {
+			continue
+		}
+		if unused[info.lineNum] == nil {
+			unused[info.lineNum] = make(map[string]bool)
+		}
+		unused[info.lineNum][strings.TrimSpace(info.name)] = true
+	}
+	renames := rangeRenames(f, tf, unused)
+	var changes []Change
+	for _, info := range notUsedVarsInfo {
+		if ignored(code, starts, info.lineNum) {
+			continue
+		}
+		if opts.Number {
+			id++
+		}
+		switch info.kind {
+		case symbolImport:
+			c, ok := importAddition(
+				code, tf, f, starts, info, id, opts,
+			)
+			if ok {
+				changes = append(changes, c)
+			}
+			continue
+		case symbolLabel:
+			c, ok := labelAddition(tf, f, info, id, opts)
+			if ok {
+				changes = append(changes, c)
+			}
+			continue
+		}
+		name := strings.TrimSpace(info.name)
+		// Range variables are renamed to ‘_’ rather than used.
+		if ident, ok := renames[info.lineNum][name]; ok {
+			c := renameChange(tf, ident, KindRange, id, opts)
+			changes = append(changes, c)
+			continue
+		}
+		end := lineEnd(code, starts, info.lineNum)
+		suffix := fakeUsageCommentText(opts, id)
+		text := fakeUsagePrefix + " " + name + suffix
+		if opts.Render != nil {
+			text = opts.Render(name, SyntaxInfo{
+				// +1 is an adjustment for 1-based count.
+				Line:    info.lineNum + 1,
+				Code:    string(code[starts[info.lineNum]:end]),
+				Comment: suffix,
+			})
+		}
+		changes = append(changes, Change{
+			Action:  ActionAdd,
+			Name:    name,
+			LineNum: info.lineNum,
+			Start:   end,
+			End:     end,
+			Text:    text,
+			Author:  opts.Author,
+			ID:      id,
+			Date:    opts.Date,
+		})
+	}
+	changes = declChanges(code, changes, opts)
+	changes = gatherAdditions(code, changes, opts)
+	if opts.Params || opts.Receivers {
+		renamed := renameAdditions(code, tf, f, starts, id, opts)
+		changes = append(changes, renamed...)
+		if n := len(renamed); n > 0 {
+			id = renamed[n-1].ID
+		}
+	}
+	if opts.Results {
+		silenced := resultsAdditions(
+			code, opts.Siblings, starts, id, opts,
+		)
+		changes = append(changes, silenced...)
+	}
+	return changes, nil
+}
+
+// fakeUsageCommentText returns the comment of fake usages created with opts
+// and, if it isn’t 0, id.
+func fakeUsageCommentText(opts Options, id int) string {
+	comment := fakeUsageCommentPrefix
+	if opts.Author != "" {
+		comment += "(" + opts.Author + ")"
+	}
+	comment += fakeUsageCommentTag
+	if id > 0 {
+		comment += IDPrefix + strconv.Itoa(id)
+	}
+	if opts.Date != "" {
+		comment += " " + opts.Date
+	}
+	return comment + fakeUsageCommentSuffix
+}
+
+// lineStarts returns offsets of the starts of lines of code.
+func lineStarts(code []byte) []int {
+	starts := []int{0}
+	for o := 0; ; {
+		i := bytes.IndexByte(code[o:], '\n')
+		if i < 0 {
+			return starts
+		}
+		o += i + 1
+		starts = append(starts, o)
+	}
+}
+
+// lineEnd returns the offset of the end of the line with 0-based number
+// lineNum in code with line starts.
+func lineEnd(code []byte, starts []int, lineNum int) int {
+	if lineNum+1 < len(starts) {
+		// -1 is an adjustment for the line break.
+		return starts[lineNum+1] - 1
+	}
+	return len(code)
+}
+
+// lineAt returns the line with 0-based number lineNum in code with line
+// starts, without the line break.
+func lineAt(code []byte, starts []int, lineNum int) []byte {
+	return code[starts[lineNum]:lineEnd(code, starts, lineNum)]
+}
+
+// ApplyChanges returns code with changes applied. changes must not overlap.
+func ApplyChanges(code []byte, changes []Change) []byte {
+	sorted := make([]Change, len(changes))
+	copy(sorted, changes)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Start < sorted[j].Start
+	})
+	// The result is allocated once, so large files aren’t copied as the
+	// buffer grows.
+	size := len(code)
+	for _, c := range sorted {
+		size += len(c.Text) - (c.End - c.Start)
+	}
+	var b bytes.Buffer
+	b.Grow(size)
+	var last int
+	for _, c := range sorted {
+		b.Write(code[last:c.Start])
+		b.WriteString(c.Text)
+		last = c.End
+	}
+	b.Write(code[last:])
+	return b.Bytes()
+}
+
+// symbolKind is what a symbol from build errors is.
+type symbolKind int
+
+const (
+	// symbolVar is a variable or any other symbol caught by a prefix of
+	// errors.
+	symbolVar symbolKind = iota
+	// symbolImport is the path of an unused import.
+	symbolImport
+	// symbolLabel is an unused label.
+	symbolLabel
+)
+
+// symbolInfo represents name, line number and kind of symbols (variables,
+// functions, imports, etc.) from build errors.
+type symbolInfo struct {
+	name    string
+	lineNum int
+	kind    symbolKind
+}
+
+const GoFileExt = ".go"
+
+// BuildError is an error of the go command building code. Err is
+// ErrNoToolchain or ErrBuildFailed, and Output is what it printed, if it ran.
+type BuildError struct {
+	Output []byte
+	Err    error
+}
+
+func (e *BuildError) Error() string {
+	output := strings.TrimSpace(string(e.Output))
+	if output == "" {
+		return e.Err.Error()
+	}
+	return e.Err.Error() + ": " + output
+}
+
+func (e *BuildError) Unwrap() error { return e.Err }
+
+// getSymbolsInfoFromBuildErrors tries to build code with siblings and checks
+// a build stdout for errors of code catched by r. If any, it returns a slice of
+// structs with a line and a name of every catched symbol. Results are cached
+// in builds.
+func getSymbolsInfoFromBuildErrors(
+	ctx context.Context,
+	code []byte,
+	siblings map[string][]byte,
+	suffix string,
+) ([]symbolInfo, error) {
+	select {
+	case <-ctx.Done():
+		return nil, nil
+	default:
+		const thisName = "getSymbolsInfoFromBuildErrors"
+
+		wd, err := os.Getwd()
+		if err != nil {
+			format := thisName + ": in os.Getwd: %v"
+			return nil, fmt.Errorf(format, err)
+		}
+		bc, err := buildContextOf(wd)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", thisName, err)
+		}
+		key := newBuildKey(code, siblings, suffix, bc)
+		if info, ok := Builds.get(key); ok {
+			return info, nil
+		}
+		td, err := MakeTempDir()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", thisName, err)
+		}
+		defer os.RemoveAll(td)
+		tf, err := os.CreateTemp(td, "*"+GoFileExt)
+		if err != nil {
+			format := thisName + ": in os.CreateTemp: %v"
+			return nil, fmt.Errorf(format, err)
+		}
+		defer tf.Close()
+		tf.Write(code)
+		args := []string{"build", "-o", os.DevNull}
+		if len(siblings) > 0 {
+			// Otherwise errors of siblings may hide the ones of
+			// code after the 10th error.
+			args = append(args, "-gcflags=-e")
+		}
+		args = append(args, tf.Name())
+		for name, sibling := range siblings {
+			p := filepath.Join(td, filepath.Base(name))
+			if err := os.WriteFile(p, sibling, 0o644); err != nil {
+				format := thisName + ": in os.WriteFile: %v"
+				return nil, fmt.Errorf(format, err)
+			}
+			args = append(args, p)
+		}
+		boutput, err := exec.Command("go", args...).CombinedOutput()
+		if errors.Is(err, exec.ErrNotFound) {
+			berr := &BuildError{Err: ErrNoToolchain}
+			return nil, fmt.Errorf("%s: %w", thisName, berr)
+		}
+		if err == nil {
+			Builds.put(key, nil)
+			return nil, nil
+		}
+		// The go command failed before building, e.g. of a broken
+		// toolchain or GOFLAGS, if it printed no errors of files.
+		if len(builderr.Parse(boutput)) == 0 {
+			berr := &BuildError{
+				Output: boutput, Err: ErrBuildFailed,
+			}
+			return nil, fmt.Errorf("%s: %w", thisName, berr)
+		}
+		// Errors of siblings are told apart by the file name.
+		base := strings.TrimSuffix(filepath.Base(tf.Name()), GoFileExt)
+		info := parseSymbolErrors(boutput, base, suffix)
+		Builds.put(key, info)
+		return info, nil
+	}
+}
+
+// parseSymbolErrors returns a line and a name of every symbol from errors in
+// the build output of the file with the base name without the extension
+// whose messages start with prefix. Names are the rest of the messages.
+func parseSymbolErrors(output []byte, base, prefix string) []symbolInfo {
+	var info []symbolInfo
+	for _, e := range builderr.Parse(output) {
+		// Paths are split on both separators, as the build may run on
+		// Windows.
+		name := e.File[strings.LastIndexAny(e.File, `/\`)+1:]
+		if name != base+GoFileExt {
+			continue
+		}
+		symbol, ok := symbolOf(e.Message, prefix)
+		if !ok {
+			continue
+		}
+		// -1 is an adjustment for 0-based count.
+		symbol.lineNum = e.Line - 1
+		info = append(info, symbol)
+	}
+	return info
+}
+
+// symbolOf returns the symbol of an error with message which starts with
+// prefix; its name is the rest of message. Errors of unused imports and labels
+// are caught along with notUsedErrorRegexpSuffix, as the same build reports
+// them all.
+func symbolOf(message, prefix string) (symbolInfo, bool) {
+	if rest, ok := strings.CutPrefix(message, prefix); ok {
+		return symbolInfo{name: rest}, true
+	}
+	if prefix != notUsedErrorRegexpSuffix {
+		return symbolInfo{}, false
+	}
+	if m := notUsedLabel.FindStringSubmatch(message); m != nil {
+		return symbolInfo{name: m[1], kind: symbolLabel}, true
+	}
+	m := notUsedImport.FindStringSubmatch(message)
+	if m == nil {
+		return symbolInfo{}, false
+	}
+	p, err := strconv.Unquote(m[1])
+	if err != nil {
+		return symbolInfo{}, false
+	}
+	return symbolInfo{name: p, kind: symbolImport}, true
+}
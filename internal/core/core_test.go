@@ -0,0 +1,392 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// testdata is the directory of test files shared with the gouse command.
+var testdata = filepath.Join("..", "..", "testdata")
+
+const filesCmpErr = `
+========= got:
+%s
+========= want:
+%s`
+
+const getSymbolsInfoFromBuildErrorsInput = `
+	package p
+
+	func main() {
+	var (
+		notUsed0 = false
+		used0    bool
+	)
+	notUsed1, used1 := "", "", "" // more values than variables
+	_, _ = used0, used1 // no closing brace
+`
+
+func TestGetSymbolsInfoFromBuildErrors(t *testing.T) {
+	ctx := context.Background()
+	ctx, cancel := context.WithCancel(ctx)
+	t.Cleanup(cancel)
+	t.Run("ignore other errors", func(t *testing.T) {
+		t.Parallel()
+		input := []byte(
+			getSymbolsInfoFromBuildErrorsInput,
+		)
+		want := []symbolInfo{
+			{"notUsed0", 5, symbolVar},
+			{"notUsed1", 8, symbolVar},
+		}
+		got, err := getSymbolsInfoFromBuildErrors(
+			ctx, input, nil, notUsedErrorRegexpSuffix,
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, info := range got {
+			if info.name != want[i].name {
+				t.Errorf(
+					"got: %s, want: %s",
+					info.name,
+					want[i].name,
+				)
+			}
+			if info.lineNum != want[i].lineNum {
+				t.Errorf(
+					"got: %d, want: %d",
+					info.lineNum,
+					want[i].lineNum,
+				)
+			}
+		}
+	})
+}
+
+func TestGetSymbolsInfoFromBuildErrorsFailure(t *testing.T) {
+	t.Setenv("GOFLAGS", "-mod=bogus")
+	input := []byte("package p\n\nfunc f() {\n\tbogus := 0\n}\n")
+	_, err := getSymbolsInfoFromBuildErrors(
+		context.Background(), input, nil, notUsedErrorRegexpSuffix,
+	)
+	var berr *BuildError
+	if !errors.Is(err, ErrBuildFailed) || !errors.As(err, &berr) ||
+		!bytes.Contains(berr.Output, []byte("-mod=bogus")) {
+		t.Errorf("got: %v, want: %v with output", err, ErrBuildFailed)
+	}
+}
+
+func TestParseSymbolErrors(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name   string
+		output string
+		want   []symbolInfo
+	}{
+		{
+			"unix path",
+			"# command-line-arguments\n" +
+				"/tmp/gouse1/2.go:4:2: " +
+				"declared and not used: x\n",
+			[]symbolInfo{{"x", 3, symbolVar}},
+		},
+		{
+			"windows path",
+			`C:\Users\a\gouse1\2.go:12:3: ` +
+				"declared and not used: y\r\n",
+			[]symbolInfo{{"y", 11, symbolVar}},
+		},
+		{
+			"colons in path",
+			`C:\a:b\2.go:7:2: declared and not used: z` + "\n" +
+				"/a:1:2/2.go:9:5: declared and not used: w\n",
+			[]symbolInfo{{"z", 6, symbolVar}, {"w", 8, symbolVar}},
+		},
+		{
+			"other files and errors",
+			`C:\gouse1\12.go:4:2: declared and not used: x` + "\n" +
+				`C:\gouse1\2.go:5:2: undefined: y` + "\n",
+			nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			output := []byte(tt.output)
+			got := parseSymbolErrors(
+				output, "2", notUsedErrorRegexpSuffix,
+			)
+			for i := range got {
+				got[i].name = strings.TrimSpace(got[i].name)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got: %v, want: %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFindChanges(t *testing.T) {
+	ctx := context.Background()
+	ctx, cancel := context.WithCancel(ctx)
+	t.Cleanup(cancel)
+	add, remove := ActionAdd, ActionRemove
+	tests := []struct {
+		filename string
+		mode     Mode
+		want     []Change
+	}{
+		{
+			filename: "not_used.input",
+			want: []Change{
+				{Action: add, Name: "notUsed0", LineNum: 7},
+				{Action: add, Name: "notUsed1", LineNum: 10},
+			},
+		},
+		{
+			filename: "used.input",
+			want: []Change{
+				{Action: remove, Name: "notUsed0", LineNum: 6},
+				{Action: remove, Name: "notUsed1", LineNum: 9},
+			},
+		},
+		{
+			filename: "used_gofmted.input",
+			want: []Change{
+				{Action: remove, Name: "notUsed0", LineNum: 7},
+				{Action: remove, Name: "notUsed1", LineNum: 11},
+			},
+		},
+		{
+			filename: "used.input",
+			mode:     ModeAdd,
+		},
+		{
+			filename: "not_used.input",
+			mode:     ModeRemove,
+		},
+	}
+	for _, tt := range tests {
+		test := tt
+		name := fmt.Sprintf("%s %d", test.filename, test.mode)
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			input, err := os.ReadFile(
+				filepath.Join(testdata, test.filename),
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := FindChanges(
+				ctx, input, Options{Mode: test.mode},
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != len(test.want) {
+				t.Fatalf("got: %v, want: %v", got, test.want)
+			}
+			for i, c := range got {
+				w := test.want[i]
+				if c.Action != w.Action || c.Name != w.Name ||
+					c.LineNum != w.LineNum {
+					t.Errorf("got: %v, want: %v", c, w)
+				}
+			}
+		})
+	}
+}
+
+func TestFindMarkers(t *testing.T) {
+	input := []byte(`package p
+
+func main() {
+	notUsed0, notUsed1 := "", ""; _ = notUsed0 /* TODO: gouse */
+	_ = notUsed1 /* TODO: gouse */
+}
+`)
+	want := `package p
+
+func main() {
+	notUsed0, notUsed1 := "", ""
+}
+`
+	markers := FindMarkers(input)
+	if len(markers) != 2 {
+		t.Fatalf("got: %v, want 2 markers", markers)
+	}
+	if got := ApplyChanges(input, markers); string(got) != want {
+		t.Errorf(filesCmpErr, got, want)
+	}
+}
+
+func TestFindChangesKinds(t *testing.T) {
+	ctx := context.Background()
+	ctx, cancel := context.WithCancel(ctx)
+	t.Cleanup(cancel)
+	input := []byte(`package p
+
+import "strings"
+
+type T struct{}
+
+func (r T) m(a int) {
+L:
+	for i, v := range []int{} {
+		println(v)
+	}
+	x := 1
+	f()
+}
+
+func f() int { return 0 }
+`)
+	opts := Options{Params: true, Receivers: true, Results: true}
+	changes, err := FindChanges(ctx, input, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"blanked import of strings",
+		"commented out label L",
+		"fake usage of x",
+		"ignored results of f",
+		"renamed parameter a",
+		"renamed range variable i",
+		"renamed receiver r",
+	}
+	summaries := func(changes []Change) []string {
+		var got []string
+		for _, c := range changes {
+			got = append(got, c.Summary())
+		}
+		slices.Sort(got)
+		return got
+	}
+	if got := summaries(changes); !slices.Equal(got, want) {
+		t.Errorf("got: %q, want: %q", got, want)
+	}
+	// Markers are told apart the same way.
+	markers := FindMarkers(ApplyChanges(input, changes))
+	if got := summaries(markers); !slices.Equal(got, want) {
+		t.Errorf("got: %q of markers, want: %q", got, want)
+	}
+}
+
+func TestFindChangesStamps(t *testing.T) {
+	ctx := context.Background()
+	ctx, cancel := context.WithCancel(ctx)
+	t.Cleanup(cancel)
+	input, err := os.ReadFile(filepath.Join(testdata, "not_used.input"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := Options{Mode: ModeAdd, Author: "alice", Date: "2024-06-01"}
+	changes, err := FindChanges(ctx, input, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	toggled := ApplyChanges(input, changes)
+	// Removal must find the author and date back.
+	for _, c := range FindMarkers(toggled) {
+		if c.Author != opts.Author || c.Date != opts.Date {
+			t.Errorf("got: %v, want: %v", c, opts)
+		}
+	}
+	want := "notUsed0 = false; " +
+		"_ = notUsed0 /* TODO(alice): gouse 2024-06-01 */"
+	if !bytes.Contains(toggled, []byte(want)) {
+		t.Errorf("got: %s, want in it: %s", toggled, want)
+	}
+}
+
+func TestFindChangesRender(t *testing.T) {
+	t.Parallel()
+	const code = "package p\n\nfunc f() {\n\ta := 0\n}\n"
+	var decls []SyntaxInfo
+	opts := Options{
+		Mode:    ModeAdd,
+		Backend: BackendTypeCheck,
+		Render: func(name string, decl SyntaxInfo) string {
+			decls = append(decls, decl)
+			return "; _ = " + name + "; println(" + name + ")" +
+				decl.Comment
+		},
+	}
+	changes, err := FindChanges(context.Background(), []byte(code), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := ApplyChanges([]byte(code), changes)
+	want := "package p\n\nfunc f() {\n" +
+		"\ta := 0; _ = a; println(a) /* TODO: gouse */\n}\n"
+	if string(got) != want {
+		t.Errorf(filesCmpErr, got, want)
+	}
+	wantDecl := SyntaxInfo{
+		Line: 4, Code: "\ta := 0", Comment: " /* TODO: gouse */",
+	}
+	if len(decls) != 1 || decls[0] != wantDecl {
+		t.Errorf("got: %+v, want: [%+v]", decls, wantDecl)
+	}
+	// Rendered fake usages are removed like others.
+	removed := ApplyChanges(got, FindMarkers(got))
+	if string(removed) != code {
+		t.Errorf(filesCmpErr, removed, code)
+	}
+}
+
+func TestFindChangesNumber(t *testing.T) {
+	ctx := context.Background()
+	ctx, cancel := context.WithCancel(ctx)
+	t.Cleanup(cancel)
+	input := []byte(`package p
+
+func main() {
+	used := 0; _ = used /* TODO(alice): gouse#4 2024-06-01 */
+	notUsed0, notUsed1 := 1, 2
+}
+`)
+	opts := Options{Mode: ModeAdd, Number: true}
+	changes, err := FindChanges(ctx, input, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	toggled := ApplyChanges(input, changes)
+	want := `notUsed0, notUsed1 := 1, 2; ` +
+		`_ = notUsed0 /* TODO: gouse#5 */; ` +
+		`_ = notUsed1 /* TODO: gouse#6 */`
+	if !bytes.Contains(toggled, []byte(want)) {
+		t.Errorf("got: %s, want in it: %s", toggled, want)
+	}
+	// Removal must find IDs back.
+	var ids []int
+	for _, c := range FindMarkers(toggled) {
+		ids = append(ids, c.ID)
+	}
+	if fmt.Sprint(ids) != "[4 5 6]" {
+		t.Errorf("got: %v, want: %v", ids, []int{4, 5, 6})
+	}
+}
+
+func TestLineStarts(t *testing.T) {
+	t.Parallel()
+	code := []byte("a\n\nbc\nd")
+	starts := lineStarts(code)
+	if want := []int{0, 2, 3, 6}; !slices.Equal(starts, want) {
+		t.Fatalf("got: %v, want: %v", starts, want)
+	}
+	for n, want := range []string{"a", "", "bc", "d"} {
+		if got := lineAt(code, starts, n); string(got) != want {
+			t.Errorf("%d: got: %q, want: %q", n, got, want)
+		}
+	}
+}
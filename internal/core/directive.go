@@ -0,0 +1,47 @@
+package core
+
+import "bytes"
+
+const (
+	// ignoreDirective on or above the line of a declaration makes gouse
+	// never create fake usages for variables declared there, so
+	// deliberately unused ones keep producing compiler errors.
+	ignoreDirective = "//gouse:ignore"
+	// fileIgnoreDirective on a line of its own before the package clause
+	// excludes the whole file from toggling, e.g. a generated one.
+	fileIgnoreDirective = "//gouse:file ignore"
+)
+
+var packageClause = []byte("package ")
+
+// fileIgnored reports whether code is marked with fileIgnoreDirective.
+func fileIgnored(code []byte) bool {
+	// Lines are taken one by one, as only the ones before the package
+	// clause matter.
+	for len(code) > 0 {
+		l, rest, _ := bytes.Cut(code, []byte("\n"))
+		code = rest
+		l = bytes.TrimSpace(l)
+		if bytes.HasPrefix(l, packageClause) {
+			return false
+		}
+		if string(l) == fileIgnoreDirective {
+			return true
+		}
+	}
+	return false
+}
+
+// ignored reports whether the line with 0-based number lineNum in code with
+// line starts is marked with ignoreDirective.
+func ignored(code []byte, starts []int, lineNum int) bool {
+	directive := []byte(ignoreDirective)
+	if bytes.Contains(lineAt(code, starts, lineNum), directive) {
+		return true
+	}
+	if lineNum == 0 {
+		return false
+	}
+	previous := lineAt(code, starts, lineNum-1)
+	return bytes.HasPrefix(bytes.TrimSpace(previous), directive)
+}
@@ -0,0 +1,68 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+func TestFindChangesIgnored(t *testing.T) {
+	ctx := context.Background()
+	ctx, cancel := context.WithCancel(ctx)
+	t.Cleanup(cancel)
+	input := []byte(`package p
+
+func main() {
+	notUsed0 := 0 //gouse:ignore
+	//gouse:ignore until the parser lands
+	notUsed1 := 1
+	notUsed2 := 2
+}
+`)
+	changes, err := FindChanges(ctx, input, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 1 || changes[0].Name != "notUsed2" {
+		t.Errorf("got: %v, want: notUsed2", changes)
+	}
+}
+
+func TestFindChangesFileIgnored(t *testing.T) {
+	ctx := context.Background()
+	ctx, cancel := context.WithCancel(ctx)
+	t.Cleanup(cancel)
+	tests := []struct {
+		input string
+		want  int
+	}{
+		{
+			input: "// Code generated by x. DO NOT EDIT.\n\n" +
+				"//gouse:file ignore\n\npackage p\n\n" +
+				"func main() {\n\tnotUsed := 0\n}\n",
+		},
+		{
+			input: "package p\n\n//gouse:file ignore\n\n" +
+				"func main() {\n\tnotUsed := 0\n}\n",
+			want: 1,
+		},
+	}
+	for _, tt := range tests {
+		test := tt
+		t.Run(fmt.Sprint(test.want), func(t *testing.T) {
+			t.Parallel()
+			changes, err := FindChanges(
+				ctx, []byte(test.input), Options{},
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(changes) != test.want {
+				t.Errorf(
+					"got: %d changes, want: %d",
+					len(changes), test.want,
+				)
+			}
+		})
+	}
+}
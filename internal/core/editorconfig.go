@@ -0,0 +1,242 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// editorconfigName is the name of files with editor settings of projects, see
+// https://editorconfig.org.
+const editorconfigName = ".editorconfig"
+
+// defaultIndentSize is the number of spaces of an indentation level if
+// .editorconfig sets spaces without a size.
+const defaultIndentSize = 4
+
+// EditorStyle is how statements created on lines of their own are indented
+// and ended, as .editorconfig files say. The zero value is a tab and ‘\n’, the
+// style of gofmt.
+type EditorStyle struct {
+	// indent is one level of indentation.
+	indent string
+	// eol is the line ending.
+	eol string
+}
+
+// EditorStyleFor returns the style of the file p set by .editorconfig files in
+// its directory and the ones above it, up to the one with ‘root = true’.
+// Closer files take precedence, and so do later sections of a file.
+func EditorStyleFor(p string) (EditorStyle, error) {
+	const thisName = "EditorStyleFor"
+
+	abs, err := filepath.Abs(p)
+	if err != nil {
+		format := thisName + ": in filepath.Abs: %v"
+		return EditorStyle{}, fmt.Errorf(format, err)
+	}
+	// The closest file goes first.
+	var configs []editorconfig
+	for dir := filepath.Dir(abs); ; {
+		path := filepath.Join(dir, editorconfigName)
+		c, err := readEditorconfig(path)
+		if err != nil {
+			return EditorStyle{}, fmt.Errorf(thisName+": %v", err)
+		}
+		c.dir = dir
+		configs = append(configs, c)
+		parent := filepath.Dir(dir)
+		if c.root || parent == dir {
+			break
+		}
+		dir = parent
+	}
+	props := make(map[string]string)
+	for i := len(configs) - 1; i >= 0; i-- {
+		c := configs[i]
+		rel, err := filepath.Rel(c.dir, abs)
+		if err != nil {
+			format := thisName + ": in filepath.Rel: %v"
+			return EditorStyle{}, fmt.Errorf(format, err)
+		}
+		for _, s := range c.sections {
+			if s.glob.MatchString(filepath.ToSlash(rel)) {
+				for k, v := range s.props {
+					props[k] = v
+				}
+			}
+		}
+	}
+	return styleOf(props), nil
+}
+
+// styleOf returns the style set by properties of .editorconfig files.
+func styleOf(props map[string]string) EditorStyle {
+	var style EditorStyle
+	if props["indent_style"] == "space" {
+		size, err := strconv.Atoi(props["indent_size"])
+		if err != nil {
+			size, err = strconv.Atoi(props["tab_width"])
+		}
+		if err != nil || size <= 0 {
+			size = defaultIndentSize
+		}
+		style.indent = strings.Repeat(" ", size)
+	}
+	// Carriage returns alone end lines nowhere Go runs.
+	if props["end_of_line"] == "crlf" {
+		style.eol = "\r\n"
+	}
+	return style
+}
+
+// editorconfig is an .editorconfig file in the directory dir.
+type editorconfig struct {
+	dir string
+	// root reports whether files above dir are ignored.
+	root     bool
+	sections []editorconfigSection
+}
+
+// editorconfigSection is a section of an .editorconfig file whose properties
+// apply to files which the glob of its header matches.
+type editorconfigSection struct {
+	// glob matches slash-separated paths relative to the directory of the
+	// file, see editorconfigGlob.
+	glob *regexp.Regexp
+	// props are keyed by lowercase names.
+	props map[string]string
+}
+
+// readEditorconfig parses the .editorconfig file at path. A missing file has
+// no sections, and sections with invalid globs are skipped.
+func readEditorconfig(path string) (editorconfig, error) {
+	const thisName = "readEditorconfig"
+
+	var c editorconfig
+	b, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return c, fmt.Errorf(thisName+": in os.ReadFile: %v", err)
+	}
+	var section *editorconfigSection
+	s := bufio.NewScanner(bytes.NewReader(b))
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+		if header, ok := strings.CutPrefix(line, "["); ok {
+			section = nil
+			header, ok = strings.CutSuffix(header, "]")
+			if !ok {
+				continue
+			}
+			glob, err := editorconfigGlob(header)
+			if err != nil {
+				continue
+			}
+			c.sections = append(c.sections, editorconfigSection{
+				glob:  glob,
+				props: make(map[string]string),
+			})
+			section = &c.sections[len(c.sections)-1]
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.ToLower(strings.TrimSpace(value))
+		switch {
+		// Properties before any section are of the file itself.
+		case section == nil && key == "root":
+			c.root = value == "true"
+		case section != nil:
+			section.props[key] = value
+		}
+	}
+	if err := s.Err(); err != nil {
+		return c, fmt.Errorf(thisName+": in *Scanner.Scan: %v", err)
+	}
+	return c, nil
+}
+
+// editorconfigGlob returns a regexp matching slash-separated paths relative to
+// the directory of an .editorconfig file which the glob of a section header
+// matches. Globs without ‘/’ match files in any subdirectory.
+func editorconfigGlob(glob string) (*regexp.Regexp, error) {
+	var b strings.Builder
+	if !strings.Contains(glob, "/") {
+		b.WriteString("^(?:.*/)?")
+	} else {
+		b.WriteString("^")
+		glob = strings.TrimPrefix(glob, "/")
+	}
+	var braces int
+	for i := 0; i < len(glob); i++ {
+		switch ch := glob[i]; ch {
+		case '*':
+			if i+1 < len(glob) && glob[i+1] == '*' {
+				b.WriteString(".*")
+				i++
+			} else {
+				b.WriteString("[^/]*")
+			}
+		case '?':
+			b.WriteString("[^/]")
+		case '[':
+			end := strings.IndexByte(glob[i:], ']')
+			if end < 0 {
+				b.WriteString(`\[`)
+				continue
+			}
+			class := glob[i+1 : i+end]
+			if negated, ok := strings.CutPrefix(class, "!"); ok {
+				class = "^" + negated
+			}
+			b.WriteString("[" + class + "]")
+			i += end
+		case '{':
+			braces++
+			b.WriteString("(?:")
+		case '}':
+			if braces == 0 {
+				b.WriteString(`\}`)
+				continue
+			}
+			braces--
+			b.WriteString(")")
+		case ',':
+			if braces == 0 {
+				b.WriteString(",")
+				continue
+			}
+			b.WriteString("|")
+		case '\\':
+			if i+1 < len(glob) {
+				i++
+				b.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+			}
+		default:
+			b.WriteString(regexp.QuoteMeta(string(ch)))
+		}
+	}
+	b.WriteString("$")
+	r, err := regexp.Compile(b.String())
+	if err != nil {
+		format := "editorconfigGlob: in regexp.Compile: %v"
+		return nil, fmt.Errorf(format, err)
+	}
+	return r, nil
+}
@@ -0,0 +1,89 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEditorconfigGlob(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		glob string
+		path string
+		want bool
+	}{
+		{"*", "main.go", true},
+		{"*.go", "cmd/gouse/main.go", true},
+		{"*.go", "go.mod", false},
+		{"*.{go,mod}", "go.mod", true},
+		{"cmd/*.go", "cmd/main.go", true},
+		{"cmd/*.go", "cmd/gouse/main.go", false},
+		{"/cmd/**.go", "cmd/gouse/main.go", true},
+		{"[!a]*.go", "main.go", true},
+		{"[!m]*.go", "main.go", false},
+		{"ma?n.go", "main.go", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.glob+" "+tt.path, func(t *testing.T) {
+			t.Parallel()
+			r, err := editorconfigGlob(tt.glob)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := r.MatchString(tt.path); got != tt.want {
+				t.Errorf("got: %t, want: %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEditorStyleFor(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	files := map[string]string{
+		// Files above the root one are ignored.
+		editorconfigName: "[*]\nend_of_line = cr\n",
+		filepath.Join("project", editorconfigName): "root = true\n" +
+			"[*]\nindent_style = space\nindent_size = 2\n" +
+			"end_of_line = crlf\n",
+		filepath.Join("project", "sub", editorconfigName): "# Go\n" +
+			"[*.go]\nindent_size = 8\n",
+	}
+	for name, contents := range files {
+		p := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		err := os.WriteFile(p, []byte(contents), 0o644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct {
+		path string
+		want EditorStyle
+	}{
+		{"a.go", EditorStyle{}},
+		{
+			filepath.Join("project", "a.go"),
+			EditorStyle{indent: "  ", eol: "\r\n"},
+		},
+		{
+			filepath.Join("project", "sub", "a.go"),
+			EditorStyle{indent: "        ", eol: "\r\n"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			t.Parallel()
+			got, err := EditorStyleFor(filepath.Join(dir, tt.path))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got: %q, want: %q", got, tt.want)
+			}
+		})
+	}
+}
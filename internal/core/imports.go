@@ -0,0 +1,105 @@
+package core
+
+import (
+	"bytes"
+	"go/ast"
+	"go/token"
+	"regexp"
+	"strconv"
+)
+
+// importAliasMarker precedes the name of a named import in the marker of the
+// import blanked, like in ‘// TODO: gouse as log’.
+const importAliasMarker = " as "
+
+// notUsedImport catches the quoted path of an error of an unused import, which
+// starts with it rather than with a prefix like other errors. Named imports
+// are reported with their names.
+var notUsedImport = regexp.MustCompile(
+	`^("(?:[^"\\]|\\.)*") imported(?: as \w+)? and not used$`,
+)
+
+// blankedImport catches an import blanked by importAddition: the blank name,
+// the path, the rest of the line before the marker, e.g. a comment, the
+// optional author, ID and date of the marker and the optional name of the
+// import.
+var blankedImport = regexp.MustCompile(
+	`(?m)^[ \t]*(?:import[ \t]+)?(_ )("(?:[^"\\\n]|\\.)*"|` + "`[^`\n]*`" +
+		`)(.*?)[ \t]*` + lineCommentPrefix + ` TODO` +
+		`(?:\(([^()*\n]+)\))?` +
+		regexp.QuoteMeta(fakeUsageCommentTag) +
+		`(?:` + IDPrefix + `(\d+))?` +
+		`(?: (\d{4}-\d{2}-\d{2}))?` +
+		`(?:` + importAliasMarker + `(\w+|\.))?$`,
+)
+
+// importAddition returns a change which blanks the unused import of info in
+// code, parsed into f with the token file tf, and marks it with a TODO comment
+// stamped with id, so the package is still imported, e.g. for the code which
+// used it to be brought back. The name of a named import is kept in the
+// marker. It reports false if the import isn’t found.
+func importAddition(
+	code []byte,
+	tf *token.File,
+	f *ast.File,
+	starts []int,
+	info symbolInfo,
+	id int,
+	opts Options,
+) (Change, bool) {
+	for _, spec := range f.Imports {
+		// -1 is an adjustment for 0-based count.
+		lineNum := tf.Line(spec.Path.Pos()) - 1
+		if lineNum != info.lineNum {
+			continue
+		}
+		if p, err := strconv.Unquote(spec.Path.Value); err != nil ||
+			p != info.name {
+			continue
+		}
+		// The name, if any, is replaced along with the path.
+		start, path := tf.Offset(spec.Pos()), tf.Offset(spec.Path.Pos())
+		end := lineEnd(code, starts, info.lineNum)
+		marker := lineCommentPrefix + " " + todoText(opts, id)
+		if spec.Name != nil {
+			marker += importAliasMarker + spec.Name.Name
+		}
+		return Change{
+			Action:  ActionAdd,
+			Kind:    KindImport,
+			Name:    info.name,
+			LineNum: info.lineNum,
+			Start:   start,
+			End:     end,
+			Text:    "_ " + string(code[path:end]) + " " + marker,
+			Author:  opts.Author,
+			ID:      id,
+			Date:    opts.Date,
+		}, true
+	}
+	return Change{}, false
+}
+
+// findImportMarkers returns changes which restore every import blanked by
+// importAddition.
+func findImportMarkers(code []byte) []Change {
+	var changes []Change
+	for _, m := range blankedImport.FindAllSubmatchIndex(code, -1) {
+		path := string(code[m[4]:m[5]])
+		c := Change{
+			Action:  ActionRemove,
+			Kind:    KindImport,
+			LineNum: bytes.Count(code[:m[2]], []byte("\n")),
+			Start:   m[2],
+			End:     m[1],
+			Text:    path + string(code[m[6]:m[7]]),
+		}
+		if m[14] >= 0 {
+			c.Text = string(code[m[14]:m[15]]) + " " + c.Text
+		}
+		c.Name, _ = strconv.Unquote(path)
+		stampMarker(&c, code, m, 8)
+		changes = append(changes, c)
+	}
+	return changes
+}
@@ -0,0 +1,123 @@
+package core
+
+import (
+	"context"
+	"testing"
+)
+
+const importsInput = `package p
+
+import (
+	. "errors"
+	"fmt"
+	l "log"
+	"os" // Comment.
+	_ "strings"
+	"unicode"
+)
+
+func main() {
+	notUsed0 := 0
+	_ = unicode.IsUpper
+}
+`
+
+func TestFindChangesImports(t *testing.T) {
+	for _, backend := range []Backend{BackendBuild, BackendTypeCheck} {
+		t.Run(string(backend), func(t *testing.T) {
+			t.Parallel()
+			ctx := context.Background()
+			ctx, cancel := context.WithCancel(ctx)
+			t.Cleanup(cancel)
+			input := []byte(importsInput)
+			opts := Options{
+				Author: "alice", Number: true, Backend: backend,
+			}
+			changes, err := FindChanges(ctx, input, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := ApplyChanges(input, changes)
+			want := `package p
+
+import (
+	_ "errors" // TODO(alice): gouse#1 as .
+	_ "fmt" // TODO(alice): gouse#2
+	_ "log" // TODO(alice): gouse#3 as l
+	_ "os" // Comment. // TODO(alice): gouse#4
+	_ "strings"
+	"unicode"
+)
+
+func main() {
+	notUsed0 := 0; _ = notUsed0 /* TODO(alice): gouse#5 */
+	_ = unicode.IsUpper
+}
+`
+			if string(got) != want {
+				t.Errorf(filesCmpErr, got, want)
+			}
+			markers := FindMarkers(got)
+			if len(markers) != 5 {
+				t.Fatalf("got: %v, want 5 markers", markers)
+			}
+			if c := markers[2]; c.Name != "log" || c.ID != 3 ||
+				c.Author != opts.Author {
+				t.Errorf("got: %v, want: log", c)
+			}
+			if id := maxMarkerID(got); id != 5 {
+				t.Errorf("got: %d, want: 5", id)
+			}
+			restored := ApplyChanges(got, markers)
+			if string(restored) != importsInput {
+				t.Errorf(filesCmpErr, restored, importsInput)
+			}
+		})
+	}
+}
+
+func TestFindImportMarkers(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name string
+		code string
+		want string
+	}{
+		{
+			"single",
+			"import _ \"fmt\" // TODO: gouse 2024-01-02\n",
+			"import \"fmt\"\n",
+		},
+		{
+			"gofmted",
+			"import (\n\t_ \"fmt\" // TODO: gouse\n" +
+				"\t_ \"os\"  // x // TODO: gouse\n)\n",
+			"import (\n\t\"fmt\"\n\t\"os\"  // x\n)\n",
+		},
+		{
+			"named",
+			"import _ \"github.com/x/y\" // TODO: gouse#2 as log\n",
+			"import log \"github.com/x/y\"\n",
+		},
+		{
+			"raw path",
+			"import _ `fmt` // TODO: gouse\n",
+			"import `fmt`\n",
+		},
+		{
+			"hand-written",
+			"import _ \"embed\" // TODO: embed files\n",
+			"import _ \"embed\" // TODO: embed files\n",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			code := []byte(test.code)
+			got := ApplyChanges(code, findImportMarkers(code))
+			if string(got) != test.want {
+				t.Errorf(filesCmpErr, got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package core
+
+import (
+	"bytes"
+	"go/ast"
+	"go/token"
+	"regexp"
+	"strings"
+)
+
+var (
+	// notUsedLabel catches the name of an unused label from an error of
+	// the go command or of type-checking, which word it differently.
+	notUsedLabel = regexp.MustCompile(
+		`^label (\w+) (?:defined|declared) and not used$`,
+	)
+	// commentedLabel catches a label commented out by labelAddition, like
+	// ‘/* L: TODO: gouse */’: its name and its optional author, ID and
+	// date.
+	commentedLabel = regexp.MustCompile(
+		`/\* (\w+):` + regexp.QuoteMeta(fakeUsageCommentPrefix[3:]) +
+			`(?:\(([^()*\n]+)\))?` +
+			regexp.QuoteMeta(fakeUsageCommentTag) +
+			`(?:` + IDPrefix + `(\d+))?` +
+			`(?: (\d{4}-\d{2}-\d{2}))?` +
+			regexp.QuoteMeta(fakeUsageCommentSuffix),
+	)
+)
+
+// labelAddition returns a change which comments out the unused label of info
+// in code, parsed into f with the token file tf, along with a TODO comment
+// stamped with id, so it can be restored when code which jumps to it returns.
+// It reports false if the label isn’t found.
+func labelAddition(
+	tf *token.File, f *ast.File, info symbolInfo, id int, opts Options,
+) (Change, bool) {
+	var label *ast.LabeledStmt
+	ast.Inspect(f, func(n ast.Node) bool {
+		s, ok := n.(*ast.LabeledStmt)
+		// -1 is an adjustment for 0-based count.
+		if ok && s.Label.Name == info.name &&
+			tf.Line(s.Pos())-1 == info.lineNum {
+			label = s
+		}
+		return label == nil
+	})
+	if label == nil {
+		return Change{}, false
+	}
+	// The comment is opened before the label rather than before TODO.
+	comment := fakeUsageCommentText(opts, id)
+	comment = strings.TrimPrefix(comment, fakeUsageCommentPrefix[:3])
+	return Change{
+		Action:  ActionAdd,
+		Kind:    KindLabel,
+		Name:    info.name,
+		LineNum: info.lineNum,
+		Start:   tf.Offset(label.Label.Pos()),
+		// +1 is an adjustment for the colon.
+		End:    tf.Offset(label.Colon) + 1,
+		Text:   "/* " + info.name + ":" + comment,
+		Author: opts.Author,
+		ID:     id,
+		Date:   opts.Date,
+	}, true
+}
+
+// findLabelMarkers returns changes which restore every label commented out by
+// labelAddition.
+func findLabelMarkers(code []byte) []Change {
+	var changes []Change
+	for _, m := range commentedLabel.FindAllSubmatchIndex(code, -1) {
+		name := string(code[m[2]:m[3]])
+		c := Change{
+			Action:  ActionRemove,
+			Kind:    KindLabel,
+			Name:    name,
+			LineNum: bytes.Count(code[:m[0]], []byte("\n")),
+			Start:   m[0],
+			End:     m[1],
+			Text:    name + ":",
+		}
+		stampMarker(&c, code, m, 4)
+		changes = append(changes, c)
+	}
+	return changes
+}
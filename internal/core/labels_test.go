@@ -0,0 +1,68 @@
+package core
+
+import (
+	"context"
+	"testing"
+)
+
+func TestFindChangesLabels(t *testing.T) {
+	const input = `package p
+
+func f() {
+L:
+	for {
+		break L
+	}
+M:
+	for {
+	}
+N: for {
+	}
+}
+`
+	const want = `package p
+
+func f() {
+L:
+	for {
+		break L
+	}
+/* M: TODO(alice): gouse#1 */
+	for {
+	}
+/* N: TODO(alice): gouse#2 */ for {
+	}
+}
+`
+	for _, backend := range []Backend{BackendBuild, BackendTypeCheck} {
+		t.Run(string(backend), func(t *testing.T) {
+			t.Parallel()
+			ctx := context.Background()
+			ctx, cancel := context.WithCancel(ctx)
+			t.Cleanup(cancel)
+			opts := Options{
+				Author: "alice", Number: true, Backend: backend,
+			}
+			changes, err := FindChanges(ctx, []byte(input), opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := ApplyChanges([]byte(input), changes)
+			if string(got) != want {
+				t.Errorf(filesCmpErr, got, want)
+			}
+			markers := FindMarkers(got)
+			if len(markers) != 2 {
+				t.Fatalf("got: %v, want 2 markers", markers)
+			}
+			if c := markers[1]; c.Name != "N" || c.ID != 2 ||
+				c.Author != opts.Author {
+				t.Errorf("got: %v, want: N", c)
+			}
+			restored := ApplyChanges(got, markers)
+			if string(restored) != input {
+				t.Errorf(filesCmpErr, restored, input)
+			}
+		})
+	}
+}
@@ -0,0 +1,214 @@
+package core
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"regexp"
+	"strings"
+)
+
+// Placement is where fake usages are created.
+type Placement string
+
+const (
+	// PlacementLine creates every fake usage at the end of the line of its
+	// variable.
+	PlacementLine Placement = "line"
+	// PlacementFunction gathers fake usages of variables declared in the
+	// top-level scope of a function into one statement at the end of its
+	// body.
+	PlacementFunction Placement = "function"
+)
+
+func (p *Placement) String() string { return string(*p) }
+
+func (p *Placement) Set(s string) error {
+	switch Placement(s) {
+	case PlacementLine, PlacementFunction:
+		*p = Placement(s)
+		return nil
+	}
+	return fmt.Errorf("unknown placement %q, want line or function", s)
+}
+
+// gatheredFakeUsage catches a fake usage created with PlacementFunction with
+// the preceding line break, which may be CRLF, see EditorStyle.
+var gatheredFakeUsage = regexp.MustCompile(
+	`\r?\n[ \t]*_(?:[ \t]*,[ \t]*_)*[ \t]*=[ \t]*\w+(?:[ \t]*,[ \t]*\w+)*` +
+		fakeUsageCommentRegexp,
+)
+
+// funcBody is the body of a function with variables declared in its top-level
+// scope.
+type funcBody struct {
+	block *ast.BlockStmt
+	// results reports whether the function has results, so the body must
+	// end with its terminating statement.
+	results bool
+	// vars are names of the variables which fake usages can be gathered
+	// for, keyed by 0-based numbers of the lines they’re declared on.
+	vars map[int]map[string]bool
+}
+
+// gatherAdditions returns additions with fake usages of variables declared in
+// the top-level scope of a function replaced by one change which creates their
+// fake usages at the end of the body, if opts.Placement is PlacementFunction.
+// If the function has results, they’re created before its last statement.
+func gatherAdditions(code []byte, additions []Change, opts Options) []Change {
+	if opts.Placement != PlacementFunction {
+		return additions
+	}
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(
+		fset, "", code, parser.SkipObjectResolution,
+	)
+	if err != nil {
+		return additions
+	}
+	tf := fset.File(f.FileStart)
+	var bodies []*funcBody
+	ast.Inspect(f, func(n ast.Node) bool {
+		var typ *ast.FuncType
+		var block *ast.BlockStmt
+		switch n := n.(type) {
+		case *ast.FuncDecl:
+			typ, block = n.Type, n.Body
+		case *ast.FuncLit:
+			typ, block = n.Type, n.Body
+		default:
+			return true
+		}
+		if block == nil || len(block.List) == 0 {
+			return true
+		}
+		bodies = append(bodies, newFuncBody(tf, typ, block))
+		return true
+	})
+	gathered := make(map[*funcBody][]Change)
+	var changes []Change
+	for _, c := range additions {
+		// Only fake usages are gathered.
+		var body *funcBody
+		if c.Start == c.End {
+			body = bodyOf(bodies, c)
+		}
+		if body == nil {
+			changes = append(changes, c)
+			continue
+		}
+		gathered[body] = append(gathered[body], c)
+	}
+	// Bodies are visited in order, so changes are deterministic.
+	for _, body := range bodies {
+		if cs := gathered[body]; len(cs) > 0 {
+			g, ok := gatheredChange(code, tf, body, cs, opts)
+			if !ok {
+				changes = append(changes, cs...)
+				continue
+			}
+			changes = append(changes, g)
+		}
+	}
+	return changes
+}
+
+// newFuncBody returns block, the body of a function of the type typ in the
+// token file tf, with its variables.
+func newFuncBody(
+	tf *token.File, typ *ast.FuncType, block *ast.BlockStmt,
+) *funcBody {
+	body := &funcBody{
+		block:   block,
+		results: typ.Results != nil && len(typ.Results.List) > 0,
+		vars:    make(map[int]map[string]bool),
+	}
+	last := len(block.List) - 1
+	for i, s := range block.List {
+		// Fake usages are gathered before the last statement then.
+		if body.results && i == last {
+			break
+		}
+		for _, ident := range declaredIdents(s) {
+			// -1 is an adjustment for 0-based count.
+			lineNum := tf.Line(ident.Pos()) - 1
+			if body.vars[lineNum] == nil {
+				body.vars[lineNum] = make(map[string]bool)
+			}
+			body.vars[lineNum][ident.Name] = true
+		}
+	}
+	return body
+}
+
+// bodyOf returns the innermost of bodies, which are in the source order, which
+// declares the variable of the fake usage c in its top-level scope or nil if
+// there is none.
+func bodyOf(bodies []*funcBody, c Change) *funcBody {
+	var found *funcBody
+	for _, body := range bodies {
+		if body.vars[c.LineNum][c.Name] {
+			found = body
+		}
+	}
+	return found
+}
+
+// gatheredChange returns a change which creates fake usages of changes at the
+// end of body in code with the token file tf. It’s false if the statement can’t
+// take a line of its own there.
+func gatheredChange(
+	code []byte,
+	tf *token.File,
+	body *funcBody,
+	changes []Change,
+	opts Options,
+) (Change, bool) {
+	// The statement is inserted before the line of next.
+	next := body.block.Rbrace
+	if body.results {
+		next = body.block.List[len(body.block.List)-1].Pos()
+	}
+	offset := tf.Offset(next)
+	line := tf.Line(next)
+	lineStart := tf.Offset(tf.LineStart(line))
+	indent := code[lineStart:offset]
+	oneLine := line == tf.Line(body.block.Lbrace)
+	if len(bytes.TrimSpace(indent)) > 0 || oneLine {
+		return Change{}, false
+	}
+	unit, eol := opts.Style.indent, opts.Style.eol
+	if unit == "" {
+		unit = "\t"
+	}
+	if eol == "" {
+		eol = "\n"
+	}
+	if !body.results {
+		indent = append(bytes.Clone(indent), unit...)
+	}
+	names := make([]string, len(changes))
+	blanks := make([]string, len(changes))
+	for i, c := range changes {
+		names[i] = c.Name
+		blanks[i] = "_"
+	}
+	id := changes[0].ID
+	text := string(indent) + strings.Join(blanks, ", ") + " = " +
+		strings.Join(names, ", ") + fakeUsageCommentText(opts, id) +
+		eol
+	return Change{
+		Action: ActionAdd,
+		Name:   strings.Join(names, ", "),
+		// -1 is an adjustment for 0-based count.
+		LineNum: line - 1,
+		Start:   lineStart,
+		End:     lineStart,
+		Text:    text,
+		Author:  opts.Author,
+		ID:      id,
+		Date:    opts.Date,
+	}, true
+}
@@ -0,0 +1,108 @@
+package core
+
+import (
+	"context"
+	"testing"
+)
+
+func TestFindChangesPlacement(t *testing.T) {
+	ctx := context.Background()
+	ctx, cancel := context.WithCancel(ctx)
+	t.Cleanup(cancel)
+	input := `package p
+
+func f() int {
+	notUsed0 := 1
+	if true {
+		notUsed1 := 2
+	}
+	notUsed2, notUsed3 := 3, 4
+	return 0
+}
+
+func g() {
+	notUsed4 := func() {
+		notUsed5 := 5
+	}
+}
+`
+	want := `package p
+
+func f() int {
+	notUsed0 := 1
+	if true {
+		notUsed1 := 2; _ = notUsed1 /* TODO: gouse#2 */
+	}
+	notUsed2, notUsed3 := 3, 4
+	_, _, _ = notUsed0, notUsed2, notUsed3 /* TODO: gouse#1 */
+	return 0
+}
+
+func g() {
+	notUsed4 := func() {
+		notUsed5 := 5
+		_ = notUsed5 /* TODO: gouse#6 */
+	}
+	_ = notUsed4 /* TODO: gouse#5 */
+}
+`
+	opts := Options{Placement: PlacementFunction, Number: true}
+	changes, err := FindChanges(ctx, []byte(input), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := ApplyChanges([]byte(input), changes)
+	if string(got) != want {
+		t.Errorf(filesCmpErr, got, want)
+	}
+	markers := FindMarkers(got)
+	if len(markers) != 4 {
+		t.Fatalf("got: %v, want 4 markers", markers)
+	}
+	wantName := "notUsed0, notUsed2, notUsed3"
+	if markers[1].Name != wantName || markers[1].ID != 1 {
+		t.Errorf("got: %v, want: %s with ID 1", markers[1], wantName)
+	}
+	restored := ApplyChanges(got, markers)
+	if string(restored) != input {
+		t.Errorf(filesCmpErr, restored, input)
+	}
+}
+
+func TestFindChangesPlacementStyle(t *testing.T) {
+	ctx := context.Background()
+	ctx, cancel := context.WithCancel(ctx)
+	t.Cleanup(cancel)
+	input := "package p\r\n\r\nfunc f() {\r\n  notUsed := 1\r\n}\r\n"
+	want := "package p\r\n\r\nfunc f() {\r\n  notUsed := 1\r\n" +
+		"  _ = notUsed /* TODO: gouse */\r\n}\r\n"
+	opts := Options{
+		Placement: PlacementFunction,
+		Style:     EditorStyle{indent: "  ", eol: "\r\n"},
+	}
+	changes, err := FindChanges(ctx, []byte(input), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := ApplyChanges([]byte(input), changes)
+	if string(got) != want {
+		t.Errorf(filesCmpErr, got, want)
+	}
+	// The fake usage is removed with its line ending.
+	removed := ApplyChanges(got, FindMarkers(got))
+	if string(removed) != input {
+		t.Errorf(filesCmpErr, removed, input)
+	}
+}
+
+func TestPlacementSet(t *testing.T) {
+	var p Placement
+	if err := p.Set("function"); err != nil || p != PlacementFunction {
+		t.Errorf(
+			"got: %s, %v, want: %s, nil", p, err, PlacementFunction,
+		)
+	}
+	if err := p.Set("top"); err == nil {
+		t.Error("got: nil, want: error")
+	}
+}
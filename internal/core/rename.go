@@ -0,0 +1,243 @@
+package core
+
+import (
+	"bytes"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"regexp"
+	"strings"
+)
+
+// renamedIdent catches an identifier renamed to ‘_’ by renameChange, like
+// ‘_ /* TODO: gouse ctx */’: its optional author, ID and date and its name.
+var renamedIdent = regexp.MustCompile(
+	`\b_` + regexp.QuoteMeta(fakeUsageCommentPrefix) +
+		`(?:\(([^()*\n]+)\))?` +
+		regexp.QuoteMeta(fakeUsageCommentTag) +
+		`(?:` + IDPrefix + `(\d+))?` +
+		`(?: (\d{4}-\d{2}-\d{2}))?` +
+		` (\w+)` + regexp.QuoteMeta(fakeUsageCommentSuffix),
+)
+
+// renameChange returns a change of kind which renames ident with the token
+// file tf to ‘_’, keeping its name in a TODO comment stamped with id, so it
+// can be restored.
+func renameChange(
+	tf *token.File, ident *ast.Ident, kind Kind, id int, opts Options,
+) Change {
+	comment := fakeUsageCommentText(opts, id)
+	comment = strings.TrimSuffix(comment, fakeUsageCommentSuffix)
+	return Change{
+		Action: ActionAdd,
+		Kind:   kind,
+		Name:   ident.Name,
+		// -1 is an adjustment for 0-based count.
+		LineNum: tf.Line(ident.Pos()) - 1,
+		Start:   tf.Offset(ident.Pos()),
+		End:     tf.Offset(ident.End()),
+		Text: "_" + comment + " " + ident.Name +
+			fakeUsageCommentSuffix,
+		Author: opts.Author,
+		ID:     id,
+		Date:   opts.Date,
+	}
+}
+
+// findRenameMarkers returns changes which restore every identifier renamed by
+// renameChange. Identifiers of code which doesn’t parse are taken for
+// parameters, the most common of them.
+func findRenameMarkers(code []byte) []Change {
+	matches := renamedIdent.FindAllSubmatchIndex(code, -1)
+	if matches == nil {
+		return nil
+	}
+	kindOf := func(int) Kind { return KindParam }
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "", code, parser.SkipObjectResolution)
+	if err == nil {
+		kinds := renameKinds(f)
+		tf := fset.File(f.Pos())
+		kindOf = func(offset int) Kind {
+			if k, ok := kinds[tf.Pos(offset)]; ok {
+				return k
+			}
+			return KindParam
+		}
+	}
+	var changes []Change
+	for _, m := range matches {
+		name := string(code[m[8]:m[9]])
+		c := Change{
+			Action:  ActionRemove,
+			Kind:    kindOf(m[0]),
+			Name:    name,
+			LineNum: bytes.Count(code[:m[0]], []byte("\n")),
+			Start:   m[0],
+			End:     m[1],
+			Text:    name,
+		}
+		stampMarker(&c, code, m, 2)
+		changes = append(changes, c)
+	}
+	return changes
+}
+
+// renameAdditions returns changes which rename parameters, if opts.Params is
+// true, and receivers, if opts.Receivers is true, of functions in code, parsed
+// into f with the token file tf, which their bodies don’t reference to ‘_’.
+// IDs, if opts.Number is true, follow id.
+func renameAdditions(
+	code []byte,
+	tf *token.File,
+	f *ast.File,
+	starts []int,
+	id int,
+	opts Options,
+) []Change {
+	var changes []Change
+	kinds := renameKinds(f)
+	for _, ident := range unusedIdents(f, opts.Params, opts.Receivers) {
+		// -1 is an adjustment for 0-based count.
+		if ignored(code, starts, tf.Line(ident.Pos())-1) {
+			continue
+		}
+		if opts.Number {
+			id++
+		}
+		c := renameChange(tf, ident, kinds[ident.Pos()], id, opts)
+		changes = append(changes, c)
+	}
+	return changes
+}
+
+// renameKinds returns kinds of renames of identifiers of receivers,
+// parameters and range variables in f by their positions.
+func renameKinds(f *ast.File) map[token.Pos]Kind {
+	kinds := make(map[token.Pos]Kind)
+	add := func(list *ast.FieldList, kind Kind) {
+		if list == nil {
+			return
+		}
+		for _, field := range list.List {
+			for _, name := range field.Names {
+				kinds[name.Pos()] = kind
+			}
+		}
+	}
+	ast.Inspect(f, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.FuncDecl:
+			add(n.Recv, KindReceiver)
+			add(n.Type.Params, KindParam)
+		case *ast.FuncLit:
+			add(n.Type.Params, KindParam)
+		case *ast.RangeStmt:
+			for _, e := range []ast.Expr{n.Key, n.Value} {
+				if ident, ok := e.(*ast.Ident); ok {
+					kinds[ident.Pos()] = KindRange
+				}
+			}
+		}
+		return true
+	})
+	return kinds
+}
+
+// rangeRenames returns identifiers of variables declared by range clauses in
+// f with the token file tf which unused has for their lines, keyed by 0-based
+// numbers of the lines and names, if another variable of the clause is used.
+// Otherwise, renaming them to ‘_’ would leave the clause with no new
+// variables.
+func rangeRenames(
+	f *ast.File, tf *token.File, unused map[int]map[string]bool,
+) map[int]map[string]*ast.Ident {
+	renames := make(map[int]map[string]*ast.Ident)
+	ast.Inspect(f, func(n ast.Node) bool {
+		s, ok := n.(*ast.RangeStmt)
+		if !ok || s.Tok != token.DEFINE {
+			return true
+		}
+		var kept int
+		var idents []*ast.Ident
+		for _, e := range []ast.Expr{s.Key, s.Value} {
+			ident, ok := e.(*ast.Ident)
+			if !ok || ident.Name == "_" {
+				continue
+			}
+			// -1 is an adjustment for 0-based count.
+			lineNum := tf.Line(ident.Pos()) - 1
+			if unused[lineNum][ident.Name] {
+				idents = append(idents, ident)
+			} else {
+				kept++
+			}
+		}
+		if kept == 0 {
+			return true
+		}
+		for _, ident := range idents {
+			lineNum := tf.Line(ident.Pos()) - 1
+			if renames[lineNum] == nil {
+				renames[lineNum] = make(map[string]*ast.Ident)
+			}
+			renames[lineNum][ident.Name] = ident
+		}
+		return true
+	})
+	return renames
+}
+
+// unusedIdents returns identifiers of named parameters, if params is true, and
+// receivers, if receivers is true, of functions in f which their bodies don’t
+// reference, in the order of positions. References are counted by names, so a
+// parameter shadowed by a variable which is used counts as used.
+func unusedIdents(f *ast.File, params, receivers bool) []*ast.Ident {
+	var idents []*ast.Ident
+	ast.Inspect(f, func(n ast.Node) bool {
+		var lists []*ast.FieldList
+		var body *ast.BlockStmt
+		switch n := n.(type) {
+		case *ast.FuncDecl:
+			body = n.Body
+			if receivers {
+				lists = append(lists, n.Recv)
+			}
+			if params {
+				lists = append(lists, n.Type.Params)
+			}
+		case *ast.FuncLit:
+			body = n.Body
+			if params {
+				lists = append(lists, n.Type.Params)
+			}
+		default:
+			return true
+		}
+		if body == nil {
+			return true
+		}
+		refs := make(map[string]int)
+		ast.Inspect(body, func(n ast.Node) bool {
+			if ident, ok := n.(*ast.Ident); ok {
+				refs[ident.Name]++
+			}
+			return true
+		})
+		for _, list := range lists {
+			if list == nil {
+				continue
+			}
+			for _, field := range list.List {
+				for _, name := range field.Names {
+					if name.Name != "_" &&
+						refs[name.Name] == 0 {
+						idents = append(idents, name)
+					}
+				}
+			}
+		}
+		return true
+	})
+	return idents
+}
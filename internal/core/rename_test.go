@@ -0,0 +1,151 @@
+package core
+
+import (
+	"context"
+	"testing"
+)
+
+const paramsInput = `package p
+
+func f(ctx context, a, _ int, b string) int {
+	h := func(x, y int) int { return x }
+	return a + h(0, 0)
+}
+
+func g(s string, n int) // Without a body.
+
+func (r *T) m(v int) {}
+`
+
+func TestFindChangesParams(t *testing.T) {
+	tests := []struct {
+		name string
+		opts Options
+		want string
+	}{
+		{
+			"off",
+			Options{},
+			paramsInput,
+		},
+		{
+			"on",
+			Options{Params: true, Author: "alice", Number: true},
+			`package p
+
+func f(_ /* TODO(alice): gouse#1 ctx */ context, a, _ int, ` +
+				`_ /* TODO(alice): gouse#2 b */ string) int {
+	h := func(x, _ /* TODO(alice): gouse#3 y */ int) int { return x }
+	return a + h(0, 0)
+}
+
+func g(s string, n int) // Without a body.
+
+func (r *T) m(_ /* TODO(alice): gouse#4 v */ int) {}
+`,
+		},
+		{
+			"receivers",
+			Options{Receivers: true},
+			`package p
+
+func f(ctx context, a, _ int, b string) int {
+	h := func(x, y int) int { return x }
+	return a + h(0, 0)
+}
+
+func g(s string, n int) // Without a body.
+
+func (_ /* TODO: gouse r */ *T) m(v int) {}
+`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			ctx := context.Background()
+			ctx, cancel := context.WithCancel(ctx)
+			t.Cleanup(cancel)
+			input := []byte(paramsInput)
+			test.opts.Backend = BackendTypeCheck
+			test.opts.Mode = ModeAdd
+			changes, err := FindChanges(ctx, input, test.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := ApplyChanges(input, changes)
+			if string(got) != test.want {
+				t.Errorf(filesCmpErr, got, test.want)
+			}
+			// Removal must restore the names whether or not
+			// Params is set.
+			markers := FindMarkers(got)
+			if len(markers) != len(changes) {
+				t.Fatalf("got: %v, want: %d markers",
+					markers, len(changes))
+			}
+			for i, c := range markers {
+				if c.Name != changes[i].Name ||
+					c.ID != changes[i].ID {
+					t.Errorf("got: %v, want: %v",
+						c, changes[i])
+				}
+			}
+			restored := ApplyChanges(got, markers)
+			if string(restored) != paramsInput {
+				t.Errorf(filesCmpErr, restored, paramsInput)
+			}
+		})
+	}
+}
+
+func TestFindChangesRange(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	ctx, cancel := context.WithCancel(ctx)
+	t.Cleanup(cancel)
+	const input = `package p
+
+func f(xs []int) {
+	for i, v := range xs {
+		println(i)
+	}
+	for k, v := range xs {
+		println(v)
+	}
+	for k, v := range xs {
+	}
+	for k := range xs {
+	}
+}
+`
+	want := `package p
+
+func f(xs []int) {
+	for i, _ /* TODO: gouse#1 v */ := range xs {
+		println(i)
+	}
+	for _ /* TODO: gouse#2 k */, v := range xs {
+		println(v)
+	}
+	for k, v := range xs {; _ = k /* TODO: gouse#3 */` +
+		`; _ = v /* TODO: gouse#4 */
+	}
+	for k := range xs {; _ = k /* TODO: gouse#5 */
+	}
+}
+`
+	opts := Options{Backend: BackendTypeCheck, Number: true}
+	changes, err := FindChanges(ctx, []byte(input), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := ApplyChanges([]byte(input), changes)
+	if string(got) != want {
+		t.Errorf(filesCmpErr, got, want)
+	}
+	restored := ApplyChanges(got, FindMarkers(got))
+	if string(restored) != input {
+		t.Errorf(filesCmpErr, restored, input)
+	}
+}
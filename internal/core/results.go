@@ -0,0 +1,182 @@
+package core
+
+import (
+	"bytes"
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"regexp"
+	"strings"
+)
+
+// resultsMarker ends the TODO comment of a call whose results are assigned to
+// ‘_’ by resultsAdditions, like in ‘_ = f() /* TODO: gouse results */’.
+const resultsMarker = " results"
+
+// silencedCall catches a call whose results are assigned to ‘_’ by
+// resultsAdditions: the assignment up to the comment, the call and the
+// optional author, ID and date of the comment.
+var silencedCall = regexp.MustCompile(
+	`(?m)(?:^|[;{])[ \t]*(_(?:, _)* = (.+?)` +
+		regexp.QuoteMeta(fakeUsageCommentPrefix) +
+		`(?:\(([^()*\n]+)\))?` +
+		regexp.QuoteMeta(fakeUsageCommentTag) +
+		`(?:` + IDPrefix + `(\d+))?` +
+		`(?: (\d{4}-\d{2}-\d{2}))?` +
+		regexp.QuoteMeta(resultsMarker+fakeUsageCommentSuffix) + `)`,
+)
+
+// resultsAdditions returns changes which assign results of calls in code,
+// type-checked with siblings, which are statements of their own to ‘_’, one
+// per result, marked with TODO comments. Only calls which take a line have
+// their results assigned, and only ones whose results are known, so calls of
+// packages which can’t be imported are kept. IDs, if opts.Number is true,
+// follow id.
+func resultsAdditions(
+	code []byte,
+	siblings map[string][]byte,
+	starts []int,
+	id int,
+	opts Options,
+) []Change {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, typeCheckedName, code, 0)
+	if err != nil {
+		return nil
+	}
+	files := []*ast.File{f}
+	for name, sibling := range siblings {
+		s, err := parser.ParseFile(fset, name, sibling, 0)
+		if err != nil {
+			return nil
+		}
+		files = append(files, s)
+	}
+	info := &types.Info{
+		Types: make(map[ast.Expr]types.TypeAndValue),
+		Uses:  make(map[*ast.Ident]types.Object),
+	}
+	conf := types.Config{
+		Importer: fallbackImporter{
+			importer.ForCompiler(fset, "source", nil),
+		},
+		// Code may not build, e.g. of unused variables.
+		Error: func(error) {},
+	}
+	conf.Check(f.Name.Name, fset, files, info)
+	tf := fset.File(f.FileStart)
+	var changes []Change
+	ast.Inspect(f, func(n ast.Node) bool {
+		s, ok := n.(*ast.ExprStmt)
+		if !ok {
+			return true
+		}
+		call, ok := s.X.(*ast.CallExpr)
+		if !ok {
+			return true
+		}
+		// -1 is an adjustment for 0-based count.
+		lineNum := tf.Line(s.Pos()) - 1
+		if tf.Line(s.End())-1 != lineNum ||
+			ignored(code, starts, lineNum) {
+			return true
+		}
+		count := results(info, call)
+		if count == 0 {
+			return true
+		}
+		if opts.Number {
+			id++
+		}
+		start, end := tf.Offset(s.Pos()), tf.Offset(s.End())
+		blanks := strings.Repeat("_, ", count-1) + "_"
+		comment := strings.TrimSuffix(
+			fakeUsageCommentText(opts, id), fakeUsageCommentSuffix,
+		) + resultsMarker + fakeUsageCommentSuffix
+		stmt := string(code[start:end])
+		changes = append(changes, Change{
+			Action:  ActionAdd,
+			Kind:    KindResults,
+			Name:    types.ExprString(call.Fun),
+			LineNum: lineNum,
+			Start:   start,
+			End:     end,
+			Text:    blanks + " = " + stmt + comment,
+			Author:  opts.Author,
+			ID:      id,
+			Date:    opts.Date,
+		})
+		return true
+	})
+	return changes
+}
+
+// results returns how many results call has in info or 0 if it has none, isn’t
+// known or is of a builtin function or a conversion.
+func results(info *types.Info, call *ast.CallExpr) int {
+	fun := ast.Unparen(call.Fun)
+	if sel, ok := fun.(*ast.SelectorExpr); ok {
+		fun = sel.Sel
+	}
+	if ident, ok := fun.(*ast.Ident); ok {
+		if _, ok := info.Uses[ident].(*types.Builtin); ok {
+			return 0
+		}
+	}
+	if tv := info.Types[call.Fun]; tv.IsType() {
+		return 0
+	}
+	tv, ok := info.Types[call]
+	if !ok || tv.IsVoid() || tv.Type == nil {
+		return 0
+	}
+	switch t := tv.Type.(type) {
+	case *types.Tuple:
+		return t.Len()
+	case *types.Basic:
+		if t.Kind() == types.Invalid {
+			return 0
+		}
+	}
+	return 1
+}
+
+// findResultsMarkers returns changes which restore every call whose results
+// are assigned to ‘_’ by resultsAdditions.
+func findResultsMarkers(code []byte) []Change {
+	var changes []Change
+	for _, m := range silencedCall.FindAllSubmatchIndex(code, -1) {
+		call := string(code[m[4]:m[5]])
+		c := Change{
+			Action:  ActionRemove,
+			Kind:    KindResults,
+			LineNum: bytes.Count(code[:m[2]], []byte("\n")),
+			Start:   m[2],
+			End:     m[3],
+			Text:    call,
+		}
+		if e, err := parser.ParseExpr(call); err == nil {
+			if e, ok := e.(*ast.CallExpr); ok {
+				c.Name = types.ExprString(e.Fun)
+			}
+		}
+		stampMarker(&c, code, m, 6)
+		changes = append(changes, c)
+	}
+	return changes
+}
+
+// fallbackImporter imports packages with Importer, e.g. from source, and ones
+// it can’t, e.g. in WebAssembly, with emptyImporter.
+type fallbackImporter struct {
+	types.Importer
+}
+
+func (i fallbackImporter) Import(p string) (*types.Package, error) {
+	if pkg, err := i.Importer.Import(p); err == nil {
+		return pkg, nil
+	}
+	return emptyImporter{}.Import(p)
+}
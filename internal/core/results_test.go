@@ -0,0 +1,87 @@
+package core
+
+import (
+	"context"
+	"testing"
+)
+
+const resultsInput = `package p
+
+import (
+	"strconv"
+
+	"example.com/missing"
+)
+
+func g() (int, error) { return 0, nil }
+
+func h() {}
+
+func f() {
+	strconv.Atoi("1") // Comment.
+	g()
+	h()
+	missing.F()
+	println()
+	copy([]int{}, []int{})
+	if true { g() }
+	g(
+	)
+}
+`
+
+func TestFindChangesResults(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	ctx, cancel := context.WithCancel(ctx)
+	t.Cleanup(cancel)
+	input := []byte(resultsInput)
+	opts := Options{
+		Backend: BackendTypeCheck, Mode: ModeAdd, Results: true,
+		Author: "alice", Number: true,
+	}
+	changes, err := FindChanges(ctx, input, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := ApplyChanges(input, changes)
+	want := `package p
+
+import (
+	"strconv"
+
+	"example.com/missing"
+)
+
+func g() (int, error) { return 0, nil }
+
+func h() {}
+
+func f() {
+	_, _ = strconv.Atoi("1") /* TODO(alice): gouse#1 results */ // Comment.
+	_, _ = g() /* TODO(alice): gouse#2 results */
+	h()
+	missing.F()
+	println()
+	copy([]int{}, []int{})
+	if true { _, _ = g() /* TODO(alice): gouse#3 results */ }
+	g(
+	)
+}
+`
+	if string(got) != want {
+		t.Errorf(filesCmpErr, got, want)
+	}
+	markers := FindMarkers(got)
+	if len(markers) != 3 {
+		t.Fatalf("got: %v, want 3 markers", markers)
+	}
+	if c := markers[0]; c.Name != "strconv.Atoi" || c.ID != 1 ||
+		c.Author != opts.Author {
+		t.Errorf("got: %v, want: strconv.Atoi", c)
+	}
+	restored := ApplyChanges(got, markers)
+	if string(restored) != resultsInput {
+		t.Errorf(filesCmpErr, restored, resultsInput)
+	}
+}
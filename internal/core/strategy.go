@@ -0,0 +1,321 @@
+package core
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Strategy is how unused variables are handled.
+type Strategy string
+
+const (
+	// StrategyUse creates fake usages of unused variables.
+	StrategyUse Strategy = "use"
+	// StrategyComment comments out declarations of unused variables.
+	StrategyComment Strategy = "comment"
+	// StrategyDelete deletes declarations of unused variables, keeping
+	// them quoted in a TODO comment to restore them from.
+	StrategyDelete Strategy = "delete"
+)
+
+func (s *Strategy) String() string { return string(*s) }
+
+func (s *Strategy) Set(v string) error {
+	switch Strategy(v) {
+	case StrategyUse, StrategyComment, StrategyDelete:
+		*s = Strategy(v)
+		return nil
+	}
+	format := "unknown strategy %q, want use, comment or delete"
+	return fmt.Errorf(format, v)
+}
+
+const (
+	lineCommentPrefix = "//"
+	deletedMarker     = " deleted "
+)
+
+var (
+	// commentedDecl catches the indentation and the code of a declaration
+	// commented out with StrategyComment, and its optional author, ID and
+	// date.
+	commentedDecl = regexp.MustCompile(
+		`(?m)^([ \t]*)` + lineCommentPrefix + ` (.+?)` +
+			fakeUsageCommentRegexp + `$`,
+	)
+	// deletedDecl catches the indentation, the optional author, ID and
+	// date, and the quoted code of a declaration deleted with
+	// StrategyDelete.
+	deletedDecl = regexp.MustCompile(
+		`(?m)^([ \t]*)` + lineCommentPrefix + ` TODO` +
+			`(?:\(([^()*\n]+)\))?` +
+			regexp.QuoteMeta(fakeUsageCommentTag) +
+			`(?:` + IDPrefix + `(\d+))?` +
+			`(?: (\d{4}-\d{2}-\d{2}))?` +
+			regexp.QuoteMeta(deletedMarker) +
+			`("(?:[^"\\\n]|\\.)*")$`,
+	)
+)
+
+// declChanges returns additions with fake usages of unused variables
+// replaced by changes which comment out or delete their declarations as
+// opts.Strategy says. Only declarations which take a line of their own and
+// declare no variables referenced elsewhere in the function are replaced;
+// others keep fake usages.
+func declChanges(code []byte, additions []Change, opts Options) []Change {
+	if opts.Strategy != StrategyComment && opts.Strategy != StrategyDelete {
+		return additions
+	}
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(
+		fset, "", code, parser.SkipObjectResolution,
+	)
+	// Code which can’t be parsed keeps fake usages.
+	if err != nil {
+		return additions
+	}
+	tf := fset.File(f.FileStart)
+	unused := make(map[int]map[string]bool)
+	// ids are IDs of the first additions on lines, which the changes
+	// replacing them take.
+	ids := make(map[int]int)
+	for _, c := range additions {
+		if unused[c.LineNum] == nil {
+			unused[c.LineNum] = make(map[string]bool)
+			ids[c.LineNum] = c.ID
+		}
+		unused[c.LineNum][c.Name] = true
+	}
+	decls := make(map[int]Change)
+	for _, d := range f.Decls {
+		fd, ok := d.(*ast.FuncDecl)
+		if !ok || fd.Body == nil {
+			continue
+		}
+		// Variables which are assigned later are reported as unused
+		// too, but their declarations can’t go.
+		refs := make(map[string]int)
+		ast.Inspect(fd.Body, func(n ast.Node) bool {
+			if ident, ok := n.(*ast.Ident); ok {
+				refs[ident.Name]++
+			}
+			return true
+		})
+		ast.Inspect(fd.Body, func(n ast.Node) bool {
+			s, ok := n.(ast.Stmt)
+			if !ok {
+				return true
+			}
+			lineNum, ok := removableDecl(code, tf, s, unused, refs)
+			if !ok {
+				return true
+			}
+			start, end := tf.Offset(s.Pos()), tf.Offset(s.End())
+			decls[lineNum] = declChange(
+				string(code[start:end]),
+				strings.Join(declaredNames(s), ", "),
+				lineNum, ids[lineNum],
+				start, end,
+				opts,
+			)
+			return true
+		})
+	}
+	var changes []Change
+	for _, c := range additions {
+		d, ok := decls[c.LineNum]
+		if !ok {
+			changes = append(changes, c)
+			continue
+		}
+		// One change replaces all additions on the line.
+		if !overlaps(changes, d) {
+			changes = append(changes, d)
+		}
+	}
+	return changes
+}
+
+// removableDecl reports whether the statement s in code with the token file tf
+// is a declaration which takes a line of its own and declares only variables
+// from unused for its line which aren’t referenced elsewhere, as refs counts.
+// It returns the 0-based number of the line.
+func removableDecl(
+	code []byte,
+	tf *token.File,
+	s ast.Stmt,
+	unused map[int]map[string]bool,
+	refs map[string]int,
+) (int, bool) {
+	names := declaredNames(s)
+	if len(names) == 0 {
+		return 0, false
+	}
+	// -1 is an adjustment for 0-based count.
+	lineNum := tf.Line(s.Pos()) - 1
+	if tf.Line(s.End())-1 != lineNum {
+		return 0, false
+	}
+	for _, name := range names {
+		if !unused[lineNum][name] || refs[name] != 1 {
+			return 0, false
+		}
+	}
+	start, end := tf.Offset(s.Pos()), tf.Offset(s.End())
+	lineStart := tf.Offset(tf.LineStart(lineNum + 1))
+	lineEnd := bytes.IndexByte(code[end:], '\n')
+	if lineEnd < 0 {
+		lineEnd = len(code)
+	} else {
+		lineEnd += end
+	}
+	alone := len(bytes.TrimSpace(code[lineStart:start])) == 0 &&
+		len(bytes.TrimSpace(code[end:lineEnd])) == 0
+	return lineNum, alone
+}
+
+// declChange returns a change which comments out or deletes, as opts.Strategy
+// says, the declaration decl of names on the line with 0-based number lineNum
+// at code[start:end], stamping id into the marker if it isn’t 0.
+func declChange(
+	decl, names string, lineNum, id, start, end int, opts Options,
+) Change {
+	c := Change{
+		Action:  ActionAdd,
+		Kind:    KindDecl,
+		Name:    names,
+		LineNum: lineNum,
+		Start:   start,
+		End:     end,
+		Author:  opts.Author,
+		ID:      id,
+		Date:    opts.Date,
+	}
+	switch opts.Strategy {
+	case StrategyComment:
+		c.Text = lineCommentPrefix + " " + decl +
+			fakeUsageCommentText(opts, id)
+	case StrategyDelete:
+		c.Text = lineCommentPrefix + " " + todoText(opts, id) +
+			deletedMarker + strconv.Quote(decl)
+	}
+	return c
+}
+
+// todoText returns the comment of fake usages created with opts and id, like
+// fakeUsageCommentText does, without the comment delimiters, e.g.
+// ‘TODO(author): gouse#3’, for line comments.
+func todoText(opts Options, id int) string {
+	comment := fakeUsageCommentText(opts, id)
+	comment = strings.TrimPrefix(comment, fakeUsageCommentPrefix[:4])
+	return strings.TrimSuffix(comment, fakeUsageCommentSuffix)
+}
+
+// findDeclMarkers returns changes which restore every declaration commented
+// out or deleted by declChanges.
+func findDeclMarkers(code []byte) []Change {
+	var changes []Change
+	for _, m := range commentedDecl.FindAllSubmatchIndex(code, -1) {
+		decl := string(code[m[4]:m[5]])
+		changes = append(changes, declMarker(code, m, decl, 6))
+	}
+	for _, m := range deletedDecl.FindAllSubmatchIndex(code, -1) {
+		decl, err := strconv.Unquote(string(code[m[10]:m[11]]))
+		if err != nil {
+			continue
+		}
+		changes = append(changes, declMarker(code, m, decl, 4))
+	}
+	return changes
+}
+
+// declMarker returns a change which restores the declaration decl from the
+// marker matched at m in code. The author, the ID and the date are caught by
+// the groups of m starting at the index i.
+func declMarker(code []byte, m []int, decl string, i int) Change {
+	// The indentation is kept.
+	start := m[3]
+	c := Change{
+		Action:  ActionRemove,
+		Kind:    KindDecl,
+		LineNum: bytes.Count(code[:start], []byte("\n")),
+		Start:   start,
+		End:     m[1],
+		Text:    decl,
+	}
+	stampMarker(&c, code, m, i)
+	stmt := "package p\nfunc _() {\n" + decl + "\n}"
+	f, err := parser.ParseFile(
+		token.NewFileSet(), "", stmt, parser.SkipObjectResolution,
+	)
+	if err == nil {
+		fd := f.Decls[0].(*ast.FuncDecl)
+		if len(fd.Body.List) == 1 {
+			names := declaredNames(fd.Body.List[0])
+			c.Name = strings.Join(names, ", ")
+		}
+	}
+	return c
+}
+
+// stampMarker sets the author, the ID and the date of c to the ones of the
+// marker matched at m in code, caught by the groups of m starting at the
+// index i.
+func stampMarker(c *Change, code []byte, m []int, i int) {
+	if m[i] >= 0 {
+		c.Author = string(code[m[i]:m[i+1]])
+	}
+	if m[i+2] >= 0 {
+		c.ID, _ = strconv.Atoi(string(code[m[i+2]:m[i+3]]))
+	}
+	if m[i+4] >= 0 {
+		c.Date = string(code[m[i+4]:m[i+5]])
+	}
+}
+
+// declaredNames returns names of variables declared by s, other than ‘_’, if
+// it’s a short variable declaration or a var declaration.
+func declaredNames(s ast.Stmt) []string {
+	var names []string
+	for _, ident := range declaredIdents(s) {
+		names = append(names, ident.Name)
+	}
+	return names
+}
+
+// declaredIdents returns identifiers of variables declared by s, other than
+// ‘_’, if it’s a short variable declaration or a var declaration.
+func declaredIdents(s ast.Stmt) []*ast.Ident {
+	var idents []*ast.Ident
+	switch s := s.(type) {
+	case *ast.AssignStmt:
+		if s.Tok != token.DEFINE {
+			return nil
+		}
+		for _, e := range s.Lhs {
+			ident, ok := e.(*ast.Ident)
+			if ok && ident.Name != "_" {
+				idents = append(idents, ident)
+			}
+		}
+	case *ast.DeclStmt:
+		d, ok := s.Decl.(*ast.GenDecl)
+		if !ok || d.Tok != token.VAR {
+			return nil
+		}
+		for _, spec := range d.Specs {
+			for _, ident := range spec.(*ast.ValueSpec).Names {
+				if ident.Name != "_" {
+					idents = append(idents, ident)
+				}
+			}
+		}
+	}
+	return idents
+}
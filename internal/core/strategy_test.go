@@ -0,0 +1,99 @@
+package core
+
+import (
+	"context"
+	"testing"
+)
+
+const strategyInput = `package p
+
+func main() {
+	notUsed0 := 1
+	var notUsed1, notUsed2 = "", "*/"
+	notUsed3, used0 := 2, 3
+	notUsed4 := 4
+	notUsed4 = 5
+	_ = used0
+}
+`
+
+func TestFindChangesStrategy(t *testing.T) {
+	tests := []struct {
+		strategy Strategy
+		want     string
+	}{
+		{
+			strategy: StrategyComment,
+			want: `package p
+
+func main() {
+	// notUsed0 := 1 /* TODO(alice): gouse */
+	// var notUsed1, notUsed2 = "", "*/" /* TODO(alice): gouse */
+	notUsed3, used0 := 2, 3; _ = notUsed3 /* TODO(alice): gouse */
+	notUsed4 := 4; _ = notUsed4 /* TODO(alice): gouse */
+	notUsed4 = 5
+	_ = used0
+}
+`,
+		},
+		{
+			strategy: StrategyDelete,
+			want: `package p
+
+func main() {
+	// TODO(alice): gouse deleted "notUsed0 := 1"
+	// TODO(alice): gouse deleted "var notUsed1, notUsed2 = \"\", \"*/\""
+	notUsed3, used0 := 2, 3; _ = notUsed3 /* TODO(alice): gouse */
+	notUsed4 := 4; _ = notUsed4 /* TODO(alice): gouse */
+	notUsed4 = 5
+	_ = used0
+}
+`,
+		},
+	}
+	for _, tt := range tests {
+		test := tt
+		t.Run(string(test.strategy), func(t *testing.T) {
+			t.Parallel()
+			ctx := context.Background()
+			ctx, cancel := context.WithCancel(ctx)
+			t.Cleanup(cancel)
+			input := []byte(strategyInput)
+			opts := Options{
+				Author: "alice", Strategy: test.strategy,
+			}
+			changes, err := FindChanges(ctx, input, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := ApplyChanges(input, changes)
+			if string(got) != test.want {
+				t.Errorf(filesCmpErr, got, test.want)
+			}
+			// Removal must restore declarations with their names
+			// and authors.
+			markers := FindMarkers(got)
+			if len(markers) != 4 {
+				t.Fatalf("got: %v, want 4 markers", markers)
+			}
+			if c := markers[1]; c.Name != "notUsed1, notUsed2" ||
+				c.Author != opts.Author {
+				t.Errorf("got: %v, want: notUsed1, notUsed2", c)
+			}
+			restored := ApplyChanges(got, markers)
+			if string(restored) != strategyInput {
+				t.Errorf(filesCmpErr, restored, strategyInput)
+			}
+		})
+	}
+}
+
+func TestStrategySet(t *testing.T) {
+	var s Strategy
+	if err := s.Set("delete"); err != nil || s != StrategyDelete {
+		t.Errorf("got: %s, %v, want: %s, nil", s, err, StrategyDelete)
+	}
+	if err := s.Set("ignore"); err == nil {
+		t.Error("got: nil, want: error")
+	}
+}
@@ -0,0 +1,61 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// StaleTempDirAge is how old temporary directories of gouse are when they’re
+// taken for leaked, e.g. by a run which was killed.
+const StaleTempDirAge = 24 * time.Hour
+
+// tempDirName matches names of temporary directories made by MakeTempDir,
+// with the PID of the run which made one in the submatch.
+var tempDirName = regexp.MustCompile(`^gouse-(\d+)-\d+$`)
+
+// MakeTempDir makes a temporary directory named after gouse and the PID of
+// the run, so leaked ones are recognized, see RemoveStaleTempDirs.
+func MakeTempDir() (string, error) {
+	pattern := fmt.Sprintf("gouse-%d-", os.Getpid())
+	dir, err := os.MkdirTemp(os.TempDir(), pattern)
+	if err != nil {
+		return "", fmt.Errorf("MakeTempDir: in os.MkdirTemp: %v", err)
+	}
+	return dir, nil
+}
+
+// RemoveStaleTempDirs removes temporary directories made by MakeTempDir in
+// dir which were last modified before now by more than maxAge, except the
+// ones of this run, and returns their paths. Directories which can’t be
+// removed are left for a later run.
+func RemoveStaleTempDirs(
+	dir string, now time.Time, maxAge time.Duration,
+) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		format := "RemoveStaleTempDirs: in os.ReadDir: %v"
+		return nil, fmt.Errorf(format, err)
+	}
+	var removed []string
+	for _, e := range entries {
+		m := tempDirName.FindStringSubmatch(e.Name())
+		if m == nil || !e.IsDir() ||
+			m[1] == strconv.Itoa(os.Getpid()) {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil || now.Sub(info.ModTime()) <= maxAge {
+			continue
+		}
+		p := filepath.Join(dir, e.Name())
+		if err := os.RemoveAll(p); err != nil {
+			continue
+		}
+		removed = append(removed, p)
+	}
+	return removed, nil
+}
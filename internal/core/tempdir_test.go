@@ -0,0 +1,74 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestRemoveStaleTempDirs(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	now := time.Now()
+	old := now.Add(-2 * StaleTempDirAge)
+	own := fmt.Sprintf("gouse-%d-1", os.Getpid())
+	tests := []struct {
+		name  string
+		isDir bool
+		mtime time.Time
+		stale bool
+	}{
+		{"gouse-1-123", true, old, true},
+		{"gouse-1-456", true, now, false},
+		{own, true, old, false},
+		// E.g. a checkout of gouse.
+		{"gouse", true, old, false},
+		{"gouse-update-1", true, old, false},
+		{"gouse-2-1", false, old, false},
+	}
+	for _, tt := range tests {
+		p := filepath.Join(dir, tt.name)
+		var err error
+		if tt.isDir {
+			err = os.Mkdir(p, 0o700)
+		} else {
+			err = os.WriteFile(p, nil, 0o600)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(p, time.Time{}, tt.mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	removed, err := RemoveStaleTempDirs(dir, now, StaleTempDirAge)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{filepath.Join(dir, "gouse-1-123")}
+	if !slices.Equal(removed, want) {
+		t.Errorf("got: %v, want: %v", removed, want)
+	}
+	for _, tt := range tests {
+		_, err := os.Stat(filepath.Join(dir, tt.name))
+		if exists := err == nil; exists == tt.stale {
+			t.Errorf("%s: got exists: %t", tt.name, exists)
+		}
+	}
+}
+
+func TestMakeTempDir(t *testing.T) {
+	t.Parallel()
+	dir, err := MakeTempDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	m := tempDirName.FindStringSubmatch(filepath.Base(dir))
+	if m == nil || m[1] != fmt.Sprint(os.Getpid()) {
+		t.Errorf("got: %s, want: gouse-%d-<random>", dir, os.Getpid())
+	}
+}
@@ -0,0 +1,109 @@
+package core
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Backend is how unused variables are found.
+type Backend string
+
+const (
+	// BackendBuild builds code with the go command and takes unused
+	// variables from build errors.
+	BackendBuild Backend = "build"
+	// BackendTypeCheck type-checks code in process without resolving
+	// imports, so it runs where the go command doesn’t, e.g. in
+	// WebAssembly, see typeCheckSymbols.
+	BackendTypeCheck Backend = "typecheck"
+)
+
+func (b *Backend) String() string { return string(*b) }
+
+func (b *Backend) Set(v string) error {
+	switch Backend(v) {
+	case BackendBuild, BackendTypeCheck:
+		*b = Backend(v)
+		return nil
+	}
+	return fmt.Errorf("unknown backend %q, want build or typecheck", v)
+}
+
+// typeCheckedName is the name code is type-checked under, which siblings
+// don’t have.
+const typeCheckedName = "\x00code.go"
+
+// majorVersion catches major version suffixes of import paths, e.g. ‘/v2’ and
+// ‘.v3’ of gopkg.in.
+var majorVersion = regexp.MustCompile(`[/.]v\d+$`)
+
+// typeCheckSymbols returns a line and a name of every symbol from errors of
+// type-checking code with siblings which suffix catches, like
+// getSymbolsInfoFromBuildErrors does from build errors. Imported packages are
+// empty, so there are no errors of missing imports, and code which doesn’t
+// parse has no symbols, like code which doesn’t build.
+func typeCheckSymbols(
+	code []byte, siblings map[string][]byte, suffix string,
+) ([]symbolInfo, error) {
+	if suffix != notUsedErrorRegexpSuffix {
+		return nil, nil
+	}
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, typeCheckedName, code, 0)
+	if err != nil {
+		return nil, nil
+	}
+	files := []*ast.File{f}
+	for name, sibling := range siblings {
+		s, err := parser.ParseFile(fset, name, sibling, 0)
+		if err != nil {
+			return nil, nil
+		}
+		files = append(files, s)
+	}
+	var info []symbolInfo
+	conf := types.Config{
+		Importer: emptyImporter{},
+		Error: func(err error) {
+			e, ok := err.(types.Error)
+			if !ok {
+				return
+			}
+			p := fset.Position(e.Pos)
+			symbol, ok := symbolOf(e.Msg, suffix)
+			if !ok || p.Filename != typeCheckedName {
+				return
+			}
+			symbol.name = strings.TrimSpace(symbol.name)
+			// -1 is an adjustment for 0-based count.
+			symbol.lineNum = p.Line - 1
+			info = append(info, symbol)
+		},
+	}
+	// Errors are reported to conf.Error.
+	conf.Check(f.Name.Name, fset, files, nil)
+	// Like build errors, symbols are in the order of lines.
+	slices.SortStableFunc(info, func(a, b symbolInfo) int {
+		return a.lineNum - b.lineNum
+	})
+	return info, nil
+}
+
+// emptyImporter imports packages without declarations, named after the last
+// element of their paths.
+type emptyImporter struct{}
+
+func (emptyImporter) Import(p string) (*types.Package, error) {
+	name := path.Base(majorVersion.ReplaceAllString(p, ""))
+	name = strings.TrimPrefix(name, "go-")
+	pkg := types.NewPackage(p, name)
+	pkg.MarkComplete()
+	return pkg, nil
+}
@@ -0,0 +1,80 @@
+package core
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestTypeCheckSymbols(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name     string
+		code     string
+		siblings map[string][]byte
+		suffix   string
+		want     []symbolInfo
+	}{
+		{
+			name: "unused variables",
+			code: "package p\n\nfunc f() {\n\ty := 1\n\tx := 2\n" +
+				"}\n",
+			suffix: notUsedErrorRegexpSuffix,
+			want: []symbolInfo{
+				{name: "y", lineNum: 3},
+				{name: "x", lineNum: 4},
+			},
+		},
+		{
+			name: "unresolved imports",
+			code: "package p\n\n" +
+				"import \"example.com/go-lib/v2\"\n\n" +
+				"func f() {\n\tx := lib.New()\n}\n",
+			suffix: notUsedErrorRegexpSuffix,
+			want:   []symbolInfo{{name: "x", lineNum: 5}},
+		},
+		{
+			name: "unused variables of siblings",
+			code: "package p\n\nfunc f() {}\n",
+			siblings: map[string][]byte{
+				"a.go": []byte("package p\n\n" +
+					"func g() {\n\tx := 1\n}\n"),
+			},
+			suffix: notUsedErrorRegexpSuffix,
+		},
+		{
+			name:   "syntax errors",
+			code:   "package p\n\nfunc f() {\n\tx := \n}\n",
+			suffix: notUsedErrorRegexpSuffix,
+		},
+		{
+			name:   "other errors",
+			code:   "package p\n\nfunc f() {\n\tx := 1\n}\n",
+			suffix: noProviderErrorRegexpSuffix,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := typeCheckSymbols(
+				[]byte(tt.code), tt.siblings, tt.suffix,
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got: %v, want: %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBackendSet(t *testing.T) {
+	t.Parallel()
+	var b Backend
+	if err := b.Set("typecheck"); err != nil || b != BackendTypeCheck {
+		t.Errorf("got: %q, %v, want: %q, nil", b, err, BackendTypeCheck)
+	}
+	if err := b.Set("gopls"); err == nil {
+		t.Errorf("got: nil, want: an error of an unknown backend")
+	}
+}
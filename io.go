@@ -1,12 +1,25 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
+	"io/fs"
+	"log"
 	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/looshch/gouse/internal/core"
 )
 
 // file represents *os.File and is used wherever *os.File is used.
@@ -30,23 +43,153 @@ var openFile osOpenFile = func(
 
 // config represents parsed CLI arguments.
 type config struct {
-	version bool
-	write   bool
-	paths   []string
+	command          string
+	version          bool
+	write            bool
+	dryRun           bool
+	interactive      bool
+	tui              bool
+	output           string
+	watch            bool
+	lsp              bool
+	goplsProxy       goplsProxy
+	rpc              bool
+	serve            string
+	playground       string
+	grpc             string
+	remote           string
+	metrics          string
+	daemon           bool
+	client           bool
+	stats            statsFormat
+	date             bool
+	author           author
+	maxErrors        int
+	maxToggles       int
+	maxFileSize      fileSize
+	backup           bool
+	journal          bool
+	mtime            mtimePolicy
+	noFollowSymlinks bool
+	force            bool
+	atomic           bool
+	rcs              bool
+	cursor           cursorOffsets
+	format           outputFormat
+	print0           bool
+	patch            string
+	maxAge           age
+	txtar            bool
+	acme             bool
+	selection        bool
+	stdinFilename    string
+	diffFilter       bool
+	staged           bool
+	since            string
+	hookAction       hookAction
+	strategy         core.Strategy
+	backend          core.Backend
+	adopt            bool
+	number           bool
+	params           bool
+	receivers        bool
+	results          bool
+	placement        core.Placement
+	id               int
+	exitZero         bool
+	filelist         string
+	nul              bool
+	recursive        bool
+	includeVendor    bool
+	includeTestdata  bool
+	logFormat        logFormat
+	paths            []string
+}
+
+const (
+	commandToggle      = "toggle"
+	commandAdd         = "add"
+	commandRemove      = "remove"
+	commandCheck       = "check"
+	commandList        = "list"
+	commandAudit       = "audit"
+	commandPurge       = "purge"
+	commandReport      = "report"
+	commandCompletion  = "completion"
+	commandInstallHook = "install-hook"
+	commandDoctor      = "doctor"
+	commandUpdate      = "update"
+	commandUndo        = "undo"
+)
+
+// commands are all commands in the order they’re documented.
+var commands = []string{
+	commandToggle, commandAdd, commandRemove,
+	commandCheck, commandList, commandAudit, commandPurge, commandReport,
+	commandUndo, commandCompletion, commandInstallHook, commandDoctor,
+	commandUpdate,
 }
 
-const usageText = "usage: gouse [-v] [-w] [file paths...]"
+// noFileCommands are commands which don’t take Go files, so flags of all the
+// other commands don’t apply to them.
+var noFileCommands = []string{
+	commandUndo, commandCompletion, commandInstallHook, commandDoctor,
+	commandUpdate,
+}
+
+// modes maps toggling commands to modes of core.FindChanges.
+var modes = map[string]core.Mode{
+	commandToggle: core.ModeToggle,
+	commandAdd:    core.ModeAdd,
+	commandRemove: core.ModeRemove,
+}
+
+const usageText = "usage: gouse [toggle|add|remove] [-v] [-w] [-n] [-i] " +
+	"[-tui] [-o output path] [-rcs] [-cursor offsets] [-format format] " +
+	"[-patch patch path] [-watch] [-lsp] [-gopls-proxy[=path]] [-rpc] " +
+	"[-serve address] [-serve-playground address] [-grpc address] " +
+	"[-metrics address] [-daemon] [-client] [-stats[=json]] [-date] " +
+	"[-author[=name]] [-max-errors n] [-max-toggles n] " +
+	"[-max-file-size size] [-backup] [-journal] " +
+	"[-preserve-mtime[=same|always]] [-no-follow-symlinks] [-force] " +
+	"[-atomic] [-txtar] [-acme] [-selection] [-stdin-filename path] " +
+	"[-diff-filter] [-staged] [-strategy use|comment|delete] " +
+	"[-backend build|typecheck] [-remote address] [-adopt] [-number] " +
+	"[-params] [-receivers] [-results] [-id n] " +
+	"[-placement line|function] [-since rev] [-exit-zero] " +
+	"[-filelist path] [-0] [-r] [-include-vendor] [-include-testdata] " +
+	"[-log-format text|json] [file paths...]\n" +
+	"       gouse check|list [-max-age age] [-format format] [-print0] " +
+	"[-since rev] [-exit-zero] [-filelist path] [-0] [-r] " +
+	"[-include-vendor] [-include-testdata] [-log-format text|json] " +
+	"[file paths...]\n" +
+	"       gouse audit [-max-age age] [-since rev] [-exit-zero] " +
+	"[-filelist path] [-0] [-r] [-include-vendor] [-include-testdata] " +
+	"[-log-format text|json] [file paths or patterns...]\n" +
+	"       gouse purge [-since rev] [-exit-zero] [-filelist path] [-0] " +
+	"[-r] [-include-vendor] [-include-testdata] [-log-format text|json] " +
+	"[file paths or patterns...]\n" +
+	"       gouse report [-since rev] [-exit-zero] [-filelist path] [-0] " +
+	"[-r] [-include-vendor] [-include-testdata] [-log-format text|json] " +
+	"[file paths or patterns...]\n" +
+	"       gouse undo [file paths...]\n" +
+	"       gouse completion bash|zsh|fish|powershell\n" +
+	"       gouse install-hook [-action strip|block] pre-commit\n" +
+	"       gouse doctor\n" +
+	"       gouse update"
 
 // parseArgs accepts args, parses them and returns config, parsing message and
 // err. flag.ErrHelp is a special error which is returned on -h, -help, --help
-// and when misused.
+// and when misused. If the first argument is a command, it’s parsed with its
+// own flags; otherwise the command is toggle.
 func parseArgs(args []string) (*config, string, error) {
-	c := new(config)
-	flags := flag.NewFlagSet("", flag.ContinueOnError)
+	c := &config{command: commandToggle}
+	if len(args) > 0 && slices.Contains(commands, args[0]) {
+		c.command, args = args[0], args[1:]
+	}
+	flags := newFlagSet(c)
 	var out bytes.Buffer
 	flags.SetOutput(&out)
-	flags.BoolVar(&c.version, "v", false, "show version")
-	flags.BoolVar(&c.write, "w", false, "write results to files")
 	flags.Usage = func() { out.Write([]byte(usageText)) }
 	if err := flags.Parse(args); err != nil {
 		return nil, out.String(), err
@@ -56,29 +199,1309 @@ func parseArgs(args []string) (*config, string, error) {
 	return c, out.String(), nil
 }
 
-// toggleFile takes code from in, toggles it, deletes contents of out if it’s
-// in, and writes the toggled version to out.
-func toggleFile(ctx context.Context, in, out file) error {
-	code, err := io.ReadAll(in)
+// newFlagSet returns flags of c.command bound to fields of c. It’s shared by
+// parseArgs and completion scripts, so they can’t get out of sync.
+func newFlagSet(c *config) *flag.FlagSet {
+	flags := flag.NewFlagSet(c.command, flag.ContinueOnError)
+	switch c.command {
+	case commandToggle, commandAdd, commandRemove:
+		flags.BoolVar(&c.version, "v", false, "show version")
+		flags.BoolVar(&c.write, "w", false, "write results to files")
+		flags.BoolVar(
+			&c.dryRun, "n", false, "print planned changes only",
+		)
+		flags.BoolVar(
+			&c.interactive, "i", false, "ask before every change",
+		)
+		flags.BoolVar(
+			&c.tui, "tui", false, "choose changes full-screen",
+		)
+		flags.StringVar(&c.output, "o", "", "write result to the path")
+		flags.BoolVar(&c.rcs, "rcs", false, "print an RCS diff")
+		flags.Var(&c.cursor, "cursor", "print the offsets moved")
+		flags.Var(&c.format, "format", "print edits in the format")
+		flags.StringVar(
+			&c.patch, "patch", "", "write a patch to the path",
+		)
+		flags.BoolVar(
+			&c.watch, "watch", false, "add fake usages on changes",
+		)
+		flags.BoolVar(&c.lsp, "lsp", false, "serve LSP over stdio")
+		flags.Var(&c.goplsProxy, "gopls-proxy", "proxy LSP to gopls")
+		flags.BoolVar(
+			&c.rpc, "rpc", false, "serve JSON-RPC over stdio",
+		)
+		flags.StringVar(
+			&c.serve, "serve", "", "serve HTTP on the address",
+		)
+		flags.StringVar(
+			&c.playground, "serve-playground", "",
+			"serve a web UI on the address",
+		)
+		flags.StringVar(
+			&c.grpc, "grpc", "", "serve gRPC on the address",
+		)
+		flags.StringVar(
+			&c.metrics, "metrics", "",
+			"serve metrics on the address",
+		)
+		flags.BoolVar(
+			&c.daemon, "daemon", false, "serve runs on a socket",
+		)
+		flags.BoolVar(
+			&c.client, "client", false, "forward to -daemon",
+		)
+		flags.Var(&c.stats, "stats", "print counters: text or json")
+		flags.BoolVar(&c.date, "date", false, "stamp the date")
+		flags.Var(&c.author, "author", "stamp the author")
+		flags.IntVar(&c.maxErrors, "max-errors", 0, "cap per file")
+		flags.IntVar(&c.maxToggles, "max-toggles", 0, "cap in total")
+		c.maxFileSize = defaultMaxFileSize
+		flags.Var(&c.maxFileSize, "max-file-size", "skip larger files")
+		flags.BoolVar(
+			&c.backup, "backup", false, "back up files for undo",
+		)
+		flags.BoolVar(
+			&c.journal, "journal", false, "record changes for undo",
+		)
+		flags.Var(&c.mtime, "preserve-mtime", "same or always")
+		flags.BoolVar(
+			&c.noFollowSymlinks, "no-follow-symlinks", false,
+			"refuse to write through symlinks",
+		)
+		flags.BoolVar(
+			&c.force, "force", false,
+			"write back read-only files",
+		)
+		flags.BoolVar(
+			&c.atomic, "atomic", false,
+			"write back all files or none",
+		)
+		flags.BoolVar(
+			&c.txtar, "txtar", false, "toggle a txtar archive",
+		)
+		flags.BoolVar(
+			&c.acme, "acme", false, "toggle a selection in Acme",
+		)
+		flags.BoolVar(
+			&c.selection, "selection", false,
+			"toggle a selection from stdin",
+		)
+		flags.StringVar(
+			&c.stdinFilename, "stdin-filename", "",
+			"the file stdin is from",
+		)
+		flags.BoolVar(
+			&c.diffFilter, "diff-filter", false, "only diff lines",
+		)
+		flags.BoolVar(
+			&c.staged, "staged", false, "toggle staged contents",
+		)
+		c.strategy = core.StrategyUse
+		flags.Var(&c.strategy, "strategy", "use, comment or delete")
+		flags.StringVar(
+			&c.remote, "remote", "", "toggle on a -grpc server",
+		)
+		c.backend = core.DefaultBackend
+		flags.Var(&c.backend, "backend", "build or typecheck")
+		flags.BoolVar(
+			&c.adopt, "adopt", false, "remove hand-written _ = x",
+		)
+		flags.BoolVar(&c.number, "number", false, "stamp IDs")
+		flags.BoolVar(
+			&c.params, "params", false, "rename unused parameters",
+		)
+		flags.BoolVar(
+			&c.receivers, "receivers", false,
+			"rename unused receivers",
+		)
+		flags.BoolVar(
+			&c.results, "results", false, "assign ignored results",
+		)
+		c.placement = core.PlacementLine
+		flags.Var(&c.placement, "placement", "line or function")
+		flags.IntVar(&c.id, "id", 0, "only the fake usage with the ID")
+	case commandCheck, commandList, commandAudit:
+		if c.command == commandAudit {
+			c.maxAge = age(defaultMaxAge)
+		}
+		flags.Var(&c.maxAge, "max-age", "only older fake usages")
+		if c.command != commandAudit {
+			usage := "print edits in the format"
+			flags.Var(&c.format, "format", usage)
+			flags.BoolVar(
+				&c.print0, "print0", false,
+				"print NUL-separated file names",
+			)
+		}
+	case commandInstallHook:
+		c.hookAction = hookStrip
+		flags.Var(&c.hookAction, "action", "strip or block")
+	}
+	if !slices.Contains(noFileCommands, c.command) {
+		flags.StringVar(
+			&c.since, "since", "", "only files changed since rev",
+		)
+		flags.BoolVar(
+			&c.exitZero, "exit-zero", false, "always exit with 0",
+		)
+		flags.StringVar(
+			&c.filelist, "filelist", "", "read paths from the file",
+		)
+		flags.BoolVar(&c.nul, "0", false, "NUL-separated paths")
+		flags.BoolVar(
+			&c.recursive, "r", false, "descend into subdirectories",
+		)
+		flags.BoolVar(
+			&c.includeVendor, "include-vendor", false,
+			"descend into vendor directories",
+		)
+		flags.BoolVar(
+			&c.includeTestdata, "include-testdata", false,
+			"descend into testdata directories",
+		)
+		c.logFormat = logText
+		flags.Var(&c.logFormat, "log-format", "text or json")
+	}
+	return flags
+}
+
+// age is a duration which also accepts a number of days, e.g. ‘30d’.
+type age time.Duration
+
+const day = 24 * time.Hour
+
+func (a *age) String() string {
+	d := time.Duration(*a)
+	if d > 0 && d%day == 0 {
+		return fmt.Sprintf("%dd", d/day)
+	}
+	return d.String()
+}
+
+func (a *age) Set(s string) error {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return fmt.Errorf("invalid number of days %q", days)
+		}
+		*a = age(time.Duration(n) * day)
+		return nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*a = age(d)
+	return nil
+}
+
+// fileSize is a number of bytes which also accepts KB, MB and GB suffixes,
+// e.g. ‘5MB’.
+type fileSize int64
+
+// defaultMaxFileSize is a default size over which files are skipped, as
+// toggling multi-megabyte generated files takes long.
+const defaultMaxFileSize fileSize = 5 << 20
+
+// fileSizeUnits are suffixes of fileSize, the greatest first.
+var fileSizeUnits = []struct {
+	suffix string
+	size   fileSize
+}{
+	{"GB", 1 << 30},
+	{"MB", 1 << 20},
+	{"KB", 1 << 10},
+}
+
+func (s *fileSize) String() string {
+	for _, u := range fileSizeUnits {
+		if *s > 0 && *s%u.size == 0 {
+			return fmt.Sprintf("%d%s", *s/u.size, u.suffix)
+		}
+	}
+	return strconv.FormatInt(int64(*s), 10)
+}
+
+func (s *fileSize) Set(v string) error {
+	unit := fileSize(1)
+	for _, u := range fileSizeUnits {
+		if n, ok := strings.CutSuffix(v, u.suffix); ok {
+			v, unit = n, u.size
+			break
+		}
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || n < 0 {
+		return fmt.Errorf("invalid file size %q", v)
+	}
+	*s = fileSize(n) * unit
+	return nil
+}
+
+// author is a value of ‘-author’ flag. Without a value, fromGit is set and the
+// name is taken from git config user.name.
+type author struct {
+	name    string
+	fromGit bool
+}
+
+func (a *author) String() string { return a.name }
+
+func (a *author) Set(s string) error {
+	switch s {
+	// ‘-author’ without a value is passed as ‘true’.
+	case "true":
+		*a = author{fromGit: true}
+	case "false":
+		*a = author{}
+	default:
+		if err := validateAuthor(s); err != nil {
+			return err
+		}
+		*a = author{name: s}
+	}
+	return nil
+}
+
+// IsBoolFlag lets ‘-author’ be used without a value.
+func (a *author) IsBoolFlag() bool { return true }
+
+// validateAuthor returns an error if name can’t be stamped into a fake usage.
+func validateAuthor(name string) error {
+	if name == "" || strings.ContainsAny(name, "()*\n") {
+		return fmt.Errorf("invalid author %q", name)
+	}
+	return nil
+}
+
+// gitUserName returns git config user.name.
+func gitUserName(ctx context.Context) (string, error) {
+	out, err := exec.CommandContext(
+		ctx, "git", "config", "user.name",
+	).Output()
+	if err != nil {
+		return "", fmt.Errorf("gitUserName: in *Cmd.Output: %v", err)
+	}
+	name := strings.TrimSpace(string(out))
+	if err := validateAuthor(name); err != nil {
+		return "", fmt.Errorf("gitUserName: %v", err)
+	}
+	return name, nil
+}
+
+// statsFormat is a format of counters printed with ‘-stats’ flag. It’s empty if
+// they aren’t printed.
+type statsFormat string
+
+const (
+	statsText statsFormat = "text"
+	statsJSON statsFormat = "json"
+)
+
+func (f *statsFormat) String() string { return string(*f) }
+
+func (f *statsFormat) Set(s string) error {
+	switch statsFormat(s) {
+	case statsText, statsJSON:
+		*f = statsFormat(s)
+	// ‘-stats’ without a value is passed as ‘true’.
+	case "true":
+		*f = statsText
+	case "false":
+		*f = ""
+	default:
+		return fmt.Errorf("unknown format %q", s)
+	}
+	return nil
+}
+
+// IsBoolFlag lets ‘-stats’ be used without a value.
+func (f *statsFormat) IsBoolFlag() bool { return true }
+
+// stats represents counters of a run.
+type stats struct {
+	// Files is a number of files with at least one change.
+	Files   int `json:"files"`
+	Added   int `json:"added"`
+	Removed int `json:"removed"`
+}
+
+// add counts changes of a file.
+func (s *stats) add(changes []core.Change) {
+	if len(changes) > 0 {
+		s.Files++
+	}
+	for _, c := range changes {
+		if c.Action == core.ActionRemove {
+			s.Removed++
+		} else {
+			s.Added++
+		}
+	}
+}
+
+// format returns s in format f.
+func (s *stats) format(f statsFormat) string {
+	if f == statsJSON {
+		b, _ := json.Marshal(s)
+		return string(b)
+	}
+	return fmt.Sprintf(
+		"files: %d, added: %d, removed: %d",
+		s.Files, s.Added, s.Removed,
+	)
+}
+
+// samePath reports whether paths a and b point to the same file.
+func samePath(a, b string) bool {
+	if filepath.Clean(a) == filepath.Clean(b) {
+		return true
+	}
+	aInfo, err := os.Stat(a)
+	if err != nil {
+		return false
+	}
+	bInfo, err := os.Stat(b)
+	if err != nil {
+		return false
+	}
+	return os.SameFile(aInfo, bInfo)
+}
+
+// changesFilter returns changes to code which must be applied.
+type changesFilter func(
+	code []byte, changes []core.Change,
+) ([]core.Change, error)
+
+// chainFilters returns a changesFilter which applies filters in order. nil
+// filters are skipped.
+func chainFilters(filters ...changesFilter) changesFilter {
+	return func(code []byte, changes []core.Change) ([]core.Change, error) {
+		for _, f := range filters {
+			if f == nil {
+				continue
+			}
+			var err error
+			changes, err = f(code, changes)
+			if err != nil {
+				return nil, fmt.Errorf("chainFilters: %v", err)
+			}
+		}
+		return changes, nil
+	}
+}
+
+// writeHook is a side effect of writing a file back with changes: read is what
+// was read from it, and toggled is what it’s written back with, both in its
+// encoding.
+type writeHook func(read, toggled []byte, changes []core.Change) error
+
+// chainHooks returns a writeHook which calls hooks in order. nil hooks are
+// skipped.
+func chainHooks(hooks ...writeHook) writeHook {
+	return func(read, toggled []byte, changes []core.Change) error {
+		for _, h := range hooks {
+			if h == nil {
+				continue
+			}
+			if err := h(read, toggled, changes); err != nil {
+				return fmt.Errorf("chainHooks: %v", err)
+			}
+		}
+		return nil
+	}
+}
+
+// writeHooks are called around writing a file back, only with changes which
+// are written. Either may be nil.
+type writeHooks struct {
+	// before is called before the file is written, e.g. to back it up.
+	before writeHook
+	// after is called after the file is written, e.g. to record what was
+	// written.
+	after writeHook
+}
+
+const stoppedFormat = "%s:%d: stopped after %d changes over -max-toggles"
+
+// budget caps the number of changes across all files.
+type budget struct {
+	max, left int
+	log       *log.Logger
+	// stopped reports whether where the budget ran out was printed.
+	stopped bool
+}
+
+func newBudget(max int, log *log.Logger) *budget {
+	return &budget{max: max, left: max, log: log}
+}
+
+// filter returns a changesFilter which keeps changes in the file name while
+// the budget lasts and prints to log where it ran out.
+func (b *budget) filter(name string) changesFilter {
+	return func(code []byte, changes []core.Change) ([]core.Change, error) {
+		if len(changes) <= b.left {
+			b.left -= len(changes)
+			return changes, nil
+		}
+		kept := changes[:b.left]
+		// It’s printed once, for the first skipped change.
+		if !b.stopped {
+			c := changes[b.left]
+			// +1 is an adjustment for 1-based count.
+			b.log.Printf(stoppedFormat, name, c.LineNum+1, b.max)
+			b.stopped = true
+		}
+		b.left = 0
+		return kept, nil
+	}
+}
+
+// onlyID returns a changesFilter which keeps only changes of the fake usage
+// stamped with id.
+func onlyID(id int) changesFilter {
+	return func(code []byte, changes []core.Change) ([]core.Change, error) {
+		var kept []core.Change
+		for _, c := range changes {
+			if c.ID == id {
+				kept = append(kept, c)
+			}
+		}
+		return kept, nil
+	}
+}
+
+const skippedAdditionsFormat = "%s: skipped %d fake usages over -max-errors"
+
+const skippedLargeFileFormat = "%s: skipped, %d bytes is over -max-file-size"
+
+// sizeOver returns the size of the file p and whether it’s over max, which is
+// no limit if it’s 0. Files which can’t be stat’ed aren’t over, so opening them
+// reports the error.
+func sizeOver(p string, max fileSize) (int64, bool) {
+	if max == 0 {
+		return 0, false
+	}
+	info, err := os.Stat(p)
+	if err != nil {
+		return 0, false
+	}
+	return info.Size(), fileSize(info.Size()) > max
+}
+
+// limitAdditions returns a changesFilter which keeps at most max fake usages
+// to create, top-down, and prints to log how many of them were skipped in the
+// file name.
+func limitAdditions(name string, max int, log *log.Logger) changesFilter {
+	return func(code []byte, changes []core.Change) ([]core.Change, error) {
+		var kept []core.Change
+		var added, skipped int
+		for _, c := range changes {
+			if c.Action == core.ActionAdd {
+				if added == max {
+					skipped++
+					continue
+				}
+				added++
+			}
+			kept = append(kept, c)
+		}
+		if skipped > 0 {
+			log.Printf(skippedAdditionsFormat, name, skipped)
+		}
+		return kept, nil
+	}
+}
+
+// toggleFile takes code from in, toggles it with opts, deletes contents of out
+// if it’s in, and writes the toggled version to out. If filter isn’t nil, only
+// changes it returns are applied. hooks are called if out is in. It returns
+// the applied changes.
+func toggleFile(
+	ctx context.Context, opts core.Options, in, out file,
+	filter changesFilter, hooks writeHooks,
+) ([]core.Change, error) {
+	read, err := readCode(in)
 	if err != nil {
-		return fmt.Errorf("toggleFile: in io.ReadAll: %v", err)
+		return nil, fmt.Errorf("toggleFile: %v", err)
 	}
-	toggled, err := toggle(ctx, code)
+	toggled, changes, err := toggledCode(ctx, opts, read, filter)
 	if err != nil {
-		return fmt.Errorf("toggleFile: %v", err)
+		return nil, fmt.Errorf("toggleFile: %v", err)
 	}
+	// Files without changes aren’t rewritten, so their modification
+	// time stays intact.
+	if out == in && len(changes) == 0 {
+		return nil, nil
+	}
+	if out != in {
+		hooks = writeHooks{}
+	}
+	err = writeBackHooked(in, out, read, toggled, changes, hooks)
+	if err != nil {
+		return nil, fmt.Errorf("toggleFile: %v", err)
+	}
+	return changes, nil
+}
+
+// writeBackHooked writes toggled like writeToggled does, calling hooks before
+// and after it with read and changes.
+func writeBackHooked(
+	in, out file, read, toggled []byte, changes []core.Change,
+	hooks writeHooks,
+) error {
+	const thisName = "writeBackHooked"
+	if hooks.before != nil {
+		if err := hooks.before(read, toggled, changes); err != nil {
+			return fmt.Errorf("%s: %v", thisName, err)
+		}
+	}
+	if err := writeToggled(in, out, read, toggled); err != nil {
+		return fmt.Errorf("%s: %v", thisName, err)
+	}
+	if hooks.after != nil {
+		if err := hooks.after(read, toggled, changes); err != nil {
+			return fmt.Errorf("%s: %v", thisName, err)
+		}
+	}
+	return nil
+}
+
+// toggledCode returns read toggled as opts says with changes which filter
+// kept. It’s in the encoding of read.
+func toggledCode(
+	ctx context.Context, opts core.Options, read []byte,
+	filter changesFilter,
+) ([]byte, []core.Change, error) {
+	code, enc, err := decodeCode(read)
+	if err != nil {
+		return nil, nil, fmt.Errorf("toggledCode: %v", err)
+	}
+	changes, err := core.FindChanges(ctx, code, opts)
+	if err != nil {
+		return nil, nil, fmt.Errorf("toggledCode: %v", err)
+	}
+	if filter != nil {
+		changes, err = filter(code, changes)
+		if err != nil {
+			return nil, nil, fmt.Errorf("toggledCode: %v", err)
+		}
+	}
+	return encodeCode(core.ApplyChanges(code, changes), enc), changes, nil
+}
+
+// readCode returns all code from in. Files on disk are read into a buffer of
+// their size, so large ones aren’t copied as it grows.
+func readCode(in file) ([]byte, error) {
+	var b bytes.Buffer
+	if f, ok := in.(*os.File); ok {
+		info, err := f.Stat()
+		if err == nil && info.Mode().IsRegular() {
+			b.Grow(int(info.Size()) + bytes.MinRead)
+		}
+	}
+	if _, err := b.ReadFrom(in); err != nil {
+		return nil, fmt.Errorf("readCode: in *Buffer.ReadFrom: %v", err)
+	}
+	return b.Bytes(), nil
+}
+
+// writeToggled deletes contents of out if it’s in and writes toggled to out.
+// Files on disk are replaced atomically, see writeFileAtomically, unless they
+// changed since code was read from them.
+func writeToggled(in, out file, code, toggled []byte) error {
 	if out == in {
+		if f, ok := out.(*os.File); ok {
+			if err := checkUnchanged(f.Name(), code); err != nil {
+				return fmt.Errorf("writeToggled: %v", err)
+			}
+			err := writeFileAtomically(f.Name(), toggled)
+			if err == nil {
+				return nil
+			}
+			// Otherwise the file is written in place, which keeps
+			// its owner.
+			if err != errOwnerNotKept {
+				return fmt.Errorf("writeToggled: %v", err)
+			}
+		}
 		if _, err := out.Seek(0, io.SeekStart); err != nil {
-			return fmt.Errorf("toggleFile: in *File.Seek: %v", err)
+			return fmt.Errorf(
+				"writeToggled: in *File.Seek: %v", err,
+			)
 		}
 		if err := out.Truncate(0); err != nil {
 			return fmt.Errorf(
-				"toggleFile: in *File.Truncate: %v", err,
+				"writeToggled: in *File.Truncate: %v", err,
 			)
 		}
 	}
 	if _, err := out.Write(toggled); err != nil {
-		return fmt.Errorf("toggleFile: in *File.Write: %v", err)
+		return fmt.Errorf("writeToggled: in *File.Write: %v", err)
 	}
 	return nil
 }
+
+// writeOutput writes b to the file p of ‘-o’ flag and gives it the mode of
+// the file in, if in isn’t empty. Regular files, new ones included, are
+// replaced atomically, see writeFileAtomically; others, e.g. named pipes, and
+// files whose owner can’t be kept are written in place.
+func writeOutput(p, in string, b []byte, openFile osOpenFile) (err error) {
+	const thisName = "writeOutput"
+
+	info, err := os.Stat(p)
+	if errors.Is(err, fs.ErrNotExist) {
+		// writeFileAtomically replaces existing files, so an empty one
+		// is created first and removed if it isn’t written.
+		var f file
+		f, err = openFile(p, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+		if err != nil {
+			return fmt.Errorf("%s: %v", thisName, err)
+		}
+		f.Close()
+		defer func() {
+			if err != nil {
+				os.Remove(p)
+			}
+		}()
+		info, err = os.Stat(p)
+	}
+	if err != nil {
+		return fmt.Errorf(thisName+": in os.Stat: %v", err)
+	}
+	regular := info.Mode().IsRegular()
+	var written bool
+	if regular {
+		err = writeFileAtomically(p, b)
+		// Otherwise the file is written in place, which keeps its
+		// owner.
+		if err != nil && err != errOwnerNotKept {
+			return fmt.Errorf("%s: %v", thisName, err)
+		}
+		written = err == nil
+	}
+	flag := os.O_WRONLY
+	if !written {
+		flag |= os.O_TRUNC
+	}
+	out, err := openFile(p, flag, 0)
+	if err != nil {
+		return fmt.Errorf("%s: %v", thisName, err)
+	}
+	defer out.Close()
+	if !written {
+		if _, err = out.Write(b); err != nil {
+			return fmt.Errorf(thisName+": in *File.Write: %v", err)
+		}
+	}
+	// Modes of e.g. terminals aren’t to be changed.
+	if regular && in != "" {
+		if err = copyMode(out, in); err != nil {
+			return fmt.Errorf("%s: %v", thisName, err)
+		}
+	}
+	return nil
+}
+
+// isRegularFile reports whether the file p is a regular file, unlike e.g. a
+// named pipe or a pipe of process substitution, which can be read only once
+// and can’t be written back. Paths which can’t be read are reported as
+// regular, so opening them reports the error.
+func isRegularFile(p string) bool {
+	info, err := os.Stat(p)
+	return err != nil || info.Mode().IsRegular()
+}
+
+// refuseSymlinks returns an error if any of paths is a symbolic link, so files
+// aren’t written through links with ‘-no-follow-symlinks’ flag.
+func refuseSymlinks(paths []string) error {
+	for _, p := range paths {
+		if p == stdinPath {
+			continue
+		}
+		info, err := os.Lstat(p)
+		// Opening the path reports the error.
+		if err != nil {
+			continue
+		}
+		// Pipes behind links, e.g. of process substitution, aren’t
+		// written back.
+		if info.Mode()&os.ModeSymlink != 0 && isRegularFile(p) {
+			format := "%s is a symbolic link, not following it"
+			return fmt.Errorf(format, p)
+		}
+	}
+	return nil
+}
+
+// keptMode returns the mode bits of the file info describes which rewritten
+// files keep: permissions and setuid, setgid and sticky bits.
+func keptMode(info os.FileInfo) os.FileMode {
+	return info.Mode() &
+		(os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky)
+}
+
+// copyMode gives out, if it’s a file on disk, the mode of the file p, so
+// e.g. executable scripts stay executable when written elsewhere.
+func copyMode(out file, p string) error {
+	f, ok := out.(*os.File)
+	if !ok {
+		return nil
+	}
+	info, err := os.Stat(p)
+	if err != nil {
+		return fmt.Errorf("copyMode: in os.Stat: %v", err)
+	}
+	if err := f.Chmod(keptMode(info)); err != nil {
+		return fmt.Errorf("copyMode: in *File.Chmod: %v", err)
+	}
+	return nil
+}
+
+// makeWritable gives the owner permission to write the file p if it’s
+// read-only, for ‘-force’ flag. It returns the mode p had and whether it was
+// changed, so restoreMode can give it back.
+func makeWritable(p string) (os.FileMode, bool, error) {
+	const thisName = "makeWritable"
+
+	info, err := os.Stat(p)
+	if err != nil {
+		return 0, false, fmt.Errorf(thisName+": in os.Stat: %v", err)
+	}
+	mode := keptMode(info)
+	if mode&0o200 != 0 {
+		return mode, false, nil
+	}
+	if err := os.Chmod(p, mode|0o200); err != nil {
+		return 0, false, fmt.Errorf(thisName+": in os.Chmod: %v", err)
+	}
+	return mode, true, nil
+}
+
+// restoreMode gives the file p the mode which makeWritable returned.
+func restoreMode(p string, mode os.FileMode) error {
+	if err := os.Chmod(p, mode); err != nil {
+		return fmt.Errorf("restoreMode: in os.Chmod: %v", err)
+	}
+	return nil
+}
+
+// errFileChanged is returned by checkUnchanged if a file changed since it was
+// read, e.g. was saved by an editor meanwhile.
+var errFileChanged = errors.New(
+	"the file changed since it was read, not overwriting it",
+)
+
+// compareChunkSize is the size of chunks checkUnchanged compares files in.
+const compareChunkSize = 64 << 10
+
+// checkUnchanged returns errFileChanged if the file p no longer has contents
+// code, so newer contents aren’t overwritten with results of older ones. The
+// file is compared in chunks, so large files aren’t held in memory twice.
+func checkUnchanged(p string, code []byte) error {
+	const thisName = "checkUnchanged"
+
+	f, err := os.Open(p)
+	if err != nil {
+		return fmt.Errorf(thisName+": in os.Open: %v", err)
+	}
+	defer f.Close()
+	chunk := make([]byte, compareChunkSize)
+	for {
+		n, err := io.ReadFull(f, chunk)
+		if !bytes.HasPrefix(code, chunk[:n]) {
+			return errFileChanged
+		}
+		code = code[n:]
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf(thisName+": in io.ReadFull: %v", err)
+		}
+	}
+	if len(code) > 0 {
+		return errFileChanged
+	}
+	return nil
+}
+
+// tempFilePattern is a pattern of names of temporary files which
+// writeFileAtomically creates next to the files it writes.
+const tempFilePattern = ".*.gouse.tmp"
+
+// errOwnerNotKept is returned by writeFileAtomically if the replacement of a
+// file can’t get its owner, e.g. because the file is someone else’s.
+var errOwnerNotKept = errors.New("cannot keep the owner of the file")
+
+// writeFileAtomically writes b to a temporary file in the directory of the
+// file p and renames it over p, so p has either its old or its new contents
+// even if gouse is killed midway. The mode and the owner of p are kept, and a
+// symbolic link p stays one, as the file it points to is written. If the owner
+// can’t be kept, p is left intact and errOwnerNotKept is returned.
+func writeFileAtomically(p string, b []byte) (err error) {
+	const thisName = "writeFileAtomically"
+
+	target, err := filepath.EvalSymlinks(p)
+	if err != nil {
+		format := thisName + ": in filepath.EvalSymlinks: %v"
+		return fmt.Errorf(format, err)
+	}
+	info, err := os.Stat(target)
+	if err != nil {
+		return fmt.Errorf(thisName+": in os.Stat: %v", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(target), tempFilePattern)
+	if err != nil {
+		return fmt.Errorf(thisName+": in os.CreateTemp: %v", err)
+	}
+	defer func() {
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+	if _, err := tmp.Write(b); err != nil {
+		return fmt.Errorf(thisName+": in *File.Write: %v", err)
+	}
+	if err := keepOwner(tmp, info); err != nil {
+		return errOwnerNotKept
+	}
+	// The mode is set after the owner, as changing the owner drops setuid
+	// and setgid bits.
+	if err := tmp.Chmod(keptMode(info)); err != nil {
+		return fmt.Errorf(thisName+": in *File.Chmod: %v", err)
+	}
+	// Otherwise the rename may reach the disk before the contents.
+	if err := tmp.Sync(); err != nil {
+		return fmt.Errorf(thisName+": in *File.Sync: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf(thisName+": in *File.Close: %v", err)
+	}
+	if err := os.Rename(tmp.Name(), target); err != nil {
+		return fmt.Errorf(thisName+": in os.Rename: %v", err)
+	}
+	return nil
+}
+
+// openLocked opens the file p with openFile for reading and writing and takes
+// an exclusive lock of it, so gouse runs, e.g. with ‘-watch’ flag and without
+// it, don’t write the file at once. If the file was replaced while waiting for
+// the lock, e.g. atomically by another run, the replacement is opened instead.
+func openLocked(p string, openFile osOpenFile) (file, error) {
+	const thisName = "openLocked"
+
+	for {
+		f, err := openFile(p, os.O_RDWR, os.ModeExclusive)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", thisName, err)
+		}
+		osFile, ok := f.(*os.File)
+		if !ok {
+			return f, nil
+		}
+		if err := lockFile(osFile); err != nil {
+			f.Close()
+			return nil, fmt.Errorf("%s: %v", thisName, err)
+		}
+		locked, err := osFile.Stat()
+		if err != nil {
+			f.Close()
+			format := thisName + ": in *File.Stat: %v"
+			return nil, fmt.Errorf(format, err)
+		}
+		current, err := os.Stat(p)
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf(thisName+": in os.Stat: %v", err)
+		}
+		if os.SameFile(locked, current) {
+			return f, nil
+		}
+		f.Close()
+	}
+}
+
+// failure is an error toggling the file at path, which is reported after the
+// other files are toggled.
+type failure struct {
+	path string
+	err  error
+}
+
+func (f failure) Error() string {
+	name := f.path
+	if name == stdinPath {
+		name = stdinName
+	}
+	return name + ": " + f.err.Error()
+}
+
+// stdinName is used in place of a path when code is read from stdin.
+const stdinName = "<standard input>"
+
+// stdinPath stands for stdin in path arguments.
+const stdinPath = "-"
+
+// dedupePaths returns paths without repeated files, keeping the first path of
+// each, so files given twice, e.g. as relative and absolute paths or via
+// symbolic links, aren’t toggled back. Stdin paths are kept, as repeating them
+// is an error.
+func dedupePaths(paths []string) []string {
+	seen := make(map[string]bool)
+	var deduped []string
+	for _, p := range paths {
+		if p == stdinPath {
+			deduped = append(deduped, p)
+			continue
+		}
+		key := filepath.Clean(p)
+		if abs, err := filepath.Abs(p); err == nil {
+			key = abs
+		}
+		// Paths which can’t be resolved are kept apart, so opening
+		// them reports the error.
+		if target, err := filepath.EvalSymlinks(key); err == nil {
+			key = target
+		}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		deduped = append(deduped, p)
+	}
+	return deduped
+}
+
+// countPath returns how many times p is in paths.
+func countPath(paths []string, p string) int {
+	var n int
+	for _, other := range paths {
+		if other == p {
+			n++
+		}
+	}
+	return n
+}
+
+// dryRunFile takes code from in and writes to out a summary of changes toggle
+// would make with opts, one per line, prefixed with name and a line number.
+// If filter isn’t nil, only changes it returns are written. It returns the
+// written changes.
+func dryRunFile(
+	ctx context.Context,
+	opts core.Options,
+	name string,
+	in, out file,
+	filter changesFilter,
+) ([]core.Change, error) {
+	read, err := io.ReadAll(in)
+	if err != nil {
+		return nil, fmt.Errorf("dryRunFile: in io.ReadAll: %v", err)
+	}
+	code, _, err := decodeCode(read)
+	if err != nil {
+		return nil, fmt.Errorf("dryRunFile: %v", err)
+	}
+	changes, err := core.FindChanges(ctx, code, opts)
+	if err != nil {
+		return nil, fmt.Errorf("dryRunFile: %v", err)
+	}
+	if filter != nil {
+		changes, err = filter(code, changes)
+		if err != nil {
+			return nil, fmt.Errorf("dryRunFile: %v", err)
+		}
+	}
+	if _, err := out.Write(formatChanges(name, changes)); err != nil {
+		return nil, fmt.Errorf("dryRunFile: in *File.Write: %v", err)
+	}
+	return changes, nil
+}
+
+// formatChanges returns a summary of changes, one per line, prefixed with name
+// and a line number.
+func formatChanges(name string, changes []core.Change) []byte {
+	var b bytes.Buffer
+	for _, c := range changes {
+		// +1 is an adjustment for 1-based count.
+		fmt.Fprintf(
+			&b, "%s:%d: %s %s\n",
+			name, c.LineNum+1, c.Action, c.Summary(),
+		)
+	}
+	return b.Bytes()
+}
+
+// prompter asks whether to apply changes one by one, like ‘git add -p’ does.
+type prompter struct {
+	in  *bufio.Reader
+	out io.Writer
+	// quit is set when the user declines all remaining changes.
+	quit bool
+}
+
+func newPrompter(in io.Reader, out io.Writer) *prompter {
+	return &prompter{in: bufio.NewReader(in), out: out}
+}
+
+const (
+	promptText = "%s %s [y,n,a,q,?]? "
+	promptHelp = `y - apply this change
+n - do not apply this change
+a - apply this and all later changes in the file
+q - quit; do not apply this or any of the remaining changes
+`
+	contextLines = 2
+)
+
+// filter returns a changesFilter which prompts for every change in the file
+// name.
+func (p *prompter) filter(name string) changesFilter {
+	return func(code []byte, changes []core.Change) ([]core.Change, error) {
+		var accepted []core.Change
+		lines := strings.Split(string(code), "\n")
+		for i, c := range changes {
+			if p.quit {
+				break
+			}
+			p.printContext(name, lines, c)
+			answer, err := p.ask(c)
+			if err != nil {
+				return nil, fmt.Errorf("filter: %v", err)
+			}
+			switch answer {
+			case "y":
+				accepted = append(accepted, c)
+			case "a":
+				return append(accepted, changes[i:]...), nil
+			case "q":
+				p.quit = true
+			}
+		}
+		return accepted, nil
+	}
+}
+
+// printContext prints the position of c and the lines around it.
+func (p *prompter) printContext(name string, lines []string, c core.Change) {
+	// +1 is an adjustment for 1-based count.
+	fmt.Fprintf(p.out, "%s:%d:\n", name, c.LineNum+1)
+	first := max(c.LineNum-contextLines, 0)
+	last := min(c.LineNum+contextLines, len(lines)-1)
+	for i := first; i <= last; i++ {
+		marker := " "
+		if i == c.LineNum {
+			marker = ">"
+		}
+		fmt.Fprintf(p.out, "%s %s\n", marker, lines[i])
+	}
+}
+
+// ask prompts for c until it gets a valid answer. It returns ‘q’ if the input
+// is over.
+func (p *prompter) ask(c core.Change) (string, error) {
+	for {
+		fmt.Fprintf(p.out, promptText, c.Action, c.Summary())
+		line, err := p.in.ReadString('\n')
+		if err == io.EOF && line == "" {
+			fmt.Fprintln(p.out)
+			return "q", nil
+		} else if err != nil && err != io.EOF {
+			format := "ask: in *Reader.ReadString: %v"
+			return "", fmt.Errorf(format, err)
+		}
+		switch answer := strings.TrimSpace(line); answer {
+		case "y", "n", "a", "q":
+			return answer, nil
+		default:
+			fmt.Fprint(p.out, promptHelp)
+		}
+	}
+}
+
+// listFile takes code from in and writes to out every fake usage in it, each
+// ended with terminator, prefixed with name and a line number. If
+// expiredBefore isn’t empty, only fake usages stamped with an earlier date are
+// written. It returns the number of written fake usages.
+func listFile(
+	name, expiredBefore string, terminator byte, in, out file,
+) (int, error) {
+	code, err := io.ReadAll(in)
+	if err != nil {
+		return 0, fmt.Errorf("listFile: in io.ReadAll: %v", err)
+	}
+	listed := listedMarkers(code, expiredBefore)
+	var b bytes.Buffer
+	for _, c := range listed {
+		// +1 is an adjustment for 1-based count.
+		fmt.Fprintf(&b, "%s:%d: fake usage ", name, c.LineNum+1)
+		if c.ID > 0 {
+			fmt.Fprintf(&b, "%s%d ", core.IDPrefix, c.ID)
+		}
+		fmt.Fprintf(&b, "of %s", c.Name)
+		if c.Author != "" {
+			fmt.Fprintf(&b, " by %s", c.Author)
+		}
+		if c.Date != "" {
+			fmt.Fprintf(&b, " (%s)", c.Date)
+		}
+		b.WriteByte(terminator)
+	}
+	if _, err := out.Write(b.Bytes()); err != nil {
+		return 0, fmt.Errorf("listFile: in *File.Write: %v", err)
+	}
+	return len(listed), nil
+}
+
+// listedMarkers returns fake usages in code or, if expiredBefore isn’t empty,
+// only the ones stamped with an earlier date.
+func listedMarkers(code []byte, expiredBefore string) []core.Change {
+	var listed []core.Change
+	for _, c := range core.FindMarkers(code) {
+		// Dates are compared as strings because core.DateLayout is
+		// sorted lexicographically.
+		if expiredBefore != "" &&
+			(c.Date == "" || c.Date >= expiredBefore) {
+			continue
+		}
+		listed = append(listed, c)
+	}
+	return listed
+}
+
+const (
+	// lineTerminator ends listed fake usages by default.
+	lineTerminator = '\n'
+	// nulTerminator ends listed fake usages and paths with ‘-0’ flag, so
+	// paths with any characters are safe.
+	nulTerminator = 0
+)
+
+// readNULPaths returns paths from in, each ended with nulTerminator. The last
+// one may be unterminated.
+func readNULPaths(in io.Reader) ([]string, error) {
+	b, err := io.ReadAll(in)
+	if err != nil {
+		return nil, fmt.Errorf("readNULPaths: in io.ReadAll: %v", err)
+	}
+	var paths []string
+	for _, p := range strings.Split(string(b), "\x00") {
+		if p != "" {
+			paths = append(paths, p)
+		}
+	}
+	return paths, nil
+}
+
+// fileListComment starts comments in files read by readFileList.
+const fileListComment = "#"
+
+// readFileList returns paths from the file name, one per line. Blank lines and
+// comments are skipped.
+func readFileList(name string, openFile osOpenFile) ([]string, error) {
+	f, err := openFile(name, os.O_RDONLY, os.ModeExclusive)
+	if err != nil {
+		return nil, fmt.Errorf("readFileList: %v", err)
+	}
+	defer f.Close()
+	var paths []string
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		p := strings.TrimSpace(s.Text())
+		if p == "" || strings.HasPrefix(p, fileListComment) {
+			continue
+		}
+		paths = append(paths, p)
+	}
+	if err := s.Err(); err != nil {
+		format := "readFileList: in *Scanner.Scan: %v"
+		return nil, fmt.Errorf(format, err)
+	}
+	return paths, nil
+}
+
+// reportMarkers takes code from in and passes fake usages in it to report as
+// changes which remove them. If expiredBefore isn’t empty, only fake usages
+// stamped with an earlier date are passed. It returns the number of passed fake
+// usages.
+func reportMarkers(
+	name, expiredBefore string, report editsReporter, in file,
+) (int, error) {
+	code, err := io.ReadAll(in)
+	if err != nil {
+		return 0, fmt.Errorf("reportMarkers: in io.ReadAll: %v", err)
+	}
+	listed := listedMarkers(code, expiredBefore)
+	if err := report(name, code, listed); err != nil {
+		return 0, fmt.Errorf("reportMarkers: %v", err)
+	}
+	return len(listed), nil
+}
+
+// fileNames returns an editsReporter which writes to out the name of every file
+// with changes, ended with NUL, like ‘find -print0’ does, so names with any
+// characters are safe for ‘xargs -0’.
+func fileNames(out file) editsReporter {
+	return func(name string, code []byte, changes []core.Change) error {
+		if len(changes) == 0 {
+			return nil
+		}
+		b := append([]byte(name), nulTerminator)
+		if _, err := out.Write(b); err != nil {
+			return fmt.Errorf("fileNames: in *File.Write: %v", err)
+		}
+		return nil
+	}
+}
+
+// listFiles lists fake usages from files in paths or, if there are none, from
+// in, which ‘-’ among paths stands for too, writing them to out, each ended
+// with terminator, or passing them to report if it isn’t nil. If expiredBefore
+// isn’t empty, only fake usages stamped with an earlier date are listed. It
+// returns the number of listed fake usages.
+func listFiles(
+	paths []string,
+	expiredBefore string,
+	terminator byte,
+	report editsReporter,
+	in, out file,
+
+	openFile osOpenFile,
+) (int, error) {
+	if len(paths) == 0 {
+		paths = []string{stdinPath}
+	}
+	var total int
+	for _, p := range paths {
+		name, f := stdinName, in
+		if p != stdinPath {
+			var err error
+			f, err = openFile(p, os.O_RDONLY, os.ModeExclusive)
+			if err != nil {
+				format := "listFiles: %s: %v"
+				return 0, fmt.Errorf(format, p, err)
+			}
+			name = p
+		}
+		var n int
+		var err error
+		if report != nil {
+			n, err = reportMarkers(name, expiredBefore, report, f)
+		} else {
+			n, err = listFile(
+				name, expiredBefore, terminator, f, out,
+			)
+		}
+		if p != stdinPath {
+			f.Close()
+		}
+		if err != nil {
+			return 0, fmt.Errorf("listFiles: %s: %v", name, err)
+		}
+		total += n
+	}
+	return total, nil
+}
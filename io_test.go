@@ -4,8 +4,17 @@ import (
 	"bytes"
 	"errors"
 	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
 	"strings"
 	"testing"
+	"time"
+
+	"github.com/looshch/gouse/internal/core"
 )
 
 func TestParseArgs(t *testing.T) {
@@ -49,6 +58,83 @@ func TestParseArgs(t *testing.T) {
 				paths:   []string{},
 			},
 		},
+		{
+			args: []string{"-n"},
+			conf: config{
+				dryRun: true,
+				paths:  []string{},
+			},
+		},
+		{
+			args: []string{"-o", "path1", "path2"},
+			conf: config{
+				output: "path1",
+				paths:  []string{"path2"},
+			},
+		},
+		{
+			args: []string{"-stats", "path1"},
+			conf: config{
+				stats: statsText,
+				paths: []string{"path1"},
+			},
+		},
+		{
+			args: []string{"-stats=json"},
+			conf: config{
+				stats: statsJSON,
+				paths: []string{},
+			},
+		},
+		{
+			args: []string{"-date"},
+			conf: config{
+				date:  true,
+				paths: []string{},
+			},
+		},
+		{
+			args: []string{"-author"},
+			conf: config{
+				author: author{fromGit: true},
+				paths:  []string{},
+			},
+		},
+		{
+			args: []string{"-author=Alice Smith"},
+			conf: config{
+				author: author{name: "Alice Smith"},
+				paths:  []string{},
+			},
+		},
+		{
+			args: []string{"check", "-max-age", "30d"},
+			conf: config{
+				command: commandCheck,
+				maxAge:  age(30 * 24 * time.Hour),
+				paths:   []string{},
+			},
+		},
+		{
+			args: []string{"remove", "-w", "path1"},
+			conf: config{
+				command: commandRemove,
+				write:   true,
+				paths:   []string{"path1"},
+			},
+		},
+		{
+			args: []string{"check", "path1"},
+			conf: config{
+				command: commandCheck,
+				paths:   []string{"path1"},
+			},
+		},
+		{
+			args:   []string{"list", "-h"},
+			output: usageText,
+			err:    flag.ErrHelp,
+		},
 		{
 			args: []string{"path1", "path2"},
 			conf: config{
@@ -82,6 +168,17 @@ func TestParseArgs(t *testing.T) {
 			}
 
 			wantConf := test.conf
+			// Without a command, it’s toggle.
+			if wantConf.command == "" {
+				wantConf.command = commandToggle
+			}
+			if conf.command != wantConf.command {
+				t.Errorf(
+					"got: %s, want: %s",
+					conf.command,
+					wantConf.command,
+				)
+			}
 			if (*conf).version != wantConf.version {
 				t.Errorf(
 					"got: %t, want: %t",
@@ -96,6 +193,48 @@ func TestParseArgs(t *testing.T) {
 					wantConf.write,
 				)
 			}
+			if conf.date != wantConf.date {
+				t.Errorf(
+					"got: %t, want: %t",
+					conf.date,
+					wantConf.date,
+				)
+			}
+			if conf.author != wantConf.author {
+				t.Errorf(
+					"got: %v, want: %v",
+					conf.author,
+					wantConf.author,
+				)
+			}
+			if conf.maxAge != wantConf.maxAge {
+				t.Errorf(
+					"got: %s, want: %s",
+					&conf.maxAge,
+					&wantConf.maxAge,
+				)
+			}
+			if conf.stats != wantConf.stats {
+				t.Errorf(
+					"got: %s, want: %s",
+					conf.stats,
+					wantConf.stats,
+				)
+			}
+			if conf.output != wantConf.output {
+				t.Errorf(
+					"got: %s, want: %s",
+					conf.output,
+					wantConf.output,
+				)
+			}
+			if conf.dryRun != wantConf.dryRun {
+				t.Errorf(
+					"got: %t, want: %t",
+					conf.dryRun,
+					wantConf.dryRun,
+				)
+			}
 			bpaths := []byte(strings.Join(conf.paths, ""))
 			wantConfBPaths := []byte(
 				strings.Join(wantConf.paths, ""),
@@ -109,3 +248,612 @@ func TestParseArgs(t *testing.T) {
 		})
 	}
 }
+
+func TestPrompterFilter(t *testing.T) {
+	code := []byte("a\nb\nc")
+	changes := []core.Change{
+		{Name: "a", LineNum: 0},
+		{Name: "b", LineNum: 1},
+		{Name: "c", LineNum: 2},
+	}
+	tests := []struct {
+		answers string
+		want    string
+	}{
+		{answers: "y\nn\ny\n", want: "ac"},
+		{answers: "n\na\n", want: "bc"},
+		{answers: "y\nq\n", want: "a"},
+		{answers: "x\ny\n", want: "a"},
+		{answers: "", want: ""},
+	}
+	for _, tt := range tests {
+		test := tt
+		t.Run(test.answers, func(t *testing.T) {
+			t.Parallel()
+			answers := strings.NewReader(test.answers)
+			p := newPrompter(answers, new(bytes.Buffer))
+			got, err := p.filter("filename")(code, changes)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var names string
+			for _, c := range got {
+				names += c.Name
+			}
+			if names != test.want {
+				t.Errorf("got: %s, want: %s", names, test.want)
+			}
+		})
+	}
+}
+
+func TestListFiles(t *testing.T) {
+	input, err := os.ReadFile(filepath.Join("testdata", "used.input"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var openInput osOpenFile = func(
+		name string, flag int, perm os.FileMode,
+	) (file, error) {
+		return newFakeFile(input...), nil
+	}
+	out := newFakeFile()
+	n, err := listFiles(
+		[]string{"a.go", "b.go"},
+		"",
+		lineTerminator,
+		nil,
+		newFakeFile(),
+		out,
+		openInput,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 4 {
+		t.Errorf("got: %d, want: %d", n, 4)
+	}
+	want := "a.go:7: fake usage of notUsed0\n" +
+		"a.go:10: fake usage of notUsed1\n" +
+		"b.go:7: fake usage of notUsed0\n" +
+		"b.go:10: fake usage of notUsed1\n"
+	if got := out.contents.String(); got != want {
+		t.Errorf(filesCmpErr, got, want)
+	}
+}
+
+func TestListFilesNames(t *testing.T) {
+	input, err := os.ReadFile(filepath.Join("testdata", "used.input"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var openInput osOpenFile = func(
+		name string, flag int, perm os.FileMode,
+	) (file, error) {
+		if name == "clean.go" {
+			return newFakeFile([]byte("package p\n")...), nil
+		}
+		return newFakeFile(input...), nil
+	}
+	out := newFakeFile()
+	_, err = listFiles(
+		[]string{"a b.go", "clean.go", "c\n.go"},
+		"",
+		lineTerminator,
+		fileNames(out),
+		newFakeFile(),
+		out,
+		openInput,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const want = "a b.go\x00c\n.go\x00"
+	if got := out.contents.String(); got != want {
+		t.Errorf(filesCmpErr, got, want)
+	}
+}
+
+func TestListFileExpired(t *testing.T) {
+	input, err := os.ReadFile(
+		filepath.Join("testdata", "used_dated.input"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := newFakeFile()
+	n, err := listFile(
+		"a.go",
+		"2024-06-03",
+		lineTerminator,
+		newFakeFile(input...),
+		out,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("got: %d, want: %d", n, 2)
+	}
+	want := "a.go:6: fake usage of notUsed0 (2024-06-01)\n" +
+		"a.go:8: fake usage of notUsed2 by Alice Smith (2024-06-02)\n"
+	if got := out.contents.String(); got != want {
+		t.Errorf(filesCmpErr, got, want)
+	}
+}
+
+func TestAgeSet(t *testing.T) {
+	tests := []struct {
+		value string
+		want  age
+		err   bool
+	}{
+		{value: "30d", want: age(30 * 24 * time.Hour)},
+		{value: "12h", want: age(12 * time.Hour)},
+		{value: "xd", err: true},
+		{value: "30", err: true},
+	}
+	for _, tt := range tests {
+		test := tt
+		t.Run(test.value, func(t *testing.T) {
+			t.Parallel()
+			var got age
+			err := got.Set(test.value)
+			if (err != nil) != test.err {
+				t.Fatalf("got: %v, want err: %t", err, test.err)
+			}
+			if got != test.want {
+				t.Errorf("got: %s, want: %s", &got, &test.want)
+			}
+		})
+	}
+}
+
+func TestFileSizeSet(t *testing.T) {
+	tests := []struct {
+		value string
+		want  fileSize
+		err   bool
+	}{
+		{value: "5MB", want: 5 << 20},
+		{value: "512KB", want: 512 << 10},
+		{value: "1GB", want: 1 << 30},
+		{value: "1000", want: 1000},
+		{value: "0", want: 0},
+		{value: "xMB", err: true},
+		{value: "-1", err: true},
+	}
+	for _, tt := range tests {
+		test := tt
+		t.Run(test.value, func(t *testing.T) {
+			t.Parallel()
+			var got fileSize
+			err := got.Set(test.value)
+			if (err != nil) != test.err {
+				t.Fatalf("got: %v, want err: %t", err, test.err)
+			}
+			if got != test.want {
+				t.Errorf("got: %s, want: %s", &got, &test.want)
+			}
+			if !test.err && got.String() != test.value {
+				t.Errorf("got: %s, want: %s", &got, test.value)
+			}
+		})
+	}
+}
+
+func TestSizeOver(t *testing.T) {
+	t.Parallel()
+	p := filepath.Join(t.TempDir(), "p.go")
+	if err := os.WriteFile(p, make([]byte, 2048), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		max  fileSize
+		want bool
+	}{
+		{0, false},
+		{1 << 10, true},
+		{2 << 10, false},
+	}
+	for _, tt := range tests {
+		if _, got := sizeOver(p, tt.max); got != tt.want {
+			t.Errorf("%s: got: %t, want: %t", &tt.max, got, tt.want)
+		}
+	}
+	if _, over := sizeOver("missing.go", 1); over {
+		t.Error("got: over, want: not over")
+	}
+}
+
+func TestAuthorSet(t *testing.T) {
+	tests := []struct {
+		value string
+		want  author
+		err   bool
+	}{
+		{value: "true", want: author{fromGit: true}},
+		{value: "false"},
+		{value: "alice", want: author{name: "alice"}},
+		{value: "(alice)", err: true},
+		{value: "*/", err: true},
+	}
+	for _, tt := range tests {
+		test := tt
+		t.Run(test.value, func(t *testing.T) {
+			t.Parallel()
+			var got author
+			err := got.Set(test.value)
+			if (err != nil) != test.err {
+				t.Fatalf("got: %v, want err: %t", err, test.err)
+			}
+			if got != test.want {
+				t.Errorf("got: %v, want: %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestLimitAdditions(t *testing.T) {
+	changes := []core.Change{
+		{Action: core.ActionAdd, Name: "a"},
+		{Action: core.ActionRemove, Name: "b"},
+		{Action: core.ActionAdd, Name: "c"},
+		{Action: core.ActionAdd, Name: "d"},
+	}
+	var out bytes.Buffer
+	filter := limitAdditions("a.go", 1, log.New(&out, "", 0))
+	got, err := filter(nil, changes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names string
+	for _, c := range got {
+		names += c.Name
+	}
+	if names != "ab" {
+		t.Errorf("got: %s, want: %s", names, "ab")
+	}
+	want := fmt.Sprintf(skippedAdditionsFormat, "a.go", 2) + "\n"
+	if out.String() != want {
+		t.Errorf("got: %s, want: %s", out.String(), want)
+	}
+}
+
+func TestReadFileList(t *testing.T) {
+	list := "a.go\n\n# Generated files.\n  b c.go  \n\t#d.go\n"
+	var openList osOpenFile = func(
+		name string, flag int, perm os.FileMode,
+	) (file, error) {
+		return newFakeFile([]byte(list)...), nil
+	}
+	got, err := readFileList("files.txt", openList)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"a.go", "b c.go"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %v, want: %v", got, want)
+	}
+}
+
+func TestListFileNUL(t *testing.T) {
+	input, err := os.ReadFile(filepath.Join("testdata", "used.input"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := newFakeFile()
+	_, err = listFile(
+		"a b.go", "", nulTerminator, newFakeFile(input...), out,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "a b.go:7: fake usage of notUsed0\x00" +
+		"a b.go:10: fake usage of notUsed1\x00"
+	if got := out.contents.String(); got != want {
+		t.Errorf(filesCmpErr, got, want)
+	}
+}
+
+func TestReadNULPaths(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{in: ""},
+		{in: "a.go\x00", want: []string{"a.go"}},
+		{in: "a b.go\x00c\nd.go", want: []string{"a b.go", "c\nd.go"}},
+		{in: "a.go\x00\x00b.go\x00", want: []string{"a.go", "b.go"}},
+	}
+	for _, tt := range tests {
+		test := tt
+		t.Run(test.in, func(t *testing.T) {
+			t.Parallel()
+			got, err := readNULPaths(strings.NewReader(test.in))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got: %q, want: %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestListFileID(t *testing.T) {
+	input := "package p\n\nfunc main() {\n" +
+		"\tx := 0; _ = x /* TODO(alice): gouse#3 2024-06-01 */\n}\n"
+	out := newFakeFile()
+	_, err := listFile(
+		"a.go", "", lineTerminator, newFakeFile([]byte(input)...), out,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "a.go:4: fake usage #3 of x by alice (2024-06-01)\n"
+	if got := out.contents.String(); got != want {
+		t.Errorf(filesCmpErr, got, want)
+	}
+}
+
+func TestOnlyID(t *testing.T) {
+	t.Parallel()
+	code := []byte("package p\n\nfunc main() {\n" +
+		"\tx, y := 0, 1; _ = x /* TODO: gouse#5 */; " +
+		"_ = y /* TODO: gouse#6 */\n}\n")
+	kept, err := onlyID(5)(code, core.FindMarkers(code))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(kept) != 1 || kept[0].Name != "x" {
+		t.Errorf("got: %v, want: x", kept)
+	}
+}
+
+func TestBudget(t *testing.T) {
+	changes := []core.Change{
+		{Name: "a", LineNum: 0},
+		{Name: "b", LineNum: 1},
+	}
+	var out bytes.Buffer
+	b := newBudget(3, log.New(&out, "", 0))
+	var names string
+	for _, name := range []string{"a.go", "b.go", "c.go"} {
+		got, err := b.filter(name)(nil, changes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, c := range got {
+			names += c.Name
+		}
+	}
+	if names != "aba" {
+		t.Errorf("got: %s, want: %s", names, "aba")
+	}
+	want := fmt.Sprintf(stoppedFormat, "b.go", 2, 3) + "\n"
+	if out.String() != want {
+		t.Errorf("got: %s, want: %s", out.String(), want)
+	}
+}
+
+func TestWriteToggledAtomically(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	p := filepath.Join(dir, "p.go")
+	if err := os.WriteFile(p, []byte("old contents"), 0o750); err != nil {
+		t.Fatal(err)
+	}
+	link := filepath.Join(dir, "link.go")
+	if err := os.Symlink(p, link); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.OpenFile(link, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	const want = "new"
+	err = writeToggled(f, f, []byte("old contents"), []byte(want))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != want {
+		t.Errorf(filesCmpErr, got, want)
+	}
+	info, err := os.Stat(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := info.Mode().Perm(); mode != 0o750 {
+		t.Errorf("got: %o, want: %o", mode, 0o750)
+	}
+	info, err = os.Lstat(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode()&os.ModeSymlink == 0 {
+		t.Error("got: a regular file, want: a symbolic link")
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Errorf("got: %d files, want: 2", len(entries))
+	}
+}
+
+func TestWriteToggledChangedFile(t *testing.T) {
+	t.Parallel()
+	p := filepath.Join(t.TempDir(), "p.go")
+	const newer = "saved by an editor"
+	if err := os.WriteFile(p, []byte(newer), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.OpenFile(p, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	err = writeToggled(f, f, []byte("read"), []byte("toggled"))
+	if err == nil {
+		t.Error("got: nil, want: error")
+	}
+	got, err := os.ReadFile(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != newer {
+		t.Errorf(filesCmpErr, got, newer)
+	}
+}
+
+func TestCopyMode(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	in := filepath.Join(dir, "in.go")
+	if err := os.WriteFile(in, nil, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	out, err := os.Create(filepath.Join(dir, "out.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+	if err := copyMode(out, in); err != nil {
+		t.Fatal(err)
+	}
+	info, err := out.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := info.Mode().Perm(); mode != 0o755 {
+		t.Errorf("got: %o, want: %o", mode, 0o755)
+	}
+	if err := copyMode(newFakeFile(), in); err != nil {
+		t.Errorf("got: %v, want: nil", err)
+	}
+}
+
+func TestRefuseSymlinks(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	target := filepath.Join(dir, "target.go")
+	if err := os.WriteFile(target, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	link := filepath.Join(dir, "link.go")
+	if err := os.Symlink(target, link); err != nil {
+		t.Fatal(err)
+	}
+	if err := refuseSymlinks([]string{stdinPath, target}); err != nil {
+		t.Errorf("got: %v, want: nil", err)
+	}
+	if err := refuseSymlinks([]string{target, link}); err == nil {
+		t.Error("got: nil, want: error")
+	}
+}
+
+func TestMakeWritable(t *testing.T) {
+	t.Parallel()
+	p := filepath.Join(t.TempDir(), "p.go")
+	if err := os.WriteFile(p, nil, 0o444); err != nil {
+		t.Fatal(err)
+	}
+	mode, changed, err := makeWritable(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !changed || mode != 0o444 {
+		t.Errorf("got: %o, %t, want: %o, true", mode, changed, 0o444)
+	}
+	info, err := os.Stat(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := info.Mode().Perm(); got != 0o644 {
+		t.Errorf("got: %o, want: %o", got, 0o644)
+	}
+	if _, changed, _ := makeWritable(p); changed {
+		t.Error("got: changed writable file, want: intact")
+	}
+	if err := restoreMode(p, mode); err != nil {
+		t.Fatal(err)
+	}
+	if info, _ := os.Stat(p); info.Mode().Perm() != 0o444 {
+		t.Errorf("got: %o, want: %o", info.Mode().Perm(), 0o444)
+	}
+}
+
+func TestIsRegularFile(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	p := filepath.Join(dir, "p.go")
+	if err := os.WriteFile(p, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		path string
+		want bool
+	}{
+		{"regular file", p, true},
+		{"directory", dir, false},
+		{"missing file", filepath.Join(dir, "missing.go"), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if got := isRegularFile(tt.path); got != tt.want {
+				t.Errorf("got: %t, want: %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDedupePaths(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	p := filepath.Join(dir, "p.go")
+	if err := os.WriteFile(p, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	link := filepath.Join(dir, "link.go")
+	if err := os.Symlink(p, link); err != nil {
+		t.Fatal(err)
+	}
+	paths := []string{
+		p, stdinPath, filepath.Join(dir, ".", "p.go"), link,
+		"missing.go", stdinPath, "./missing.go",
+	}
+	got := dedupePaths(paths)
+	want := []string{p, stdinPath, "missing.go", stdinPath}
+	if !slices.Equal(got, want) {
+		t.Errorf("got: %v, want: %v", got, want)
+	}
+}
+
+func TestCheckUnchanged(t *testing.T) {
+	t.Parallel()
+	p := filepath.Join(t.TempDir(), "p.go")
+	// The file spans chunks.
+	code := bytes.Repeat([]byte("x"), compareChunkSize+1)
+	if err := os.WriteFile(p, code, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkUnchanged(p, code); err != nil {
+		t.Errorf("got: %v, want: nil", err)
+	}
+	changed := append(bytes.Clone(code[:len(code)-1]), 'y')
+	tests := [][]byte{changed, code[:len(code)-1], append(code, 'x')}
+	for _, older := range tests {
+		if err := checkUnchanged(p, older); err != errFileChanged {
+			t.Errorf("got: %v, want: %v", err, errFileChanged)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+//go:build unix
+
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestRunWritesPipesToStdout(t *testing.T) {
+	t.Parallel()
+	p := filepath.Join(t.TempDir(), "p.go")
+	if err := syscall.Mkfifo(p, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	code := "package p\n\nfunc f() {\n\tv := 0\n}\n"
+	go func() {
+		f, err := os.OpenFile(p, os.O_WRONLY, 0)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer f.Close()
+		f.WriteString(code)
+	}()
+	stdout, stderr := newFakeFile(), newFakeFile()
+	status := run(
+		context.Background(), []string{"-w", p}, newFakeFile(),
+		stdout, stderr, openFile,
+	)
+	if status != 0 {
+		t.Fatalf("got: %d, want: 0, %s", status, stderr.contents)
+	}
+	want := "package p\n\nfunc f() {\n" +
+		"\tv := 0; _ = v /* TODO: gouse */\n}\n"
+	if got := stdout.contents.String(); got != want {
+		t.Errorf(filesCmpErr, got, want)
+	}
+}
@@ -0,0 +1,421 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+
+	"github.com/looshch/gouse/internal/core"
+)
+
+// journalEntry records a fake usage created in a file, so it can be removed
+// exactly even after unrelated edits shifted it.
+type journalEntry struct {
+	// Run is when the run which created the fake usage started, in
+	// nanoseconds since the Unix epoch.
+	Run  int64  `json:"run"`
+	File string `json:"file"`
+	Name string `json:"name"`
+	// Offset is where Inserted starts in the file as it was written.
+	Offset   int    `json:"offset"`
+	Inserted string `json:"inserted"`
+	// Removed is what Inserted replaced, e.g. a declaration with
+	// core.StrategyComment.
+	Removed string `json:"removed,omitempty"`
+	// Hash is the SHA-256 hash of the file as it was written, in its
+	// encoding. Offset is in it decoded to UTF-8, see decodeCode.
+	Hash string `json:"hash"`
+}
+
+// defaultJournalPath returns the path of the journal under the user cache
+// directory.
+func defaultJournalPath() (string, error) {
+	dir, err := cacheDir()
+	if err != nil {
+		return "", fmt.Errorf("defaultJournalPath: %v", err)
+	}
+	return filepath.Join(dir, "journal.jsonl"), nil
+}
+
+// journal records fake usages created in files by the run which started at
+// run in a JSON Lines file at path.
+type journal struct {
+	path string
+	run  int64
+}
+
+// hook returns a writeHook which records fake usages created by changes in
+// the file name.
+func (j *journal) hook(name string) writeHook {
+	return func(read, toggled []byte, changes []core.Change) error {
+		const thisName = "*journal.hook"
+		if name == stdinName {
+			return nil
+		}
+		code, _, err := decodeCode(read)
+		if err != nil {
+			return fmt.Errorf(thisName+": %v", err)
+		}
+		entries := journalEntries(code, toggled, changes)
+		if len(entries) == 0 {
+			return nil
+		}
+		p, err := filepath.Abs(name)
+		if err != nil {
+			return fmt.Errorf(thisName+": in filepath.Abs: %v", err)
+		}
+		for i := range entries {
+			entries[i].Run = j.run
+			entries[i].File = p
+		}
+		if err := appendJournal(j.path, entries); err != nil {
+			return fmt.Errorf(thisName+": %v", err)
+		}
+		return nil
+	}
+}
+
+// journalEntries returns entries of fake usages created by changes to code,
+// with offsets in code with changes applied and the hash of toggled, which is
+// it as written, in the encoding of the file.
+func journalEntries(
+	code, toggled []byte, changes []core.Change,
+) []journalEntry {
+	sorted := slices.Clone(changes)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Start < sorted[j].Start
+	})
+	var entries []journalEntry
+	var hash string
+	// shift is how far changes before c moved its start.
+	var shift int
+	for _, c := range sorted {
+		if c.Action == core.ActionAdd {
+			if hash == "" {
+				hash = hashOf(toggled)
+			}
+			entries = append(entries, journalEntry{
+				Name:     c.Name,
+				Offset:   c.Start + shift,
+				Inserted: c.Text,
+				Removed:  string(code[c.Start:c.End]),
+				Hash:     hash,
+			})
+		}
+		shift += len(c.Text) - (c.End - c.Start)
+	}
+	return entries
+}
+
+// hashOf returns the hex-encoded SHA-256 hash of code.
+func hashOf(code []byte) string {
+	sum := sha256.Sum256(code)
+	return hex.EncodeToString(sum[:])
+}
+
+// appendJournal appends entries to the journal at path.
+func appendJournal(path string, entries []journalEntry) error {
+	const thisName = "appendJournal"
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf(thisName+": in os.MkdirAll: %v", err)
+	}
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	for _, e := range entries {
+		if err := enc.Encode(e); err != nil {
+			format := thisName + ": in *Encoder.Encode: %v"
+			return fmt.Errorf(format, err)
+		}
+	}
+	flag := os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	f, err := os.OpenFile(path, flag, 0o600)
+	if err != nil {
+		return fmt.Errorf(thisName+": in os.OpenFile: %v", err)
+	}
+	if _, err := f.Write(b.Bytes()); err != nil {
+		f.Close()
+		return fmt.Errorf(thisName+": in *File.Write: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf(thisName+": in *File.Close: %v", err)
+	}
+	return nil
+}
+
+// readJournal returns entries of the journal at path. There are none if it
+// doesn’t exist.
+func readJournal(path string) ([]journalEntry, error) {
+	const thisName = "readJournal"
+	raw, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf(thisName+": in os.ReadFile: %v", err)
+	}
+	var entries []journalEntry
+	s := bufio.NewScanner(bytes.NewReader(raw))
+	s.Buffer(nil, len(raw)+1)
+	for s.Scan() {
+		var e journalEntry
+		if err := json.Unmarshal(s.Bytes(), &e); err != nil {
+			format := thisName + ": in json.Unmarshal: %v"
+			return nil, fmt.Errorf(format, err)
+		}
+		entries = append(entries, e)
+	}
+	if err := s.Err(); err != nil {
+		return nil, fmt.Errorf(thisName+": in *Scanner.Err: %v", err)
+	}
+	return entries, nil
+}
+
+// writeJournal replaces the journal at path with entries. It’s deleted if
+// there are none.
+func writeJournal(path string, entries []journalEntry) error {
+	const thisName = "writeJournal"
+	if len(entries) == 0 {
+		err := os.Remove(path)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf(thisName+": in os.Remove: %v", err)
+		}
+		return nil
+	}
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	for _, e := range entries {
+		if err := enc.Encode(e); err != nil {
+			format := thisName + ": in *Encoder.Encode: %v"
+			return fmt.Errorf(format, err)
+		}
+	}
+	if err := os.WriteFile(path, b.Bytes(), 0o600); err != nil {
+		return fmt.Errorf(thisName+": in os.WriteFile: %v", err)
+	}
+	return nil
+}
+
+// reverseEntries returns code, decoded from the encoding enc, with fake usages
+// of entries removed, the newest first, and changes which removed them.
+// Offsets are trusted if code in enc has the hash a run left it with;
+// otherwise every fake usage is looked for nearest to its offset. Fake usages
+// which aren’t in code anymore are skipped.
+func reverseEntries(
+	code []byte, enc encoding, entries []journalEntry,
+) ([]byte, []core.Change) {
+	sorted := slices.Clone(entries)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].Run != sorted[j].Run {
+			return sorted[i].Run > sorted[j].Run
+		}
+		return sorted[i].Offset > sorted[j].Offset
+	})
+	var changes []core.Change
+	var run int64
+	var exact bool
+	for i, e := range sorted {
+		// Entries of a run are reversed from the end, so offsets of the
+		// rest stay exact.
+		if i == 0 || e.Run != run {
+			run = e.Run
+			exact = hashOf(encodeCode(code, enc)) == e.Hash
+		}
+		inserted := []byte(e.Inserted)
+		start := e.Offset
+		if !exact && !(start <= len(code) &&
+			bytes.HasPrefix(code[start:], inserted)) {
+			start = nearestIndex(code, inserted, e.Offset)
+			if start < 0 {
+				continue
+			}
+		}
+		end := start + len(inserted)
+		code = slices.Concat(
+			code[:start], []byte(e.Removed), code[end:],
+		)
+		changes = append(changes, core.Change{
+			Action:  core.ActionRemove,
+			Name:    e.Name,
+			LineNum: bytes.Count(code[:start], []byte("\n")),
+			Start:   start,
+			End:     end,
+			Text:    e.Removed,
+		})
+	}
+	return code, changes
+}
+
+// nearestIndex returns the index of the instance of sep in s nearest to
+// offset or -1 if sep isn’t present in s.
+func nearestIndex(s, sep []byte, offset int) int {
+	nearest := -1
+	for i := 0; i <= len(s); {
+		j := bytes.Index(s[i:], sep)
+		if j < 0 {
+			break
+		}
+		j += i
+		closer := distance(j, offset) < distance(nearest, offset)
+		if nearest < 0 || closer {
+			nearest = j
+		}
+		i = j + 1
+	}
+	return nearest
+}
+
+// distance returns the distance between a and b.
+func distance(a, b int) int {
+	if a > b {
+		return a - b
+	}
+	return b - a
+}
+
+// splitJournal returns entries of the file with the absolute path p, of the
+// last run which changed it if last is true, and the rest of entries.
+func splitJournal(
+	entries []journalEntry, p string, last bool,
+) ([]journalEntry, []journalEntry) {
+	var run int64
+	for _, e := range entries {
+		if e.File == p {
+			run = max(run, e.Run)
+		}
+	}
+	var taken, rest []journalEntry
+	for _, e := range entries {
+		if e.File == p && (!last || e.Run == run) {
+			taken = append(taken, e)
+			continue
+		}
+		rest = append(rest, e)
+	}
+	return taken, rest
+}
+
+// undoJournal removes fake usages journaled at path by the last run which
+// changed every file at paths or, without paths, by the last run, and drops
+// their entries. It returns the changed paths.
+func undoJournal(path string, paths []string) ([]string, error) {
+	const thisName = "undoJournal"
+	entries, err := readJournal(path)
+	if err != nil {
+		return nil, fmt.Errorf(thisName+": %v", err)
+	}
+	if len(paths) == 0 {
+		var run int64
+		for _, e := range entries {
+			run = max(run, e.Run)
+		}
+		for _, e := range entries {
+			if e.Run == run && !slices.Contains(paths, e.File) {
+				paths = append(paths, e.File)
+			}
+		}
+	}
+	var undone []string
+	for _, p := range paths {
+		abs, err := filepath.Abs(p)
+		if err != nil {
+			format := thisName + ": in filepath.Abs: %v"
+			return undone, fmt.Errorf(format, err)
+		}
+		var taken []journalEntry
+		taken, entries = splitJournal(entries, abs, true)
+		read, err := os.ReadFile(abs)
+		if err != nil {
+			format := thisName + ": in os.ReadFile: %v"
+			return undone, fmt.Errorf(format, err)
+		}
+		code, enc, err := decodeCode(read)
+		if err != nil {
+			return undone, fmt.Errorf(thisName+": %v", err)
+		}
+		reversed, changes := reverseEntries(code, enc, taken)
+		if len(changes) == 0 {
+			continue
+		}
+		reversed = encodeCode(reversed, enc)
+		// The permissions of existing files aren’t changed.
+		if err := os.WriteFile(abs, reversed, 0o644); err != nil {
+			format := thisName + ": in os.WriteFile: %v"
+			return undone, fmt.Errorf(format, err)
+		}
+		undone = append(undone, p)
+	}
+	if err := writeJournal(path, entries); err != nil {
+		return undone, fmt.Errorf(thisName+": %v", err)
+	}
+	return undone, nil
+}
+
+// journaled reports whether entries record fake usages of the file at p.
+func journaled(entries []journalEntry, p string) bool {
+	abs, err := filepath.Abs(p)
+	if err != nil {
+		return false
+	}
+	return slices.ContainsFunc(entries, func(e journalEntry) bool {
+		return e.File == abs
+	})
+}
+
+// undoFiles removes fake usages journaled at journalPath from files at paths
+// and restores the rest of them from backups in dir. Without paths, the last
+// journaled run is undone if there is one, and the last backed up one
+// otherwise. It returns the undone paths.
+func undoFiles(dir, journalPath string, paths []string) ([]string, error) {
+	const thisName = "undoFiles"
+	entries, err := readJournal(journalPath)
+	if err != nil {
+		return nil, fmt.Errorf(thisName+": %v", err)
+	}
+	if len(paths) == 0 {
+		if len(entries) == 0 {
+			restored, err := restoreBackups(dir, nil)
+			if err != nil {
+				format := thisName + ": %v"
+				return restored, fmt.Errorf(format, err)
+			}
+			return restored, nil
+		}
+		undone, err := undoJournal(journalPath, nil)
+		if err != nil {
+			return undone, fmt.Errorf(thisName+": %v", err)
+		}
+		return undone, nil
+	}
+	var fromJournal, fromBackups []string
+	for _, p := range paths {
+		if journaled(entries, p) {
+			fromJournal = append(fromJournal, p)
+		} else {
+			fromBackups = append(fromBackups, p)
+		}
+	}
+	var undone []string
+	if len(fromJournal) > 0 {
+		undone, err = undoJournal(journalPath, fromJournal)
+		if err != nil {
+			return undone, fmt.Errorf(thisName+": %v", err)
+		}
+	}
+	if len(fromBackups) > 0 {
+		restored, err := restoreBackups(dir, fromBackups)
+		undone = append(undone, restored...)
+		if err != nil {
+			return undone, fmt.Errorf(thisName+": %v", err)
+		}
+	}
+	return undone, nil
+}
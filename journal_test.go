@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/looshch/gouse/internal/core"
+)
+
+func TestUndoJournal(t *testing.T) {
+	ctx := context.Background()
+	ctx, cancel := context.WithCancel(ctx)
+	t.Cleanup(cancel)
+	tests := []struct {
+		name     string
+		strategy core.Strategy
+		enc      encoding
+	}{
+		{"use", core.StrategyUse, encodingUTF8},
+		{"comment", core.StrategyComment, encodingUTF8},
+		{"UTF-16", core.StrategyUse, encodingUTF16LE},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			dir := t.TempDir()
+			journalPath := filepath.Join(dir, "journal.jsonl")
+			p := filepath.Join(dir, "a.go")
+			const code = `package a
+
+func A() {
+	notUsed := 0
+}
+`
+			opts := core.Options{
+				Mode: core.ModeAdd, Strategy: tt.strategy,
+			}
+			changes, err := core.FindChanges(
+				ctx, []byte(code), opts,
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+			toggled := core.ApplyChanges([]byte(code), changes)
+			// The file is hashed as written, in its encoding.
+			read := encodeCode([]byte(code), tt.enc)
+			written := encodeCode(toggled, tt.enc)
+			j := &journal{path: journalPath, run: 1}
+			err = j.hook(p)(read, written, changes)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// An unrelated edit shifts the fake usage.
+			const edit = "// Package a is edited.\n"
+			edited := encodeCode(
+				append([]byte(edit), toggled...), tt.enc,
+			)
+			if err := os.WriteFile(p, edited, 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			undone, err := undoJournal(journalPath, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := []string{p}; !slices.Equal(undone, want) {
+				t.Errorf("got: %v, want: %v", undone, want)
+			}
+			got, err := os.ReadFile(p)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := encodeCode([]byte(edit+code), tt.enc)
+			if string(got) != string(want) {
+				t.Errorf(filesCmpErr, got, want)
+			}
+			entries, err := readJournal(journalPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n := len(entries); n != 0 {
+				t.Errorf("got: %d entries, want: 0", n)
+			}
+		})
+	}
+}
+
+func TestReverseEntries(t *testing.T) {
+	t.Parallel()
+	const code = "a := 0\nb := 0\n"
+	// Both runs inserted the same text, and the first one was shifted
+	// since, so the nearest instance is removed.
+	toggled := "a := 0; _ = x\nb := 0; _ = x\n"
+	entries := []journalEntry{
+		{Run: 1, Name: "x", Offset: 2, Inserted: "; _ = x"},
+		{Run: 2, Name: "x", Offset: 20, Inserted: "; _ = x"},
+		{Run: 2, Name: "y", Offset: 0, Inserted: "; _ = y"},
+	}
+	got, changes := reverseEntries([]byte(toggled), encodingUTF8, entries)
+	if string(got) != code {
+		t.Errorf(filesCmpErr, got, code)
+	}
+	var lines []int
+	for _, c := range changes {
+		lines = append(lines, c.LineNum)
+	}
+	if want := []int{1, 0}; !slices.Equal(lines, want) {
+		t.Errorf("got: %v, want: %v", lines, want)
+	}
+}
+
+func TestUndoFiles(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	journalPath := filepath.Join(dir, "journal.jsonl")
+	a := filepath.Join(dir, "a.go")
+	b := filepath.Join(dir, "b.go")
+	const code = "package p\n"
+	const inserted = "// Fake usage.\n"
+	for _, p := range []string{a, b} {
+		err := os.WriteFile(p, []byte(code+inserted), 0o644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := appendJournal(journalPath, []journalEntry{{
+		Run:      1,
+		File:     a,
+		Offset:   len(code),
+		Inserted: inserted,
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved := &backups{dir: dir}
+	if err := saved.save(b, []byte(code)); err != nil {
+		t.Fatal(err)
+	}
+
+	undone, err := undoFiles(dir, journalPath, []string{b, a})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{a, b}; !slices.Equal(undone, want) {
+		t.Errorf("got: %v, want: %v", undone, want)
+	}
+	for _, p := range []string{a, b} {
+		got, err := os.ReadFile(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != code {
+			t.Errorf(filesCmpErr, got, code)
+		}
+	}
+	if _, err := undoFiles(dir, journalPath, nil); err == nil {
+		t.Error("got: nil, want: error")
+	}
+}
@@ -0,0 +1,8 @@
+//go:build !unix && !windows
+
+package main
+
+import "os"
+
+// lockFile does nothing, as there is no advisory locking.
+func lockFile(f *os.File) error { return nil }
@@ -0,0 +1,53 @@
+//go:build unix
+
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestOpenLocked(t *testing.T) {
+	t.Parallel()
+	p := filepath.Join(t.TempDir(), "p.go")
+	if err := os.WriteFile(p, []byte("old"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	holder, err := openLocked(p, openFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opened := make(chan file)
+	go func() {
+		f, err := openLocked(p, openFile)
+		if err != nil {
+			t.Error(err)
+		}
+		opened <- f
+	}()
+	select {
+	case <-opened:
+		t.Fatal("got: opened locked file, want: wait")
+	case <-time.After(50 * time.Millisecond):
+	}
+	// The holder replaces the file the waiter has opened.
+	if err := writeFileAtomically(p, []byte("new")); err != nil {
+		t.Fatal(err)
+	}
+	holder.Close()
+	f := <-opened
+	if f == nil {
+		return
+	}
+	defer f.Close()
+	got, err := io.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "new" {
+		t.Errorf(filesCmpErr, got, "new")
+	}
+}
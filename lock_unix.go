@@ -0,0 +1,25 @@
+//go:build unix
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// lockFile takes an exclusive advisory lock of the file f, waiting for other
+// holders to release it. The lock is released when f is closed.
+func lockFile(f *os.File) error {
+	for {
+		err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX)
+		// The wait is interrupted by signals.
+		if err == syscall.EINTR {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("lockFile: in syscall.Flock: %v", err)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+var procLockFileEx = syscall.NewLazyDLL("kernel32.dll").NewProc("LockFileEx")
+
+// lockfileExclusiveLock is a flag of LockFileEx which makes the lock
+// exclusive.
+const lockfileExclusiveLock = 0x2
+
+// lockFile takes an exclusive lock of the whole file f, waiting for other
+// holders to release it. The lock is released when f is closed.
+func lockFile(f *os.File) error {
+	var overlapped syscall.Overlapped
+	r, _, err := procLockFileEx.Call(
+		f.Fd(),
+		lockfileExclusiveLock,
+		0,
+		math.MaxUint32,
+		math.MaxUint32,
+		uintptr(unsafe.Pointer(&overlapped)),
+	)
+	if r == 0 {
+		return fmt.Errorf("lockFile: in LockFileEx: %v", err)
+	}
+	return nil
+}
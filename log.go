@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+)
+
+// logFormat is a format of messages printed to stderr.
+type logFormat string
+
+const (
+	logText logFormat = "text"
+	// logJSON prints a JSON object per message, see jsonLog.
+	logJSON logFormat = "json"
+)
+
+func (f *logFormat) String() string { return string(*f) }
+
+func (f *logFormat) Set(s string) error {
+	switch logFormat(s) {
+	case logText, logJSON:
+		*f = logFormat(s)
+		return nil
+	}
+	return fmt.Errorf("unknown log format %q, want text or json", s)
+}
+
+const (
+	levelError = "error"
+	levelInfo  = "info"
+)
+
+// jsonLog writes messages to out as JSON lines with the level, the file being
+// processed, if any, and the message, so editor wrappers and CI parse them.
+type jsonLog struct {
+	out io.Writer
+	// file is the file messages are about. It’s empty if they are about no
+	// file in particular.
+	file string
+}
+
+// jsonLogEntry is a line written by jsonLog.
+type jsonLogEntry struct {
+	Level   string `json:"level"`
+	File    string `json:"file,omitempty"`
+	Message string `json:"message"`
+}
+
+// logger returns a logger which writes messages of the level to l.
+func (l *jsonLog) logger(level string) *log.Logger {
+	return log.New(jsonLogWriter{l, level}, "", logFlag)
+}
+
+// jsonLogWriter writes messages of a level to a jsonLog.
+type jsonLogWriter struct {
+	log   *jsonLog
+	level string
+}
+
+// Write writes p, a message from log.Logger, as a jsonLogEntry.
+func (w jsonLogWriter) Write(p []byte) (int, error) {
+	entry := jsonLogEntry{
+		Level:   w.level,
+		File:    w.log.file,
+		Message: strings.TrimSuffix(string(p), "\n"),
+	}
+	if err := json.NewEncoder(w.log.out).Encode(entry); err != nil {
+		format := "jsonLogWriter.Write: in *Encoder.Encode: %v"
+		return 0, fmt.Errorf(format, err)
+	}
+	return len(p), nil
+}
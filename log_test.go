@@ -0,0 +1,30 @@
+package main
+
+import "testing"
+
+func TestJSONLog(t *testing.T) {
+	t.Parallel()
+	out := newFakeFile()
+	logs := &jsonLog{out: out}
+	errorLog := logs.logger(levelError)
+	infoLog := logs.logger(levelInfo)
+	errorLog.Print("first")
+	logs.file = "p.go"
+	infoLog.Printf("%s\n", "second")
+	const want = `{"level":"error","message":"first"}` + "\n" +
+		`{"level":"info","file":"p.go","message":"second"}` + "\n"
+	if got := out.contents.String(); got != want {
+		t.Errorf(filesCmpErr, got, want)
+	}
+}
+
+func TestLogFormatSet(t *testing.T) {
+	t.Parallel()
+	var f logFormat
+	if err := f.Set("json"); err != nil || f != logJSON {
+		t.Errorf("got: %s, %v, want: %s, nil", f, err, logJSON)
+	}
+	if err := f.Set("xml"); err == nil {
+		t.Error("got: nil, want: error")
+	}
+}
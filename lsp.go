@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"strings"
+
+	"github.com/looshch/gouse/internal/core"
+)
+
+// lspReport collects changes of files into an LSP WorkspaceEdit, lists of
+// TextEdits keyed by document URIs, which editors apply with
+// ‘workspace/applyEdit’ as is.
+type lspReport struct {
+	changes map[string][]lspTextEdit
+}
+
+// add is an editsReporter which adds TextEdits of changes to code of the file
+// name.
+func (r *lspReport) add(name string, code []byte, changes []core.Change) error {
+	uri, err := lspURI(name)
+	if err != nil {
+		return fmt.Errorf("*lspReport.add: %v", err)
+	}
+	if r.changes == nil {
+		r.changes = map[string][]lspTextEdit{}
+	}
+	r.changes[uri] = append(r.changes[uri], lspTextEdits(code, changes)...)
+	return nil
+}
+
+// lspTextEdits returns TextEdits of changes to code.
+func lspTextEdits(code []byte, changes []core.Change) []lspTextEdit {
+	edits := make([]lspTextEdit, len(changes))
+	for i, c := range changes {
+		edits[i] = lspTextEdit{
+			Range: lspRange{
+				Start: lspPositionOf(code, c.Start),
+				End:   lspPositionOf(code, c.End),
+			},
+			NewText: c.Text,
+		}
+	}
+	return edits
+}
+
+// write writes the WorkspaceEdit of r to out.
+func (r *lspReport) write(out file) error {
+	changes := r.changes
+	if changes == nil {
+		changes = map[string][]lspTextEdit{}
+	}
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(lspWorkspaceEdit{Changes: changes}); err != nil {
+		format := "*lspReport.write: in *Encoder.Encode: %v"
+		return fmt.Errorf(format, err)
+	}
+	return nil
+}
+
+// lspURI returns the file URI of the file name. Standard input keeps its name,
+// as it has no URI.
+func lspURI(name string) (string, error) {
+	if name == stdinName {
+		return name, nil
+	}
+	p, err := filepath.Abs(name)
+	if err != nil {
+		return "", fmt.Errorf("lspURI: in filepath.Abs: %v", err)
+	}
+	p = filepath.ToSlash(p)
+	// Windows paths start with a volume name rather than a slash.
+	if !strings.HasPrefix(p, "/") {
+		p = "/" + p
+	}
+	return (&url.URL{Scheme: "file", Path: p}).String(), nil
+}
+
+// lspPositionOf returns the position of the offset in code. Characters are
+// counted in UTF-16 code units, the default encoding of LSP positions.
+func lspPositionOf(code []byte, offset int) lspPosition {
+	lineStart := bytes.LastIndexByte(code[:offset], '\n') + 1
+	var character int
+	for _, r := range string(code[lineStart:offset]) {
+		character++
+		// Runes outside the Basic Multilingual Plane are surrogate
+		// pairs.
+		if r > 0xffff {
+			character++
+		}
+	}
+	return lspPosition{
+		Line:      bytes.Count(code[:offset], []byte("\n")),
+		Character: character,
+	}
+}
+
+// The types below are the subset of LSP gouse writes.
+
+type lspWorkspaceEdit struct {
+	Changes map[string][]lspTextEdit `json:"changes"`
+}
+
+type lspTextEdit struct {
+	Range   lspRange `json:"range"`
+	NewText string   `json:"newText"`
+}
+
+// lspRange is a range of code, its end is exclusive.
+type lspRange struct {
+	Start lspPosition `json:"start"`
+	End   lspPosition `json:"end"`
+}
+
+// lspPosition is a 0-based line and a 0-based character in it.
+type lspPosition struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
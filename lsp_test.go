@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"testing"
+
+	"github.com/looshch/gouse/internal/core"
+)
+
+func TestLSPReport(t *testing.T) {
+	t.Parallel()
+	const code = "package p\n\nfunc f() {\n\ta := 0\n}\n"
+	changes := []core.Change{
+		{Action: core.ActionAdd, Name: "a", Start: 29, End: 29},
+	}
+	var r lspReport
+	if err := r.add("p.go", []byte(code), changes); err != nil {
+		t.Fatal(err)
+	}
+	out := newFakeFile()
+	if err := r.write(out); err != nil {
+		t.Fatal(err)
+	}
+	var got lspWorkspaceEdit
+	if err := json.Unmarshal(out.contents.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	p, err := filepath.Abs("p.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	uri := "file://" + filepath.ToSlash(p)
+	position := lspPosition{Line: 3, Character: 7}
+	want := lspRange{Start: position, End: position}
+	if edits := got.Changes[uri]; len(edits) != 1 ||
+		edits[0].Range != want {
+		t.Errorf("got: %+v, want: %s: %+v", got, uri, want)
+	}
+}
+
+func TestLSPPositionOf(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name   string
+		code   string
+		offset int
+		want   lspPosition
+	}{
+		{"ASCII", "ab\ncd", 4, lspPosition{1, 1}},
+		{"two bytes", "é = 0", 2, lspPosition{0, 1}},
+		{"surrogate pair", "\"😀\" + a", 6, lspPosition{0, 4}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got := lspPositionOf([]byte(tt.code), tt.offset)
+			if got != tt.want {
+				t.Errorf("got: %+v, want: %+v", got, tt.want)
+			}
+		})
+	}
+}
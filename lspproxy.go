@@ -0,0 +1,492 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os/exec"
+	"sync"
+
+	"github.com/looshch/gouse/internal/core"
+)
+
+// lspSyncFull is the kind of text document sync in which changes have the
+// whole content of documents.
+const lspSyncFull = 1
+
+// goplsProxy is a value of ‘-gopls-proxy’ flag: the gopls executable to run
+// behind gouse. Without a value, it’s gopls from PATH.
+type goplsProxy string
+
+func (p *goplsProxy) String() string { return string(*p) }
+
+func (p *goplsProxy) Set(s string) error {
+	switch s {
+	// ‘-gopls-proxy’ without a value is passed as ‘true’.
+	case "true":
+		*p = "gopls"
+	case "false":
+		*p = ""
+	default:
+		*p = goplsProxy(s)
+	}
+	return nil
+}
+
+// IsBoolFlag lets ‘-gopls-proxy’ be used without a value.
+func (p *goplsProxy) IsBoolFlag() bool { return true }
+
+// serveGoplsProxy runs gopls at path with args and passes LSP messages between
+// the client on in and out and gopls, see proxyLSP, until gopls exits or ctx
+// is done. Errors of gopls go to errOut.
+func serveGoplsProxy(
+	ctx context.Context,
+	opts core.Options,
+	path string,
+	args []string,
+	in io.Reader,
+	out, errOut io.Writer,
+) error {
+	const thisName = "serveGoplsProxy"
+
+	cmd := exec.CommandContext(ctx, path, args...)
+	cmd.Stderr = errOut
+	serverIn, err := cmd.StdinPipe()
+	if err != nil {
+		return fmt.Errorf("%s: in *Cmd.StdinPipe: %v", thisName, err)
+	}
+	serverOut, err := cmd.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("%s: in *Cmd.StdoutPipe: %v", thisName, err)
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("%s: in *Cmd.Start: %v", thisName, err)
+	}
+	err = proxyLSP(ctx, opts, in, out, serverIn, serverOut)
+	if err != nil {
+		cmd.Process.Kill()
+		cmd.Wait()
+		return fmt.Errorf("%s: %v", thisName, err)
+	}
+	// gopls exits on the exit notification of the client.
+	if err := cmd.Wait(); err != nil {
+		return fmt.Errorf("%s: in *Cmd.Wait: %v", thisName, err)
+	}
+	return nil
+}
+
+// lspProxy passes messages between a client and a Language Server, adding the
+// code actions of ‘-lsp’ flag to responses of the server and diagnostics of
+// fake usages to diagnostics it publishes, for ‘-gopls-proxy’ flag. Documents
+// are synced in full, so it knows their contents.
+type lspProxy struct {
+	opts core.Options
+	// mu guards the fields below and writes to out, the client.
+	mu  sync.Mutex
+	out io.Writer
+	// docs are contents of open documents keyed by URIs.
+	docs map[string][]byte
+	// diagnostics are the latest ones the server published, keyed by URIs.
+	diagnostics map[string][]json.RawMessage
+	// pending are requests of the client whose responses are changed,
+	// keyed by IDs.
+	pending map[string]lspProxyRequest
+}
+
+// lspProxyRequest is a request of the client the server hasn’t responded to.
+type lspProxyRequest struct {
+	method string
+	// uri is the document of textDocument/codeAction.
+	uri string
+}
+
+// proxyLSP passes messages from the client on in to the server on serverIn
+// and from the server on serverOut to the client on out, changing them like
+// lspProxy does, until the server closes serverOut or ctx is done. Documents
+// are toggled with opts. serverIn is closed when the client closes in.
+func proxyLSP(
+	ctx context.Context,
+	opts core.Options,
+	in io.Reader,
+	out io.Writer,
+	serverIn io.WriteCloser,
+	serverOut io.Reader,
+) error {
+	p := &lspProxy{
+		opts:        opts,
+		out:         out,
+		docs:        map[string][]byte{},
+		diagnostics: map[string][]json.RawMessage{},
+		pending:     map[string]lspProxyRequest{},
+	}
+	fromClient := make(chan error, 1)
+	go func() {
+		err := p.fromClient(in, serverIn)
+		// The server exits on the end of its input, which ends the
+		// session.
+		serverIn.Close()
+		fromClient <- err
+	}()
+	if err := p.fromServer(ctx, serverOut); err != nil {
+		return fmt.Errorf("proxyLSP: %v", err)
+	}
+	select {
+	case err := <-fromClient:
+		if err != nil {
+			return fmt.Errorf("proxyLSP: %v", err)
+		}
+	default:
+	}
+	return nil
+}
+
+// fromClient passes messages from in to serverIn, keeping track of documents
+// and requests whose responses are changed, until in is closed.
+func (p *lspProxy) fromClient(in io.Reader, serverIn io.Writer) error {
+	const thisName = "*lspProxy.fromClient"
+
+	r := bufio.NewReader(in)
+	for {
+		b, err := readLSPMessage(r)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %v", thisName, err)
+		}
+		var msg lspProxyMessage
+		// Messages which aren’t understood are passed as they are.
+		if json.Unmarshal(b, &msg) == nil {
+			if err := p.handleClient(msg); err != nil {
+				return fmt.Errorf("%s: %v", thisName, err)
+			}
+		}
+		if err := writeLSPMessage(serverIn, b); err != nil {
+			return fmt.Errorf("%s: %v", thisName, err)
+		}
+	}
+}
+
+// handleClient keeps track of documents and requests whose responses are
+// changed from msg of the client. Only errors of writing to the client are
+// returned.
+func (p *lspProxy) handleClient(msg lspProxyMessage) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var uri string
+	switch msg.Method {
+	case "initialize":
+		if msg.ID != nil {
+			p.pending[string(msg.ID)] = lspProxyRequest{
+				method: msg.Method,
+			}
+		}
+		return nil
+	case "textDocument/codeAction":
+		var params lspCodeActionParams
+		if json.Unmarshal(msg.Params, &params) == nil && msg.ID != nil {
+			p.pending[string(msg.ID)] = lspProxyRequest{
+				method: msg.Method,
+				uri:    params.TextDocument.URI,
+			}
+		}
+		return nil
+	case "textDocument/didOpen":
+		var params lspDidOpenParams
+		if json.Unmarshal(msg.Params, &params) != nil {
+			return nil
+		}
+		uri = params.TextDocument.URI
+		p.docs[uri] = []byte(params.TextDocument.Text)
+	case "textDocument/didChange":
+		var params lspProxyDidChangeParams
+		if json.Unmarshal(msg.Params, &params) != nil {
+			return nil
+		}
+		changes := params.ContentChanges
+		if len(changes) == 0 {
+			return nil
+		}
+		uri = params.TextDocument.URI
+		last := changes[len(changes)-1]
+		p.docs[uri] = []byte(last.Text)
+		// Clients which sync documents incrementally anyway leave
+		// the contents unknown, so they get no code actions.
+		if last.Range != nil {
+			delete(p.docs, uri)
+		}
+	case "textDocument/didClose":
+		var params lspDidCloseParams
+		if json.Unmarshal(msg.Params, &params) != nil {
+			return nil
+		}
+		uri = params.TextDocument.URI
+		delete(p.docs, uri)
+	default:
+		return nil
+	}
+	if err := p.publishDiagnostics(uri, nil); err != nil {
+		return fmt.Errorf("*lspProxy.handleClient: %v", err)
+	}
+	return nil
+}
+
+// fromServer passes messages from serverOut to the client, changing the ones
+// lspProxy changes, until serverOut is closed or ctx is done.
+func (p *lspProxy) fromServer(ctx context.Context, serverOut io.Reader) error {
+	const thisName = "*lspProxy.fromServer"
+
+	r := bufio.NewReader(serverOut)
+	for ctx.Err() == nil {
+		b, err := readLSPMessage(r)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %v", thisName, err)
+		}
+		var msg lspProxyMessage
+		if json.Unmarshal(b, &msg) == nil {
+			b, err = p.handleServer(ctx, msg, b)
+			if err != nil {
+				return fmt.Errorf("%s: %v", thisName, err)
+			}
+		}
+		if b == nil {
+			continue
+		}
+		p.mu.Lock()
+		err = writeLSPMessage(p.out, b)
+		p.mu.Unlock()
+		if err != nil {
+			return fmt.Errorf("%s: %v", thisName, err)
+		}
+	}
+	return nil
+}
+
+// handleServer returns b, the content of msg of the server, changed to be
+// passed to the client, or nil if it’s already sent.
+func (p *lspProxy) handleServer(
+	ctx context.Context, msg lspProxyMessage, b []byte,
+) ([]byte, error) {
+	const thisName = "*lspProxy.handleServer"
+
+	if msg.Method == "textDocument/publishDiagnostics" {
+		var params struct {
+			URI         string            `json:"uri"`
+			Diagnostics []json.RawMessage `json:"diagnostics"`
+		}
+		if json.Unmarshal(msg.Params, &params) != nil {
+			return b, nil
+		}
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		p.diagnostics[params.URI] = params.Diagnostics
+		err := p.publishDiagnostics(params.URI, msg.Params)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", thisName, err)
+		}
+		return nil, nil
+	}
+	// Only responses, which have IDs but no methods, are changed.
+	if msg.Method != "" || msg.ID == nil || msg.Result == nil {
+		return b, nil
+	}
+	p.mu.Lock()
+	req, ok := p.pending[string(msg.ID)]
+	delete(p.pending, string(msg.ID))
+	code, open := p.docs[req.uri]
+	p.mu.Unlock()
+	if !ok {
+		return b, nil
+	}
+	var result json.RawMessage
+	switch req.method {
+	case "initialize":
+		var err error
+		result, err = lspProxyCapabilities(msg.Result)
+		if err != nil {
+			return b, nil
+		}
+	case "textDocument/codeAction":
+		if !open {
+			return b, nil
+		}
+		var actions []json.RawMessage
+		if json.Unmarshal(msg.Result, &actions) != nil {
+			return b, nil
+		}
+		s := &lspServer{
+			opts: p.opts,
+			docs: map[string][]byte{req.uri: code},
+		}
+		own, err := s.codeActions(ctx, req.uri)
+		// Actions of the server are still worth responding with.
+		if err != nil {
+			return b, nil
+		}
+		for _, a := range own {
+			b, err := json.Marshal(a)
+			if err != nil {
+				format := "%s: in json.Marshal: %v"
+				return nil, fmt.Errorf(format, thisName, err)
+			}
+			actions = append(actions, b)
+		}
+		result, err = json.Marshal(actions)
+		if err != nil {
+			format := "%s: in json.Marshal: %v"
+			return nil, fmt.Errorf(format, thisName, err)
+		}
+	}
+	b, err := setJSONField(b, "result", result)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", thisName, err)
+	}
+	return b, nil
+}
+
+// publishDiagnostics sends the client the latest diagnostics of the server
+// and a diagnostic of every fake usage in the document uri. params are the
+// parameters of the diagnostics of the server, e.g. with a version of the
+// document, if any. p.mu must be held.
+func (p *lspProxy) publishDiagnostics(
+	uri string, params json.RawMessage,
+) error {
+	const thisName = "*lspProxy.publishDiagnostics"
+
+	// Diagnostics are never null.
+	diagnostics := append([]json.RawMessage{}, p.diagnostics[uri]...)
+	for _, d := range lspMarkerDiagnostics(p.docs[uri]) {
+		b, err := json.Marshal(d)
+		if err != nil {
+			format := "%s: in json.Marshal: %v"
+			return fmt.Errorf(format, thisName, err)
+		}
+		diagnostics = append(diagnostics, b)
+	}
+	var err error
+	if params == nil {
+		params, err = json.Marshal(map[string]string{"uri": uri})
+		if err != nil {
+			format := "%s: in json.Marshal: %v"
+			return fmt.Errorf(format, thisName, err)
+		}
+	}
+	params, err = setJSONField(params, "diagnostics", diagnostics)
+	if err != nil {
+		return fmt.Errorf("%s: %v", thisName, err)
+	}
+	b, err := json.Marshal(lspNotification{
+		JSONRPC: "2.0",
+		Method:  "textDocument/publishDiagnostics",
+		Params:  params,
+	})
+	if err != nil {
+		return fmt.Errorf("%s: in json.Marshal: %v", thisName, err)
+	}
+	if err := writeLSPMessage(p.out, b); err != nil {
+		return fmt.Errorf("%s: %v", thisName, err)
+	}
+	return nil
+}
+
+// lspProxyCapabilities returns result of initialize with documents synced in
+// full and code actions provided, so the proxy knows contents of documents and
+// the client asks for code actions.
+func lspProxyCapabilities(result json.RawMessage) (json.RawMessage, error) {
+	const thisName = "lspProxyCapabilities"
+
+	var r struct {
+		Capabilities json.RawMessage `json:"capabilities"`
+	}
+	if err := json.Unmarshal(result, &r); err != nil {
+		format := "%s: in json.Unmarshal: %v"
+		return nil, fmt.Errorf(format, thisName, err)
+	}
+	var c struct {
+		TextDocumentSync   json.RawMessage `json:"textDocumentSync"`
+		CodeActionProvider json.RawMessage `json:"codeActionProvider"`
+	}
+	if err := json.Unmarshal(r.Capabilities, &c); err != nil {
+		format := "%s: in json.Unmarshal: %v"
+		return nil, fmt.Errorf(format, thisName, err)
+	}
+	// The sync is either a kind or options with the kind of changes.
+	var docSync any = lspSyncFull
+	if len(c.TextDocumentSync) > 0 && c.TextDocumentSync[0] == '{' {
+		b, err := setJSONField(
+			c.TextDocumentSync, "change", lspSyncFull,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", thisName, err)
+		}
+		docSync = b
+	}
+	capabilities, err := setJSONField(
+		r.Capabilities, "textDocumentSync", docSync,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", thisName, err)
+	}
+	if string(c.CodeActionProvider) == "" ||
+		string(c.CodeActionProvider) == "false" {
+		capabilities, err = setJSONField(
+			capabilities, "codeActionProvider", true,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", thisName, err)
+		}
+	}
+	b, err := setJSONField(result, "capabilities", capabilities)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", thisName, err)
+	}
+	return b, nil
+}
+
+// setJSONField returns the JSON object obj with the field key set to v,
+// keeping other fields as they are.
+func setJSONField(obj []byte, key string, v any) (json.RawMessage, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(obj, &fields); err != nil {
+		format := "setJSONField: in json.Unmarshal: %v"
+		return nil, fmt.Errorf(format, err)
+	}
+	if fields == nil {
+		fields = map[string]json.RawMessage{}
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("setJSONField: in json.Marshal: %v", err)
+	}
+	fields[key] = b
+	b, err = json.Marshal(fields)
+	if err != nil {
+		return nil, fmt.Errorf("setJSONField: in json.Marshal: %v", err)
+	}
+	return b, nil
+}
+
+// The types below are the subset of LSP and JSON-RPC the proxy looks into.
+
+// lspProxyMessage is any message of the client or the server.
+type lspProxyMessage struct {
+	// ID is nil for notifications.
+	ID     json.RawMessage `json:"id"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+	Result json.RawMessage `json:"result"`
+}
+
+type lspProxyDidChangeParams struct {
+	TextDocument   lspTextDocumentIdentifier `json:"textDocument"`
+	ContentChanges []struct {
+		// Range is nil if Text is the whole content.
+		Range *lspRange `json:"range"`
+		Text  string    `json:"text"`
+	} `json:"contentChanges"`
+}
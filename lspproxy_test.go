@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/looshch/gouse/internal/core"
+)
+
+func TestProxyLSP(t *testing.T) {
+	t.Parallel()
+	const uri = "file:///p.go"
+	const code = "package p\n\nfunc f() {\n" +
+		"\ta := 0; _ = a /* TODO: gouse */\n}\n"
+	var in bytes.Buffer
+	// send writes a request or, without an id, a notification to in.
+	send := func(id int, method string, params any) {
+		msg := map[string]any{
+			"jsonrpc": "2.0", "method": method, "params": params,
+		}
+		if id > 0 {
+			msg["id"] = id
+		}
+		b, err := json.Marshal(msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fmt.Fprintf(&in, "Content-Length: %d\r\n\r\n%s", len(b), b)
+	}
+	send(1, "initialize", map[string]any{})
+	send(0, "textDocument/didOpen", map[string]any{
+		"textDocument": map[string]string{"uri": uri, "text": code},
+	})
+	send(2, "textDocument/codeAction", map[string]any{
+		"textDocument": map[string]string{"uri": uri},
+	})
+	send(3, "textDocument/hover", map[string]any{})
+	send(0, "exit", nil)
+
+	serverIn, toServer := io.Pipe()
+	fromServer, serverOut := io.Pipe()
+	served := make(chan []string, 1)
+	go func() {
+		served <- fakeGopls(t, serverIn, serverOut, uri)
+	}()
+	var out bytes.Buffer
+	ctx := context.Background()
+	err := proxyLSP(ctx, core.Options{}, &in, &out, toServer, fromServer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Every message of the client is passed as it is.
+	want := []string{
+		"initialize",
+		"textDocument/didOpen",
+		"textDocument/codeAction",
+		"textDocument/hover",
+		"exit",
+	}
+	if got := <-served; fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("got: %v, want: %v", got, want)
+	}
+
+	var messages []lspMessage
+	r := bufio.NewReader(&out)
+	for {
+		b, err := readLSPMessage(r)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		var msg lspMessage
+		if err := json.Unmarshal(b, &msg); err != nil {
+			t.Fatal(err)
+		}
+		messages = append(messages, msg)
+	}
+	var diagnostics []int
+	for _, msg := range messages {
+		switch {
+		case msg.ID == 1:
+			type docSync struct {
+				OpenClose bool `json:"openClose"`
+				Change    int  `json:"change"`
+			}
+			var result struct {
+				Capabilities struct {
+					Sync docSync `json:"textDocumentSync"`
+				} `json:"capabilities"`
+			}
+			err := json.Unmarshal(msg.Result, &result)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := result.Capabilities.Sync
+			if !got.OpenClose || got.Change != lspSyncFull {
+				t.Errorf("got: sync %+v, want: full sync", got)
+			}
+		case msg.ID == 2:
+			var actions []struct {
+				Title string `json:"title"`
+			}
+			err := json.Unmarshal(msg.Result, &actions)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// gopls’ own, the quick fix and the toggle.
+			if len(actions) != 3 ||
+				actions[0].Title != "Inline call" ||
+				actions[2].Title != lspToggleTitle {
+				t.Errorf("got: actions %+v", actions)
+			}
+		case msg.ID == 3:
+			if string(msg.Result) != `{"contents":"hover"}` {
+				t.Errorf("got: hover %s", msg.Result)
+			}
+		case msg.Method == "textDocument/publishDiagnostics":
+			var params lspPublishDiagnosticsParams
+			err := json.Unmarshal(msg.Params, &params)
+			if err != nil {
+				t.Fatal(err)
+			}
+			diagnostics = append(
+				diagnostics, len(params.Diagnostics),
+			)
+		}
+	}
+	// The fake usage on opening, and then along with the diagnostic of
+	// gopls.
+	if fmt.Sprint(diagnostics) != "[1 2]" {
+		t.Errorf("got: diagnostics %v, want: [1 2]", diagnostics)
+	}
+}
+
+// fakeGopls responds to messages from in to out like gopls would until the
+// exit notification and returns their methods.
+func fakeGopls(
+	t *testing.T, in io.Reader, out io.WriteCloser, uri string,
+) []string {
+	defer out.Close()
+	var methods []string
+	r := bufio.NewReader(in)
+	for {
+		b, err := readLSPMessage(r)
+		if err != nil {
+			t.Error(err)
+			return methods
+		}
+		var req struct {
+			ID     int    `json:"id"`
+			Method string `json:"method"`
+		}
+		if err := json.Unmarshal(b, &req); err != nil {
+			t.Error(err)
+			return methods
+		}
+		methods = append(methods, req.Method)
+		var resp string
+		switch req.Method {
+		case "initialize":
+			resp = `{"jsonrpc":"2.0","id":1,"result":` +
+				`{"capabilities":{"textDocumentSync":` +
+				`{"openClose":true,"change":2},` +
+				`"codeActionProvider":true}}}`
+		case "textDocument/didOpen":
+			resp = `{"jsonrpc":"2.0",` +
+				`"method":"textDocument/publishDiagnostics",` +
+				`"params":{"uri":"` + uri + `","version":1,` +
+				`"diagnostics":[{"message":"gopls"}]}}`
+		case "textDocument/codeAction":
+			resp = `{"jsonrpc":"2.0","id":2,` +
+				`"result":[{"title":"Inline call"}]}`
+		case "textDocument/hover":
+			resp = `{"jsonrpc":"2.0","id":3,` +
+				`"result":{"contents":"hover"}}`
+		case "exit":
+			return methods
+		}
+		if err := writeLSPMessage(out, []byte(resp)); err != nil {
+			t.Error(err)
+			return methods
+		}
+	}
+}
@@ -0,0 +1,416 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/textproto"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/looshch/gouse/internal/core"
+)
+
+// Codes of JSON-RPC errors the server responds with.
+const (
+	lspInvalidParams  = -32602
+	lspMethodNotFound = -32601
+	lspRequestFailed  = -32803
+)
+
+// lspToggleTitle is the title of the code action which toggles a document.
+const lspToggleTitle = "Toggle unused variables"
+
+// lspSeverityInformation is the severity of diagnostics of fake usages.
+const lspSeverityInformation = 3
+
+var errLSPExitWithoutShutdown = errors.New(
+	"the client exited without shutting the server down",
+)
+
+// lspServer is a Language Server which offers a code action toggling open
+// documents and publishes diagnostics of fake usages in them, for ‘-lsp’
+// flag.
+type lspServer struct {
+	opts core.Options
+	out  io.Writer
+	// docs are contents of open documents keyed by URIs.
+	docs     map[string][]byte
+	shutdown bool
+}
+
+// serveLSP serves requests from in with responses to out until the client
+// exits or ctx is done. Documents are toggled with opts.
+func serveLSP(
+	ctx context.Context, opts core.Options, in io.Reader, out io.Writer,
+) error {
+	s := &lspServer{opts: opts, out: out, docs: map[string][]byte{}}
+	r := bufio.NewReader(in)
+	for ctx.Err() == nil {
+		b, err := readLSPMessage(r)
+		if err == io.EOF {
+			return errLSPExitWithoutShutdown
+		}
+		if err != nil {
+			return fmt.Errorf("serveLSP: %v", err)
+		}
+		var req lspRequest
+		if err := json.Unmarshal(b, &req); err != nil {
+			format := "serveLSP: in json.Unmarshal: %v"
+			return fmt.Errorf(format, err)
+		}
+		if req.Method == "exit" {
+			if !s.shutdown {
+				return errLSPExitWithoutShutdown
+			}
+			return nil
+		}
+		if err := s.handle(ctx, req); err != nil {
+			return fmt.Errorf("serveLSP: %v", err)
+		}
+	}
+	return nil
+}
+
+// handle responds to req if it’s a request, i.e. has an ID, and handles it if
+// it’s a notification. Only errors of writing to the client are returned.
+func (s *lspServer) handle(ctx context.Context, req lspRequest) error {
+	const thisName = "*lspServer.handle"
+
+	var result any
+	var err error
+	switch req.Method {
+	case "initialize":
+		result = lspInitializeResult{
+			Capabilities: lspServerCapabilities{
+				// Documents are synced in full.
+				TextDocumentSync:   1,
+				CodeActionProvider: true,
+			},
+			ServerInfo: lspServerInfo{"gouse", currentVersion},
+		}
+	case "shutdown":
+		s.shutdown = true
+	case "textDocument/didOpen":
+		var params lspDidOpenParams
+		// Malformed notifications can’t be answered, so they’re
+		// ignored.
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil
+		}
+		doc := params.TextDocument
+		s.docs[doc.URI] = []byte(doc.Text)
+		err = s.publishDiagnostics(doc.URI)
+	case "textDocument/didChange":
+		var params lspDidChangeParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil
+		}
+		changes := params.ContentChanges
+		if len(changes) == 0 {
+			return nil
+		}
+		uri := params.TextDocument.URI
+		s.docs[uri] = []byte(changes[len(changes)-1].Text)
+		err = s.publishDiagnostics(uri)
+	case "textDocument/didClose":
+		var params lspDidCloseParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil
+		}
+		delete(s.docs, params.TextDocument.URI)
+		err = s.publishDiagnostics(params.TextDocument.URI)
+	case "textDocument/codeAction":
+		var params lspCodeActionParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			rerr := &lspError{lspInvalidParams, err.Error()}
+			return s.respond(req.ID, nil, rerr)
+		}
+		actions, aerr := s.codeActions(ctx, params.TextDocument.URI)
+		if aerr != nil {
+			rerr := &lspError{lspRequestFailed, aerr.Error()}
+			return s.respond(req.ID, nil, rerr)
+		}
+		result = actions
+	default:
+		if req.ID != nil {
+			message := "unknown method " + req.Method
+			rerr := &lspError{lspMethodNotFound, message}
+			return s.respond(req.ID, nil, rerr)
+		}
+		// Unknown notifications are ignored.
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %v", thisName, err)
+	}
+	if req.ID == nil {
+		return nil
+	}
+	if err := s.respond(req.ID, result, nil); err != nil {
+		return fmt.Errorf("%s: %v", thisName, err)
+	}
+	return nil
+}
+
+// codeActions returns a quick fix per change toggling would make to the
+// document uri, titled like suggested fixes of the gouse analyzer, and the code
+// action which toggles the whole document, or none if there is nothing to
+// toggle.
+func (s *lspServer) codeActions(
+	ctx context.Context, uri string,
+) ([]lspCodeAction, error) {
+	const thisName = "*lspServer.codeActions"
+
+	actions := []lspCodeAction{}
+	code, ok := s.docs[uri]
+	if !ok {
+		return actions, nil
+	}
+	opts := s.opts
+	if opts.Placement == core.PlacementFunction {
+		p, err := lspPath(uri)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", thisName, err)
+		}
+		opts.Style, err = core.EditorStyleFor(p)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", thisName, err)
+		}
+	}
+	changes, err := core.FindChanges(ctx, code, opts)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", thisName, err)
+	}
+	if len(changes) == 0 {
+		return actions, nil
+	}
+	for _, c := range changes {
+		edits := lspTextEdits(code, []core.Change{c})
+		actions = append(actions, lspCodeAction{
+			Title: fixTitle(c),
+			Kind:  "quickfix",
+			Edit: lspWorkspaceEdit{
+				Changes: map[string][]lspTextEdit{uri: edits},
+			},
+		})
+	}
+	return append(actions, lspCodeAction{
+		Title: lspToggleTitle,
+		Kind:  "quickfix",
+		Edit: lspWorkspaceEdit{
+			Changes: map[string][]lspTextEdit{
+				uri: lspTextEdits(code, changes),
+			},
+		},
+	}), nil
+}
+
+// publishDiagnostics sends the client a diagnostic of every fake usage in the
+// document uri. Closed documents have none.
+func (s *lspServer) publishDiagnostics(uri string) error {
+	diagnostics := lspMarkerDiagnostics(s.docs[uri])
+	err := s.write(lspNotification{
+		JSONRPC: "2.0",
+		Method:  "textDocument/publishDiagnostics",
+		Params:  lspPublishDiagnosticsParams{uri, diagnostics},
+	})
+	if err != nil {
+		return fmt.Errorf("*lspServer.publishDiagnostics: %v", err)
+	}
+	return nil
+}
+
+// lspMarkerDiagnostics returns a diagnostic of every fake usage in code.
+func lspMarkerDiagnostics(code []byte) []lspDiagnostic {
+	diagnostics := []lspDiagnostic{}
+	for _, c := range core.FindMarkers(code) {
+		diagnostics = append(diagnostics, lspDiagnostic{
+			Range: lspRange{
+				Start: lspPositionOf(code, c.Start),
+				End:   lspPositionOf(code, c.End),
+			},
+			Severity: lspSeverityInformation,
+			Source:   "gouse",
+			Message:  c.Summary(),
+		})
+	}
+	return diagnostics
+}
+
+// respond sends the client the response to the request with the id.
+func (s *lspServer) respond(
+	id json.RawMessage, result any, rerr *lspError,
+) error {
+	resp := lspResponse{JSONRPC: "2.0", ID: id, Error: rerr}
+	if rerr == nil {
+		b, err := json.Marshal(result)
+		if err != nil {
+			format := "*lspServer.respond: in json.Marshal: %v"
+			return fmt.Errorf(format, err)
+		}
+		resp.Result = b
+	}
+	if err := s.write(resp); err != nil {
+		return fmt.Errorf("*lspServer.respond: %v", err)
+	}
+	return nil
+}
+
+// write sends the client the message v.
+func (s *lspServer) write(v any) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("*lspServer.write: in json.Marshal: %v", err)
+	}
+	if err := writeLSPMessage(s.out, b); err != nil {
+		return fmt.Errorf("*lspServer.write: %v", err)
+	}
+	return nil
+}
+
+// writeLSPMessage writes the content b of a message to w, framed by headers
+// with its length, the inverse of readLSPMessage.
+func writeLSPMessage(w io.Writer, b []byte) error {
+	_, err := fmt.Fprintf(w, "Content-Length: %d\r\n\r\n%s", len(b), b)
+	if err != nil {
+		return fmt.Errorf("writeLSPMessage: in fmt.Fprintf: %v", err)
+	}
+	return nil
+}
+
+// readLSPMessage returns the content of the next message from r, framed by
+// headers with its length.
+func readLSPMessage(r *bufio.Reader) ([]byte, error) {
+	const thisName = "readLSPMessage"
+
+	headers, err := textproto.NewReader(r).ReadMIMEHeader()
+	if err == io.EOF {
+		return nil, err
+	}
+	if err != nil {
+		format := thisName + ": in *Reader.ReadMIMEHeader: %v"
+		return nil, fmt.Errorf(format, err)
+	}
+	n, err := strconv.Atoi(headers.Get("Content-Length"))
+	if err != nil {
+		return nil, fmt.Errorf(thisName+": in strconv.Atoi: %v", err)
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, fmt.Errorf(thisName+": in io.ReadFull: %v", err)
+	}
+	return b, nil
+}
+
+// lspPath returns the path of the file with the file URI uri, the inverse of
+// lspURI.
+func lspPath(uri string) (string, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return "", fmt.Errorf("lspPath: in url.Parse: %v", err)
+	}
+	if u.Scheme != "file" {
+		return "", fmt.Errorf("lspPath: %s isn’t a file URI", uri)
+	}
+	p := u.Path
+	// Windows paths start with a volume name rather than a slash.
+	if len(p) > 2 && p[2] == ':' {
+		p = strings.TrimPrefix(p, "/")
+	}
+	return filepath.FromSlash(p), nil
+}
+
+// The types below are the subset of LSP and JSON-RPC the server speaks.
+
+type lspRequest struct {
+	// ID is nil for notifications.
+	ID     json.RawMessage `json:"id"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+}
+
+type lspResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *lspError       `json:"error,omitempty"`
+}
+
+type lspNotification struct {
+	JSONRPC string `json:"jsonrpc"`
+	Method  string `json:"method"`
+	Params  any    `json:"params"`
+}
+
+type lspError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type lspInitializeResult struct {
+	Capabilities lspServerCapabilities `json:"capabilities"`
+	ServerInfo   lspServerInfo         `json:"serverInfo"`
+}
+
+type lspServerCapabilities struct {
+	TextDocumentSync   int  `json:"textDocumentSync"`
+	CodeActionProvider bool `json:"codeActionProvider"`
+}
+
+type lspServerInfo struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type lspTextDocumentItem struct {
+	URI  string `json:"uri"`
+	Text string `json:"text"`
+}
+
+type lspTextDocumentIdentifier struct {
+	URI string `json:"uri"`
+}
+
+type lspDidOpenParams struct {
+	TextDocument lspTextDocumentItem `json:"textDocument"`
+}
+
+type lspDidChangeParams struct {
+	TextDocument   lspTextDocumentIdentifier `json:"textDocument"`
+	ContentChanges []struct {
+		Text string `json:"text"`
+	} `json:"contentChanges"`
+}
+
+type lspDidCloseParams struct {
+	TextDocument lspTextDocumentIdentifier `json:"textDocument"`
+}
+
+type lspCodeActionParams struct {
+	TextDocument lspTextDocumentIdentifier `json:"textDocument"`
+	Range        lspRange                  `json:"range"`
+}
+
+type lspCodeAction struct {
+	Title string           `json:"title"`
+	Kind  string           `json:"kind"`
+	Edit  lspWorkspaceEdit `json:"edit"`
+}
+
+type lspDiagnostic struct {
+	Range    lspRange `json:"range"`
+	Severity int      `json:"severity"`
+	Source   string   `json:"source"`
+	Message  string   `json:"message"`
+}
+
+type lspPublishDiagnosticsParams struct {
+	URI         string          `json:"uri"`
+	Diagnostics []lspDiagnostic `json:"diagnostics"`
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"testing"
+
+	"github.com/looshch/gouse/internal/core"
+)
+
+// lspMessage is any message the server writes.
+type lspMessage struct {
+	ID     int             `json:"id"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+	Result json.RawMessage `json:"result"`
+	Error  *lspError       `json:"error"`
+}
+
+func TestServeLSP(t *testing.T) {
+	t.Parallel()
+	const uri = "file:///p.go"
+	const code = "package p\n\nfunc f() {\n" +
+		"\ta := 0; _ = a /* TODO: gouse */\n}\n"
+	var in bytes.Buffer
+	// send writes a request or, without an id, a notification to in.
+	send := func(id int, method string, params any) {
+		msg := map[string]any{
+			"jsonrpc": "2.0", "method": method, "params": params,
+		}
+		if id > 0 {
+			msg["id"] = id
+		}
+		b, err := json.Marshal(msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fmt.Fprintf(&in, "Content-Length: %d\r\n\r\n%s", len(b), b)
+	}
+	send(1, "initialize", map[string]any{})
+	send(0, "initialized", map[string]any{})
+	send(0, "textDocument/didOpen", map[string]any{
+		"textDocument": map[string]string{"uri": uri, "text": code},
+	})
+	send(2, "textDocument/codeAction", map[string]any{
+		"textDocument": map[string]string{"uri": uri},
+	})
+	send(3, "unknown", nil)
+	send(4, "shutdown", nil)
+	send(0, "exit", nil)
+	var out bytes.Buffer
+	err := serveLSP(context.Background(), core.Options{}, &in, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var messages []lspMessage
+	r := bufio.NewReader(&out)
+	for {
+		b, err := readLSPMessage(r)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		var m lspMessage
+		if err := json.Unmarshal(b, &m); err != nil {
+			t.Fatal(err)
+		}
+		messages = append(messages, m)
+	}
+	if len(messages) != 5 {
+		t.Fatalf("got: %d messages, want: 5", len(messages))
+	}
+
+	var initialized lspInitializeResult
+	err = json.Unmarshal(messages[0].Result, &initialized)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !initialized.Capabilities.CodeActionProvider {
+		t.Errorf("got: %s, want: code actions", messages[0].Result)
+	}
+
+	var published lspPublishDiagnosticsParams
+	if err := json.Unmarshal(messages[1].Params, &published); err != nil {
+		t.Fatal(err)
+	}
+	if d := published.Diagnostics; len(d) != 1 ||
+		d[0].Message != "fake usage of a" {
+		t.Errorf("got: %+v, want: fake usage of a", d)
+	}
+
+	var actions []lspCodeAction
+	if err := json.Unmarshal(messages[2].Result, &actions); err != nil {
+		t.Fatal(err)
+	}
+	if len(actions) != 2 {
+		t.Fatalf("got: %s, want: 2 actions", messages[2].Result)
+	}
+	changes := core.FindMarkers([]byte(code))
+	want := lspTextEdits([]byte(code), changes)
+	titles := []string{"Remove fake usage of a", lspToggleTitle}
+	for i, a := range actions {
+		edits := a.Edit.Changes[uri]
+		if a.Title != titles[i] || len(edits) != 1 ||
+			edits[0] != want[0] {
+			t.Errorf(
+				"got: %+v, want: %s with %+v",
+				a, titles[i], want,
+			)
+		}
+	}
+
+	if e := messages[3].Error; e == nil || e.Code != lspMethodNotFound {
+		t.Errorf("got: %+v, want: method not found", e)
+	}
+	if got := string(messages[4].Result); got != "null" {
+		t.Errorf("got: %s, want: null", got)
+	}
+}
+
+func TestServeLSPExitWithoutShutdown(t *testing.T) {
+	t.Parallel()
+	const exit = `{"jsonrpc":"2.0","method":"exit"}`
+	in := fmt.Sprintf("Content-Length: %d\r\n\r\n%s", len(exit), exit)
+	ctx := context.Background()
+	var out bytes.Buffer
+	err := serveLSP(ctx, core.Options{}, bytes.NewBufferString(in), &out)
+	if err != errLSPExitWithoutShutdown {
+		t.Errorf("got: %v, want: %v", err, errLSPExitWithoutShutdown)
+	}
+}
+
+func TestLSPPath(t *testing.T) {
+	t.Parallel()
+	p, err := filepath.Abs("p.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	uri, err := lspURI(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := lspPath(uri)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != p {
+		t.Errorf("got: %s, want: %s", got, p)
+	}
+	if _, err := lspPath("untitled:p.go"); err == nil {
+		t.Error("got: nil, want: error")
+	}
+}
@@ -0,0 +1,19 @@
+//go:build !js
+
+package main
+
+import (
+	"context"
+	"os"
+)
+
+func main() {
+	ctx := context.Background()
+	os.Exit(run(
+		ctx,
+		os.Args[1:],
+		os.Stdin, os.Stdout, os.Stderr,
+
+		openFile,
+	))
+}
@@ -0,0 +1,69 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"context"
+	"syscall/js"
+
+	"github.com/looshch/gouse/internal/core"
+)
+
+// main exposes gouse to JavaScript as globalThis.gouse with toggle function,
+// see toggleJS, and keeps running, so it can be called.
+func main() {
+	js.Global().Set("gouse", map[string]any{
+		"toggle": js.FuncOf(toggleJS),
+	})
+	select {}
+}
+
+// toggleJS is gouse.toggle(source, options) of JavaScript. It toggles source
+// with the type-check backend, as there is no go command in browsers, and
+// options of mode, strategy and placement strings like the fields of POST
+// /toggle requests of ‘-serve’ flag. It returns an object of the toggled code
+// and changes like edits of ‘-format json’, or an object of error.
+func toggleJS(_ js.Value, args []js.Value) any {
+	if len(args) == 0 || args[0].Type() != js.TypeString {
+		return map[string]any{"error": "toggle: source isn’t a string"}
+	}
+	code := []byte(args[0].String())
+	opts := core.Options{Backend: core.BackendTypeCheck}
+	var m, strategy, placement string
+	if len(args) > 1 && args[1].Type() == js.TypeObject {
+		get := func(key string) string {
+			v := args[1].Get(key)
+			if v.Type() != js.TypeString {
+				return ""
+			}
+			return v.String()
+		}
+		m, strategy, placement = get("mode"), get("strategy"),
+			get("placement")
+	}
+	err := overrideOptions(&opts, m, strategy, placement, "")
+	if err != nil {
+		return map[string]any{"error": "toggle: " + err.Error()}
+	}
+	changes, err := core.FindChanges(context.Background(), code, opts)
+	if err != nil {
+		return map[string]any{"error": "toggle: " + err.Error()}
+	}
+	edits := newFileEdits("", code, changes).Edits
+	jsEdits := make([]any, len(edits))
+	for i, e := range edits {
+		jsEdits[i] = map[string]any{
+			"action": e.Action,
+			"name":   e.Name,
+			"line":   e.Line,
+			"start":  e.Start,
+			"end":    e.End,
+			"old":    e.Old,
+			"new":    e.New,
+		}
+	}
+	return map[string]any{
+		"code":    string(core.ApplyChanges(code, changes)),
+		"changes": jsEdits,
+	}
+}
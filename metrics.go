@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/looshch/gouse/internal/core"
+)
+
+// latencyBuckets are upper bounds of buckets of the latency histogram in
+// seconds, the default ones of Prometheus clients.
+var latencyBuckets = []float64{
+	.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10,
+}
+
+// metrics counts requests served by ‘-daemon’, ‘-serve’ and ‘-grpc’ flags and
+// serves the counters in the Prometheus text format on GET /metrics. A nil
+// *metrics counts nothing.
+type metrics struct {
+	mu       sync.Mutex
+	requests int
+	errors   int
+	added    int
+	removed  int
+	// latencies are counts of requests per latencyBuckets, and the last
+	// one is of slower requests.
+	latencies []int
+	latency   time.Duration
+}
+
+func newMetrics() *metrics {
+	return &metrics{latencies: make([]int, len(latencyBuckets)+1)}
+}
+
+// observe counts a request served since start which made changes, or failed
+// if err isn’t nil. It returns err.
+func (m *metrics) observe(
+	start time.Time, changes []core.Change, err error,
+) error {
+	if m == nil {
+		return err
+	}
+	d := time.Since(start)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.requests++
+	if err != nil {
+		m.errors++
+	}
+	for _, c := range changes {
+		if c.Action == core.ActionAdd {
+			m.added++
+		} else {
+			m.removed++
+		}
+	}
+	m.latency += d
+	i := 0
+	for i < len(latencyBuckets) && d.Seconds() > latencyBuckets[i] {
+		i++
+	}
+	m.latencies[i]++
+	return err
+}
+
+// ServeHTTP responds with the counters in the Prometheus text format.
+func (m *metrics) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	m.write(w)
+}
+
+// write writes the counters to w in the Prometheus text format.
+func (m *metrics) write(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	counter := func(name, help string, n int) {
+		fmt.Fprintf(
+			w, "# HELP %s %s\n# TYPE %s counter\n%s %d\n",
+			name, help, name, name, n,
+		)
+	}
+	counter("gouse_requests_total", "Requests served.", m.requests)
+	counter("gouse_request_errors_total", "Requests failed.", m.errors)
+	counter(
+		"gouse_fake_usages_added_total", "Fake usages created.",
+		m.added,
+	)
+	counter(
+		"gouse_fake_usages_removed_total", "Fake usages removed.",
+		m.removed,
+	)
+	counter(
+		"gouse_build_cache_hits_total", "Builds taken from the cache.",
+		core.Builds.HitCount(),
+	)
+	const name = "gouse_request_duration_seconds"
+	fmt.Fprintf(
+		w, "# HELP %s Latency of requests.\n# TYPE %s histogram\n",
+		name, name,
+	)
+	// Buckets are cumulative.
+	var n int
+	for i, count := range m.latencies {
+		n += count
+		le := "+Inf"
+		if i < len(latencyBuckets) {
+			le = strconv.FormatFloat(latencyBuckets[i], 'g', -1, 64)
+		}
+		fmt.Fprintf(w, "%s_bucket{le=%q} %d\n", name, le, n)
+	}
+	fmt.Fprintf(w, "%s_sum %g\n", name, m.latency.Seconds())
+	fmt.Fprintf(w, "%s_count %d\n", name, n)
+}
+
+// serveMetrics serves m on GET /metrics of the TCP address addr like
+// serveHTTP, for servers which don’t speak HTTP.
+func serveMetrics(
+	ctx context.Context, addr string, m *metrics, infoLog *log.Logger,
+) error {
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", m)
+	if err := serveHTTP(ctx, addr, mux, infoLog); err != nil {
+		return fmt.Errorf("serveMetrics: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/looshch/gouse/internal/core"
+)
+
+func TestMetrics(t *testing.T) {
+	t.Parallel()
+	m := newMetrics()
+	now := time.Now()
+	changes := []core.Change{
+		{Action: core.ActionAdd}, {Action: core.ActionAdd},
+	}
+	m.observe(now, changes, nil)
+	m.observe(now, []core.Change{{Action: core.ActionRemove}}, nil)
+	m.observe(now.Add(-time.Minute), nil, errors.New("failed"))
+	var nilMetrics *metrics
+	nilMetrics.observe(now, changes, nil)
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	m.ServeHTTP(w, r)
+	got := w.Body.String()
+	for _, want := range []string{
+		"# TYPE gouse_requests_total counter\ngouse_requests_total 3\n",
+		"gouse_request_errors_total 1\n",
+		"gouse_fake_usages_added_total 2\n",
+		"gouse_fake_usages_removed_total 1\n",
+		"# TYPE gouse_request_duration_seconds histogram\n",
+		`gouse_request_duration_seconds_bucket{le="0.005"} 2` + "\n",
+		`gouse_request_duration_seconds_bucket{le="10"} 2` + "\n",
+		`gouse_request_duration_seconds_bucket{le="+Inf"} 3` + "\n",
+		"gouse_request_duration_seconds_count 3\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("got: %s, want: %q in it", got, want)
+		}
+	}
+}
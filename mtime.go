@@ -0,0 +1,187 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/looshch/gouse/internal/core"
+)
+
+// mtimePolicy is when ‘-preserve-mtime’ flag keeps modification times of files
+// written back. It’s empty if they aren’t kept.
+type mtimePolicy string
+
+const (
+	// mtimeSame keeps the modification time a file had with the same
+	// contents, so a toggle which is undone, e.g. by removing fake usages
+	// and adding them back, doesn’t trigger rebuilds.
+	mtimeSame mtimePolicy = "same"
+	// mtimeAlways keeps the modification time of every file.
+	mtimeAlways mtimePolicy = "always"
+)
+
+func (p *mtimePolicy) String() string { return string(*p) }
+
+func (p *mtimePolicy) Set(s string) error {
+	switch mtimePolicy(s) {
+	case mtimeSame, mtimeAlways:
+		*p = mtimePolicy(s)
+		return nil
+	}
+	// ‘-preserve-mtime’ without a value.
+	if s == "true" {
+		*p = mtimeSame
+		return nil
+	}
+	return fmt.Errorf("unknown mtime policy %q, want same or always", s)
+}
+
+// IsBoolFlag lets ‘-preserve-mtime’ be used without a value.
+func (p *mtimePolicy) IsBoolFlag() bool { return true }
+
+// defaultMtimesPath returns the path of the file which keeps modification
+// times of contents of files, under the user cache directory.
+func defaultMtimesPath() (string, error) {
+	dir, err := cacheDir()
+	if err != nil {
+		return "", fmt.Errorf("defaultMtimesPath: %v", err)
+	}
+	return filepath.Join(dir, "mtimes.json"), nil
+}
+
+// maxMtimes is the number of contents of a file whose modification times are
+// kept.
+const maxMtimes = 8
+
+// mtimes keeps modification times of files written back as policy says.
+type mtimes struct {
+	// path is the file which keeps modification times of contents of
+	// files between runs, see mtimeSame.
+	path   string
+	policy mtimePolicy
+	// pending are files about to be written back, keyed by names.
+	pending map[string]pendingMtime
+}
+
+// pendingMtime is a file about to be written back.
+type pendingMtime struct {
+	// old and new are hashes of its contents before and after writing.
+	old, new string
+	mtime    time.Time
+}
+
+// contentsMtime is a modification time of contents of a file with the hash.
+type contentsMtime struct {
+	Hash  string    `json:"hash"`
+	Mtime time.Time `json:"mtime"`
+}
+
+// hook returns a writeHook which takes note of the contents and the
+// modification time of the file name before it’s written back with changes.
+// Contents are hashed as they’re on disk, in the encoding of the file.
+func (m *mtimes) hook(name string) writeHook {
+	return func(read, toggled []byte, changes []core.Change) error {
+		if len(changes) == 0 || name == stdinName {
+			return nil
+		}
+		info, err := os.Stat(name)
+		if err != nil {
+			return fmt.Errorf("*mtimes.hook: in os.Stat: %v", err)
+		}
+		if m.pending == nil {
+			m.pending = make(map[string]pendingMtime)
+		}
+		m.pending[name] = pendingMtime{
+			old:   hashOf(read),
+			new:   hashOf(toggled),
+			mtime: info.ModTime(),
+		}
+		return nil
+	}
+}
+
+// restore sets the modification time of the file name, which was written back
+// after hook had taken note of it, as the policy of m says.
+func (m *mtimes) restore(name string) error {
+	const thisName = "*mtimes.restore"
+
+	pending, ok := m.pending[name]
+	if !ok {
+		return nil
+	}
+	delete(m.pending, name)
+	if m.policy == mtimeAlways || pending.new == pending.old {
+		return chtime(name, pending.mtime)
+	}
+	p, err := filepath.Abs(name)
+	if err != nil {
+		return fmt.Errorf(thisName+": in filepath.Abs: %v", err)
+	}
+	known, err := readMtimes(m.path)
+	if err != nil {
+		return fmt.Errorf("%s: %v", thisName, err)
+	}
+	kept := known[p]
+	for _, c := range kept {
+		if c.Hash == pending.new {
+			if err := chtime(name, c.Mtime); err != nil {
+				return fmt.Errorf("%s: %v", thisName, err)
+			}
+			break
+		}
+	}
+	// The latest contents go first.
+	kept = append([]contentsMtime{{pending.old, pending.mtime}}, kept...)
+	known[p] = kept[:min(len(kept), maxMtimes)]
+	if err := writeMtimes(m.path, known); err != nil {
+		return fmt.Errorf("%s: %v", thisName, err)
+	}
+	return nil
+}
+
+// chtime sets the modification time of the file p to mtime, leaving its access
+// time as is.
+func chtime(p string, mtime time.Time) error {
+	if err := os.Chtimes(p, time.Time{}, mtime); err != nil {
+		return fmt.Errorf("chtime: in os.Chtimes: %v", err)
+	}
+	return nil
+}
+
+// readMtimes returns modification times of contents of files kept in the file
+// at path, keyed by absolute paths of the files.
+func readMtimes(path string) (map[string][]contentsMtime, error) {
+	known := make(map[string][]contentsMtime)
+	b, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return known, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("readMtimes: in os.ReadFile: %v", err)
+	}
+	if err := json.Unmarshal(b, &known); err != nil {
+		return nil, fmt.Errorf("readMtimes: in json.Unmarshal: %v", err)
+	}
+	return known, nil
+}
+
+// writeMtimes keeps modification times of contents of files in the file at
+// path.
+func writeMtimes(path string, known map[string][]contentsMtime) error {
+	b, err := json.Marshal(known)
+	if err != nil {
+		return fmt.Errorf("writeMtimes: in json.Marshal: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("writeMtimes: in os.MkdirAll: %v", err)
+	}
+	if err := os.WriteFile(path, b, 0o600); err != nil {
+		return fmt.Errorf("writeMtimes: in os.WriteFile: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/looshch/gouse/internal/core"
+)
+
+func TestMtimesRestore(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	p := filepath.Join(dir, "p.go")
+	const code = "package p\n"
+	if err := os.WriteFile(p, []byte(code), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	original := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	if err := os.Chtimes(p, time.Time{}, original); err != nil {
+		t.Fatal(err)
+	}
+	// toggle writes p back with changes, as run does.
+	toggle := func(m *mtimes, changes []core.Change) time.Time {
+		code, err := os.ReadFile(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		toggled := core.ApplyChanges(code, changes)
+		if err := m.hook(p)(code, toggled, changes); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, toggled, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := m.restore(p); err != nil {
+			t.Fatal(err)
+		}
+		info, err := os.Stat(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return info.ModTime()
+	}
+	m := &mtimes{path: filepath.Join(dir, "mtimes.json"), policy: mtimeSame}
+	added := []core.Change{
+		{Start: len(code), End: len(code), Text: "// x\n"},
+	}
+	if got := toggle(m, added); got.Equal(original) {
+		t.Errorf("got: %v, want: a new mtime", got)
+	}
+	removed := []core.Change{{Start: len(code), End: len(code) + 5}}
+	if got := toggle(m, removed); !got.Equal(original) {
+		t.Errorf("got: %v, want: %v", got, original)
+	}
+	m.policy = mtimeAlways
+	if got := toggle(m, added); !got.Equal(original) {
+		t.Errorf("got: %v, want: %v", got, original)
+	}
+}
+
+func TestMtimePolicySet(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		value string
+		want  mtimePolicy
+	}{
+		{"true", mtimeSame},
+		{"same", mtimeSame},
+		{"always", mtimeAlways},
+	}
+	for _, tt := range tests {
+		var p mtimePolicy
+		if err := p.Set(tt.value); err != nil || p != tt.want {
+			t.Errorf("got: %s, %v, want: %s, nil", p, err, tt.want)
+		}
+	}
+	var p mtimePolicy
+	if err := p.Set("never"); err == nil {
+		t.Error("got: nil, want: error")
+	}
+}
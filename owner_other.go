@@ -0,0 +1,8 @@
+//go:build !unix
+
+package main
+
+import "os"
+
+// keepOwner does nothing, as files have no owners like on Unix.
+func keepOwner(f *os.File, info os.FileInfo) error { return nil }
@@ -0,0 +1,22 @@
+//go:build unix
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// keepOwner gives the file f the owner and the group of the file info
+// describes.
+func keepOwner(f *os.File, info os.FileInfo) error {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return nil
+	}
+	if err := f.Chown(int(st.Uid), int(st.Gid)); err != nil {
+		return fmt.Errorf("keepOwner: in *File.Chown: %v", err)
+	}
+	return nil
+}
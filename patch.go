@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+
+	"github.com/looshch/gouse/internal/core"
+)
+
+// patchContext is the number of unchanged lines around changed ones in
+// patches, the default of diff and git.
+const patchContext = 3
+
+// patchEdits returns an editsReporter which writes to out a unified diff of
+// changes per file, so out becomes a patch of all files which ‘git apply’
+// and ‘patch -p1’ apply.
+func patchEdits(out file) editsReporter {
+	return func(name string, code []byte, changes []core.Change) error {
+		if len(changes) == 0 {
+			return nil
+		}
+		diff := unifiedDiff(name, code, changes)
+		if _, err := out.Write(diff); err != nil {
+			return fmt.Errorf("patchEdits: in *File.Write: %v", err)
+		}
+		return nil
+	}
+}
+
+// unifiedDiff returns a unified diff of code of the file name and code with
+// changes applied, with ‘a/’ and ‘b/’ prefixes of git.
+func unifiedDiff(name string, code []byte, changes []core.Change) []byte {
+	lines := bytes.SplitAfter(code, []byte("\n"))
+	// The last empty line isn’t a line.
+	if len(lines[len(lines)-1]) == 0 {
+		lines = lines[:len(lines)-1]
+	}
+	p := filepath.ToSlash(filepath.Clean(name))
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "--- a/%s\n+++ b/%s\n", p, p)
+	hunks := rcsHunks(code, changes)
+	// delta is the number of added lines minus the number of deleted ones
+	// in preceding groups.
+	var delta int
+	for len(hunks) > 0 {
+		// A group of hunks whose context lines overlap makes one
+		// unified diff hunk.
+		n := 1
+		for ; n < len(hunks); n++ {
+			between := code[hunks[n-1].end:hunks[n].start]
+			gap := bytes.Count(between, []byte("\n"))
+			if gap > 2*patchContext {
+				break
+			}
+		}
+		group := hunks[:n]
+		hunks = hunks[n:]
+		first := bytes.Count(code[:group[0].start], []byte("\n"))
+		last := bytes.Count(code[:group[n-1].end], []byte("\n"))
+		// A hunk ending with an unterminated line touches it too.
+		if end := group[n-1].end; end > 0 && code[end-1] != '\n' {
+			last++
+		}
+		start := max(first-patchContext, 0)
+		end := min(last+patchContext, len(lines))
+		var body bytes.Buffer
+		oldCount, newCount := end-start, end-start
+		next := start
+		for _, h := range group {
+			from := bytes.Count(code[:h.start], []byte("\n"))
+			to := from + countLines(code[h.start:h.end])
+			writePatchLines(&body, ' ', lines[next:from])
+			writePatchLines(&body, '-', lines[from:to])
+			added := bytes.SplitAfter(h.apply(code), []byte("\n"))
+			if len(added[len(added)-1]) == 0 {
+				added = added[:len(added)-1]
+			}
+			writePatchLines(&body, '+', added)
+			newCount += len(added) - (to - from)
+			next = to
+		}
+		writePatchLines(&body, ' ', lines[next:end])
+		// +1 is an adjustment for 1-based count. Empty ranges start
+		// at the line before them.
+		oldStart, newStart := start+1, start+1+delta
+		if oldCount == 0 {
+			oldStart--
+		}
+		if newCount == 0 {
+			newStart--
+		}
+		fmt.Fprintf(
+			&b, "@@ -%d,%d +%d,%d @@\n",
+			oldStart, oldCount, newStart, newCount,
+		)
+		b.Write(body.Bytes())
+		delta += newCount - oldCount
+	}
+	return b.Bytes()
+}
+
+// writePatchLines writes lines to b, each prefixed with prefix. A line without
+// a line break is followed by the marker of diff.
+func writePatchLines(b *bytes.Buffer, prefix byte, lines [][]byte) {
+	for _, l := range lines {
+		b.WriteByte(prefix)
+		b.Write(l)
+		if len(l) == 0 || l[len(l)-1] != '\n' {
+			b.WriteString("\n\\ No newline at end of file\n")
+		}
+	}
+}
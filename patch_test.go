@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/looshch/gouse/internal/core"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	t.Parallel()
+	// numbered returns lines with numbers from 1 to n.
+	numbered := func(n int) string {
+		var b strings.Builder
+		for i := range n {
+			b.WriteString(strings.Repeat("x", i+1) + "\n")
+		}
+		return b.String()
+	}
+	// at returns a change which inserts text at the end of the line with
+	// the 1-based number n in code.
+	at := func(code string, n int, text string) core.Change {
+		var o int
+		for range n {
+			o += strings.IndexByte(code[o:], '\n') + 1
+		}
+		return core.Change{Start: o - 1, End: o - 1, Text: text}
+	}
+	long := numbered(20)
+	tests := []struct {
+		name    string
+		code    string
+		changes []core.Change
+		want    string
+	}{
+		{
+			"one change",
+			numbered(5),
+			[]core.Change{at(numbered(5), 3, "!")},
+			"@@ -1,5 +1,5 @@\n" +
+				" x\n xx\n-xxx\n+xxx!\n xxxx\n xxxxx\n",
+		},
+		{
+			"distant changes",
+			long,
+			[]core.Change{at(long, 2, "!"), at(long, 19, "!")},
+			"@@ -1,5 +1,5 @@\n" +
+				" x\n-xx\n+xx!\n xxx\n xxxx\n xxxxx\n" +
+				"@@ -16,5 +16,5 @@\n" +
+				" " + strings.Repeat("x", 16) + "\n" +
+				" " + strings.Repeat("x", 17) + "\n" +
+				" " + strings.Repeat("x", 18) + "\n" +
+				"-" + strings.Repeat("x", 19) + "\n" +
+				"+" + strings.Repeat("x", 19) + "!\n" +
+				" " + strings.Repeat("x", 20) + "\n",
+		},
+		{
+			"inserted line",
+			"a\nb\n",
+			[]core.Change{{Start: 2, End: 2, Text: "c\n"}},
+			"@@ -1,2 +1,3 @@\n a\n+c\n b\n",
+		},
+		{
+			"no line break at the end",
+			"a\nb",
+			[]core.Change{{Start: 3, End: 3, Text: "!"}},
+			"@@ -1,2 +1,2 @@\n a\n" +
+				"-b\n\\ No newline at end of file\n" +
+				"+b!\n\\ No newline at end of file\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got := unifiedDiff("p.go", []byte(tt.code), tt.changes)
+			want := "--- a/p.go\n+++ b/p.go\n" + tt.want
+			if string(got) != want {
+				t.Errorf(filesCmpErr, got, want)
+			}
+			// The patch is applied by git as is.
+			dir := t.TempDir()
+			p := filepath.Join(dir, "p.go")
+			err := os.WriteFile(p, []byte(tt.code), 0o644)
+			if err != nil {
+				t.Fatal(err)
+			}
+			cmd := exec.Command("git", "apply", "-")
+			cmd.Dir = dir
+			cmd.Stdin = bytes.NewReader(got)
+			if out, err := cmd.CombinedOutput(); err != nil {
+				t.Fatalf("git apply: %v: %s", err, out)
+			}
+			patched, err := os.ReadFile(p)
+			if err != nil {
+				t.Fatal(err)
+			}
+			code := []byte(tt.code)
+			applied := core.ApplyChanges(code, tt.changes)
+			if !bytes.Equal(patched, applied) {
+				t.Errorf(filesCmpErr, patched, applied)
+			}
+		})
+	}
+}
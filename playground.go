@@ -0,0 +1,33 @@
+package main
+
+import (
+	_ "embed"
+	"net/http"
+
+	"github.com/looshch/gouse/internal/core"
+)
+
+// playgroundPage is the web UI of ‘-serve-playground’ flag: an input pane, an
+// output pane with lines created and removed highlighted, and selects of the
+// options of POST /toggle requests it makes.
+//
+//go:embed playground.html
+var playgroundPage []byte
+
+// newPlaygroundHandler returns the handler of ‘-serve-playground’ flag: GET /
+// responds with playgroundPage, and other requests are handled like of
+// ‘-serve’ flag, see newHTTPHandler.
+func newPlaygroundHandler(
+	opts core.Options, maxSize fileSize, m *metrics,
+) http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/", newHTTPHandler(opts, maxSize, m))
+	mux.HandleFunc("GET /{$}", playground)
+	return mux
+}
+
+// playground responds with playgroundPage.
+func playground(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(playgroundPage)
+}
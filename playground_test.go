@@ -0,0 +1,79 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/looshch/gouse/internal/core"
+)
+
+func TestPlaygroundHandler(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name       string
+		method     string
+		target     string
+		body       string
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			name:       "page",
+			method:     http.MethodGet,
+			target:     "/",
+			wantStatus: http.StatusOK,
+			wantBody:   string(playgroundPage),
+		},
+		{
+			name:       "toggle",
+			method:     http.MethodPost,
+			target:     "/toggle?mode=remove",
+			body:       "package p\n",
+			wantStatus: http.StatusOK,
+			wantBody:   "package p\n",
+		},
+		{
+			name:       "health",
+			method:     http.MethodGet,
+			target:     "/healthz",
+			wantStatus: http.StatusOK,
+			wantBody:   "ok\n",
+		},
+		{
+			name:       "unknown path",
+			method:     http.MethodGet,
+			target:     "/index.html",
+			wantStatus: http.StatusNotFound,
+		},
+	}
+	handler := newPlaygroundHandler(core.Options{}, 0, nil)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			body := strings.NewReader(tt.body)
+			r := httptest.NewRequest(tt.method, tt.target, body)
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			resp := w.Result()
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf(
+					"got: %d, want: %d",
+					resp.StatusCode, tt.wantStatus,
+				)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			got, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.wantBody {
+				t.Errorf(filesCmpErr, got, tt.wantBody)
+			}
+		})
+	}
+}
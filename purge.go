@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"sort"
+
+	"github.com/looshch/gouse/internal/core"
+)
+
+// purgeFiles removes every fake usage from files in paths, writing them back,
+// and writes to out where they were. Fake usages journaled at journalPath are
+// removed exactly first, and their entries are dropped. It returns directories
+// of changed files and the number of removed fake usages.
+func purgeFiles(
+	ctx context.Context,
+	paths []string,
+	journalPath string,
+	out file,
+
+	openFile osOpenFile,
+) ([]string, int, error) {
+	const thisName = "purgeFiles"
+
+	entries, err := readJournal(journalPath)
+	if err != nil {
+		return nil, 0, fmt.Errorf("%s: %v", thisName, err)
+	}
+	opts := core.Options{Mode: core.ModeRemove}
+	var dirs []string
+	var n int
+	for _, p := range paths {
+		var taken []journalEntry
+		if abs, err := filepath.Abs(p); err == nil {
+			taken, entries = splitJournal(entries, abs, false)
+		}
+		changes, err := purgeFile(ctx, opts, p, taken, openFile)
+		if err != nil {
+			format := thisName + ": %s: %v"
+			return dirs, n, fmt.Errorf(format, p, err)
+		}
+		if len(changes) == 0 {
+			continue
+		}
+		if _, err := out.Write(formatChanges(p, changes)); err != nil {
+			format := thisName + ": in *File.Write: %v"
+			return dirs, n, fmt.Errorf(format, err)
+		}
+		n += len(changes)
+		if d := filepath.Dir(p); !slices.Contains(dirs, d) {
+			dirs = append(dirs, d)
+		}
+	}
+	if err := writeJournal(journalPath, entries); err != nil {
+		return dirs, n, fmt.Errorf("%s: %v", thisName, err)
+	}
+	return dirs, n, nil
+}
+
+// purgeFile removes fake usages of entries and then the rest of them from the
+// file at p with opts and returns the changes which removed them.
+func purgeFile(
+	ctx context.Context,
+	opts core.Options,
+	p string,
+	entries []journalEntry,
+
+	openFile osOpenFile,
+) ([]core.Change, error) {
+	const thisName = "purgeFile"
+	f, err := openFile(p, os.O_RDWR, os.ModeExclusive)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", thisName, err)
+	}
+	defer f.Close()
+	read, err := io.ReadAll(f)
+	if err != nil {
+		return nil, fmt.Errorf(thisName+": in io.ReadAll: %v", err)
+	}
+	code, enc, err := decodeCode(read)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", thisName, err)
+	}
+	code, reversed := reverseEntries(code, enc, entries)
+	changes, err := core.FindChanges(ctx, code, opts)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", thisName, err)
+	}
+	if len(reversed) == 0 && len(changes) == 0 {
+		return nil, nil
+	}
+	toggled := encodeCode(core.ApplyChanges(code, changes), enc)
+	if err := writeToggled(f, f, read, toggled); err != nil {
+		return nil, fmt.Errorf("%s: %v", thisName, err)
+	}
+	changes = append(reversed, changes...)
+	sort.SliceStable(changes, func(i, j int) bool {
+		return changes[i].LineNum < changes[j].LineNum
+	})
+	return changes, nil
+}
+
+// buildDirs builds packages in dirs, discarding the results, and returns build
+// errors if there are any. Every package is built in its directory, so dirs
+// may belong to different modules.
+func buildDirs(ctx context.Context, dirs []string) error {
+	for _, d := range dirs {
+		cmd := exec.CommandContext(ctx, "go", "build", "-o", os.DevNull)
+		cmd.Dir = d
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			return fmt.Errorf(
+				"buildDirs: in *Cmd.CombinedOutput: %v: %s",
+				err, bytes.TrimSpace(out),
+			)
+		}
+	}
+	return nil
+}
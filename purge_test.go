@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestPurgeFiles(t *testing.T) {
+	ctx := context.Background()
+	ctx, cancel := context.WithCancel(ctx)
+	t.Cleanup(cancel)
+	dir := t.TempDir()
+	files := map[string]string{
+		"go.mod": "module m\n",
+		"a/a.go": `package a
+
+func A() int {
+	used := 1; _ = used /* TODO: gouse */
+	return used
+}
+`,
+		"b/b.go": `package b
+
+func B() {
+	notUsed := 1; _ = notUsed /* TODO: gouse */
+}
+`,
+		"c/c.go": "package c\n",
+	}
+	for name, code := range files {
+		p := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(code), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	a := filepath.Join(dir, "a", "a.go")
+	b := filepath.Join(dir, "b", "b.go")
+	c := filepath.Join(dir, "c", "c.go")
+	out := newFakeFile()
+	journalPath := filepath.Join(dir, "journal.jsonl")
+	dirs, n, err := purgeFiles(
+		ctx, []string{a, b, c}, journalPath, out, openFile,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("got: %d, want: %d", n, 2)
+	}
+	wantDirs := []string{filepath.Dir(a), filepath.Dir(b)}
+	if !slices.Equal(dirs, wantDirs) {
+		t.Errorf("got: %v, want: %v", dirs, wantDirs)
+	}
+	want := a + ":4: remove fake usage of used\n" +
+		b + ":4: remove fake usage of notUsed\n"
+	if got := out.contents.String(); got != want {
+		t.Errorf(filesCmpErr, got, want)
+	}
+	got, err := os.ReadFile(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantA := "package a\n\nfunc A() int {\n\tused := 1\n\treturn used\n}\n"
+	if string(got) != wantA {
+		t.Errorf(filesCmpErr, got, wantA)
+	}
+
+	if err := buildDirs(ctx, dirs[:1]); err != nil {
+		t.Errorf("got: %v, want: nil", err)
+	}
+	// The variable of the removed fake usage is unused again.
+	if err := buildDirs(ctx, dirs); err == nil {
+		t.Error("got: nil, want: error")
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/looshch/gouse/internal/core"
+)
+
+// rcsFile takes code from in and writes to out an RCS diff, the format of
+// ‘diff -n’, of changes toggle would make with opts. Editors, e.g. Emacs with
+// go-mode, apply it to a buffer in place. If filter isn’t nil, only changes it
+// returns are written. It returns the written changes.
+func rcsFile(
+	ctx context.Context,
+	opts core.Options,
+	in, out file,
+	filter changesFilter,
+) ([]core.Change, error) {
+	code, err := io.ReadAll(in)
+	if err != nil {
+		return nil, fmt.Errorf("rcsFile: in io.ReadAll: %v", err)
+	}
+	changes, err := core.FindChanges(ctx, code, opts)
+	if err != nil {
+		return nil, fmt.Errorf("rcsFile: %v", err)
+	}
+	if filter != nil {
+		changes, err = filter(code, changes)
+		if err != nil {
+			return nil, fmt.Errorf("rcsFile: %v", err)
+		}
+	}
+	if _, err := out.Write(rcsDiff(code, changes)); err != nil {
+		return nil, fmt.Errorf("rcsFile: in *File.Write: %v", err)
+	}
+	return changes, nil
+}
+
+// rcsHunk is a range of whole lines of code, code[start:end], touched by
+// changes.
+type rcsHunk struct {
+	start, end int
+	changes    []core.Change
+}
+
+// rcsDiff returns an RCS diff of code and code with changes applied. Lines
+// touched by changes are deleted with ‘dL N’ commands and added back changed
+// with ‘aL N’ ones, where L is a line number in code.
+func rcsDiff(code []byte, changes []core.Change) []byte {
+	var b bytes.Buffer
+	for _, h := range rcsHunks(code, changes) {
+		// +1 is an adjustment for 1-based count.
+		first := bytes.Count(code[:h.start], []byte("\n")) + 1
+		deleted := countLines(code[h.start:h.end])
+		if deleted > 0 {
+			fmt.Fprintf(&b, "d%d %d\n", first, deleted)
+		}
+		text := h.apply(code)
+		if added := countLines(text); added > 0 {
+			// Lines are added after the last deleted one.
+			fmt.Fprintf(&b, "a%d %d\n", first-1+deleted, added)
+			b.Write(text)
+		}
+	}
+	return b.Bytes()
+}
+
+// rcsHunks returns ranges of whole lines of code touched by changes, sorted
+// and with adjacent ones merged.
+func rcsHunks(code []byte, changes []core.Change) []rcsHunk {
+	sorted := make([]core.Change, len(changes))
+	copy(sorted, changes)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Start < sorted[j].Start
+	})
+	var hunks []rcsHunk
+	for _, c := range sorted {
+		start := bytes.LastIndexByte(code[:c.Start], '\n') + 1
+		end := len(code)
+		if i := bytes.IndexByte(code[c.End:], '\n'); i >= 0 {
+			end = c.End + i + 1
+		}
+		// Whole lines inserted or deleted don’t touch the next one.
+		atLineStart := c.End == 0 || code[c.End-1] == '\n'
+		wholeLines := strings.HasSuffix(c.Text, "\n") ||
+			c.Text == "" && start == c.Start
+		if atLineStart && wholeLines {
+			end = c.End
+		}
+		// Adjacent hunks are merged, so lines are added once after
+		// each line.
+		if n := len(hunks); n > 0 && start <= hunks[n-1].end {
+			h := &hunks[n-1]
+			h.end = max(h.end, end)
+			h.changes = append(h.changes, c)
+			continue
+		}
+		hunks = append(hunks, rcsHunk{
+			start: start, end: end, changes: []core.Change{c},
+		})
+	}
+	return hunks
+}
+
+// apply returns the lines of h in code with the changes of h applied.
+func (h rcsHunk) apply(code []byte) []byte {
+	// Changes are applied to the lines of the hunk alone.
+	shifted := make([]core.Change, len(h.changes))
+	for i, c := range h.changes {
+		c.Start -= h.start
+		c.End -= h.start
+		shifted[i] = c
+	}
+	return core.ApplyChanges(code[h.start:h.end], shifted)
+}
+
+// countLines returns the number of lines in b, counting the last one even if
+// it has no line break.
+func countLines(b []byte) int {
+	n := bytes.Count(b, []byte("\n"))
+	if len(b) > 0 && b[len(b)-1] != '\n' {
+		n++
+	}
+	return n
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/looshch/gouse/internal/core"
+)
+
+func TestRCSDiff(t *testing.T) {
+	t.Parallel()
+	const code = "package p\n\nfunc f() {\n\ta := 0\n\tb := 0\n}\n"
+	// offset returns the offset of the end of the line with the 1-based
+	// number n in code.
+	offset := func(n int) int {
+		var o int
+		for range n {
+			o += bytes.IndexByte([]byte(code[o:]), '\n') + 1
+		}
+		return o - 1
+	}
+	// insert returns a change which inserts text at the offset o.
+	insert := func(o int, text string) core.Change {
+		return core.Change{Start: o, End: o, Text: text}
+	}
+	tests := []struct {
+		name    string
+		changes []core.Change
+		want    string
+	}{
+		{
+			"no changes",
+			nil,
+			"",
+		},
+		{
+			"insertions at line ends",
+			[]core.Change{
+				insert(offset(4), "; _ = a"),
+				insert(offset(5), "; _ = b"),
+			},
+			"d4 2\na5 2\n\ta := 0; _ = a\n\tb := 0; _ = b\n",
+		},
+		{
+			"insertion of a line",
+			[]core.Change{insert(offset(5)+1, "\t_, _ = a, b\n")},
+			"a5 1\n\t_, _ = a, b\n",
+		},
+		{
+			"deletion of a line",
+			[]core.Change{
+				{Start: offset(3) + 1, End: offset(4) + 1},
+			},
+			"d4 1\n",
+		},
+		{
+			"changes in one line",
+			[]core.Change{
+				insert(offset(4)-5, "x"),
+				insert(offset(4), "; _ = a"),
+			},
+			"d4 1\na4 1\n\tax := 0; _ = a\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got := rcsDiff([]byte(code), tt.changes)
+			if string(got) != tt.want {
+				t.Errorf(filesCmpErr, got, tt.want)
+			}
+			patched, err := applyRCS([]byte(code), got)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := core.ApplyChanges([]byte(code), tt.changes)
+			if !bytes.Equal(patched, want) {
+				t.Errorf(filesCmpErr, patched, want)
+			}
+		})
+	}
+}
+
+// applyRCS returns code patched with the RCS diff, as editors do.
+func applyRCS(code, diff []byte) ([]byte, error) {
+	lines := bytes.SplitAfter(code, []byte("\n"))
+	commands := bytes.SplitAfter(diff, []byte("\n"))
+	var b bytes.Buffer
+	// next is the 0-based number of the next line of code to copy.
+	var next int
+	for i := 0; i < len(commands) && len(commands[i]) > 0; i++ {
+		var op byte
+		var l, n int
+		command := string(commands[i])
+		_, err := fmt.Sscanf(command, "%c%d %d", &op, &l, &n)
+		if err != nil {
+			return nil, err
+		}
+		switch op {
+		case 'd':
+			for ; next < l-1; next++ {
+				b.Write(lines[next])
+			}
+			next += n
+		case 'a':
+			for ; next < l; next++ {
+				b.Write(lines[next])
+			}
+			for range n {
+				i++
+				b.Write(commands[i])
+			}
+		}
+	}
+	for ; next < len(lines); next++ {
+		b.Write(lines[next])
+	}
+	return b.Bytes(), nil
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+
+	"github.com/looshch/gouse/internal/core"
+)
+
+// rdjsonSource names gouse in reviewdog diagnostics.
+var rdjsonSource = rdjsonSourceName{Name: "gouse", URL: "https://" + modulePath}
+
+// rdjsonDiagnostics returns reviewdog diagnostics of changes to code of the
+// file name, each with a suggestion making the change, so reviewdog posts
+// them as review suggestions.
+func rdjsonDiagnostics(
+	name string, code []byte, changes []core.Change,
+) []rdjsonDiagnostic {
+	p := filepath.ToSlash(name)
+	diagnostics := make([]rdjsonDiagnostic, len(changes))
+	for i, c := range changes {
+		rule, text := describeChange(c)
+		r := rdjsonRange{
+			Start: rdjsonPositionOf(code, c.Start),
+			End:   rdjsonPositionOf(code, c.End),
+		}
+		diagnostics[i] = rdjsonDiagnostic{
+			Message: text,
+			Location: rdjsonLocation{
+				Path:  p,
+				Range: r,
+			},
+			Severity: "WARNING",
+			Source:   rdjsonSource,
+			Code:     rdjsonCode{Value: rule},
+			Suggestions: []rdjsonSuggestion{
+				{Range: r, Text: c.Text},
+			},
+		}
+	}
+	return diagnostics
+}
+
+// rdjsonPositionOf returns the position of the offset in code.
+func rdjsonPositionOf(code []byte, offset int) rdjsonPosition {
+	lineStart := bytes.LastIndexByte(code[:offset], '\n')
+	// +1 is an adjustment for 1-based count; lineStart is the index of the
+	// previous line break, so the column is already 1-based.
+	return rdjsonPosition{
+		Line:   bytes.Count(code[:offset], []byte("\n")) + 1,
+		Column: offset - lineStart,
+	}
+}
+
+// rdjsonlEdits returns an editsReporter which writes to out a reviewdog
+// diagnostic per line, the rdjsonl format.
+func rdjsonlEdits(out file) editsReporter {
+	return func(name string, code []byte, changes []core.Change) error {
+		enc := json.NewEncoder(out)
+		for _, d := range rdjsonDiagnostics(name, code, changes) {
+			if err := enc.Encode(d); err != nil {
+				format := "rdjsonlEdits: in *Encoder.Encode: %v"
+				return fmt.Errorf(format, err)
+			}
+		}
+		return nil
+	}
+}
+
+// rdjsonReport collects diagnostics of files into a reviewdog diagnostic
+// result, the rdjson format.
+type rdjsonReport struct {
+	diagnostics []rdjsonDiagnostic
+}
+
+// add is an editsReporter which adds diagnostics of changes to code of the
+// file name.
+func (r *rdjsonReport) add(
+	name string, code []byte, changes []core.Change,
+) error {
+	d := rdjsonDiagnostics(name, code, changes)
+	r.diagnostics = append(r.diagnostics, d...)
+	return nil
+}
+
+// write writes the result of r to out.
+func (r *rdjsonReport) write(out file) error {
+	result := rdjsonResult{
+		Source:      rdjsonSource,
+		Severity:    "WARNING",
+		Diagnostics: r.diagnostics,
+	}
+	if result.Diagnostics == nil {
+		result.Diagnostics = []rdjsonDiagnostic{}
+	}
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(result); err != nil {
+		format := "*rdjsonReport.write: in *Encoder.Encode: %v"
+		return fmt.Errorf(format, err)
+	}
+	return nil
+}
+
+// The types below are the subset of reviewdog diagnostic format gouse writes.
+
+type rdjsonResult struct {
+	Source      rdjsonSourceName   `json:"source"`
+	Severity    string             `json:"severity"`
+	Diagnostics []rdjsonDiagnostic `json:"diagnostics"`
+}
+
+type rdjsonDiagnostic struct {
+	Message     string             `json:"message"`
+	Location    rdjsonLocation     `json:"location"`
+	Severity    string             `json:"severity"`
+	Source      rdjsonSourceName   `json:"source"`
+	Code        rdjsonCode         `json:"code"`
+	Suggestions []rdjsonSuggestion `json:"suggestions"`
+}
+
+type rdjsonSourceName struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+}
+
+type rdjsonCode struct {
+	Value string `json:"value"`
+}
+
+type rdjsonLocation struct {
+	Path  string      `json:"path"`
+	Range rdjsonRange `json:"range"`
+}
+
+// rdjsonRange is a range of code, its end is exclusive.
+type rdjsonRange struct {
+	Start rdjsonPosition `json:"start"`
+	End   rdjsonPosition `json:"end"`
+}
+
+// rdjsonPosition is a 1-based line and a 1-based column in bytes.
+type rdjsonPosition struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+type rdjsonSuggestion struct {
+	Range rdjsonRange `json:"range"`
+	Text  string      `json:"text"`
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestRDJSONDiagnostics(t *testing.T) {
+	t.Parallel()
+	const code = "package p\n\nfunc f() {\n" +
+		"\ta := 0; _ = a /* TODO: gouse */\n}\n"
+	out := newFakeFile()
+	_, err := listFiles(
+		[]string{"-"}, "", lineTerminator, rdjsonlEdits(out),
+		newFakeFile([]byte(code)...), nil,
+		openFile,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got rdjsonDiagnostic
+	if err := json.Unmarshal(out.contents.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	want := rdjsonRange{
+		Start: rdjsonPosition{Line: 4, Column: 8},
+		End:   rdjsonPosition{Line: 4, Column: 33},
+	}
+	if got.Code.Value != ruleFakeUsage ||
+		got.Location.Path != stdinName ||
+		got.Location.Range != want ||
+		len(got.Suggestions) != 1 ||
+		got.Suggestions[0].Range != want ||
+		got.Suggestions[0].Text != "" {
+		t.Errorf("got: %+v, want: a removal in %+v", got, want)
+	}
+}
+
+func TestRDJSONPositionOf(t *testing.T) {
+	t.Parallel()
+	const code = "ab\ncd\n"
+	tests := []struct {
+		offset int
+		want   rdjsonPosition
+	}{
+		{0, rdjsonPosition{1, 1}},
+		{2, rdjsonPosition{1, 3}},
+		{3, rdjsonPosition{2, 1}},
+		{6, rdjsonPosition{3, 1}},
+	}
+	for _, tt := range tests {
+		got := rdjsonPositionOf([]byte(code), tt.offset)
+		if got != tt.want {
+			t.Errorf("got: %+v, want: %+v", got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+
+	"github.com/looshch/gouse/gousepb"
+	"github.com/looshch/gouse/internal/core"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// remoteModes maps modes to modes of requests. Toggling, the default one,
+// isn’t sent, so the server toggles with its own mode.
+var remoteModes = map[core.Mode]gousepb.Mode{
+	core.ModeAdd:    gousepb.Mode_MODE_ADD,
+	core.ModeRemove: gousepb.Mode_MODE_REMOVE,
+}
+
+// remote finds changes on a server of ‘-grpc’ flag, e.g. in a dev container
+// which has the toolchain and the module cache code needs to build, see
+// ‘-remote’ flag. The changes are applied locally like any others.
+type remote struct {
+	client gousepb.GouseClient
+}
+
+// dialRemote returns a remote of the server on the address and the connection
+// to close when it’s no longer needed. The connection is made on the first
+// request, without TLS, like ‘-grpc’ flag serves, so the server must be a
+// trusted one on the machine or a private network.
+func dialRemote(addr string) (*remote, io.Closer, error) {
+	conn, err := grpc.NewClient(
+		addr, grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		format := "dialRemote: in grpc.NewClient: %v"
+		return nil, nil, fmt.Errorf(format, err)
+	}
+	return &remote{client: gousepb.NewGouseClient(conn)}, conn, nil
+}
+
+// FindChanges streams code and its siblings to the server and returns the
+// changes it finds with the strategy and placement of opts and its mode unless
+// it’s the default one, see remoteModes. Other options are the flags of the
+// server.
+func (r *remote) FindChanges(
+	ctx context.Context, code []byte, opts core.Options,
+) ([]core.Change, error) {
+	const thisName = "*remote.FindChanges"
+
+	stream, err := r.client.Toggle(ctx)
+	if err != nil {
+		format := "%s: in GouseClient.Toggle: %v"
+		return nil, fmt.Errorf(format, thisName, err)
+	}
+	o := &gousepb.Options{
+		Mode:      remoteModes[opts.Mode],
+		Strategy:  opts.Strategy.String(),
+		Placement: opts.Placement.String(),
+		Siblings:  opts.Siblings,
+	}
+	// The first chunk is sent even if there is no source, as it has the
+	// options.
+	for i := 0; i == 0 || i < len(code); i += grpcChunkSize {
+		chunk := &gousepb.SourceChunk{
+			Data: code[i:min(i+grpcChunkSize, len(code))],
+		}
+		if i == 0 {
+			chunk.Options = o
+		}
+		if err := stream.Send(chunk); err != nil {
+			format := "%s: in Gouse_ToggleClient.Send: %v"
+			return nil, fmt.Errorf(format, thisName, err)
+		}
+	}
+	if err := stream.CloseSend(); err != nil {
+		format := "%s: in Gouse_ToggleClient.CloseSend: %v"
+		return nil, fmt.Errorf(format, thisName, err)
+	}
+	// Only the first chunk has edits, and the result is made of them
+	// locally.
+	first, err := stream.Recv()
+	if err != nil {
+		format := "%s: in Gouse_ToggleClient.Recv: %v"
+		return nil, fmt.Errorf(format, thisName, err)
+	}
+	for {
+		if _, err := stream.Recv(); err == io.EOF {
+			break
+		} else if err != nil {
+			format := "%s: in Gouse_ToggleClient.Recv: %v"
+			return nil, fmt.Errorf(format, thisName, err)
+		}
+	}
+	changes := make([]core.Change, len(first.GetEdits()))
+	for i, e := range first.GetEdits() {
+		start, end := int(e.GetStart()), int(e.GetEnd())
+		if start < 0 || start > end || end > len(code) {
+			format := "%s: edit of %s out of the source: %d:%d"
+			return nil, fmt.Errorf(
+				format, thisName, e.GetName(), start, end,
+			)
+		}
+		changes[i] = core.Change{
+			Action: core.Action(e.GetAction()),
+			Name:   e.GetName(),
+			// -1 is an adjustment for 0-based count.
+			LineNum: int(e.GetLine()) - 1,
+			Start:   start,
+			End:     end,
+			Text:    e.GetText(),
+		}
+	}
+	if c, ok := overlapping(changes); ok {
+		format := "%s: edit of %s overlaps another one: %d:%d"
+		return nil, fmt.Errorf(format, thisName, c.Name, c.Start, c.End)
+	}
+	return changes, nil
+}
+
+// overlapping returns a change which starts before the end of the previous one
+// in the order core.ApplyChanges applies changes in, if any.
+func overlapping(changes []core.Change) (core.Change, bool) {
+	sorted := slices.Clone(changes)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Start < sorted[j].Start
+	})
+	for i := 1; i < len(sorted); i++ {
+		if sorted[i].Start < sorted[i-1].End {
+			return sorted[i], true
+		}
+	}
+	return core.Change{}, false
+}
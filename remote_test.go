@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/looshch/gouse/internal/core"
+)
+
+func TestRemoteFindChanges(t *testing.T) {
+	t.Parallel()
+	const added = "package p\n\nfunc f() {\n" +
+		"\ta := g(); _ = a /* TODO: gouse */\n}\n"
+	const removed = "package p\n\nfunc f() {\n\ta := g()\n}\n"
+	siblings := map[string][]byte{
+		"g.go": []byte("package p\n\nfunc g() int { return 0 }\n"),
+	}
+	// Over grpcChunkSize, so the source is streamed in several chunks.
+	padding := "\n" + strings.Repeat("// padding\n", grpcChunkSize/8)
+	tests := []struct {
+		name string
+		code string
+		opts core.Options
+		// addServer makes the request to a server which only adds fake
+		// usages.
+		addServer bool
+		want      string
+		wantErr   bool
+	}{
+		{
+			name: "add with siblings",
+			code: removed,
+			opts: core.Options{Siblings: siblings},
+			want: added,
+		},
+		{
+			name: "add with broken siblings",
+			code: removed,
+			opts: core.Options{Siblings: map[string][]byte{
+				"g.go": []byte("package p\n\nfunc g() int {\n"),
+			}},
+			// The package doesn’t parse, so it isn’t type-checked.
+			want: removed,
+		},
+		{
+			name: "remove",
+			code: added,
+			opts: core.Options{Mode: core.ModeRemove},
+			want: removed,
+		},
+		{
+			name: "add nothing",
+			code: added,
+			opts: core.Options{
+				Mode: core.ModeAdd, Siblings: siblings,
+			},
+			want: added,
+		},
+		{
+			name:      "mode of the server",
+			code:      added,
+			addServer: true,
+			want:      added,
+		},
+		{
+			name: "remove on an add server",
+			code: added,
+			opts: core.Options{Mode: core.ModeRemove},
+			// The mode of the request overrides the one of the
+			// server.
+			addServer: true,
+			want:      removed,
+		},
+		{
+			name: "large source",
+			code: added + padding,
+			want: removed + padding,
+		},
+		{
+			name:    "unknown strategy",
+			code:    added,
+			opts:    core.Options{Strategy: "flip"},
+			wantErr: true,
+		},
+	}
+	r := &remote{client: newGRPCClient(t, &grpcServer{})}
+	addRemote := &remote{client: newGRPCClient(t, &grpcServer{
+		opts: core.Options{Mode: core.ModeAdd},
+	})}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			r := r
+			if tt.addServer {
+				r = addRemote
+			}
+			code := []byte(tt.code)
+			changes, err := r.FindChanges(
+				context.Background(), code, tt.opts,
+			)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf(
+					"got: %v, want error: %t",
+					err, tt.wantErr,
+				)
+			}
+			if err != nil {
+				return
+			}
+			got := string(core.ApplyChanges(code, changes))
+			if got != tt.want {
+				t.Errorf(filesCmpErr, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOverlapping(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name    string
+		changes []core.Change
+		want    bool
+	}{
+		{"none", nil, false},
+		{
+			"adjacent",
+			[]core.Change{
+				{Name: "b", Start: 4, End: 6},
+				{Name: "a", Start: 0, End: 4},
+				{Name: "c", Start: 6, End: 6},
+			},
+			false,
+		},
+		{
+			"overlapping",
+			[]core.Change{
+				{Name: "a", Start: 0, End: 4},
+				{Name: "b", Start: 2, End: 6},
+			},
+			true,
+		},
+	}
+	for _, tt := range tests {
+		if _, got := overlapping(tt.changes); got != tt.want {
+			t.Errorf("%s: got: %t, want: %t", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/looshch/gouse/internal/core"
+)
+
+// packageReport is what a package, a directory of Go files, accumulates:
+// unused variables, fake usages and files with any of them.
+type packageReport struct {
+	dir        string
+	unused     int
+	fakeUsages int
+	files      []string
+}
+
+// reportPackages returns reports of packages of files in paths, sorted by the
+// number of unused variables and fake usages, the greatest first. Packages
+// with neither are left out.
+func reportPackages(
+	ctx context.Context,
+	paths []string,
+
+	openFile osOpenFile,
+) ([]packageReport, error) {
+	const thisName = "reportPackages"
+
+	byDir := make(map[string]*packageReport)
+	for _, p := range paths {
+		f, err := openFile(p, os.O_RDONLY, os.ModeExclusive)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s: %v", thisName, p, err)
+		}
+		code, err := io.ReadAll(f)
+		f.Close()
+		if err != nil {
+			format := thisName + ": %s: in io.ReadAll: %v"
+			return nil, fmt.Errorf(format, p, err)
+		}
+		fakeUsages := len(core.FindMarkers(code))
+		// Variables with fake usages are used, so only the other
+		// ones are found.
+		opts := core.Options{Mode: core.ModeAdd}
+		unused, err := core.FindChanges(ctx, code, opts)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s: %v", thisName, p, err)
+		}
+		if fakeUsages == 0 && len(unused) == 0 {
+			continue
+		}
+		dir := filepath.Dir(p)
+		r, ok := byDir[dir]
+		if !ok {
+			r = &packageReport{dir: dir}
+			byDir[dir] = r
+		}
+		r.unused += len(unused)
+		r.fakeUsages += fakeUsages
+		r.files = append(r.files, filepath.Base(p))
+	}
+	reports := make([]packageReport, 0, len(byDir))
+	for _, r := range byDir {
+		reports = append(reports, *r)
+	}
+	sort.Slice(reports, func(i, j int) bool {
+		ri, rj := reports[i], reports[j]
+		ni, nj := ri.unused+ri.fakeUsages, rj.unused+rj.fakeUsages
+		if ni != nj {
+			return ni > nj
+		}
+		return ri.dir < rj.dir
+	})
+	return reports, nil
+}
+
+// writePackageReports writes reports to out as a table with a row per
+// package and a total.
+func writePackageReports(reports []packageReport, out file) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprint(w, "package\tunused\tfake usages\tfiles\n")
+	var unused, fakeUsages int
+	for _, r := range reports {
+		fmt.Fprintf(
+			w, "%s\t%d\t%d\t%s\n",
+			r.dir, r.unused, r.fakeUsages,
+			strings.Join(r.files, ", "),
+		)
+		unused += r.unused
+		fakeUsages += r.fakeUsages
+	}
+	fmt.Fprintf(w, "total\t%d\t%d\n", unused, fakeUsages)
+	if err := w.Flush(); err != nil {
+		format := "writePackageReports: in *Writer.Flush: %v"
+		return fmt.Errorf(format, err)
+	}
+	return nil
+}
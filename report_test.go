@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReportPackages(t *testing.T) {
+	ctx := context.Background()
+	ctx, cancel := context.WithCancel(ctx)
+	t.Cleanup(cancel)
+	inputs := make(map[string][]byte)
+	for _, name := range []string{"used", "not_used"} {
+		p := filepath.Join("testdata", name+".input")
+		input, err := os.ReadFile(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		inputs[name] = input
+	}
+	var openInput osOpenFile = func(
+		name string, flag int, perm os.FileMode,
+	) (file, error) {
+		switch filepath.Base(name) {
+		case "used.go":
+			return newFakeFile(inputs["used"]...), nil
+		case "not_used.go":
+			return newFakeFile(inputs["not_used"]...), nil
+		}
+		return newFakeFile([]byte("package p\n")...), nil
+	}
+	paths := []string{
+		"a/used.go", "a/clean.go", "b/used.go", "b/not_used.go",
+		"c/clean.go",
+	}
+	reports, err := reportPackages(ctx, paths, openInput)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := newFakeFile()
+	if err := writePackageReports(reports, out); err != nil {
+		t.Fatal(err)
+	}
+	const want = "package  unused  fake usages  files\n" +
+		"b        2       2            used.go, not_used.go\n" +
+		"a        0       2            used.go\n" +
+		"total    2       4\n"
+	if got := out.contents.String(); got != want {
+		t.Errorf(filesCmpErr, got, want)
+	}
+}
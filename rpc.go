@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/looshch/gouse/internal/core"
+)
+
+// Methods of ‘-rpc’ flag.
+const (
+	// rpcToggle toggles code like the toggle command.
+	rpcToggle = "toggle"
+	// rpcCheck lists fake usages in code like the check command.
+	rpcCheck = "check"
+	// rpcRemoveAll removes all fake usages from code like the remove
+	// command.
+	rpcRemoveAll = "removeAll"
+)
+
+// rpcParams are parameters of every method.
+type rpcParams struct {
+	Code string `json:"code"`
+	// Path is the file code is from, if any. .editorconfig files are
+	// looked up by it with ‘-placement function’.
+	Path string `json:"path,omitempty"`
+}
+
+// rpcCodeResult is the result of rpcToggle and rpcRemoveAll.
+type rpcCodeResult struct {
+	Code string `json:"code"`
+	// Changed is the number of fake usages created or removed.
+	Changed int `json:"changed"`
+}
+
+// rpcFakeUsage is a fake usage listed by rpcCheck.
+type rpcFakeUsage struct {
+	// Line is 1-based.
+	Line int    `json:"line"`
+	Name string `json:"name"`
+}
+
+// serveRPC serves JSON-RPC 2.0 requests read from in, one per line, with
+// responses written to out the same way, until in ends or ctx is done. Code is
+// toggled with opts. The messages are the ones of serveLSP without headers.
+func serveRPC(
+	ctx context.Context, opts core.Options, in io.Reader, out io.Writer,
+) error {
+	const thisName = "serveRPC"
+
+	dec := json.NewDecoder(in)
+	enc := json.NewEncoder(out)
+	for ctx.Err() == nil {
+		var req lspRequest
+		err := dec.Decode(&req)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			format := thisName + ": in *Decoder.Decode: %v"
+			return fmt.Errorf(format, err)
+		}
+		result, rerr := callRPC(ctx, opts, req)
+		// Notifications aren’t answered.
+		if req.ID == nil {
+			continue
+		}
+		resp := lspResponse{JSONRPC: "2.0", ID: req.ID, Error: rerr}
+		if rerr == nil {
+			resp.Result, err = json.Marshal(result)
+			if err != nil {
+				format := thisName + ": in json.Marshal: %v"
+				return fmt.Errorf(format, err)
+			}
+		}
+		if err := enc.Encode(resp); err != nil {
+			format := thisName + ": in *Encoder.Encode: %v"
+			return fmt.Errorf(format, err)
+		}
+	}
+	return nil
+}
+
+// callRPC returns the result of the method of req.
+func callRPC(
+	ctx context.Context, opts core.Options, req lspRequest,
+) (any, *lspError) {
+	switch req.Method {
+	case rpcToggle, rpcCheck, rpcRemoveAll:
+	default:
+		message := "unknown method " + req.Method
+		return nil, &lspError{lspMethodNotFound, message}
+	}
+	var params rpcParams
+	if err := json.Unmarshal(req.Params, &params); err != nil {
+		return nil, &lspError{lspInvalidParams, err.Error()}
+	}
+	code := []byte(params.Code)
+	if req.Method == rpcCheck {
+		usages := []rpcFakeUsage{}
+		for _, c := range core.FindMarkers(code) {
+			// +1 is an adjustment for 1-based count.
+			usage := rpcFakeUsage{c.LineNum + 1, c.Name}
+			usages = append(usages, usage)
+		}
+		return usages, nil
+	}
+	if req.Method == rpcRemoveAll {
+		opts.Mode = core.ModeRemove
+	}
+	if params.Path != "" && opts.Placement == core.PlacementFunction {
+		style, err := core.EditorStyleFor(params.Path)
+		if err != nil {
+			return nil, &lspError{lspRequestFailed, err.Error()}
+		}
+		opts.Style = style
+	}
+	changes, err := core.FindChanges(ctx, code, opts)
+	if err != nil {
+		return nil, &lspError{lspRequestFailed, err.Error()}
+	}
+	return rpcCodeResult{
+		Code:    string(core.ApplyChanges(code, changes)),
+		Changed: len(changes),
+	}, nil
+}
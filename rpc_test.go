@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/looshch/gouse/internal/core"
+)
+
+func TestServeRPC(t *testing.T) {
+	t.Parallel()
+	const added = "package p\n\nfunc f() {\n" +
+		"\ta := 0; _ = a /* TODO: gouse */\n}\n"
+	const removed = "package p\n\nfunc f() {\n\ta := 0\n}\n"
+	params, err := json.Marshal(rpcParams{Code: added})
+	if err != nil {
+		t.Fatal(err)
+	}
+	in := strings.Join([]string{
+		`{"jsonrpc":"2.0","id":1,"method":"check","params":` +
+			string(params) + `}`,
+		`{"jsonrpc":"2.0","id":2,"method":"removeAll","params":` +
+			string(params) + `}`,
+		// Notifications aren’t answered.
+		`{"jsonrpc":"2.0","method":"toggle","params":` +
+			string(params) + `}`,
+		`{"jsonrpc":"2.0","id":"3","method":"unknown"}`,
+	}, "\n")
+	var out bytes.Buffer
+	err = serveRPC(
+		context.Background(), core.Options{},
+		strings.NewReader(in), &out,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var responses []lspResponse
+	dec := json.NewDecoder(&out)
+	for dec.More() {
+		var resp lspResponse
+		if err := dec.Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		responses = append(responses, resp)
+	}
+	if len(responses) != 3 {
+		t.Fatalf("got: %d responses, want: 3", len(responses))
+	}
+
+	var usages []rpcFakeUsage
+	if err := json.Unmarshal(responses[0].Result, &usages); err != nil {
+		t.Fatal(err)
+	}
+	if want := (rpcFakeUsage{4, "a"}); len(usages) != 1 ||
+		usages[0] != want {
+		t.Errorf("got: %+v, want: %+v", usages, want)
+	}
+
+	var result rpcCodeResult
+	if err := json.Unmarshal(responses[1].Result, &result); err != nil {
+		t.Fatal(err)
+	}
+	if want := (rpcCodeResult{removed, 1}); result != want {
+		t.Errorf("got: %+v, want: %+v", result, want)
+	}
+
+	if string(responses[2].ID) != `"3"` || responses[2].Error == nil ||
+		responses[2].Error.Code != lspMethodNotFound {
+		t.Errorf("got: %+v, want: method not found", responses[2])
+	}
+}
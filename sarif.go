@@ -0,0 +1,217 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+
+	"github.com/looshch/gouse/internal/core"
+)
+
+const (
+	sarifVersion = "2.1.0"
+	sarifSchema  = "https://json.schemastore.org/sarif-2.1.0.json"
+
+	// ruleUnusedVariable reports a variable a fake usage would be created
+	// for.
+	ruleUnusedVariable = "unused-variable"
+	// ruleFakeUsage reports a fake usage left in code.
+	ruleFakeUsage = "fake-usage"
+)
+
+// describeChange returns the rule c is reported under and a message about it.
+// Unused variables are described like the compiler does.
+func describeChange(c core.Change) (string, string) {
+	switch {
+	case c.Action == core.ActionRemove:
+		return ruleFakeUsage, c.Summary()
+	case c.Kind == core.KindVar:
+		return ruleUnusedVariable, "declared and not used: " + c.Name
+	}
+	return ruleUnusedVariable, c.Problem()
+}
+
+// fixTitle returns the title of the fix which makes c, the same as of the
+// suggested fix of the gouse analyzer, so editors show the same quick fixes
+// whichever way they get them.
+func fixTitle(c core.Change) string {
+	if c.Action == core.ActionAdd {
+		return "Create " + c.Summary()
+	}
+	return "Remove " + c.Summary()
+}
+
+// sarifReport collects results of files into a SARIF 2.1.0 log which code
+// scanning dashboards, e.g. of GitHub, ingest. Every result has a fix which
+// makes the edit toggle would make.
+type sarifReport struct {
+	results []sarifResult
+}
+
+// sarifRules are rules results of sarifReport refer to.
+var sarifRules = []sarifRule{
+	{
+		ID: ruleUnusedVariable,
+		ShortDescription: sarifMessage{
+			Text: "Declared and not used variable",
+		},
+	},
+	{
+		ID:               ruleFakeUsage,
+		ShortDescription: sarifMessage{Text: "Fake usage left in code"},
+	},
+}
+
+// add is an editsReporter which adds results of changes to code of the file
+// name.
+func (r *sarifReport) add(
+	name string, code []byte, changes []core.Change,
+) error {
+	location := sarifArtifactLocation{URI: filepath.ToSlash(name)}
+	for _, c := range changes {
+		rule, text := describeChange(c)
+		fix := fixTitle(c)
+		offset := c.Start
+		r.results = append(r.results, sarifResult{
+			RuleID:  rule,
+			Level:   "warning",
+			Message: sarifMessage{Text: text},
+			Locations: []sarifLocation{{
+				PhysicalLocation: sarifPhysicalLocation{
+					ArtifactLocation: location,
+					// +1 is an adjustment for 1-based
+					// count.
+					Region: &sarifRegion{
+						StartLine: c.LineNum + 1,
+					},
+				},
+			}},
+			Fixes: []sarifFix{{
+				Description: sarifMessage{Text: fix},
+				ArtifactChanges: []sarifArtifactChange{{
+					ArtifactLocation: location,
+					Replacements: []sarifReplacement{{
+						DeletedRegion: sarifRegion{
+							ByteOffset: &offset,
+							ByteLength: c.End -
+								c.Start,
+						},
+						InsertedContent: &sarifContent{
+							Text: c.Text,
+						},
+					}},
+				}},
+			}},
+		})
+	}
+	return nil
+}
+
+// write writes the log of r to out.
+func (r *sarifReport) write(out file) error {
+	results := r.results
+	// Results are required, so no results are an empty list.
+	if results == nil {
+		results = []sarifResult{}
+	}
+	driver := sarifDriver{
+		Name:           "gouse",
+		Version:        currentVersion,
+		InformationURI: "https://" + modulePath,
+		Rules:          sarifRules,
+	}
+	log := sarifLog{
+		Version: sarifVersion,
+		Schema:  sarifSchema,
+		Runs: []sarifRun{{
+			Tool:    sarifTool{Driver: driver},
+			Results: results,
+		}},
+	}
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(log); err != nil {
+		format := "*sarifReport.write: in *Encoder.Encode: %v"
+		return fmt.Errorf(format, err)
+	}
+	return nil
+}
+
+// The types below are the subset of SARIF 2.1.0 gouse writes.
+
+type sarifLog struct {
+	Version string     `json:"version"`
+	Schema  string     `json:"$schema"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	Version        string      `json:"version"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID               string       `json:"id"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations"`
+	Fixes     []sarifFix      `json:"fixes,omitempty"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           *sarifRegion          `json:"region,omitempty"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+type sarifRegion struct {
+	StartLine  int  `json:"startLine,omitempty"`
+	ByteOffset *int `json:"byteOffset,omitempty"`
+	ByteLength int  `json:"byteLength,omitempty"`
+}
+
+type sarifFix struct {
+	Description     sarifMessage          `json:"description"`
+	ArtifactChanges []sarifArtifactChange `json:"artifactChanges"`
+}
+
+type sarifArtifactChange struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Replacements     []sarifReplacement    `json:"replacements"`
+}
+
+type sarifReplacement struct {
+	DeletedRegion   sarifRegion   `json:"deletedRegion"`
+	InsertedContent *sarifContent `json:"insertedContent,omitempty"`
+}
+
+type sarifContent struct {
+	Text string `json:"text"`
+}
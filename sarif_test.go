@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/looshch/gouse/internal/core"
+)
+
+func TestSARIFReport(t *testing.T) {
+	t.Parallel()
+	const code = "package p\n\nfunc f() {\n" +
+		"\ta := 0; _ = a /* TODO: gouse */\n}\n"
+	var r sarifReport
+	n, err := listFiles(
+		[]string{"-"}, "", lineTerminator, r.add,
+		newFakeFile([]byte(code)...), nil,
+		openFile,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("got: %d, want: %d", n, 1)
+	}
+	added := []core.Change{{
+		Action:  core.ActionAdd,
+		Name:    "b",
+		LineNum: 4,
+		Start:   40,
+		End:     40,
+		Text:    "; _ = b",
+	}}
+	if err := r.add("dir\\b.go", nil, added); err != nil {
+		t.Fatal(err)
+	}
+	out := newFakeFile()
+	if err := r.write(out); err != nil {
+		t.Fatal(err)
+	}
+	var log sarifLog
+	if err := json.Unmarshal(out.contents.Bytes(), &log); err != nil {
+		t.Fatal(err)
+	}
+	if log.Version != sarifVersion || len(log.Runs) != 1 {
+		t.Fatalf("got: %+v, want: one run of %s", log, sarifVersion)
+	}
+	results := log.Runs[0].Results
+	if len(results) != 2 {
+		t.Fatalf("got: %d results, want: 2", len(results))
+	}
+	tests := []struct {
+		rule, uri string
+		line      int
+		offset    int
+		length    int
+		text      string
+	}{
+		{ruleFakeUsage, stdinName, 4, 29, 25, ""},
+		{ruleUnusedVariable, "dir\\b.go", 5, 40, 0, "; _ = b"},
+	}
+	for i, tt := range tests {
+		got := results[i]
+		location := got.Locations[0].PhysicalLocation
+		replacement := got.Fixes[0].ArtifactChanges[0].Replacements[0]
+		deleted := replacement.DeletedRegion
+		if got.RuleID != tt.rule ||
+			location.ArtifactLocation.URI != tt.uri ||
+			location.Region.StartLine != tt.line ||
+			*deleted.ByteOffset != tt.offset ||
+			deleted.ByteLength != tt.length ||
+			replacement.InsertedContent.Text != tt.text {
+			t.Errorf("got: %+v, want: %+v", got, tt)
+		}
+	}
+}
+
+func TestDescribeChange(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		c          core.Change
+		rule, text string
+		fix        string
+	}{
+		{
+			core.Change{Action: core.ActionAdd, Name: "a"},
+			ruleUnusedVariable, "declared and not used: a",
+			"Create fake usage of a",
+		},
+		{
+			core.Change{
+				Action: core.ActionAdd,
+				Kind:   core.KindImport,
+				Name:   "fmt",
+			},
+			ruleUnusedVariable, "unused import fmt",
+			"Create blanked import of fmt",
+		},
+		{
+			core.Change{
+				Action: core.ActionRemove,
+				Kind:   core.KindLabel,
+				Name:   "L",
+			},
+			ruleFakeUsage, "commented out label L",
+			"Remove commented out label L",
+		},
+		{
+			core.Change{
+				Action: core.ActionRemove,
+				Kind:   core.KindResults,
+				Name:   "f",
+			},
+			ruleFakeUsage, "ignored results of f",
+			"Remove ignored results of f",
+		},
+	}
+	for _, tt := range tests {
+		rule, text := describeChange(tt.c)
+		if rule != tt.rule || text != tt.text {
+			t.Errorf(
+				"got: %s, %q, want: %s, %q",
+				rule, text, tt.rule, tt.text,
+			)
+		}
+		if got := fixTitle(tt.c); got != tt.fix {
+			t.Errorf("got: %q, want: %q", got, tt.fix)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/looshch/gouse/internal/core"
+)
+
+// acmeFileEnv is the environment variable Acme and sam set to the name of the
+// file of the window a command runs in.
+const acmeFileEnv = "samfile"
+
+var errSelectionNotInFile = errors.New(
+	"the selection isn’t in the file, save it first",
+)
+
+// toggleSelection reads a selection of the file name from in and writes to out
+// only the selection toggled with opts in the context of the file, applying
+// only changes returned by filter. The selection is looked up in the file as
+// saved, and its first occurrence is taken. With core.ModeToggle, fake usages
+// are removed if the selection has any and created for variables declared in
+// it otherwise. Changes outside the selection, e.g. statements created at the
+// start of a function with core.PlacementFunction, are dropped, so the
+// selection keeps its indentation and what’s around it. It returns the
+// changes.
+func toggleSelection(
+	ctx context.Context,
+	opts core.Options,
+	name string,
+	in, out file,
+	filter changesFilter,
+) ([]core.Change, error) {
+	const thisName = "toggleSelection"
+
+	sel, err := readCode(in)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", thisName, err)
+	}
+	code, err := os.ReadFile(name)
+	if err != nil {
+		return nil, fmt.Errorf("%s: in os.ReadFile: %v", thisName, err)
+	}
+	start := bytes.Index(code, sel)
+	if start < 0 {
+		err := errSelectionNotInFile
+		return nil, fmt.Errorf("%s: %s: %v", thisName, name, err)
+	}
+	end := start + len(sel)
+	if opts.Mode == core.ModeToggle {
+		opts.Mode = core.ModeAdd
+		if len(core.FindMarkers(sel)) > 0 {
+			opts.Mode = core.ModeRemove
+		}
+	}
+	all, err := core.FindChanges(ctx, code, opts)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", thisName, err)
+	}
+	// Changes are moved to be relative to the selection.
+	lines := bytes.Count(code[:start], []byte("\n"))
+	var changes []core.Change
+	for _, c := range all {
+		if c.Start < start || c.End > end {
+			continue
+		}
+		c.Start -= start
+		c.End -= start
+		c.LineNum -= lines
+		changes = append(changes, c)
+	}
+	if filter != nil {
+		changes, err = filter(sel, changes)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", thisName, err)
+		}
+	}
+	if _, err := out.Write(core.ApplyChanges(sel, changes)); err != nil {
+		return nil, fmt.Errorf("%s: in *File.Write: %v", thisName, err)
+	}
+	return changes, nil
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/looshch/gouse/internal/core"
+)
+
+func TestToggleSelection(t *testing.T) {
+	t.Parallel()
+	const code = "package p\n\nfunc f() {\n\ta := 0\n\tb := 1\n}\n"
+	const toggled = "package p\n\nfunc f() {\n" +
+		"\ta := 0; _ = a /* TODO: gouse */\n\tb := 1\n}\n"
+	tests := []struct {
+		name        string
+		code        string
+		selection   string
+		want        string
+		wantChanges int
+		wantErr     bool
+	}{
+		{
+			name:        "add in the selection only",
+			code:        code,
+			selection:   "\tb := 1\n",
+			want:        "\tb := 1; _ = b /* TODO: gouse */\n",
+			wantChanges: 1,
+		},
+		{
+			name:      "add nothing where variables are used",
+			code:      code,
+			selection: "func f() {",
+			want:      "func f() {",
+		},
+		{
+			name:        "remove in the selection only",
+			code:        toggled,
+			selection:   "\ta := 0; _ = a /* TODO: gouse */",
+			want:        "\ta := 0",
+			wantChanges: 1,
+		},
+		{
+			name:      "selection not in the file",
+			code:      code,
+			selection: "\tc := 2\n",
+			wantErr:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			p := filepath.Join(t.TempDir(), "p.go")
+			err := os.WriteFile(p, []byte(tt.code), 0o644)
+			if err != nil {
+				t.Fatal(err)
+			}
+			in := newFakeFile([]byte(tt.selection)...)
+			out := newFakeFile()
+			ctx := context.Background()
+			changes, err := toggleSelection(
+				ctx, core.Options{}, p, in, out, nil,
+			)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf(
+					"got: %v, want error: %t",
+					err, tt.wantErr,
+				)
+			}
+			if got := out.contents.String(); got != tt.want {
+				t.Errorf(filesCmpErr, got, tt.want)
+			}
+			if len(changes) != tt.wantChanges {
+				t.Errorf(
+					"got: %d changes, want: %d",
+					len(changes), tt.wantChanges,
+				)
+			}
+		})
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/looshch/gouse/internal/core"
+)
+
+// serveShutdownTimeout is how long requests in flight are waited for when the
+// server is interrupted.
+const serveShutdownTimeout = 5 * time.Second
+
+// changesHeader is the response header with the number of fake usages created
+// or removed by POST /toggle.
+const changesHeader = "X-Gouse-Changes"
+
+// newHTTPHandler returns the handler of ‘-serve’ flag: POST /toggle toggles
+// source from the body with opts, see toggleHandler, GET /healthz responds
+// with ‘ok’ and GET /metrics serves m, which counts toggles.
+func newHTTPHandler(
+	opts core.Options, maxSize fileSize, m *metrics,
+) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", healthz)
+	mux.Handle("POST /toggle", toggleHandler(opts, maxSize, m))
+	mux.Handle("GET /metrics", m)
+	return mux
+}
+
+// healthz responds with ‘ok’ while the server is up.
+func healthz(w http.ResponseWriter, _ *http.Request) {
+	io.WriteString(w, "ok\n")
+}
+
+// toggleHandler responds with source from the body toggled with opts, which
+// ‘mode’, ‘strategy’ and ‘placement’ query parameters override, and the number
+// of changes in changesHeader; ‘filename’ sets the file .editorconfig files
+// are looked up for. Bodies over maxSize are refused unless it’s 0. Requests
+// are counted in m.
+func toggleHandler(
+	opts core.Options, maxSize fileSize, m *metrics,
+) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		changes, err := toggleHTTP(w, r, opts, maxSize)
+		m.observe(start, changes, err)
+	}
+}
+
+// toggleHTTP responds to r like toggleHandler does and returns the changes or
+// the error it responded with.
+func toggleHTTP(
+	w http.ResponseWriter, r *http.Request, opts core.Options,
+	maxSize fileSize,
+) ([]core.Change, error) {
+	if err := setHTTPOptions(&opts, r); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, err
+	}
+	body := r.Body
+	if maxSize > 0 {
+		body = http.MaxBytesReader(w, body, int64(maxSize))
+	}
+	code, err := io.ReadAll(body)
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return nil, err
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, err
+	}
+	changes, err := core.FindChanges(r.Context(), code, opts)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, err
+	}
+	w.Header().Set("Content-Type", "text/x-go; charset=utf-8")
+	w.Header().Set(changesHeader, strconv.Itoa(len(changes)))
+	w.Write(core.ApplyChanges(code, changes))
+	return changes, nil
+}
+
+// setHTTPOptions sets opts from query parameters of r.
+func setHTTPOptions(opts *core.Options, r *http.Request) error {
+	query := r.URL.Query()
+	err := overrideOptions(
+		opts,
+		query.Get("mode"),
+		query.Get("strategy"),
+		query.Get("placement"),
+		query.Get("filename"),
+	)
+	if err != nil {
+		return fmt.Errorf("setHTTPOptions: %v", err)
+	}
+	return nil
+}
+
+// overrideOptions sets opts from options of a request to a server, leaving
+// the ones which are empty as flags set them. m is the name of a toggling
+// command, and filename is the file .editorconfig files are looked up for.
+func overrideOptions(
+	opts *core.Options, m, strategy, placement, filename string,
+) error {
+	const thisName = "overrideOptions"
+
+	if m != "" {
+		mode, ok := modes[m]
+		if !ok {
+			format := thisName + ": unknown mode %q, " +
+				"want toggle, add or remove"
+			return fmt.Errorf(format, m)
+		}
+		opts.Mode = mode
+	}
+	if strategy != "" {
+		if err := opts.Strategy.Set(strategy); err != nil {
+			return fmt.Errorf("%s: %v", thisName, err)
+		}
+	}
+	if placement != "" {
+		if err := opts.Placement.Set(placement); err != nil {
+			return fmt.Errorf("%s: %v", thisName, err)
+		}
+	}
+	if filename != "" && opts.Placement == core.PlacementFunction {
+		style, err := core.EditorStyleFor(filename)
+		if err != nil {
+			return fmt.Errorf("%s: %v", thisName, err)
+		}
+		opts.Style = style
+	}
+	return nil
+}
+
+// serveHTTP serves handler on the TCP address addr, printing it to infoLog,
+// until ctx is done, and then waits for requests in flight.
+func serveHTTP(
+	ctx context.Context, addr string, handler http.Handler,
+	infoLog *log.Logger,
+) error {
+	const thisName = "serveHTTP"
+
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf(thisName+": in net.Listen: %v", err)
+	}
+	infoLog.Printf(listeningFormat, l.Addr())
+	srv := &http.Server{
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	served := make(chan error, 1)
+	go func() { served <- srv.Serve(l) }()
+	select {
+	case err := <-served:
+		return fmt.Errorf(thisName+": in *Server.Serve: %v", err)
+	case <-ctx.Done():
+	}
+	ctx, cancel := context.WithTimeout(
+		context.Background(), serveShutdownTimeout,
+	)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		return fmt.Errorf(thisName+": in *Server.Shutdown: %v", err)
+	}
+	return nil
+}
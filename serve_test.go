@@ -0,0 +1,109 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/looshch/gouse/internal/core"
+)
+
+func TestHTTPHandler(t *testing.T) {
+	t.Parallel()
+	const added = "package p\n\nfunc f() {\n" +
+		"\ta := 0; _ = a /* TODO: gouse */\n}\n"
+	const removed = "package p\n\nfunc f() {\n\ta := 0\n}\n"
+	tests := []struct {
+		name        string
+		method      string
+		target      string
+		body        string
+		wantStatus  int
+		wantBody    string
+		wantChanges string
+	}{
+		{
+			name:        "toggle",
+			method:      http.MethodPost,
+			target:      "/toggle",
+			body:        added,
+			wantStatus:  http.StatusOK,
+			wantBody:    removed,
+			wantChanges: "1",
+		},
+		{
+			name:        "nothing to remove",
+			method:      http.MethodPost,
+			target:      "/toggle?mode=remove&filename=p.go",
+			body:        removed,
+			wantStatus:  http.StatusOK,
+			wantBody:    removed,
+			wantChanges: "0",
+		},
+		{
+			name:       "unknown mode",
+			method:     http.MethodPost,
+			target:     "/toggle?mode=flip",
+			body:       added,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "too large",
+			method:     http.MethodPost,
+			target:     "/toggle",
+			body:       added + strings.Repeat("\n", 64),
+			wantStatus: http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:       "toggle with GET",
+			method:     http.MethodGet,
+			target:     "/toggle",
+			wantStatus: http.StatusMethodNotAllowed,
+		},
+		{
+			name:       "health",
+			method:     http.MethodGet,
+			target:     "/healthz",
+			wantStatus: http.StatusOK,
+			wantBody:   "ok\n",
+		},
+	}
+	handler := newHTTPHandler(
+		core.Options{}, fileSize(len(added)), newMetrics(),
+	)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			body := strings.NewReader(tt.body)
+			r := httptest.NewRequest(tt.method, tt.target, body)
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			resp := w.Result()
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf(
+					"got: %d, want: %d",
+					resp.StatusCode, tt.wantStatus,
+				)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			got, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.wantBody {
+				t.Errorf(filesCmpErr, got, tt.wantBody)
+			}
+			changes := resp.Header.Get(changesHeader)
+			if changes != tt.wantChanges {
+				t.Errorf(
+					"got: %q, want: %q",
+					changes, tt.wantChanges,
+				)
+			}
+		})
+	}
+}
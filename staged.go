@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/looshch/gouse/internal/core"
+)
+
+// stagedFile represents a Go file staged in the git index.
+type stagedFile struct {
+	// path is relative to the root of the repository.
+	path string
+	mode string
+	hash string
+}
+
+// stagedFiles returns regular Go files added, copied or modified in the git
+// index of the repository with the root top.
+func stagedFiles(ctx context.Context, top string) ([]stagedFile, error) {
+	out, err := git(
+		ctx, top, nil,
+		"diff", "--cached", "--raw", "-z", "--no-abbrev",
+		"--no-renames", "--diff-filter=ACM",
+	)
+	if err != nil {
+		return nil, fmt.Errorf("stagedFiles: %v", err)
+	}
+	// Every entry is ‘:old-mode new-mode old-hash new-hash status’ and the
+	// path, both terminated with NUL.
+	fields := strings.Split(string(out), "\x00")
+	var files []stagedFile
+	for i := 0; i+1 < len(fields); i += 2 {
+		meta := strings.Fields(fields[i])
+		if len(meta) != 5 {
+			format := "stagedFiles: invalid entry: %s"
+			return nil, fmt.Errorf(format, fields[i])
+		}
+		p := fields[i+1]
+		// Symbolic links and submodules have other modes.
+		regular := meta[1] == "100644" || meta[1] == "100755"
+		if !regular || path.Ext(p) != core.GoFileExt {
+			continue
+		}
+		files = append(files, stagedFile{
+			path: p, mode: meta[1], hash: meta[3],
+		})
+	}
+	return files, nil
+}
+
+// toggleStaged toggles with opts the staged contents of Go files in the git
+// index of the repository containing the directory dir and stages the results,
+// leaving the working tree intact. Only changes returned by the filter of
+// filterFor are applied. If dryRun is true, it writes a summary of changes to
+// out instead. It returns changes of every file.
+func toggleStaged(
+	ctx context.Context,
+	opts core.Options,
+	dir string,
+	dryRun bool,
+	out file,
+	filterFor func(name string) changesFilter,
+) ([][]core.Change, error) {
+	const thisName = "toggleStaged"
+
+	topOut, err := git(ctx, dir, nil, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", thisName, err)
+	}
+	top := strings.TrimSpace(string(topOut))
+	files, err := stagedFiles(ctx, top)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", thisName, err)
+	}
+	var toggled [][]core.Change
+	for _, f := range files {
+		// Errors say which file failed.
+		format := thisName + ": %s: %v"
+		code, err := git(ctx, top, nil, "cat-file", "blob", f.hash)
+		if err != nil {
+			return toggled, fmt.Errorf(format, f.path, err)
+		}
+		changes, err := core.FindChanges(ctx, code, opts)
+		if err != nil {
+			return toggled, fmt.Errorf(format, f.path, err)
+		}
+		if filter := filterFor(f.path); filter != nil {
+			changes, err = filter(code, changes)
+			if err != nil {
+				return toggled, fmt.Errorf(format, f.path, err)
+			}
+		}
+		if dryRun {
+			summary := formatChanges(f.path, changes)
+			if _, err := out.Write(summary); err != nil {
+				format := thisName + ": in *File.Write: %v"
+				return toggled, fmt.Errorf(format, err)
+			}
+			toggled = append(toggled, changes)
+			continue
+		}
+		if len(changes) == 0 {
+			continue
+		}
+		hash, err := git(
+			ctx, top, core.ApplyChanges(code, changes),
+			"hash-object", "-w", "--stdin", "--path", f.path,
+		)
+		if err != nil {
+			return toggled, fmt.Errorf(format, f.path, err)
+		}
+		cacheInfo := f.mode + "," + strings.TrimSpace(string(hash)) +
+			"," + f.path
+		_, err = git(
+			ctx, top, nil, "update-index", "--cacheinfo", cacheInfo,
+		)
+		if err != nil {
+			return toggled, fmt.Errorf(format, f.path, err)
+		}
+		toggled = append(toggled, changes)
+	}
+	return toggled, nil
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/looshch/gouse/internal/core"
+)
+
+const stagedInput = `package main
+
+func main() {
+	notUsed := 0; _ = notUsed /* TODO: gouse */
+}
+`
+
+func TestToggleStaged(t *testing.T) {
+	ctx := context.Background()
+	ctx, cancel := context.WithCancel(ctx)
+	t.Cleanup(cancel)
+	dir := t.TempDir()
+	gitRun := func(args ...string) string {
+		t.Helper()
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("%v: %s", err, out)
+		}
+		return string(out)
+	}
+	p := filepath.Join(dir, "main.go")
+	if err := os.WriteFile(p, []byte(stagedInput), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	readme := filepath.Join(dir, "readme.md")
+	if err := os.WriteFile(readme, []byte(stagedInput), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	gitRun("init", "-q")
+	gitRun("add", "main.go", "readme.md")
+	// The working tree differs from the index and must stay intact.
+	worktree := stagedInput + "// Unstaged.\n"
+	if err := os.WriteFile(p, []byte(worktree), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	dryRun := newFakeFile()
+	_, err := toggleStaged(
+		ctx,
+		core.Options{Mode: core.ModeRemove},
+		dir,
+		true,
+		dryRun,
+		func(string) changesFilter { return nil },
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "main.go:4: remove fake usage of notUsed\n"
+	if got := dryRun.contents.String(); got != want {
+		t.Errorf("got: %s, want: %s", got, want)
+	}
+	if got := gitRun("show", ":main.go"); got != stagedInput {
+		t.Errorf("got: %s, want: %s", got, stagedInput)
+	}
+
+	toggled, err := toggleStaged(
+		ctx,
+		core.Options{Mode: core.ModeRemove},
+		dir,
+		false,
+		newFakeFile(),
+		func(string) changesFilter { return nil },
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(toggled) != 1 || len(toggled[0]) != 1 {
+		t.Errorf("got: %v, want: 1 change", toggled)
+	}
+	wantStaged := strings.Replace(
+		stagedInput, "; _ = notUsed"+core.FakeUsageSuffix, "", 1,
+	)
+	if got := gitRun("show", ":main.go"); got != wantStaged {
+		t.Errorf("got: %s, want: %s", got, wantStaged)
+	}
+	if got := gitRun("show", ":readme.md"); got != stagedInput {
+		t.Errorf("got: %s, want: %s", got, stagedInput)
+	}
+	got, err := os.ReadFile(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != worktree {
+		t.Errorf("got: %s, want: %s", got, worktree)
+	}
+}
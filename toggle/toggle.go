@@ -0,0 +1,414 @@
+// Package toggle toggles ‘declared and not used’ errors in Go code like the
+// gouse command does: it removes fake usages, _ = notUsedVar with a TODO
+// comment, if there are any and creates them otherwise.
+//
+//	added, err := toggle.Toggle(ctx, src, toggle.WithMode(toggle.ModeAdd))
+//
+// By default, code is built with the go command in a temporary directory to
+// find unused variables, so it must be on PATH. WithBackend(BackendTypeCheck)
+// type-checks code in process instead.
+package toggle
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"go/parser"
+	"go/token"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"time"
+
+	"github.com/looshch/gouse/internal/core"
+)
+
+// Mode limits what Toggle does.
+type Mode = core.Mode
+
+const (
+	// ModeToggle removes fake usages if there are any and creates them
+	// otherwise.
+	ModeToggle = core.ModeToggle
+	// ModeAdd only creates fake usages.
+	ModeAdd = core.ModeAdd
+	// ModeRemove only removes fake usages.
+	ModeRemove = core.ModeRemove
+)
+
+// Strategy is how unused variables are handled.
+type Strategy = core.Strategy
+
+const (
+	// StrategyUse creates fake usages of unused variables.
+	StrategyUse = core.StrategyUse
+	// StrategyComment comments out declarations of unused variables.
+	StrategyComment = core.StrategyComment
+	// StrategyDelete deletes declarations of unused variables, keeping
+	// them quoted in a TODO comment to restore them from.
+	StrategyDelete = core.StrategyDelete
+)
+
+// Placement is where fake usages are created.
+type Placement = core.Placement
+
+const (
+	// PlacementLine creates every fake usage at the end of the line of its
+	// variable.
+	PlacementLine = core.PlacementLine
+	// PlacementFunction gathers fake usages of variables declared in the
+	// top-level scope of a function into one statement at the end of its
+	// body.
+	PlacementFunction = core.PlacementFunction
+)
+
+// Backend is how unused variables are found.
+type Backend = core.Backend
+
+const (
+	// BackendBuild builds code with the go command and takes unused
+	// variables from build errors.
+	BackendBuild = core.BackendBuild
+	// BackendTypeCheck type-checks code in process without resolving
+	// imports.
+	BackendTypeCheck = core.BackendTypeCheck
+)
+
+// Action is a kind of Edit.
+type Action = core.Action
+
+const (
+	// ActionAdd creates a fake usage.
+	ActionAdd = core.ActionAdd
+	// ActionRemove removes a fake usage.
+	ActionRemove = core.ActionRemove
+)
+
+// Edit is a single edit toggling makes to the source: Old, src[Start:End], is
+// replaced with New.
+type Edit struct {
+	Action Action
+	// Name is the name of the variable whose fake usage is created or
+	// removed.
+	Name string
+	// Line is the 1-based number of the line of the variable.
+	Line       int
+	Start, End int
+	Old, New   string
+}
+
+// ToggleResult is the result of ToggleEdits: the toggled code and the edits
+// which toggle the source into it, ordered by Start.
+type ToggleResult struct {
+	Code  []byte
+	Edits []Edit
+}
+
+// Errors of Toggle and the like wrap these, so failures can be told apart
+// with errors.Is. ToggleFS wraps errors of files in *fs.PathError.
+var (
+	// ErrSyntax means fake usages were to be created in code which
+	// doesn’t parse. The gouse command keeps such code as is instead.
+	ErrSyntax = errors.New("code isn’t valid Go")
+	// ErrNoToolchain means code was to be built and the go command
+	// isn’t on PATH.
+	ErrNoToolchain = core.ErrNoToolchain
+	// ErrBuildFailed means the go command failed without errors of
+	// files, e.g. of a broken GOFLAGS; see BuildError for its output.
+	ErrBuildFailed = core.ErrBuildFailed
+)
+
+// BuildError carries the output of the go command with ErrNoToolchain or
+// ErrBuildFailed, for errors.As.
+type BuildError = core.BuildError
+
+// SyntaxInfo describes the declaration of a variable a fake usage is created
+// for, see WithRender.
+type SyntaxInfo = core.SyntaxInfo
+
+// Option configures Toggle.
+type Option func(*core.Options)
+
+// WithMode makes Toggle only create or only remove fake usages. The default
+// is ModeToggle.
+func WithMode(m Mode) Option {
+	return func(o *core.Options) { o.Mode = m }
+}
+
+// WithStrategy sets how unused variables are handled. The default is
+// StrategyUse.
+func WithStrategy(s Strategy) Option {
+	return func(o *core.Options) { o.Strategy = s }
+}
+
+// WithPlacement sets where fake usages are created. The default is
+// PlacementLine.
+func WithPlacement(p Placement) Option {
+	return func(o *core.Options) { o.Placement = p }
+}
+
+// WithBackend sets how unused variables are found. The default is
+// BackendBuild, or BackendTypeCheck in WebAssembly, which can’t run the go
+// command.
+func WithBackend(b Backend) Option {
+	return func(o *core.Options) { o.Backend = b }
+}
+
+// WithAuthor stamps the author into created fake usages, like in
+// ‘TODO(author): gouse’.
+func WithAuthor(author string) Option {
+	return func(o *core.Options) { o.Author = author }
+}
+
+// WithDate stamps the date of t into created fake usages, like in
+// ‘TODO: gouse 2006-01-02’.
+func WithDate(t time.Time) Option {
+	return func(o *core.Options) { o.Date = t.Format(core.DateLayout) }
+}
+
+// WithNumber stamps created fake usages with IDs which follow the greatest
+// one in code, like in ‘TODO: gouse#3’.
+func WithNumber() Option {
+	return func(o *core.Options) { o.Number = true }
+}
+
+// WithAdopt makes removal take hand-written fake usages too: bare ‘_ = x’
+// statements whose variable x has no other use.
+func WithAdopt() Option {
+	return func(o *core.Options) { o.Adopt = true }
+}
+
+// WithParams makes parameters which bodies of their functions don’t reference
+// renamed to ‘_’ too, keeping their names in TODO comments to be restored from.
+func WithParams() Option {
+	return func(o *core.Options) { o.Params = true }
+}
+
+// WithReceivers makes receivers which bodies of their methods don’t reference
+// renamed to ‘_’ too, like WithParams does parameters.
+func WithReceivers() Option {
+	return func(o *core.Options) { o.Receivers = true }
+}
+
+// WithResults makes results of calls which are statements of their own
+// assigned to ‘_’ too, like ‘_, _ = f()’, with TODO comments to be restored
+// from.
+func WithResults() Option {
+	return func(o *core.Options) { o.Results = true }
+}
+
+// WithSiblings builds code with other files of its package, keyed by names,
+// so identifiers declared in them resolve.
+func WithSiblings(siblings map[string][]byte) Option {
+	return func(o *core.Options) { o.Siblings = siblings }
+}
+
+// WithRender makes created fake usages rendered with render: its result is
+// inserted at the end of the line of decl in place of ‘; _ = varName’ followed
+// by decl.Comment, e.g. to log the variable too:
+//
+//	func(varName string, decl toggle.SyntaxInfo) string {
+//		return "; _ = " + varName + "; log.Print(" + varName + ")" +
+//			decl.Comment
+//	}
+//
+// For the fake usage to be removed, the result must start with ‘; _ =’ and end
+// with decl.Comment. Statements gathered with PlacementFunction and
+// declarations handled with StrategyComment and StrategyDelete aren’t rendered
+// with it.
+func WithRender(render func(varName string, decl SyntaxInfo) string) Option {
+	return func(o *core.Options) { o.Render = render }
+}
+
+// Toggle returns src toggled with opts. src is a single Go file.
+func Toggle(
+	ctx context.Context, src []byte, opts ...Option,
+) ([]byte, error) {
+	result, err := ToggleEdits(ctx, src, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("Toggle: %w", err)
+	}
+	return result.Code, nil
+}
+
+// ToggleEdits returns src toggled with opts along with the edits which make
+// it, e.g. to build diffs or apply only some of them with Apply.
+func ToggleEdits(
+	ctx context.Context, src []byte, opts ...Option,
+) (*ToggleResult, error) {
+	o := core.Options{Backend: core.DefaultBackend}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if err := validate(o); err != nil {
+		return nil, fmt.Errorf("ToggleEdits: %w", err)
+	}
+	changes, err := core.FindChanges(ctx, src, o)
+	if err != nil {
+		return nil, fmt.Errorf("ToggleEdits: %w", err)
+	}
+	// Code which doesn’t parse has no changes to add, and callers are
+	// told why rather than getting it back as is.
+	if len(changes) == 0 && o.Mode != core.ModeRemove && o.Finder == nil {
+		fset := token.NewFileSet()
+		mode := parser.SkipObjectResolution
+		if _, err := parser.ParseFile(fset, "", src, mode); err != nil {
+			format := "ToggleEdits: %w: %v"
+			return nil, fmt.Errorf(format, ErrSyntax, err)
+		}
+	}
+	sort.SliceStable(changes, func(i, j int) bool {
+		return changes[i].Start < changes[j].Start
+	})
+	edits := make([]Edit, len(changes))
+	for i, c := range changes {
+		edits[i] = Edit{
+			Action: c.Action,
+			Name:   c.Name,
+			// +1 is an adjustment for 1-based count.
+			Line:  c.LineNum + 1,
+			Start: c.Start,
+			End:   c.End,
+			Old:   string(src[c.Start:c.End]),
+			New:   c.Text,
+		}
+	}
+	code := core.ApplyChanges(src, changes)
+	return &ToggleResult{Code: code, Edits: edits}, nil
+}
+
+// Apply returns src with edits of ToggleEdits of src applied, e.g. only the
+// ones a user picked. edits must not overlap.
+func Apply(src []byte, edits []Edit) []byte {
+	changes := make([]core.Change, len(edits))
+	for i, e := range edits {
+		changes[i] = core.Change{
+			Start: e.Start, End: e.End, Text: e.New,
+		}
+	}
+	return core.ApplyChanges(src, changes)
+}
+
+// ToggleReader writes code read from src toggled with opts to dst, like
+// Toggle. The whole of src is read before anything is written, as code must
+// be built as a whole.
+func ToggleReader(
+	ctx context.Context, dst io.Writer, src io.Reader, opts ...Option,
+) error {
+	code, err := io.ReadAll(src)
+	if err != nil {
+		return fmt.Errorf("ToggleReader: in io.ReadAll: %w", err)
+	}
+	toggled, err := Toggle(ctx, code, opts...)
+	if err != nil {
+		return fmt.Errorf("ToggleReader: %w", err)
+	}
+	if _, err := dst.Write(toggled); err != nil {
+		return fmt.Errorf("ToggleReader: in Writer.Write: %w", err)
+	}
+	return nil
+}
+
+// ToggleFS toggles Go files of fsys matched by patterns, like in fs.Glob,
+// with opts and returns the toggled code of the ones which changed, keyed by
+// their paths in fsys. A pattern which matches a directory stands for Go files
+// directly in it. Every file is toggled on its own; WithSiblings adds the same
+// siblings to each. fsys isn’t written to, so in-memory and overlay file
+// systems work, and callers write the result where they want.
+func ToggleFS(
+	ctx context.Context, fsys fs.FS, patterns []string, opts ...Option,
+) (map[string][]byte, error) {
+	const thisName = "ToggleFS"
+
+	var paths []string
+	seen := make(map[string]bool)
+	for _, pattern := range patterns {
+		matches, err := fs.Glob(fsys, pattern)
+		if err != nil {
+			format := "%s: in fs.Glob: %w"
+			return nil, fmt.Errorf(format, thisName, err)
+		}
+		if len(matches) == 0 {
+			format := "%s: no files match %q"
+			return nil, fmt.Errorf(format, thisName, pattern)
+		}
+		for _, m := range matches {
+			files, err := goFiles(fsys, m)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", thisName, err)
+			}
+			for _, f := range files {
+				if !seen[f] {
+					seen[f] = true
+					paths = append(paths, f)
+				}
+			}
+		}
+	}
+	toggled := make(map[string][]byte)
+	for _, p := range paths {
+		code, err := fs.ReadFile(fsys, p)
+		if err != nil {
+			format := "%s: in fs.ReadFile: %w"
+			return nil, fmt.Errorf(format, thisName, err)
+		}
+		result, err := Toggle(ctx, code, opts...)
+		if err != nil {
+			perr := &fs.PathError{Op: "toggle", Path: p, Err: err}
+			return nil, fmt.Errorf("%s: %w", thisName, perr)
+		}
+		if !bytes.Equal(result, code) {
+			toggled[p] = result
+		}
+	}
+	return toggled, nil
+}
+
+// goFiles returns the path p if it’s a Go file or paths of Go files directly
+// in it if it’s a directory of fsys.
+func goFiles(fsys fs.FS, p string) ([]string, error) {
+	info, err := fs.Stat(fsys, p)
+	if err != nil {
+		return nil, fmt.Errorf("goFiles: in fs.Stat: %w", err)
+	}
+	if !info.IsDir() {
+		if path.Ext(p) != core.GoFileExt {
+			return nil, nil
+		}
+		return []string{p}, nil
+	}
+	entries, err := fs.ReadDir(fsys, p)
+	if err != nil {
+		return nil, fmt.Errorf("goFiles: in fs.ReadDir: %w", err)
+	}
+	var files []string
+	for _, e := range entries {
+		if !e.IsDir() && path.Ext(e.Name()) == core.GoFileExt {
+			files = append(files, path.Join(p, e.Name()))
+		}
+	}
+	return files, nil
+}
+
+// validate returns an error if o has a strategy, placement or backend which
+// isn’t one of the constants, as flags of the gouse command would.
+func validate(o core.Options) error {
+	if o.Strategy != "" {
+		if err := o.Strategy.Set(string(o.Strategy)); err != nil {
+			return err
+		}
+	}
+	if o.Placement != "" {
+		if err := o.Placement.Set(string(o.Placement)); err != nil {
+			return err
+		}
+	}
+	if o.Backend != "" {
+		if err := o.Backend.Set(string(o.Backend)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
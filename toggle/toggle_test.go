@@ -0,0 +1,330 @@
+package toggle_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"testing/iotest"
+	"time"
+
+	"github.com/looshch/gouse/toggle"
+)
+
+const filesCmpErr = `
+========= got:
+%s
+========= want:
+%s`
+
+func TestToggle(t *testing.T) {
+	testdata := filepath.Join("..", "testdata")
+	inputsPaths, err := filepath.Glob(filepath.Join(testdata, "*.input"))
+	ctx := context.Background()
+	ctx, cancel := context.WithCancel(ctx)
+	t.Cleanup(cancel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range inputsPaths {
+		_, filename := filepath.Split(p)
+		testName := filename[:len(filename)-len(filepath.Ext(p))]
+		t.Run(testName, func(t *testing.T) {
+			t.Parallel()
+			input, err := os.ReadFile(p)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := toggle.Toggle(ctx, input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want, err := os.ReadFile(
+				filepath.Join(testdata, testName+".golden"),
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf(filesCmpErr, got, want)
+			}
+		})
+	}
+}
+
+func TestToggleOptions(t *testing.T) {
+	t.Parallel()
+	const code = "package p\n\nfunc f() {\n\ta := 0\n}\n"
+	date := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	render := func(varName string, decl toggle.SyntaxInfo) string {
+		return "; _ = " + varName + "; println(" + varName + ")" +
+			decl.Comment
+	}
+	tests := []struct {
+		name    string
+		opts    []toggle.Option
+		want    string
+		wantErr bool
+	}{
+		{
+			"stamps",
+			[]toggle.Option{
+				toggle.WithAuthor("me"),
+				toggle.WithNumber(),
+				toggle.WithDate(date),
+			},
+			"package p\n\nfunc f() {\n" +
+				"\ta := 0; _ = a " +
+				"/* TODO(me): gouse#1 2024-05-01 */\n" +
+				"}\n",
+			false,
+		},
+		{
+			"remove only",
+			[]toggle.Option{toggle.WithMode(toggle.ModeRemove)},
+			code,
+			false,
+		},
+		{
+			"comment",
+			[]toggle.Option{
+				toggle.WithStrategy(toggle.StrategyComment),
+			},
+			"package p\n\nfunc f() {\n" +
+				"\t// a := 0 /* TODO: gouse */\n" +
+				"}\n",
+			false,
+		},
+		{
+			"render",
+			[]toggle.Option{toggle.WithRender(render)},
+			"package p\n\nfunc f() {\n" +
+				"\ta := 0; _ = a; println(a) " +
+				"/* TODO: gouse */\n}\n",
+			false,
+		},
+		{
+			"unknown strategy",
+			[]toggle.Option{toggle.WithStrategy("forget")},
+			"",
+			true,
+		},
+		{
+			"unknown backend",
+			[]toggle.Option{toggle.WithBackend("guess")},
+			"",
+			true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			// The type-check backend doesn’t need the go command.
+			typeCheck := toggle.WithBackend(toggle.BackendTypeCheck)
+			opts := append([]toggle.Option{typeCheck}, test.opts...)
+			got, err := toggle.Toggle(
+				context.Background(), []byte(code), opts...,
+			)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("got: error %v, want error: %v",
+					err, test.wantErr)
+			}
+			if string(got) != test.want {
+				t.Errorf(filesCmpErr, got, test.want)
+			}
+		})
+	}
+}
+
+func TestToggleReader(t *testing.T) {
+	t.Parallel()
+	const code = "package p\n\nfunc f() {\n\ta := 0\n}\n"
+	const want = "package p\n\nfunc f() {\n" +
+		"\ta := 0; _ = a /* TODO: gouse */\n}\n"
+	typeCheck := toggle.WithBackend(toggle.BackendTypeCheck)
+	tests := []struct {
+		name    string
+		src     io.Reader
+		want    string
+		wantErr bool
+	}{
+		{"code", strings.NewReader(code), want, false},
+		{
+			"code in pieces",
+			iotest.OneByteReader(strings.NewReader(code)),
+			want,
+			false,
+		},
+		{"failing", iotest.ErrReader(errors.New("failed")), "", true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			var dst bytes.Buffer
+			err := toggle.ToggleReader(
+				context.Background(), &dst, test.src, typeCheck,
+			)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("got: error %v, want error: %v",
+					err, test.wantErr)
+			}
+			if got := dst.String(); got != test.want {
+				t.Errorf(filesCmpErr, got, test.want)
+			}
+		})
+	}
+}
+
+func TestToggleFS(t *testing.T) {
+	t.Parallel()
+	const unused = "package p\n\nfunc f() {\n\ta := 0\n}\n"
+	const added = "package p\n\nfunc f() {\n" +
+		"\ta := 0; _ = a /* TODO: gouse */\n}\n"
+	const used = "package p\n\nfunc g() int {\n\tb := 0\n\treturn b\n}\n"
+	fsys := fstest.MapFS{
+		"a.go":         {Data: []byte(unused)},
+		"b.go":         {Data: []byte(used)},
+		"readme.md":    {Data: []byte("# p\n")},
+		"sub/c.go":     {Data: []byte(added)},
+		"sub/sub/d.go": {Data: []byte(unused)},
+	}
+	tests := []struct {
+		name     string
+		patterns []string
+		want     map[string]string
+		wantErr  bool
+	}{
+		{
+			"glob",
+			[]string{"*"},
+			map[string]string{"a.go": added, "sub/c.go": unused},
+			false,
+		},
+		{
+			"directory",
+			[]string{"sub"},
+			map[string]string{"sub/c.go": unused},
+			false,
+		},
+		{
+			"file taken once",
+			[]string{"sub/sub/d.go", "sub/*/*.go"},
+			map[string]string{"sub/sub/d.go": added},
+			false,
+		},
+		{"no match", []string{"*.txt"}, nil, true},
+		{"bad pattern", []string{"["}, nil, true},
+	}
+	typeCheck := toggle.WithBackend(toggle.BackendTypeCheck)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			ctx := context.Background()
+			got, err := toggle.ToggleFS(
+				ctx, fsys, test.patterns, typeCheck,
+			)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("got: error %v, want error: %v",
+					err, test.wantErr)
+			}
+			if len(got) != len(test.want) {
+				t.Errorf("got: %d files, want: %d",
+					len(got), len(test.want))
+			}
+			for p, want := range test.want {
+				if string(got[p]) != want {
+					t.Errorf(filesCmpErr, got[p], want)
+				}
+			}
+		})
+	}
+}
+
+func TestToggleEdits(t *testing.T) {
+	t.Parallel()
+	const code = "package p\n\nfunc f() {\n\ta := 0\n\tb := 0\n}\n"
+	ctx := context.Background()
+	typeCheck := toggle.WithBackend(toggle.BackendTypeCheck)
+	result, err := toggle.ToggleEdits(ctx, []byte(code), typeCheck)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const comment = " /* TODO: gouse */"
+	want := []toggle.Edit{
+		{
+			Action: toggle.ActionAdd, Name: "a", Line: 4,
+			Start: 29, End: 29, New: "; _ = a" + comment,
+		},
+		{
+			Action: toggle.ActionAdd, Name: "b", Line: 5,
+			Start: 37, End: 37, New: "; _ = b" + comment,
+		},
+	}
+	if !slices.Equal(result.Edits, want) {
+		t.Errorf("got: %+v, want: %+v", result.Edits, want)
+	}
+	wantCode := "package p\n\nfunc f() {\n" +
+		"\ta := 0; _ = a" + comment + "\n" +
+		"\tb := 0; _ = b" + comment + "\n}\n"
+	if string(result.Code) != wantCode {
+		t.Errorf(filesCmpErr, result.Code, wantCode)
+	}
+	got := toggle.Apply([]byte(code), result.Edits)
+	if string(got) != wantCode {
+		t.Errorf(filesCmpErr, got, wantCode)
+	}
+	// Only the picked edit is applied.
+	got = toggle.Apply([]byte(code), result.Edits[1:])
+	wantPicked := "package p\n\nfunc f() {\n\ta := 0\n" +
+		"\tb := 0; _ = b" + comment + "\n}\n"
+	if string(got) != wantPicked {
+		t.Errorf(filesCmpErr, got, wantPicked)
+	}
+
+	removal, err := toggle.ToggleEdits(ctx, result.Code, typeCheck)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(removal.Edits) != 2 ||
+		removal.Edits[0].Action != toggle.ActionRemove ||
+		removal.Edits[0].Old != "; _ = a"+comment {
+		t.Errorf("got: %+v, want: removals", removal.Edits)
+	}
+	if string(removal.Code) != code {
+		t.Errorf(filesCmpErr, removal.Code, code)
+	}
+}
+
+func TestToggleErrors(t *testing.T) {
+	t.Setenv("PATH", t.TempDir())
+	ctx := context.Background()
+	const broken = "package p\n\nfunc f() {\n"
+	const unused = "package p\n\nfunc f() {\n\ta := 0\n}\n"
+	typeCheck := toggle.WithBackend(toggle.BackendTypeCheck)
+
+	_, err := toggle.Toggle(ctx, []byte(broken), typeCheck)
+	if !errors.Is(err, toggle.ErrSyntax) {
+		t.Errorf("got: %v, want: %v", err, toggle.ErrSyntax)
+	}
+
+	_, err = toggle.Toggle(ctx, []byte(unused))
+	var berr *toggle.BuildError
+	if !errors.Is(err, toggle.ErrNoToolchain) || !errors.As(err, &berr) {
+		t.Errorf("got: %v, want: %v", err, toggle.ErrNoToolchain)
+	}
+
+	fsys := fstest.MapFS{"a.go": {Data: []byte(broken)}}
+	_, err = toggle.ToggleFS(ctx, fsys, []string{"a.go"}, typeCheck)
+	var perr *fs.PathError
+	if !errors.As(err, &perr) || perr.Path != "a.go" ||
+		!errors.Is(err, toggle.ErrSyntax) {
+		t.Errorf("got: %v, want: a path error of a.go", err)
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/looshch/gouse/internal/core"
+)
+
+// stagedWrite is a file toggled in memory and not yet written back, for
+// ‘-atomic’ flag.
+type stagedWrite struct {
+	path string
+	// code is what was read from the file, and toggled is what it’s
+	// written back with.
+	code, toggled []byte
+	changes       []core.Change
+	hooks         writeHooks
+}
+
+// writeBackFunc replaces code of the file p with toggled.
+type writeBackFunc func(p string, code, toggled []byte) error
+
+// stageFile toggles code from in and returns it to be written back to the file
+// name later, calling hooks around it. Files without changes aren’t staged, so
+// the zero stagedWrite is returned for them.
+func stageFile(
+	ctx context.Context, opts core.Options, name string, in file,
+	filter changesFilter, hooks writeHooks,
+) (stagedWrite, []core.Change, error) {
+	read, err := readCode(in)
+	if err != nil {
+		return stagedWrite{}, nil, fmt.Errorf("stageFile: %v", err)
+	}
+	toggled, changes, err := toggledCode(ctx, opts, read, filter)
+	if err != nil || len(changes) == 0 {
+		if err != nil {
+			err = fmt.Errorf("stageFile: %v", err)
+		}
+		return stagedWrite{}, nil, err
+	}
+	s := stagedWrite{name, read, toggled, changes, hooks}
+	return s, changes, nil
+}
+
+// commitWrites writes back staged files in order with write, calling their
+// before hooks ahead of every write and their after hooks once all of them are
+// written. If writing one fails or ctx is done before all of them are written,
+// the written ones get their code back, so the tree is left as it was, and
+// their paths are returned. Files which can’t be rolled back are reported in
+// the error.
+func commitWrites(
+	ctx context.Context, staged []stagedWrite, write writeBackFunc,
+) ([]string, error) {
+	for i, s := range staged {
+		err := ctx.Err()
+		if err == nil && s.hooks.before != nil {
+			err = s.hooks.before(s.code, s.toggled, s.changes)
+		}
+		if err == nil {
+			err = write(s.path, s.code, s.toggled)
+		}
+		if err == nil {
+			continue
+		}
+		errs := []error{failure{s.path, err}}
+		var rolledBack []string
+		// Later files may depend on earlier ones, so they go first.
+		for _, s := range slices.Backward(staged[:i]) {
+			err := write(s.path, s.toggled, s.code)
+			if err != nil {
+				err = fmt.Errorf("in rollback: %v", err)
+				errs = append(errs, failure{s.path, err})
+				continue
+			}
+			rolledBack = append(rolledBack, s.path)
+		}
+		return rolledBack, errors.Join(errs...)
+	}
+	// Writes are recorded only once all of them are final.
+	var errs []error
+	for _, s := range staged {
+		if s.hooks.after == nil {
+			continue
+		}
+		err := s.hooks.after(s.code, s.toggled, s.changes)
+		if err != nil {
+			errs = append(errs, failure{s.path, err})
+		}
+	}
+	return nil, errors.Join(errs...)
+}
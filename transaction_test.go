@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/looshch/gouse/internal/core"
+)
+
+func TestCommitWrites(t *testing.T) {
+	t.Parallel()
+	errBroken := errors.New("broken")
+	staged := []stagedWrite{
+		{path: "a.go", code: []byte("a"), toggled: []byte("A")},
+		{path: "b.go", code: []byte("b"), toggled: []byte("B")},
+		{path: "c.go", code: []byte("c"), toggled: []byte("C")},
+	}
+	tests := []struct {
+		name   string
+		cancel bool
+		// broken is the file which can’t be written.
+		broken         string
+		wantFiles      map[string]string
+		wantRolledBack []string
+		wantErr        bool
+	}{
+		{
+			name: "all written",
+			wantFiles: map[string]string{
+				"a.go": "A", "b.go": "B", "c.go": "C",
+			},
+		},
+		{
+			name:   "failed write",
+			broken: "c.go",
+			wantFiles: map[string]string{
+				"a.go": "a", "b.go": "b", "c.go": "c",
+			},
+			wantRolledBack: []string{"b.go", "a.go"},
+			wantErr:        true,
+		},
+		{
+			name:   "interrupted",
+			cancel: true,
+			wantFiles: map[string]string{
+				"a.go": "a", "b.go": "b", "c.go": "c",
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			files := map[string]string{
+				"a.go": "a", "b.go": "b", "c.go": "c",
+			}
+			write := func(p string, code, toggled []byte) error {
+				if p == tt.broken {
+					return errBroken
+				}
+				if files[p] != string(code) {
+					return fmt.Errorf("%s changed", p)
+				}
+				files[p] = string(toggled)
+				return nil
+			}
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if tt.cancel {
+				cancel()
+			}
+			rolledBack, err := commitWrites(ctx, staged, write)
+			if (err != nil) != tt.wantErr {
+				format := "got: %v, want error: %t"
+				t.Fatalf(format, err, tt.wantErr)
+			}
+			if !maps.Equal(files, tt.wantFiles) {
+				format := "got: %v, want: %v"
+				t.Errorf(format, files, tt.wantFiles)
+			}
+			if !slices.Equal(rolledBack, tt.wantRolledBack) {
+				t.Errorf(
+					"got: %v, want: %v",
+					rolledBack, tt.wantRolledBack,
+				)
+			}
+		})
+	}
+}
+
+func TestCommitWritesHooks(t *testing.T) {
+	t.Parallel()
+	for _, broken := range []string{"", "b.go"} {
+		var calls []string
+		record := func(when, p string) writeHook {
+			return func(_, _ []byte, _ []core.Change) error {
+				calls = append(calls, when+" "+p)
+				return nil
+			}
+		}
+		hooksOf := func(p string) writeHooks {
+			before, after := record("before", p), record("after", p)
+			return writeHooks{before, after}
+		}
+		staged := []stagedWrite{
+			{path: "a.go", hooks: hooksOf("a.go")},
+			{path: "b.go", hooks: hooksOf("b.go")},
+		}
+		write := func(p string, _, _ []byte) error {
+			if p == broken {
+				return errors.New("broken")
+			}
+			return nil
+		}
+		_, err := commitWrites(context.Background(), staged, write)
+		if (err != nil) != (broken != "") {
+			t.Fatalf("got: %v, want error: %t", err, broken != "")
+		}
+		// Rolled back writes aren’t recorded.
+		want := []string{"before a.go", "before b.go"}
+		if broken == "" {
+			want = append(want, "after a.go", "after b.go")
+		}
+		if !slices.Equal(calls, want) {
+			t.Errorf("got: %v, want: %v", calls, want)
+		}
+	}
+}
+
+func TestRunAtomic(t *testing.T) {
+	t.Parallel()
+	input, err := os.ReadFile(filepath.Join("testdata", "not_used.input"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	p := filepath.Join(dir, "a.go")
+	if err := os.WriteFile(p, input, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	missing := filepath.Join(dir, "missing.go")
+	stderr := newFakeFile()
+	status := run(
+		context.Background(),
+		[]string{"-w", "-atomic", p, missing},
+		newFakeFile(), newFakeFile(), stderr,
+
+		openFile,
+	)
+	if status != 1 {
+		t.Errorf("got: %d, want: 1", status)
+	}
+	// The file toggled isn’t written back as the other one failed.
+	got, err := os.ReadFile(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(input) {
+		t.Errorf(filesCmpErr, got, input)
+	}
+	status = run(
+		context.Background(),
+		[]string{"-w", "-atomic", p},
+		newFakeFile(), newFakeFile(), stderr,
+
+		openFile,
+	)
+	if status != 0 {
+		format := "got: %d, want: 0, stderr: %s"
+		t.Errorf(format, status, stderr.contents)
+	}
+	want, err := os.ReadFile(filepath.Join("testdata", "not_used.golden"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err = os.ReadFile(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(want) {
+		t.Errorf(filesCmpErr, got, want)
+	}
+}
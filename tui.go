@@ -0,0 +1,306 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/looshch/gouse/internal/core"
+	"golang.org/x/term"
+)
+
+// fileChanges represents code of a file and changes toggle makes to it.
+type fileChanges struct {
+	name    string
+	code    []byte
+	changes []core.Change
+}
+
+// selectorItem is a change listed in selector.
+type selectorItem struct {
+	file    int
+	change  core.Change
+	checked bool
+}
+
+// selector is a state of the full-screen list of changes to choose from.
+type selector struct {
+	files  []*fileChanges
+	items  []selectorItem
+	cursor int
+	// offset is an index of the first visible item.
+	offset int
+	// done is set when the user either applies or aborts the selection.
+	done    bool
+	applied bool
+}
+
+// newSelector returns selector listing changes of files, all of them checked.
+func newSelector(files []*fileChanges) *selector {
+	s := &selector{files: files}
+	for i, f := range files {
+		for _, c := range f.changes {
+			item := selectorItem{file: i, change: c, checked: true}
+			s.items = append(s.items, item)
+		}
+	}
+	return s
+}
+
+const (
+	keyUp     = "\x1b[A"
+	keyDown   = "\x1b[B"
+	keyEscape = "\x1b"
+	keyCtrlC  = "\x03"
+	keyEnter  = "\r"
+)
+
+// handleKey updates s according to key pressed by the user.
+func (s *selector) handleKey(key string) {
+	switch key {
+	case keyUp, "k":
+		if s.cursor > 0 {
+			s.cursor--
+		}
+	case keyDown, "j":
+		if s.cursor < len(s.items)-1 {
+			s.cursor++
+		}
+	case " ":
+		if len(s.items) > 0 {
+			s.items[s.cursor].checked = !s.items[s.cursor].checked
+		}
+	case "a", "n":
+		for i := range s.items {
+			s.items[i].checked = key == "a"
+		}
+	case keyEnter:
+		s.done, s.applied = true, true
+	case "q", keyEscape, keyCtrlC:
+		s.done = true
+	}
+}
+
+// selected returns checked changes of every file in the order of files. If
+// the selection is aborted, there are no changes.
+func (s *selector) selected() [][]core.Change {
+	changes := make([][]core.Change, len(s.files))
+	if !s.applied {
+		return changes
+	}
+	for _, item := range s.items {
+		if item.checked {
+			fc := &changes[item.file]
+			*fc = append(*fc, item.change)
+		}
+	}
+	return changes
+}
+
+const (
+	selectorHelp = "gouse: space toggle, a all, n none, " +
+		"enter apply, q abort"
+	// previewHeight is a number of lines of the preview pane, including
+	// the separator.
+	previewHeight = 2*contextLines + 3
+)
+
+// render writes the screen of s with size width×height to w.
+func (s *selector) render(w io.Writer, width, height int) {
+	var lines []string
+	lines = append(lines, selectorHelp)
+	listHeight := max(height-previewHeight-1, 1)
+	if s.cursor < s.offset {
+		s.offset = s.cursor
+	} else if s.cursor >= s.offset+listHeight {
+		s.offset = s.cursor - listHeight + 1
+	}
+	for i := s.offset; i < s.offset+listHeight; i++ {
+		if i >= len(s.items) {
+			lines = append(lines, "")
+			continue
+		}
+		item := s.items[i]
+		cursor, checkbox := " ", "[ ]"
+		if i == s.cursor {
+			cursor = ">"
+		}
+		if item.checked {
+			checkbox = "[x]"
+		}
+		c := item.change
+		// +1 is an adjustment for 1-based count.
+		lines = append(lines, fmt.Sprintf(
+			"%s %s %s:%d: %s %s",
+			cursor, checkbox, s.files[item.file].name,
+			c.LineNum+1, c.Action, c.Summary(),
+		))
+	}
+	lines = append(lines, strings.Repeat("-", width))
+	if len(s.items) > 0 {
+		lines = append(lines, s.preview()...)
+	}
+	var b bytes.Buffer
+	// Move the cursor home and clear the screen.
+	b.WriteString("\x1b[H\x1b[2J")
+	for i, l := range lines {
+		if i == height {
+			break
+		}
+		if r := []rune(l); len(r) > width {
+			l = string(r[:width])
+		}
+		if i > 0 {
+			b.WriteString("\r\n")
+		}
+		b.WriteString(l)
+	}
+	w.Write(b.Bytes())
+}
+
+// preview returns lines around the change under the cursor in diff-like
+// format.
+func (s *selector) preview() []string {
+	item := s.items[s.cursor]
+	c := item.change
+	code := s.files[item.file].code
+	lines := strings.Split(string(code), "\n")
+	toggledLines := strings.Split(
+		string(core.ApplyChanges(code, []core.Change{c})), "\n",
+	)
+	var preview []string
+	for i := max(c.LineNum-contextLines, 0); i < c.LineNum; i++ {
+		preview = append(preview, "  "+lines[i])
+	}
+	preview = append(preview, "- "+lines[c.LineNum])
+	// The line is gone if the fake usage was on its own line.
+	if len(toggledLines) == len(lines) {
+		preview = append(preview, "+ "+toggledLines[c.LineNum])
+	}
+	last := min(c.LineNum+contextLines, len(lines)-1)
+	for i := c.LineNum + 1; i <= last; i++ {
+		preview = append(preview, "  "+lines[i])
+	}
+	return preview
+}
+
+const ttyPath = "/dev/tty"
+
+// runSelector shows s full-screen on the terminal tty until the user either
+// applies or aborts the selection.
+func runSelector(tty *os.File, s *selector) error {
+	fd := int(tty.Fd())
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return fmt.Errorf("runSelector: in term.MakeRaw: %v", err)
+	}
+	defer term.Restore(fd, state)
+	// Switch to the alternate screen and hide the cursor.
+	fmt.Fprint(tty, "\x1b[?1049h\x1b[?25l")
+	defer fmt.Fprint(tty, "\x1b[?25h\x1b[?1049l")
+	key := make([]byte, 8)
+	for !s.done {
+		width, height, err := term.GetSize(fd)
+		if err != nil {
+			width, height = 80, 24
+		}
+		s.render(tty, width, height)
+		n, err := tty.Read(key)
+		if err != nil {
+			return fmt.Errorf("runSelector: in *File.Read: %v", err)
+		}
+		s.handleKey(string(key[:n]))
+	}
+	return nil
+}
+
+// toggleFilesInTUI reads files from paths, finds changes with opts, filtered
+// by the filter of filterFor if it isn’t nil, lets the user choose changes to
+// apply in the full-screen list and either writes toggled files back, calling
+// hooks of hooksFor around writes with the chosen changes, or, if write is
+// false, writes them to stdout. If the selection is aborted, files are left
+// intact. It returns the applied changes of every file in the order of paths.
+func toggleFilesInTUI(
+	ctx context.Context,
+	opts core.Options,
+	paths []string,
+	write bool,
+	stdout file,
+	filterFor func(name string) changesFilter,
+	hooksFor func(name string) writeHooks,
+
+	openFile osOpenFile,
+) ([][]core.Change, error) {
+	const thisName = "toggleFilesInTUI"
+
+	var files []*fileChanges
+	for _, p := range paths {
+		in, err := openFile(p, os.O_RDONLY, os.ModeExclusive)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s: %v", thisName, p, err)
+		}
+		code, err := io.ReadAll(in)
+		in.Close()
+		if err != nil {
+			format := thisName + ": %s: in io.ReadAll: %v"
+			return nil, fmt.Errorf(format, p, err)
+		}
+		changes, err := core.FindChanges(ctx, code, opts)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s: %v", thisName, p, err)
+		}
+		if filter := filterFor(p); filter != nil {
+			changes, err = filter(code, changes)
+			if err != nil {
+				format := thisName + ": %s: %v"
+				return nil, fmt.Errorf(format, p, err)
+			}
+		}
+		files = append(files, &fileChanges{p, code, changes})
+	}
+
+	tty, err := os.OpenFile(ttyPath, os.O_RDWR, 0)
+	if err != nil {
+		return nil, fmt.Errorf("%s: in os.OpenFile: %v", thisName, err)
+	}
+	defer tty.Close()
+	s := newSelector(files)
+	if err := runSelector(tty, s); err != nil {
+		return nil, fmt.Errorf("%s: %v", thisName, err)
+	}
+
+	selected := s.selected()
+	for i, changes := range selected {
+		f := files[i]
+		toggled := core.ApplyChanges(f.code, changes)
+		if !write {
+			err := writeToggled(nil, stdout, nil, toggled)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", thisName, err)
+			}
+			continue
+		}
+		if len(changes) == 0 {
+			continue
+		}
+		// Files are written like without ‘-tui’ flag, locked and
+		// only if they didn’t change during the selection.
+		out, err := openLocked(f.name, openFile)
+		if err != nil {
+			format := thisName + ": %s: %v"
+			return nil, fmt.Errorf(format, f.name, err)
+		}
+		err = writeBackHooked(
+			out, out, f.code, toggled, changes, hooksFor(f.name),
+		)
+		out.Close()
+		if err != nil {
+			format := thisName + ": %s: %v"
+			return nil, fmt.Errorf(format, f.name, err)
+		}
+	}
+	return selected, nil
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/looshch/gouse/internal/core"
+)
+
+func TestSelector(t *testing.T) {
+	files := []*fileChanges{
+		{
+			name:    "a.go",
+			changes: []core.Change{{Name: "a0"}, {Name: "a1"}},
+		},
+		{
+			name:    "b.go",
+			changes: []core.Change{{Name: "b0"}},
+		},
+	}
+	tests := []struct {
+		keys []string
+		want string
+	}{
+		{keys: []string{keyEnter}, want: "a0a1|b0"},
+		{keys: []string{"q"}, want: "|"},
+		{keys: []string{" ", keyDown, keyEscape}, want: "|"},
+		{keys: []string{" ", "j", "j", " ", keyEnter}, want: "a1|"},
+		{keys: []string{"n", keyDown, " ", keyEnter}, want: "a1|"},
+		{keys: []string{"n", "a", keyUp, " ", keyEnter}, want: "a1|b0"},
+		{
+			keys: []string{"k", " ", "j", "j", "j", " ", keyEnter},
+			want: "a1|",
+		},
+	}
+	for _, tt := range tests {
+		test := tt
+		t.Run(strings.Join(test.keys, " "), func(t *testing.T) {
+			t.Parallel()
+			s := newSelector(files)
+			for _, k := range test.keys {
+				s.handleKey(k)
+			}
+			if !s.done {
+				t.Error("got: not done, want: done")
+			}
+			var got []string
+			for _, changes := range s.selected() {
+				var names string
+				for _, c := range changes {
+					names += c.Name
+				}
+				got = append(got, names)
+			}
+			if g := strings.Join(got, "|"); g != test.want {
+				t.Errorf("got: %s, want: %s", g, test.want)
+			}
+		})
+	}
+}
+
+func TestSelectorPreview(t *testing.T) {
+	const fake = "\t_ = c /* TODO: gouse */"
+	code := []byte("a\nb\nc\n" + fake + "\nd")
+	tests := []struct {
+		name   string
+		change core.Change
+		want   []string
+	}{
+		{
+			name: "add",
+			change: core.Change{
+				LineNum: 1, Start: 3, End: 3, Text: "; _ = b",
+			},
+			want: []string{
+				"  a", "- b", "+ b; _ = b", "  c", "  " + fake,
+			},
+		},
+		{
+			name: "remove after gofmt",
+			change: core.Change{
+				Action:  core.ActionRemove,
+				LineNum: 3,
+				Start:   5,
+				End:     6 + len(fake),
+			},
+			want: []string{"  b", "  c", "- " + fake, "  d"},
+		},
+	}
+	for _, tt := range tests {
+		test := tt
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			s := newSelector([]*fileChanges{
+				{
+					code:    code,
+					changes: []core.Change{test.change},
+				},
+			})
+			got := strings.Join(s.preview(), "\n")
+			want := strings.Join(test.want, "\n")
+			if got != want {
+				t.Errorf("got: %q, want: %q", got, want)
+			}
+			var b bytes.Buffer
+			s.render(&b, 80, 24)
+			screen := strings.ReplaceAll(b.String(), "\r\n", "\n")
+			if !strings.Contains(screen, want) {
+				t.Errorf("got: %q, want: %q", screen, want)
+			}
+		})
+	}
+}
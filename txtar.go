@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path"
+
+	"github.com/looshch/gouse/internal/core"
+	"golang.org/x/tools/txtar"
+)
+
+// toggleTxtar reads a txtar archive from in, toggles with opts every Go file
+// of it in the context of other Go files in its directory, applying only
+// changes returned by the filter of filterFor, and writes the toggled archive
+// to out. Other files and the comment of the archive are kept as is. It
+// returns changes of every file.
+func toggleTxtar(
+	ctx context.Context,
+	opts core.Options,
+	in io.Reader,
+	out io.Writer,
+	filterFor func(name string) changesFilter,
+) ([][]core.Change, error) {
+	const thisName = "toggleTxtar"
+
+	data, err := io.ReadAll(in)
+	if err != nil {
+		return nil, fmt.Errorf("%s: in io.ReadAll: %v", thisName, err)
+	}
+	a := txtar.Parse(data)
+	// Names in txtar archives are slash-separated on every OS.
+	dirs := make(map[string]map[string][]byte)
+	for _, f := range a.Files {
+		if path.Ext(f.Name) != core.GoFileExt {
+			continue
+		}
+		dir := path.Dir(f.Name)
+		if dirs[dir] == nil {
+			dirs[dir] = make(map[string][]byte)
+		}
+		dirs[dir][f.Name] = f.Data
+	}
+	var toggled [][]core.Change
+	for i, f := range a.Files {
+		if path.Ext(f.Name) != core.GoFileExt {
+			continue
+		}
+		siblings := make(map[string][]byte)
+		for name, code := range dirs[path.Dir(f.Name)] {
+			if name != f.Name {
+				siblings[name] = code
+			}
+		}
+		fileOpts := opts
+		fileOpts.Siblings = siblings
+		changes, err := core.FindChanges(ctx, f.Data, fileOpts)
+		if err != nil {
+			return nil, fmt.Errorf(
+				"%s: %s: %v", thisName, f.Name, err,
+			)
+		}
+		if filter := filterFor(f.Name); filter != nil {
+			changes, err = filter(f.Data, changes)
+			if err != nil {
+				return nil, fmt.Errorf(
+					"%s: %s: %v", thisName, f.Name, err,
+				)
+			}
+		}
+		a.Files[i].Data = core.ApplyChanges(f.Data, changes)
+		toggled = append(toggled, changes)
+	}
+	if _, err := out.Write(txtar.Format(a)); err != nil {
+		return nil, fmt.Errorf("%s: in Write: %v", thisName, err)
+	}
+	return toggled, nil
+}
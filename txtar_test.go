@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/looshch/gouse/internal/core"
+	"golang.org/x/tools/txtar"
+)
+
+func TestToggleTxtar(t *testing.T) {
+	ctx := context.Background()
+	ctx, cancel := context.WithCancel(ctx)
+	t.Cleanup(cancel)
+	// Built alone, main.go has more than 10 errors about undefined
+	// functions, which hide the error about notUsed.
+	var calls, funcs strings.Builder
+	for i := range 11 {
+		fmt.Fprintf(&calls, "\tf%d()\n", i)
+		fmt.Fprintf(&funcs, "func f%d() {}\n", i)
+	}
+	main := "package main\n\nfunc main() {\n" + calls.String() +
+		"\tnotUsed := true\n}\n"
+	util := "package main\n\n" + funcs.String()
+	const readme = "notUsed := true\n"
+	in := txtar.Format(&txtar.Archive{
+		Comment: []byte("comment\n"),
+		Files: []txtar.File{
+			{Name: "a/main.go", Data: []byte(main)},
+			{Name: "a/util.go", Data: []byte(util)},
+			{Name: "a/readme.md", Data: []byte(readme)},
+		},
+	})
+	var out bytes.Buffer
+	toggled, err := toggleTxtar(
+		ctx,
+		core.Options{},
+		bytes.NewReader(in),
+		&out,
+		func(string) changesFilter { return nil },
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := txtar.Format(&txtar.Archive{
+		Comment: []byte("comment\n"),
+		Files: []txtar.File{
+			{
+				Name: "a/main.go",
+				Data: []byte(strings.Replace(
+					main,
+					"notUsed := true",
+					"notUsed := true; _ = notUsed"+
+						core.FakeUsageSuffix,
+					1,
+				)),
+			},
+			{Name: "a/util.go", Data: []byte(util)},
+			{Name: "a/readme.md", Data: []byte(readme)},
+		},
+	})
+	if got := out.String(); got != string(want) {
+		t.Errorf("got: %s, want: %s", got, want)
+	}
+	if len(toggled) != 2 || len(toggled[0]) != 1 || len(toggled[1]) != 0 {
+		t.Errorf("got: %v, want: 1 change in a/main.go", toggled)
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/looshch/gouse/internal/core"
+	"golang.org/x/mod/semver"
+)
+
+// modulePath is the path gouse is installed by.
+const modulePath = "github.com/looshch/gouse"
+
+// latestVersion returns the latest released version of gouse as the go command
+// resolves it with GOPROXY in effect.
+func latestVersion(ctx context.Context) (string, error) {
+	cmd := exec.CommandContext(
+		ctx, "go", "list", "-m", "-f", "{{.Version}}",
+		modulePath+"@latest",
+	)
+	// Otherwise the module in the working directory may get in the way.
+	cmd.Dir = os.TempDir()
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf(
+			"latestVersion: in *Cmd.CombinedOutput: %v: %s",
+			err, bytes.TrimSpace(out),
+		)
+	}
+	return string(bytes.TrimSpace(out)), nil
+}
+
+// update replaces the executable exe with the latest released version of gouse
+// if it’s newer than current. It returns the latest version and whether exe was
+// replaced. The go command builds the version for the platform gouse runs on
+// and verifies the downloaded module against the checksum database, GOSUMDB.
+func update(
+	ctx context.Context, current, exe string,
+) (string, bool, error) {
+	const thisName = "update"
+	latest, err := latestVersion(ctx)
+	if err != nil {
+		format := thisName + ": in latestVersion: %v"
+		return "", false, fmt.Errorf(format, err)
+	}
+	if semver.Compare(latest, current) <= 0 {
+		return latest, false, nil
+	}
+	dir, err := core.MakeTempDir()
+	if err != nil {
+		return "", false, fmt.Errorf("%s: %v", thisName, err)
+	}
+	defer os.RemoveAll(dir)
+	cmd := exec.CommandContext(
+		ctx, "go", "install", modulePath+"@"+latest,
+	)
+	cmd.Dir = dir
+	cmd.Env = append(
+		os.Environ(),
+		"GOBIN="+dir, "GOOS="+runtime.GOOS, "GOARCH="+runtime.GOARCH,
+	)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		format := thisName + ": in *Cmd.CombinedOutput: %v: %s"
+		return "", false, fmt.Errorf(format, err, bytes.TrimSpace(out))
+	}
+	name := "gouse"
+	if runtime.GOOS == "windows" {
+		name += ".exe"
+	}
+	err = replaceExecutable(filepath.Join(dir, name), exe)
+	if err != nil {
+		format := thisName + ": in replaceExecutable: %v"
+		return "", false, fmt.Errorf(format, err)
+	}
+	return latest, true, nil
+}
+
+// replaceExecutable replaces the executable exe with the file at path, keeping
+// the permissions of exe. exe is moved aside first since running executables
+// can’t be overwritten on Windows, and the moved one is left there if it can’t
+// be removed.
+func replaceExecutable(path, exe string) error {
+	const thisName = "replaceExecutable"
+	info, err := os.Stat(exe)
+	if err != nil {
+		return fmt.Errorf(thisName+": in os.Stat: %v", err)
+	}
+	// The new executable is copied next to exe first, so renaming it
+	// doesn’t cross file systems.
+	next := exe + ".new"
+	if err := copyFile(path, next, info.Mode().Perm()); err != nil {
+		os.Remove(next)
+		return fmt.Errorf(thisName+": in copyFile: %v", err)
+	}
+	prev := exe + ".old"
+	if err := os.Rename(exe, prev); err != nil {
+		os.Remove(next)
+		return fmt.Errorf(thisName+": in os.Rename: %v", err)
+	}
+	if err := os.Rename(next, exe); err != nil {
+		os.Rename(prev, exe)
+		os.Remove(next)
+		return fmt.Errorf(thisName+": in os.Rename: %v", err)
+	}
+	os.Remove(prev)
+	return nil
+}
+
+// copyFile copies the file at src to dst, created with perm.
+func copyFile(src, dst string, perm os.FileMode) error {
+	const thisName = "copyFile"
+	in, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf(thisName+": in os.Open: %v", err)
+	}
+	defer in.Close()
+	flag := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	out, err := os.OpenFile(dst, flag, perm)
+	if err != nil {
+		return fmt.Errorf(thisName+": in os.OpenFile: %v", err)
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return fmt.Errorf(thisName+": in io.Copy: %v", err)
+	}
+	if err := out.Close(); err != nil {
+		return fmt.Errorf(thisName+": in *File.Close: %v", err)
+	}
+	return nil
+}
+
+// moduleVersion returns the semantic version of gouse built with the module
+// version mv, falling back to currentVersion for binaries built from a
+// checkout.
+func moduleVersion(mv string) string {
+	if mv == "" || mv == "(devel)" || !strings.HasPrefix(mv, "v") {
+		return "v" + currentVersion
+	}
+	return mv
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestUpdate(t *testing.T) {
+	ctx := context.Background()
+	ctx, cancel := context.WithCancel(ctx)
+	t.Cleanup(cancel)
+	proxy := t.TempDir()
+	versions := filepath.Join(proxy, modulePath, "@v")
+	if err := os.MkdirAll(versions, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"list":        "v1.0.0\nv9.0.0\n",
+		"v9.0.0.info": `{"Version":"v9.0.0"}`,
+	}
+	for name, contents := range files {
+		p := filepath.Join(versions, name)
+		if err := os.WriteFile(p, []byte(contents), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("GOPROXY", "file://"+filepath.ToSlash(proxy))
+	t.Setenv("GOMODCACHE", t.TempDir())
+	t.Setenv("GOFLAGS", "")
+
+	exe := filepath.Join(t.TempDir(), "gouse")
+	latest, updated, err := update(ctx, "v9.0.0", exe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if latest != "v9.0.0" || updated {
+		t.Errorf("got: %s, %t, want: v9.0.0, false", latest, updated)
+	}
+
+	t.Setenv("GOPROXY", "off")
+	if _, _, err := update(ctx, "v1.0.0", exe); err == nil {
+		t.Error("got: nil, want: error")
+	}
+}
+
+func TestReplaceExecutable(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	exe := filepath.Join(dir, "gouse")
+	if err := os.WriteFile(exe, []byte("old"), 0o750); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "gouse")
+	if err := os.WriteFile(path, []byte("new"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := replaceExecutable(path, exe); err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(exe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "new" {
+		t.Errorf("got: %s, want: new", got)
+	}
+	info, err := os.Stat(exe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0o750 {
+		t.Errorf("got: %v, want: %v", perm, os.FileMode(0o750))
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("got: %d files, want: 1", len(entries))
+	}
+}
+
+func TestModuleVersion(t *testing.T) {
+	t.Parallel()
+	tests := []struct{ mv, want string }{
+		{"v1.4.0", "v1.4.0"},
+		{"(devel)", "v" + currentVersion},
+		{"", "v" + currentVersion},
+	}
+	for _, tt := range tests {
+		if got := moduleVersion(tt.mv); got != tt.want {
+			t.Errorf("got: %s, want: %s", got, tt.want)
+		}
+	}
+}
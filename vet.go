@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/looshch/gouse/internal/core"
+)
+
+const (
+	// vetAnalyzer is the analyzer name diagnostics are keyed by, the one of
+	// the gouse analyzer.
+	vetAnalyzer = "gouse"
+	// vetCommandLinePackage is the package path of files go vet can’t tell
+	// the import path of, e.g. from standard input.
+	vetCommandLinePackage = "command-line-arguments"
+)
+
+// vetReport collects diagnostics of files into the shape ‘go vet -json’
+// prints: a JSON object per package, keyed by its import path, with
+// diagnostics keyed by the analyzer name.
+type vetReport struct {
+	// packages are import paths in the order of files.
+	packages    []string
+	diagnostics map[string][]vetDiagnostic
+	// importPaths caches import paths of directories.
+	importPaths map[string]string
+}
+
+// add is an editsReporter which adds diagnostics of changes to code of the
+// file name.
+func (r *vetReport) add(name string, code []byte, changes []core.Change) error {
+	if len(changes) == 0 {
+		return nil
+	}
+	if r.diagnostics == nil {
+		r.diagnostics = map[string][]vetDiagnostic{}
+		r.importPaths = map[string]string{}
+	}
+	pkg := vetCommandLinePackage
+	if name != stdinName {
+		dir := filepath.Dir(name)
+		var ok bool
+		if pkg, ok = r.importPaths[dir]; !ok {
+			pkg = importPath(dir)
+			r.importPaths[dir] = pkg
+		}
+	}
+	if _, ok := r.diagnostics[pkg]; !ok {
+		r.packages = append(r.packages, pkg)
+	}
+	for _, c := range changes {
+		rule, text := describeChange(c)
+		p := rdjsonPositionOf(code, c.Start)
+		posn := fmt.Sprintf("%s:%d:%d", name, p.Line, p.Column)
+		r.diagnostics[pkg] = append(r.diagnostics[pkg], vetDiagnostic{
+			Category: rule,
+			Posn:     posn,
+			Message:  text,
+			SuggestedFixes: []vetSuggestedFix{{
+				Message: fixTitle(c),
+				Edits: []vetTextEdit{{
+					Filename: name,
+					Start:    c.Start,
+					End:      c.End,
+					New:      c.Text,
+				}},
+			}},
+		})
+	}
+	return nil
+}
+
+// write writes the diagnostics of r to out, a JSON object per package.
+func (r *vetReport) write(out file) error {
+	for _, pkg := range r.packages {
+		tree := map[string]map[string][]vetDiagnostic{
+			pkg: {vetAnalyzer: r.diagnostics[pkg]},
+		}
+		b, err := json.MarshalIndent(tree, "", "\t")
+		if err != nil {
+			format := "*vetReport.write: in json.MarshalIndent: %v"
+			return fmt.Errorf(format, err)
+		}
+		if _, err := out.Write(append(b, '\n')); err != nil {
+			format := "*vetReport.write: in *File.Write: %v"
+			return fmt.Errorf(format, err)
+		}
+	}
+	return nil
+}
+
+// importPath returns the import path of the package in dir or, if the go
+// command can’t tell it, vetCommandLinePackage.
+func importPath(dir string) string {
+	cmd := exec.Command("go", "list", "-e", "-f", "{{.ImportPath}}", ".")
+	cmd.Dir = dir
+	out, err := cmd.Output()
+	p := strings.TrimSpace(string(out))
+	// Directories outside modules are listed as relative paths.
+	if err != nil || p == "" || strings.HasPrefix(p, "_") {
+		return vetCommandLinePackage
+	}
+	return p
+}
+
+// The types below are the ones of ‘go vet -json’ diagnostics.
+
+type vetDiagnostic struct {
+	Category       string            `json:"category,omitempty"`
+	Posn           string            `json:"posn"`
+	Message        string            `json:"message"`
+	SuggestedFixes []vetSuggestedFix `json:"suggested_fixes,omitempty"`
+}
+
+type vetSuggestedFix struct {
+	Message string        `json:"message"`
+	Edits   []vetTextEdit `json:"edits"`
+}
+
+// vetTextEdit replaces bytes Start:End of the file Filename with New.
+type vetTextEdit struct {
+	Filename string `json:"filename"`
+	Start    int    `json:"start"`
+	End      int    `json:"end"`
+	New      string `json:"new"`
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestVetReport(t *testing.T) {
+	t.Parallel()
+	const code = "package p\n\nfunc f() {\n" +
+		"\ta := 0; _ = a /* TODO: gouse */\n}\n"
+	var r vetReport
+	_, err := listFiles(
+		[]string{"-"}, "", lineTerminator, r.add,
+		newFakeFile([]byte(code)...), nil,
+		openFile,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := newFakeFile()
+	if err := r.write(out); err != nil {
+		t.Fatal(err)
+	}
+	var got map[string]map[string][]vetDiagnostic
+	if err := json.Unmarshal(out.contents.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	diagnostics := got[vetCommandLinePackage][vetAnalyzer]
+	want := vetTextEdit{Filename: stdinName, Start: 29, End: 54}
+	if len(diagnostics) != 1 ||
+		diagnostics[0].Posn != stdinName+":4:8" ||
+		diagnostics[0].SuggestedFixes[0].Message !=
+			"Remove fake usage of a" ||
+		diagnostics[0].SuggestedFixes[0].Edits[0] != want {
+		t.Errorf("got: %+v, want: a fix with %+v", got, want)
+	}
+}
+
+func TestImportPath(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		dir, want string
+	}{
+		{"analyzer", modulePath + "/analyzer"},
+		{t.TempDir(), vetCommandLinePackage},
+	}
+	for _, tt := range tests {
+		if got := importPath(tt.dir); got != tt.want {
+			t.Errorf("got: %s, want: %s", got, tt.want)
+		}
+	}
+}
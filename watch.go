@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/looshch/gouse/internal/core"
+)
+
+// watchDelay is how long watchFiles waits for a file to stop changing before
+// toggling it. Editors often save a file with several writes.
+const watchDelay = 100 * time.Millisecond
+
+// watchFiles creates fake usages with opts in files from paths every time they
+// change until ctx is done, applying only changes returned by the filter of
+// filterFor and calling hooks of hooksFor around writes. It never removes fake
+// usages. Paths may be directories, then every Go file directly in them is
+// watched. Errors of toggling are printed to errorLog and don’t stop watching.
+func watchFiles(
+	ctx context.Context,
+	opts core.Options,
+	paths []string,
+	filterFor func(name string) changesFilter,
+	hooksFor func(name string) writeHooks,
+	errorLog *log.Logger,
+
+	openFile osOpenFile,
+) error {
+	const thisName = "watchFiles"
+
+	opts.Mode = core.ModeAdd
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		format := thisName + ": in fsnotify.NewWatcher: %v"
+		return fmt.Errorf(format, err)
+	}
+	defer w.Close()
+	// Directories are watched instead of files because editors often save
+	// a file by renaming a new one over it.
+	dirs := make(map[string]bool)
+	files := make(map[string]bool)
+	for _, p := range paths {
+		info, err := os.Stat(p)
+		if err != nil {
+			return fmt.Errorf("%s: in os.Stat: %v", thisName, err)
+		}
+		p = filepath.Clean(p)
+		dir := filepath.Dir(p)
+		if info.IsDir() {
+			dir = p
+			dirs[p] = true
+		} else {
+			files[p] = true
+		}
+		if err := w.Add(dir); err != nil {
+			format := thisName + ": in *Watcher.Add: %v"
+			return fmt.Errorf(format, err)
+		}
+	}
+	isWatched := func(name string) bool {
+		name = filepath.Clean(name)
+		inDir := dirs[filepath.Dir(name)]
+		return files[name] ||
+			inDir && filepath.Ext(name) == core.GoFileExt
+	}
+
+	pending := make(map[string]bool)
+	timer := time.NewTimer(watchDelay)
+	timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case e, ok := <-w.Events:
+			if !ok {
+				return nil
+			}
+			if !e.Has(fsnotify.Write) && !e.Has(fsnotify.Create) ||
+				!isWatched(e.Name) {
+				continue
+			}
+			pending[filepath.Clean(e.Name)] = true
+			timer.Reset(watchDelay)
+		case err, ok := <-w.Errors:
+			if !ok {
+				return nil
+			}
+			errorLog.Print(fmt.Errorf("%s: %v", thisName, err))
+		case <-timer.C:
+			for p := range pending {
+				delete(pending, p)
+				err := watchToggle(
+					ctx,
+					opts,
+					p,
+					filterFor(p),
+					hooksFor(p),
+					openFile,
+				)
+				if err != nil {
+					errorLog.Print(failure{p, err})
+				}
+			}
+		}
+	}
+}
+
+// watchToggle toggles the file p with opts, applying only changes returned by
+// filter and calling hooks around writing it.
+func watchToggle(
+	ctx context.Context,
+	opts core.Options,
+	p string,
+	filter changesFilter,
+	hooks writeHooks,
+
+	openFile osOpenFile,
+) error {
+	if opts.Placement == core.PlacementFunction {
+		style, err := core.EditorStyleFor(p)
+		if err != nil {
+			return fmt.Errorf("watchToggle: %v", err)
+		}
+		opts.Style = style
+	}
+	f, err := openLocked(p, openFile)
+	if err != nil {
+		return fmt.Errorf("watchToggle: %v", err)
+	}
+	defer f.Close()
+	// The file isn’t written if there is nothing to add, so writes of
+	// watchToggle itself don’t trigger it again.
+	if _, err := toggleFile(ctx, opts, f, f, filter, hooks); err != nil {
+		return fmt.Errorf("watchToggle: %v", err)
+	}
+	return nil
+}
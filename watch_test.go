@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/looshch/gouse/internal/core"
+)
+
+func TestWatchFiles(t *testing.T) {
+	input, err := os.ReadFile(filepath.Join("testdata", "not_used.input"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := os.ReadFile(filepath.Join("testdata", "not_used.golden"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"file", "directory"} {
+		name := name
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			dir := t.TempDir()
+			p := filepath.Join(dir, "main.go")
+			if err := os.WriteFile(p, nil, 0o644); err != nil {
+				t.Fatal(err)
+			}
+			watched := p
+			if name == "directory" {
+				watched = dir
+			}
+			ctx, cancel := context.WithCancel(context.Background())
+			done := make(chan error)
+			go func() {
+				done <- watchFiles(
+					ctx,
+					core.Options{},
+					[]string{watched},
+					func(string) changesFilter {
+						return nil
+					},
+					func(string) writeHooks {
+						return writeHooks{}
+					},
+					log.New(io.Discard, "", 0),
+					openFile,
+				)
+			}()
+			// Give the watcher time to start.
+			time.Sleep(watchDelay)
+			if err := os.WriteFile(p, input, 0o644); err != nil {
+				t.Fatal(err)
+			}
+			var got []byte
+			deadline := time.Now().Add(10 * time.Second)
+			for time.Now().Before(deadline) {
+				got, err = os.ReadFile(p)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if bytes.Equal(got, want) {
+					break
+				}
+				time.Sleep(watchDelay)
+			}
+			cancel()
+			if err := <-done; err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf(filesCmpErr, got, want)
+			}
+		})
+	}
+}